@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"shell-e/internal/audit"
+	"shell-e/internal/config"
+)
+
+// runAudit implements `shell-e audit verify [file]` and returns the exit
+// code: 0 when the log is intact, 1 when it was tampered with, 2 on usage
+// or I/O errors
+func runAudit(args []string) int {
+	if len(args) == 0 || args[0] != "verify" || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, "Usage: shell-e audit verify [audit.jsonl]")
+		return 2
+	}
+
+	path := ""
+	if len(args) == 2 {
+		path = args[1]
+	} else {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			return 2
+		}
+		path = cfg.AuditPath()
+	}
+
+	n, err := audit.Verify(path)
+	var verr *audit.VerifyError
+	switch {
+	case errors.As(err, &verr):
+		fmt.Printf("❌ %s: %v\n", path, err)
+		fmt.Printf("   The first %d record(s) are intact\n", n)
+		return 1
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Could not read %s: %v\n", path, err)
+		return 2
+	}
+	fmt.Printf("✅ %s: %d record(s) verified, chain intact\n", path, n)
+	return 0
+}
@@ -1,25 +1,36 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 
+	"shell-e/internal/audit"
 	"shell-e/internal/config"
 	"shell-e/internal/executor"
+	"shell-e/internal/hooks"
 	"shell-e/internal/llm"
 	"shell-e/internal/logger"
 	"shell-e/internal/memory"
 	"shell-e/internal/planner"
 	"shell-e/internal/safety"
+	"shell-e/internal/trash"
 	"shell-e/internal/ui"
+	"shell-e/internal/workspace"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		os.Exit(runAudit(os.Args[2:]))
+	}
+
 	// Initialize Logger
 	if err := logger.Init("shell-e.log"); err != nil {
 		fmt.Printf("Error initializing logger: %v\n", err)
@@ -43,7 +54,15 @@ func main() {
 
 	// Initialize LLM server
 	server := llm.NewLlamaServer(cfg.LlamaBinPath, cfg.ModelPath, cfg.ContextSize, cfg.ServerPort)
-	server.SystemPrompt = planner.SystemPrompt
+	server.SystemPrompt = planner.SystemPromptFor(cfg.Shell)
+	if name := cfg.ChatTemplateFor(cfg.ModelPath); name != "" {
+		tmpl, err := llm.GetChatTemplate(name)
+		if err != nil {
+			log.Fatalf("Invalid chat template: %v", err)
+		}
+		server.Template = tmpl
+		logger.Info("Using raw completion mode with %s chat template", tmpl.Name)
+	}
 
 	// Setup signal handling for clean shutdown (Ctrl+C kills server)
 	sigChan := make(chan os.Signal, 1)
@@ -67,12 +86,89 @@ func main() {
 	fmt.Println("   ✅ AI server ready!")
 
 	// Initialize components
-	exec := executor.NewExecutor(mem.WorkingDir)
+	roots := workspace.NewRoots(cfg.AllowedRoots)
+	workDir := mem.WorkingDir
+	if roots.Restricted() && !roots.Contains(workDir) {
+		workDir = roots.Paths()[0]
+		mem.WorkingDir = workDir
+	}
+	exec := executor.NewExecutor(workDir)
+	exec.Roots = roots
+	exec.Persistent = cfg.PersistentShell
+	exec.Structured = cfg.StructuredOutput
+	if cfg.OutputEncoding != "" {
+		if _, err := executor.LookupEncoding(cfg.OutputEncoding); err != nil {
+			log.Fatalf("Invalid output_encoding: %v", err)
+		}
+		exec.Encoding = cfg.OutputEncoding
+	}
+	exec.Timeout = time.Duration(cfg.CommandTimeout) * time.Second
+	for _, o := range cfg.TimeoutOverrides {
+		exec.TimeoutRules = append(exec.TimeoutRules, executor.TimeoutRule{
+			Pattern: o.Pattern,
+			Timeout: time.Duration(o.Seconds) * time.Second,
+		})
+	}
+	if cfg.Undo {
+		exec.Trash = trash.New(filepath.Join(cfg.DataDirectory(), "trash"))
+		exec.Trash.MaxSnapshots = cfg.UndoMaxSnapshots
+		exec.Trash.MaxBytes = int64(cfg.UndoMaxMB) << 20
+	}
+	exec.SetEnvOverlay(mem.Env)
+	defer exec.Close()
 	safetyChecker := safety.NewChecker()
+	safetyChecker.Roots = roots
+	if err := safetyChecker.SetUserPolicy(cfg.PolicyPath()); err != nil {
+		log.Fatalf("Invalid safety policy: %v", err)
+	}
+	if len(cfg.Hooks.Pre) > 0 || len(cfg.Hooks.Post) > 0 {
+		h, err := buildHooks(cfg.Hooks)
+		if err != nil {
+			log.Fatalf("Invalid hooks: %v", err)
+		}
+		// A rewritten command gets the same safety check as a planned one,
+		// but no confirmation prompt: it must be safe outright
+		h.Check = func(p hooks.Payload) error {
+			workDir := p.Cwd
+			if p.Target != "" {
+				workDir = ""
+			}
+			a := safetyChecker.CheckShell(p.Command, p.Shell, workDir)
+			if a.Level != safety.Safe {
+				return errors.New(a.Reason)
+			}
+			return nil
+		}
+		exec.Hooks = h
+	}
 	plan := planner.NewPlanner(server, mem, cfg.Shell)
 
 	// Build TUI
 	m := ui.NewModel(plan, exec, safetyChecker, mem)
+	var targets []executor.SSHConfig
+	for _, t := range cfg.Targets {
+		name := t.Name
+		if name == "" {
+			name = t.Host
+		}
+		targets = append(targets, executor.SSHConfig{
+			Name:       name,
+			Host:       t.Host,
+			User:       t.User,
+			KeyFile:    t.KeyFile,
+			KnownHosts: t.KnownHosts,
+			Dir:        t.Dir,
+		})
+	}
+	m.SetTargets(targets)
+	m.SetPasswordCache(time.Duration(cfg.SudoCacheSeconds) * time.Second)
+	if cfg.AuditLog {
+		auditLog, err := audit.Open(cfg.AuditPath())
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		m.SetAudit(auditLog)
+	}
 
 	// Start BubbleTea
 	p := tea.NewProgram(m, tea.WithAltScreen())
@@ -85,3 +181,34 @@ func main() {
 	mem.Save()
 	fmt.Println("👋 Shell-E closed. Memory saved.")
 }
+
+// buildHooks turns the configured hooks into the executor's
+func buildHooks(cfg config.HooksConfig) (*hooks.Hooks, error) {
+	convert := func(list []config.HookConfig) ([]hooks.Hook, error) {
+		var out []hooks.Hook
+		for i, c := range list {
+			if c.Command == "" {
+				return nil, fmt.Errorf("hook %d (%s) has no command", i+1, c.Name)
+			}
+			if c.Timeout < 0 {
+				return nil, fmt.Errorf("hook %s has a negative timeout", c.Command)
+			}
+			out = append(out, hooks.Hook{
+				Name:    c.Name,
+				Program: c.Command,
+				Args:    c.Args,
+				Timeout: time.Duration(c.Timeout) * time.Second,
+			})
+		}
+		return out, nil
+	}
+	pre, err := convert(cfg.Pre)
+	if err != nil {
+		return nil, err
+	}
+	post, err := convert(cfg.Post)
+	if err != nil {
+		return nil, err
+	}
+	return &hooks.Hooks{Pre: pre, Post: post}, nil
+}
@@ -0,0 +1,246 @@
+// Package audit keeps an append-only, hash-chained JSONL record of every
+// command Shell-E planned, so later edits to the file can be detected.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Record is one planned command: what was asked, what the safety check
+// said, whether it ran and how it ended
+type Record struct {
+	Seq  int       `json:"seq"`
+	Time time.Time `json:"time"`
+	Prev string    `json:"prev"` // Hash of the previous record; "" for the first
+
+	UserInput string `json:"user_input"`
+	Plan      string `json:"plan,omitempty"` // The planner's explanation
+	Command   string `json:"command"`
+	Shell     string `json:"shell,omitempty"`
+	WorkDir   string `json:"work_dir,omitempty"`
+	Stdin     string `json:"stdin,omitempty"` // Where its stdin came from, e.g. "{{last_output}}"
+
+	Safety    string `json:"safety"` // "safe", "confirm" or "blocked"
+	Reason    string `json:"reason,omitempty"`
+	Rule      string `json:"rule,omitempty"` // The policy rule that decided Safety, e.g. "built-in:kill"
+	Confirmed bool   `json:"confirmed"`      // The user approved a "confirm" command
+
+	// Hook names the pre-hook that refused the command or rewrote it to
+	// Rewritten, which is then what ran
+	Hook      string `json:"hook,omitempty"`
+	Rewritten string `json:"rewritten,omitempty"`
+
+	Executed   bool   `json:"executed"`
+	Background bool   `json:"background,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	OutputHash string `json:"output_hash,omitempty"` // HashOutput of the full output
+
+	Hash string `json:"hash"` // SHA-256 of this record with Hash empty
+}
+
+// Log appends records to one JSONL file. Other processes may append to
+// the same file; a file lock keeps the chain in order.
+type Log struct {
+	path string
+
+	mu   sync.Mutex
+	seq  int
+	last string // Hash of the last record
+	size int64  // How much of the file seq and last account for
+}
+
+// Open opens (creating if needed) the audit log at path and picks up the
+// chain where the last record left off
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	l := &Log{path: path}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := l.catchUp(f); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// catchUp reads the records appended to f since the log last looked, so
+// the chain continues from the real end of the file. A damaged record is
+// left for Verify to report; the chain continues from the last one that
+// parses.
+func (l *Log) catchUp(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == l.size {
+		return nil
+	}
+	if info.Size() < l.size {
+		// Truncated or replaced: start over
+		l.seq, l.last, l.size = 0, "", 0
+	}
+	if _, err := f.Seek(l.size, io.SeekStart); err != nil {
+		return err
+	}
+	scanner := newScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if json.Unmarshal(scanner.Bytes(), &r) == nil && r.Hash != "" {
+			l.seq, l.last = r.Seq, r.Hash
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	l.size = info.Size()
+	return nil
+}
+
+// Path is the file the log writes to
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append fills in r's sequence number, time and hashes and writes it.
+// The file stays locked from reading where the chain ends to writing, so
+// records appended by another process are chained to, not forked from.
+func (l *Log) Append(r Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+	if err := l.catchUp(f); err != nil {
+		return err
+	}
+
+	r.Seq = l.seq + 1
+	r.Time = time.Now().UTC()
+	r.Prev = l.last
+	hash, err := r.hash()
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	line = append(line, '\n')
+	if _, err := f.Write(line); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	l.seq, l.last = r.Seq, r.Hash
+	l.size += int64(len(line))
+	return nil
+}
+
+// hash is the SHA-256 of the record's JSON with Hash empty. Prev is part
+// of it, which chains each record to the one before.
+func (r Record) hash() (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// HashOutput identifies a command's output without storing it
+func HashOutput(output string) string {
+	sum := sha256.Sum256([]byte(output))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// VerifyError reports the first record that doesn't check out
+type VerifyError struct {
+	Line   int
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// Verify checks every record of the log at path: that it is exactly as
+// written, that its hash matches, and that it chains to the previous one
+// with the next sequence number. It returns how many records are intact
+// before the first problem. Records removed from the end can't be
+// detected from the file alone; compare the count with what is expected.
+func Verify(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := newScanner(f)
+	prev := ""
+	n := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		fail := func(format string, args ...any) (int, error) {
+			return n, &VerifyError{Line: n + 1, Reason: fmt.Sprintf(format, args...)}
+		}
+
+		var r Record
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&r); err != nil {
+			return fail("not a valid record: %v", err)
+		}
+		// Re-encoding must give back the same bytes, so edits that keep
+		// the hash field (reformatting, reordering) show up too
+		if again, _ := json.Marshal(r); !bytes.Equal(again, line) {
+			return fail("record was modified")
+		}
+		if r.Seq != n+1 {
+			return fail("expected sequence %d, found %d (records missing or reordered)", n+1, r.Seq)
+		}
+		if r.Prev != prev {
+			return fail("does not chain to the previous record")
+		}
+		if hash, _ := r.hash(); hash != r.Hash {
+			return fail("hash mismatch (record was modified)")
+		}
+		prev = r.Hash
+		n++
+	}
+	return n, scanner.Err()
+}
+
+// newScanner reads records line by line, allowing long ones
+func newScanner(f *os.File) *bufio.Scanner {
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return scanner
+}
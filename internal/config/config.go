@@ -4,6 +4,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -16,9 +18,130 @@ type Config struct {
 	Temperature  float64 `mapstructure:"temperature"`
 	TopK         int     `mapstructure:"top_k"`
 	TopP         float64 `mapstructure:"top_p"`
-	Shell        string  `mapstructure:"shell"` // "powershell" or "cmd"
+	Shell        string  `mapstructure:"shell"` // "powershell", "cmd", "bash", "zsh" or "sh"
 	DataDir      string  `mapstructure:"data_dir"`
 	ServerPort   int     `mapstructure:"server_port"` // Port for llama-server
+
+	// PersistentShell keeps one shell process alive across commands so
+	// environment variables, aliases and functions carry over
+	PersistentShell bool `mapstructure:"persistent_shell"`
+
+	// StructuredOutput detects JSON, CSV and column output and shows it as
+	// a table; PowerShell pipelines get ConvertTo-Json appended for this.
+	// Off by default, since the command run then isn't quite the one shown.
+	StructuredOutput bool `mapstructure:"structured_output"`
+
+	// ChatTemplate selects raw /completion mode with a Shell-E-applied
+	// template ("chatml", "llama3", "phi", "gemma", "mistral").
+	// Empty or "auto" uses llama-server's /v1/chat/completions.
+	ChatTemplate string `mapstructure:"chat_template"`
+	// ModelTemplates overrides ChatTemplate per model, keyed by GGUF file name
+	ModelTemplates map[string]string `mapstructure:"model_templates"`
+
+	// Undo snapshots files before commands delete or overwrite them, keeping
+	// at most UndoMaxSnapshots snapshots and UndoMaxMB megabytes
+	Undo             bool `mapstructure:"undo"`
+	UndoMaxSnapshots int  `mapstructure:"undo_max_snapshots"`
+	UndoMaxMB        int  `mapstructure:"undo_max_mb"`
+
+	// AllowedRoots confines Shell-E to these directory trees: cd outside
+	// them is refused and commands touching paths outside need
+	// confirmation. Empty allows everything.
+	AllowedRoots []string `mapstructure:"allowed_roots"`
+
+	// AuditLog appends every planned command, its safety assessment and
+	// outcome to a hash-chained audit.jsonl in the data directory
+	AuditLog bool `mapstructure:"audit_log"`
+
+	// OutputEncoding is what command output that isn't UTF-8 is decoded
+	// from, e.g. "cp850" or "latin1". Empty detects it and switches
+	// PowerShell and cmd to UTF-8 output.
+	OutputEncoding string `mapstructure:"output_encoding"`
+
+	// SudoCacheSeconds is how long a sudo password typed into Shell-E is
+	// remembered (in memory only); 0 asks for it for every command
+	SudoCacheSeconds int `mapstructure:"sudo_cache_seconds"`
+
+	// Targets are remote hosts /target can switch to; commands then run
+	// there over SSH
+	Targets []TargetConfig `mapstructure:"targets"`
+
+	// Hooks run programs around every command with a JSON description of
+	// it on stdin. A pre-hook that fails or times out refuses the command.
+	Hooks HooksConfig `mapstructure:"hooks"`
+
+	// CommandTimeout is the default command timeout in seconds; 0 disables it
+	CommandTimeout int `mapstructure:"command_timeout"`
+	// TimeoutOverrides give matching commands (installs, builds) their own
+	// timeout. The first matching pattern wins.
+	TimeoutOverrides []TimeoutOverride `mapstructure:"timeout_overrides"`
+}
+
+// TimeoutOverride sets the timeout for commands containing Pattern's words,
+// e.g. {pattern: "npm install", seconds: 600}. Seconds 0 means no timeout.
+type TimeoutOverride struct {
+	Pattern string `mapstructure:"pattern"`
+	Seconds int    `mapstructure:"seconds"`
+}
+
+// TargetConfig is a remote host reachable over SSH, e.g.
+// {name: "web", host: "web.example.com", user: "deploy", dir: "/srv/app"}.
+// Without key_file the SSH agent and the usual keys in ~/.ssh are used.
+type TargetConfig struct {
+	Name       string `mapstructure:"name"`
+	Host       string `mapstructure:"host"` // host or host:port
+	User       string `mapstructure:"user"`
+	KeyFile    string `mapstructure:"key_file"`
+	KnownHosts string `mapstructure:"known_hosts"` // Defaults to ~/.ssh/known_hosts
+	Dir        string `mapstructure:"dir"`
+}
+
+// HooksConfig lists the hooks run before and after each command
+type HooksConfig struct {
+	Pre  []HookConfig `mapstructure:"pre"`
+	Post []HookConfig `mapstructure:"post"`
+}
+
+// HookConfig is a program run as a hook, e.g.
+// {name: "freeze", command: "/usr/local/bin/freeze-check", timeout: 2}
+type HookConfig struct {
+	Name    string   `mapstructure:"name"`
+	Command string   `mapstructure:"command"` // The program, run directly without a shell
+	Args    []string `mapstructure:"args"`
+	Timeout int      `mapstructure:"timeout"` // Seconds; 0 uses the default of 5
+}
+
+// DefaultTimeoutOverrides allow package managers and builds 10 minutes
+func DefaultTimeoutOverrides() []TimeoutOverride {
+	var overrides []TimeoutOverride
+	for _, pattern := range []string{
+		"winget", "choco", "scoop", "apt", "apt-get", "dnf", "yum", "pacman", "brew",
+		"npm install", "npm ci", "yarn install", "pnpm install", "pip install",
+		"cargo build", "go build", "go test", "mvn", "gradle", "docker build", "docker pull",
+	} {
+		overrides = append(overrides, TimeoutOverride{Pattern: pattern, Seconds: 600})
+	}
+	return overrides
+}
+
+// ChatTemplateFor returns the chat template configured for the given model
+// path, or "" when the server's embedded template should be used
+func (c *Config) ChatTemplateFor(modelPath string) string {
+	name := strings.ToLower(filepath.Base(modelPath))
+	for model, tmpl := range c.ModelTemplates {
+		if strings.ToLower(model) == name {
+			return normalizeTemplate(tmpl)
+		}
+	}
+	return normalizeTemplate(c.ChatTemplate)
+}
+
+func normalizeTemplate(name string) string {
+	name = strings.TrimSpace(name)
+	if strings.EqualFold(name, "auto") {
+		return ""
+	}
+	return name
 }
 
 // DataDirectory returns the resolved data directory path
@@ -30,6 +153,29 @@ func (c *Config) DataDirectory() string {
 	return filepath.Join(home, ".shell-e")
 }
 
+// AuditPath is where the audit log is kept
+func (c *Config) AuditPath() string {
+	return filepath.Join(c.DataDirectory(), "audit.jsonl")
+}
+
+// PolicyPath is where the user's safety policy is kept
+func (c *Config) PolicyPath() string {
+	return filepath.Join(c.DataDirectory(), "policy.yaml")
+}
+
+// DefaultShell picks the shell for this platform: PowerShell on Windows,
+// otherwise the user's login shell if it is one we support, else bash
+func DefaultShell() string {
+	if runtime.GOOS == "windows" {
+		return "powershell"
+	}
+	switch sh := filepath.Base(os.Getenv("SHELL")); sh {
+	case "bash", "zsh", "sh":
+		return sh
+	}
+	return "bash"
+}
+
 func LoadConfig() (*Config, error) {
 	viper.SetDefault("model_path", "assets/localmodel/qwen2.5-3b-instruct-q4_k_m.gguf")
 	viper.SetDefault("llama_bin_path", "assets/bin/llama-server.exe")
@@ -38,9 +184,24 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("temperature", 0.1)
 	viper.SetDefault("top_k", 40)
 	viper.SetDefault("top_p", 0.9)
-	viper.SetDefault("shell", "powershell")
+	viper.SetDefault("shell", DefaultShell())
 	viper.SetDefault("data_dir", "")
 	viper.SetDefault("server_port", 8055)
+	viper.SetDefault("chat_template", "")
+	viper.SetDefault("persistent_shell", false)
+	viper.SetDefault("structured_output", false)
+	viper.SetDefault("undo", true)
+	viper.SetDefault("undo_max_snapshots", 20)
+	viper.SetDefault("undo_max_mb", 100)
+	viper.SetDefault("allowed_roots", []string{})
+	viper.SetDefault("audit_log", true)
+	viper.SetDefault("output_encoding", "")
+	viper.SetDefault("sudo_cache_seconds", 300)
+	viper.SetDefault("targets", []TargetConfig{})
+	viper.SetDefault("hooks.pre", []HookConfig{})
+	viper.SetDefault("hooks.post", []HookConfig{})
+	viper.SetDefault("command_timeout", 30)
+	viper.SetDefault("timeout_overrides", DefaultTimeoutOverrides())
 
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
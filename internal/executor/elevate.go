@@ -0,0 +1,100 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// elevationPattern finds sudo, doas or runas at the start of a statement,
+// including inside $( ) and after pipes and separators
+var elevationPattern = regexp.MustCompile(`(?i)(?:^|[;&|(\n])\s*(sudo|doas|runas)(?:\.exe)?(?:\s|$)`)
+
+// sudoPattern finds each sudo that starts a statement, for rewriting
+var sudoPattern = regexp.MustCompile(`(^\s*|[;&|(\n]\s*)sudo(\s|$)`)
+
+// passwordCheckTimeout bounds the "sudo -n true" probe
+const passwordCheckTimeout = 5 * time.Second
+
+// ElevationTool returns the privilege elevation tool command uses —
+// "sudo", "doas" or "runas" — or "" if it uses none
+func ElevationTool(command string) string {
+	m := elevationPattern.FindStringSubmatch(command)
+	if m == nil {
+		return ""
+	}
+	return strings.ToLower(m[1])
+}
+
+// NeedsPassword reports whether sudo will ask for a password to run
+// command where commands currently run. It is false for commands without
+// sudo and for users allowed to run sudo without a password.
+//
+// Commands run without a terminal, so sudo can't reuse credentials from
+// an earlier command: it asks every time unless told not to.
+func (e *Executor) NeedsPassword(command string) bool {
+	if ElevationTool(command) != "sudo" {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), passwordCheckTimeout)
+	defer cancel()
+
+	if t := e.CurrentTarget(); t != nil {
+		out, err := t.Run(ctx, "sudo -n true", nil, nil)
+		return err != nil || out.ExitCode != 0
+	}
+	cmd := exec.CommandContext(ctx, "sudo", "-n", "true")
+	cmd.Dir = e.WorkingDir
+	cmd.Env = e.environ()
+	return cmd.Run() != nil
+}
+
+// askpassScript is the SUDO_ASKPASS helper for sudo -A, which runs it
+// only if it needs a password. It prints the password from the file
+// next to it and deletes the file, so the password is never in the
+// environment of the command or anything it starts.
+const askpassScript = `#!/bin/sh
+dir=$(dirname "$0")
+cat "$dir/password" 2>/dev/null
+rm -f "$dir/password"
+`
+
+// sudoWithAskpass makes every sudo in command get its password from the
+// SUDO_ASKPASS helper. Stdin is left to the command: a sudo after a pipe
+// reads the piped data, and one that doesn't prompt leaves nothing
+// behind for the program it runs.
+func sudoWithAskpass(command string) string {
+	return sudoPattern.ReplaceAllString(command, "${1}sudo -A${2}")
+}
+
+// writeAskpass writes the askpass helper and the password it hands out
+// to a private temporary directory. The caller removes the directory
+// when the command is done.
+func writeAskpass(password string) (helper, dir string, err error) {
+	dir, err = os.MkdirTemp("", "shelle-askpass-*")
+	if err != nil {
+		return "", "", err
+	}
+	helper = filepath.Join(dir, "askpass")
+	if err = os.WriteFile(filepath.Join(dir, "password"), []byte(password+"\n"), 0600); err == nil {
+		err = os.WriteFile(helper, []byte(askpassScript), 0700)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return helper, dir, nil
+}
+
+// PasswordRejected reports whether sudo refused the password a command
+// was given, so a cached copy can be forgotten
+func PasswordRejected(r *Result) bool {
+	text := strings.ToLower(r.Stderr + "\n" + r.Error)
+	return strings.Contains(text, "incorrect password") ||
+		strings.Contains(text, "sorry, try again") ||
+		strings.Contains(text, "no password was provided")
+}
@@ -0,0 +1,181 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// latin1 decodes output from tools that write Latin-1. Windows-1252 is
+// used because it agrees with Latin-1 on every printable character and
+// also covers the quotes and dashes Windows tools produce in 0x80-0x9F.
+var latin1 encoding.Encoding = charmap.Windows1252
+
+// codePages maps Windows code page numbers to their encodings
+var codePages = map[int]encoding.Encoding{
+	437: charmap.CodePage437, 850: charmap.CodePage850, 852: charmap.CodePage852,
+	855: charmap.CodePage855, 858: charmap.CodePage858, 860: charmap.CodePage860,
+	862: charmap.CodePage862, 863: charmap.CodePage863, 865: charmap.CodePage865,
+	866: charmap.CodePage866, 874: charmap.Windows874,
+	932: japanese.ShiftJIS, 936: simplifiedchinese.GBK, 949: korean.EUCKR, 950: traditionalchinese.Big5,
+	1250: charmap.Windows1250, 1251: charmap.Windows1251, 1252: charmap.Windows1252,
+	1253: charmap.Windows1253, 1254: charmap.Windows1254, 1255: charmap.Windows1255,
+	1256: charmap.Windows1256, 1257: charmap.Windows1257, 1258: charmap.Windows1258,
+	20866: charmap.KOI8R, 28591: charmap.ISO8859_1, 28592: charmap.ISO8859_2,
+	28605: charmap.ISO8859_15, 65001: unicode.UTF8,
+}
+
+// LookupEncoding finds an encoding by name: a code page ("cp850", "850",
+// "windows-1252"), "latin1", or any IANA name such as "iso-8859-15"
+func LookupEncoding(name string) (encoding.Encoding, error) {
+	n := strings.ToLower(strings.TrimSpace(name))
+	for _, prefix := range []string{"cp", "windows-", "ibm"} {
+		n = strings.TrimPrefix(n, prefix)
+	}
+	if cp, err := strconv.Atoi(n); err == nil {
+		if enc, ok := codePages[cp]; ok {
+			return enc, nil
+		}
+		return nil, fmt.Errorf("unsupported code page %d", cp)
+	}
+	if n == "latin1" || n == "latin-1" {
+		return latin1, nil
+	}
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+	return enc, nil
+}
+
+// outputEncoding is what output that isn't UTF-8 is assumed to be in:
+// the configured Encoding, else the system's (the console code page on
+// Windows, the locale's charset elsewhere)
+func (e *Executor) outputEncoding() encoding.Encoding {
+	if e.Encoding != "" {
+		if enc, err := LookupEncoding(e.Encoding); err == nil {
+			return enc
+		}
+	}
+	return systemEncoding()
+}
+
+// remoteEncoding is outputEncoding for a remote host, whose code page
+// this machine's says nothing about
+func (e *Executor) remoteEncoding() encoding.Encoding {
+	if e.Encoding != "" {
+		if enc, err := LookupEncoding(e.Encoding); err == nil {
+			return enc
+		}
+	}
+	return latin1
+}
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// decodeOutput turns what a command printed into valid UTF-8. A BOM
+// decides the encoding; so does text that is evidently UTF-16LE (what
+// PowerShell 5 writes when its console encoding is Unicode). Valid UTF-8
+// is kept as is, and anything else is decoded from fallback.
+func decodeOutput(data []byte, fallback encoding.Encoding) string {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		data = data[len(utf8BOM):]
+	case bytes.HasPrefix(data, utf16LEBOM):
+		return transcode(data[len(utf16LEBOM):], unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM))
+	case bytes.HasPrefix(data, utf16BEBOM):
+		return transcode(data[len(utf16BEBOM):], unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM))
+	case looksUTF16LE(data):
+		return transcode(data, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM))
+	}
+	return decodeLine(data, fallback)
+}
+
+// decodeLine is decodeOutput without encoding detection, for output that
+// arrives a line at a time. Valid UTF-8 is kept even when it is mixed
+// with text in another encoding: a single-byte fallback decodes only the
+// bytes that aren't UTF-8, and a multi-byte one, whose characters can't
+// be told apart from UTF-8 byte by byte, only the lines that aren't.
+func decodeLine(data []byte, fallback encoding.Encoding) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	if fallback == nil {
+		fallback = systemEncoding()
+	}
+	var b strings.Builder
+	if _, single := fallback.(*charmap.Charmap); !single {
+		for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+			if utf8.Valid(line) {
+				b.Write(line)
+			} else {
+				b.WriteString(transcode(line, fallback))
+			}
+		}
+		return b.String()
+	}
+	for len(data) > 0 {
+		valid := 0
+		for valid < len(data) {
+			r, size := utf8.DecodeRune(data[valid:])
+			if r == utf8.RuneError && size == 1 {
+				break
+			}
+			valid += size
+		}
+		b.Write(data[:valid])
+		data = data[valid:]
+
+		invalid := 0
+		for invalid < len(data) {
+			r, size := utf8.DecodeRune(data[invalid:])
+			if r != utf8.RuneError || size != 1 {
+				break
+			}
+			invalid++
+		}
+		b.WriteString(transcode(data[:invalid], fallback))
+		data = data[invalid:]
+	}
+	return b.String()
+}
+
+// transcode decodes data from enc, replacing anything undecodable so the
+// result is always valid UTF-8
+func transcode(data []byte, enc encoding.Encoding) string {
+	out, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		out = data
+	}
+	return strings.ToValidUTF8(string(out), "�")
+}
+
+// looksUTF16LE reports whether data is mostly ASCII written as UTF-16LE,
+// i.e. nearly every second byte is zero
+func looksUTF16LE(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	zeros := 0
+	for i := 1; i < len(data); i += 2 {
+		if data[i] == 0 {
+			zeros++
+		}
+	}
+	return zeros*10 >= (len(data)/2)*9
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+
+package executor
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/text/encoding"
+)
+
+// systemEncoding is the locale's charset. Under a UTF-8 locale, output
+// that isn't UTF-8 most likely comes from a tool writing Latin-1.
+func systemEncoding() encoding.Encoding {
+	for _, key := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		locale := os.Getenv(key)
+		if locale == "" {
+			continue
+		}
+		_, charset, _ := strings.Cut(locale, ".")
+		charset, _, _ = strings.Cut(charset, "@")
+		switch strings.ToLower(strings.ReplaceAll(charset, "-", "")) {
+		case "", "utf8":
+			return latin1
+		}
+		if enc, err := LookupEncoding(charset); err == nil {
+			return enc
+		}
+		return latin1
+	}
+	return latin1
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package executor
+
+import (
+	"golang.org/x/sys/windows"
+	"golang.org/x/text/encoding"
+)
+
+var procGetOEMCP = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetOEMCP")
+
+// systemEncoding is the console's output code page, which is what cmd and
+// most console programs write when their output is piped. Without a
+// console (or when it is already UTF-8) the OEM code page is used.
+func systemEncoding() encoding.Encoding {
+	cp, err := windows.GetConsoleOutputCP()
+	if err != nil || cp == 0 || cp == 65001 {
+		oem, _, _ := procGetOEMCP.Call()
+		cp = uint32(oem)
+	}
+	if enc, ok := codePages[int(cp)]; ok && cp != 65001 {
+		return enc
+	}
+	return latin1
+}
@@ -0,0 +1,479 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Environment overlay
+//
+// Like handleCD for directories, the executor understands commands that only
+// set environment variables (export X=..., $env:X = ..., set X=...) and
+// keeps the result in an overlay applied to every later command. The
+// overlay is a map of name to value; an empty value removes the variable
+// from the inherited environment.
+
+// EnvOverlay returns a copy of the environment changes made so far
+func (e *Executor) EnvOverlay() map[string]string {
+	e.envMu.Lock()
+	defer e.envMu.Unlock()
+	overlay := make(map[string]string, len(e.env))
+	for k, v := range e.env {
+		overlay[k] = v
+	}
+	return overlay
+}
+
+// SetEnvOverlay replaces the overlay, e.g. with one restored from memory
+func (e *Executor) SetEnvOverlay(overlay map[string]string) {
+	e.envMu.Lock()
+	defer e.envMu.Unlock()
+	e.env = make(map[string]string, len(overlay))
+	for k, v := range overlay {
+		e.env[envKey(k)] = v
+	}
+}
+
+// UnsetEnv drops name from the overlay, restoring the inherited value.
+// Returns false if the overlay did not contain it.
+func (e *Executor) UnsetEnv(name string) bool {
+	e.envMu.Lock()
+	defer e.envMu.Unlock()
+	key := envKey(name)
+	if _, ok := e.env[key]; !ok {
+		return false
+	}
+	delete(e.env, key)
+	return true
+}
+
+// ClearEnv drops all overlay changes. Persistent sessions are restarted so
+// they pick up the clean environment.
+func (e *Executor) ClearEnv() {
+	e.envMu.Lock()
+	e.env = nil
+	e.envMu.Unlock()
+	e.CloseSessions()
+}
+
+// applyEnv records changes in the overlay
+func (e *Executor) applyEnv(changes []EnvChange) {
+	e.envMu.Lock()
+	defer e.envMu.Unlock()
+	if e.env == nil {
+		e.env = make(map[string]string)
+	}
+	for _, c := range changes {
+		if c.Unset {
+			e.env[envKey(c.Name)] = ""
+		} else {
+			e.env[envKey(c.Name)] = c.Value
+		}
+	}
+}
+
+// lookupEnv resolves a variable through the overlay, then the process env
+func (e *Executor) lookupEnv(name string) string {
+	e.envMu.Lock()
+	v, ok := e.env[envKey(name)]
+	e.envMu.Unlock()
+	if ok {
+		return v
+	}
+	return os.Getenv(name)
+}
+
+// environ returns the process environment with the overlay applied, in
+// the form expected by exec.Cmd.Env. Returns nil (inherit unchanged) when
+// the overlay is empty.
+func (e *Executor) environ() []string {
+	e.envMu.Lock()
+	defer e.envMu.Unlock()
+	if len(e.env) == 0 {
+		return nil
+	}
+
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, overridden := e.env[envKey(name)]; overridden {
+			continue
+		}
+		env = append(env, kv)
+	}
+
+	names := make([]string, 0, len(e.env))
+	for name := range e.env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if v := e.env[name]; v != "" {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env
+}
+
+// handleEnv applies parsed environment changes natively and reports them
+func (e *Executor) handleEnv(changes []EnvChange, start time.Time) *Result {
+	e.applyEnv(changes)
+
+	var lines []string
+	for _, c := range changes {
+		if c.Unset {
+			lines = append(lines, fmt.Sprintf("Unset %s", c.Name))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s=%s", c.Name, c.Value))
+		}
+	}
+
+	output := strings.Join(lines, "\n")
+	return &Result{
+		Success:        true,
+		Output:         output,
+		Stdout:         output,
+		Duration:       time.Since(start),
+		CurrentWorkDir: e.WorkingDir,
+	}
+}
+
+// envKey normalizes a variable name for the overlay map. Windows variable
+// names are case-insensitive.
+func envKey(name string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToUpper(name)
+	}
+	return name
+}
+
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// --- POSIX (bash, zsh, sh) ---
+
+// parsePosixEnv handles export NAME=value..., bare NAME=value assignments
+// and unset NAME...
+func parsePosixEnv(command string, lookup func(string) string) ([]EnvChange, bool) {
+	words, ok := posixWords(command, lookup)
+	if !ok || len(words) == 0 {
+		return nil, false
+	}
+
+	var changes []EnvChange
+	switch words[0] {
+	case "export":
+		for _, w := range words[1:] {
+			if strings.HasPrefix(w, "-") {
+				return nil, false // export -n / -p / -f change semantics
+			}
+			name, value, hasValue := strings.Cut(w, "=")
+			if !envNameRe.MatchString(name) {
+				return nil, false
+			}
+			if hasValue {
+				changes = append(changes, EnvChange{Name: name, Value: value})
+			}
+		}
+		// "export NAME" alone only marks an existing variable for export
+		return changes, len(changes) > 0
+
+	case "unset":
+		for _, w := range words[1:] {
+			if w == "-v" {
+				continue
+			}
+			if strings.HasPrefix(w, "-") || !envNameRe.MatchString(w) {
+				return nil, false
+			}
+			changes = append(changes, EnvChange{Name: w, Unset: true})
+		}
+		return changes, len(changes) > 0
+	}
+
+	// NAME=value [NAME=value...] with no command after it
+	for _, w := range words {
+		name, value, hasValue := strings.Cut(w, "=")
+		if !hasValue || !envNameRe.MatchString(name) {
+			return nil, false
+		}
+		changes = append(changes, EnvChange{Name: name, Value: value})
+	}
+	return changes, true
+}
+
+// parseFishEnv handles set -x/-gx NAME value... and set -e NAME
+func parseFishEnv(command string, lookup func(string) string) ([]EnvChange, bool) {
+	words, ok := posixWords(command, lookup)
+	if !ok || len(words) < 2 || words[0] != "set" {
+		return nil, false
+	}
+
+	exported, erase := false, false
+	i := 1
+	for ; i < len(words) && strings.HasPrefix(words[i], "-"); i++ {
+		switch flag := words[i]; {
+		case flag == "--export":
+			exported = true
+		case flag == "--erase":
+			erase = true
+		case flag == "--global", flag == "--universal":
+		case !strings.HasPrefix(flag, "--"):
+			exported = exported || strings.Contains(flag, "x")
+			erase = erase || strings.Contains(flag, "e")
+		default:
+			return nil, false
+		}
+	}
+	if i >= len(words) || !envNameRe.MatchString(words[i]) {
+		return nil, false
+	}
+	name := words[i]
+
+	if erase {
+		return []EnvChange{{Name: name, Unset: true}}, true
+	}
+	if !exported {
+		return nil, false // a plain fish variable, not the environment
+	}
+
+	sep := " "
+	if strings.HasSuffix(name, "PATH") {
+		sep = string(os.PathListSeparator)
+	}
+	return []EnvChange{{Name: name, Value: strings.Join(words[i+1:], sep)}}, true
+}
+
+// posixWords splits a simple command into words, removing quotes and
+// expanding $NAME / ${NAME} outside single quotes. It returns false for
+// anything beyond plain words (pipes, separators, redirects, command
+// substitution), since those are not pure assignments.
+func posixWords(command string, lookup func(string) string) ([]string, bool) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	s := strings.TrimSpace(command)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, false
+			}
+			cur.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				switch {
+				case s[j] == '\\' && j+1 < len(s) && strings.IndexByte("\"\\$`", s[j+1]) >= 0:
+					j++
+					cur.WriteByte(s[j])
+				case s[j] == '$':
+					n, ok := expandPosixVar(s[j:], lookup, &cur)
+					if !ok {
+						return nil, false
+					}
+					j += n - 1
+				case s[j] == '`':
+					return nil, false
+				default:
+					cur.WriteByte(s[j])
+				}
+			}
+			if j >= len(s) {
+				return nil, false
+			}
+			i = j
+			inWord = true
+		case c == '\\' && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+			inWord = true
+		case c == '$':
+			n, ok := expandPosixVar(s[i:], lookup, &cur)
+			if !ok {
+				return nil, false
+			}
+			i += n - 1
+			inWord = true
+		case strings.IndexByte(";&|<>()`\n", c) >= 0:
+			return nil, false
+		default:
+			cur.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, true
+}
+
+// expandPosixVar expands $NAME or ${NAME} at the start of s into out and
+// returns how many bytes it consumed. $(...) and other forms are rejected.
+func expandPosixVar(s string, lookup func(string) string, out *strings.Builder) (int, bool) {
+	if len(s) < 2 {
+		out.WriteByte('$')
+		return 1, true
+	}
+	if s[1] == '{' {
+		end := strings.IndexByte(s, '}')
+		if end < 0 || !envNameRe.MatchString(s[2:end]) {
+			return 0, false
+		}
+		out.WriteString(lookup(s[2:end]))
+		return end + 1, true
+	}
+	if s[1] == '(' {
+		return 0, false
+	}
+	n := 1
+	for n < len(s) && (s[n] == '_' || isAlnum(s[n])) {
+		n++
+	}
+	if n == 1 {
+		out.WriteByte('$')
+		return 1, true
+	}
+	out.WriteString(lookup(s[1:n]))
+	return n, true
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// --- PowerShell ---
+
+var (
+	psEnvAssignRe = regexp.MustCompile(`(?i)^\$env:([A-Za-z_][A-Za-z0-9_]*)\s*(\+?=)\s*(.+)$`)
+	psEnvRemoveRe = regexp.MustCompile(`(?i)^(?:Remove-Item|ri|del|rm)\s+(?:-Path\s+|-LiteralPath\s+)?['"]?Env:[\\/]?([A-Za-z_][A-Za-z0-9_]*)['"]?$`)
+	psEnvSetItem  = regexp.MustCompile(`(?i)^Set-Item\s+(?:-Path\s+)?['"]?Env:[\\/]?([A-Za-z_][A-Za-z0-9_]*)['"]?\s+(?:-Value\s+)?(.+)$`)
+	psNumberRe    = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+	psEnvVarRe    = regexp.MustCompile(`(?i)\$env:([A-Za-z_][A-Za-z0-9_]*)|\$\{env:([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// parsePowerShellEnv handles $env:NAME = 'value', $env:NAME += 'value',
+// Set-Item Env:NAME 'value' and Remove-Item Env:NAME
+func parsePowerShellEnv(command string, lookup func(string) string) ([]EnvChange, bool) {
+	cmd := strings.TrimSuffix(strings.TrimSpace(command), ";")
+
+	if m := psEnvRemoveRe.FindStringSubmatch(cmd); m != nil {
+		return []EnvChange{{Name: m[1], Unset: true}}, true
+	}
+
+	// Set-Item takes its value in argument mode, where a bare word is a
+	// string; after = a bare word would run as a command
+	var name, op, expr string
+	argMode := false
+	if m := psEnvAssignRe.FindStringSubmatch(cmd); m != nil {
+		name, op, expr = m[1], m[2], m[3]
+	} else if m := psEnvSetItem.FindStringSubmatch(cmd); m != nil {
+		name, op, expr, argMode = m[1], "=", m[2], true
+	} else {
+		return nil, false
+	}
+
+	expr = strings.TrimSpace(expr)
+	if strings.EqualFold(expr, "$null") {
+		return []EnvChange{{Name: name, Unset: true}}, true
+	}
+
+	value, ok := psStringValue(expr, argMode, lookup)
+	if !ok {
+		return nil, false
+	}
+	if op == "+=" {
+		value = lookup(name) + value
+	}
+	return []EnvChange{{Name: name, Value: value}}, true
+}
+
+// psStringValue evaluates a single PowerShell string literal, $env:
+// reference, number, or (in argument mode) bare word
+func psStringValue(expr string, argMode bool, lookup func(string) string) (string, bool) {
+	expandEnv := func(s string) string {
+		return psEnvVarRe.ReplaceAllStringFunc(s, func(ref string) string {
+			m := psEnvVarRe.FindStringSubmatch(ref)
+			if m[1] != "" {
+				return lookup(m[1])
+			}
+			return lookup(m[2])
+		})
+	}
+
+	switch {
+	case len(expr) >= 2 && expr[0] == '\'' && expr[len(expr)-1] == '\'':
+		inner := expr[1 : len(expr)-1]
+		if strings.Contains(strings.ReplaceAll(inner, "''", ""), "'") {
+			return "", false // more than one literal, e.g. 'a' + 'b'
+		}
+		return strings.ReplaceAll(inner, "''", "'"), true
+
+	case len(expr) >= 2 && expr[0] == '"' && expr[len(expr)-1] == '"':
+		inner := expr[1 : len(expr)-1]
+		if strings.ContainsAny(strings.ReplaceAll(inner, "`\"", ""), "\"") || strings.Contains(inner, "$(") {
+			return "", false
+		}
+		inner = expandEnv(inner)
+		inner = strings.NewReplacer("`\"", "\"", "``", "`", "`n", "\n", "`t", "\t", "`$", "$").Replace(inner)
+		return inner, true
+
+	case strings.HasPrefix(strings.ToLower(expr), "$env:") || strings.HasPrefix(strings.ToLower(expr), "${env:"):
+		if m := psEnvVarRe.FindString(expr); m == expr {
+			return expandEnv(expr), true
+		}
+		return "", false
+
+	case psNumberRe.MatchString(expr),
+		argMode && !strings.ContainsAny(expr, " \t;|&()$+'\"`"):
+		return expr, true
+	}
+	return "", false
+}
+
+// --- cmd.exe ---
+
+var cmdEnvVarRe = regexp.MustCompile(`%([A-Za-z_][A-Za-z0-9_]*)%`)
+
+// parseCmdEnv handles set NAME=value, set "NAME=value" and set NAME=
+func parseCmdEnv(command string, lookup func(string) string) ([]EnvChange, bool) {
+	cmd := strings.TrimSpace(command)
+	if len(cmd) < 4 || !strings.EqualFold(cmd[:4], "set ") {
+		return nil, false
+	}
+	rest := strings.TrimSpace(cmd[4:])
+	if strings.HasPrefix(rest, "/") || strings.ContainsAny(rest, "&|<>") {
+		return nil, false // set /a, set /p, or a compound command
+	}
+	if len(rest) >= 2 && rest[0] == '"' && rest[len(rest)-1] == '"' {
+		rest = rest[1 : len(rest)-1]
+	}
+
+	name, value, ok := strings.Cut(rest, "=")
+	if !ok || !envNameRe.MatchString(name) {
+		return nil, false // "set NAME" just prints matching variables
+	}
+	value = cmdEnvVarRe.ReplaceAllStringFunc(value, func(ref string) string {
+		return lookup(ref[1 : len(ref)-1])
+	})
+
+	if value == "" {
+		return []EnvChange{{Name: name, Unset: true}}, true
+	}
+	return []EnvChange{{Name: name, Value: value}}, true
+}
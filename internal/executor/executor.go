@@ -3,29 +3,188 @@ package executor
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"shell-e/internal/hooks"
 	"shell-e/internal/logger"
+	"shell-e/internal/table"
+	"shell-e/internal/terminal"
+	"shell-e/internal/trash"
+	"shell-e/internal/workspace"
 	"strings"
+	"sync"
 	"time"
 )
 
 // Result captures the output of a command execution
 type Result struct {
 	Success        bool
-	Output         string
+	Output         string // Stdout followed by stderr, as shown to the user
 	Error          string
 	Duration       time.Duration
 	NewWorkDir     string // Set when a cd/Set-Location command changes directory
 	CurrentWorkDir string // The actual working directory after execution
+
+	// Killed lists the processes terminated because the command timed out
+	// or was cancelled (the shell and anything it spawned)
+	Killed []KilledProcess
+
+	// Table is the output parsed as rows and columns, when Structured is
+	// on and the output is JSON, CSV or an aligned table
+	Table *table.Table
+
+	// ExitCode is the shell's exit status; -1 if it never started or was
+	// ended by a signal. Commands handled natively (cd, env) report 0 or 1.
+	ExitCode int
+	// Signal names the signal that ended the shell (Unix only), e.g.
+	// "terminated" after a timeout
+	Signal    string
+	TimedOut  bool
+	Cancelled bool
+
+	Stdout string
+	Stderr string // Empty in persistent sessions, which merge the streams
+
+	// PeakMemory (bytes) and CPUTime cover the shell and what it ran; both
+	// are 0 when unknown (persistent sessions)
+	PeakMemory int64
+	CPUTime    time.Duration
+
+	// Target names the remote host the command ran on; "" for this
+	// machine, in which case the directories above are local
+	Target string
+
+	// SnapshotID names the trash snapshot of the files the command was
+	// about to change, for undo; "" if there was none
+	SnapshotID string
+	// NotSnapshotted says why the files the command was about to change
+	// couldn't be saved for undo, e.g. because they were too large
+	NotSnapshotted string
+
+	// Hook names the pre-hook that refused or rewrote the command.
+	// Refused means it never ran; Rewritten is what ran in its place.
+	Hook      string
+	Refused   bool
+	Rewritten string
 }
 
 // Executor runs shell commands
 type Executor struct {
 	WorkingDir string
-	Timeout    time.Duration
+	Timeout    time.Duration // Default timeout; 0 means none
+
+	// TimeoutRules override Timeout for matching commands (installs,
+	// builds). The first matching rule wins.
+	TimeoutRules []TimeoutRule
+
+	// Persistent runs commands in one long-lived shell per shell type, so
+	// environment changes, aliases and functions survive between commands.
+	// Shells that can't run as a session (cmd) still get a fresh process.
+	Persistent bool
+
+	// Structured detects tabular output (JSON, CSV, aligned columns) and
+	// asks shells that support it for machine-readable output
+	Structured bool
+
+	// Trash, if set, receives a snapshot of the files a command will
+	// delete or overwrite before it runs, so the change can be undone
+	Trash *trash.Trash
+
+	// Roots confines the working directory: cd outside them is refused.
+	// The zero value allows everything.
+	Roots workspace.Roots
+
+	// Encoding is what output that isn't UTF-8 is decoded from, e.g.
+	// "cp850" or "latin1". Empty uses the console code page on Windows
+	// and the locale's charset elsewhere.
+	Encoding string
+
+	// Hooks, if set, run external programs before and after every
+	// command; a pre-hook can refuse the command or rewrite it
+	Hooks *hooks.Hooks
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*Session
+
+	envMu sync.Mutex
+	env   map[string]string // Overlay from env-setting commands; "" = removed
+
+	prevDir  string   // Directory before the last cd, for cd -
+	dirStack []string // pushd stack, most recent last
+
+	targetsMu  sync.Mutex
+	target     Target            // Where commands run; nil for this machine
+	targets    map[string]Target // Opened targets by name
+	targetDirs map[string]string // Working directory on each target
+
+	jobsMu    sync.Mutex
+	jobs      []*Job
+	nextJobID int
+}
+
+// ExecOptions customizes a single execution
+type ExecOptions struct {
+	// Context, if set, cancels the command (and everything it spawned)
+	// when done, in addition to the executor's timeout
+	Context context.Context
+
+	// OnOutput, if set, is called for every line as the command produces it.
+	// It is called from the goroutines copying stdout and stderr, so it
+	// must be safe for concurrent use.
+	OnOutput func(OutputLine)
+
+	// Timeout, if positive, replaces the timeout from TimeoutFor
+	Timeout time.Duration
+
+	// NoTimeout disables the timeout; the command runs until it exits or
+	// Context is cancelled. Used for background jobs.
+	NoTimeout bool
+
+	// Deadline, if set, receives the command's timeout so the caller can
+	// be warned before it expires and extend it
+	Deadline *Deadline
+
+	// NoSession runs the command in a fresh process even in persistent
+	// mode, so it cannot block the session. Directory and environment
+	// changes are left to that process too, so they don't affect later
+	// commands.
+	NoSession bool
+
+	// Password, if set, is given to sudo by an askpass helper (sudo -A),
+	// never on the command's stdin or in its environment. The command
+	// then runs in a fresh process, never in the persistent session. It
+	// is not logged or kept.
+	Password string
+
+	// Stdin, if set, is fed to the command's standard input, which also
+	// means a fresh process rather than the persistent session
+	Stdin *Stdin
+
+	// Plan tells hooks why the command runs
+	Plan *hooks.Plan
+
+	plain bool      // Run as written, without asking for structured output
+	job   *jobState // Set for background jobs
+}
+
+// jobState is what a background job took from the executor when it
+// started. Jobs run there rather than in the foreground's WorkingDir and
+// environment, which change under them.
+type jobState struct {
+	dir string
+	env []string // nil inherits the process environment
+}
+
+// localDir is the directory on this machine a command starts from
+func (e *Executor) localDir(opts ExecOptions) string {
+	if opts.job != nil {
+		return opts.job.dir
+	}
+	return e.WorkingDir
 }
 
 func NewExecutor(workingDir string) *Executor {
@@ -38,65 +197,198 @@ func NewExecutor(workingDir string) *Executor {
 // Execute runs a command in the specified shell.
 // It detects cd/Set-Location commands and updates the working directory.
 func (e *Executor) Execute(command, shell string) *Result {
+	return e.ExecuteWithOptions(command, shell, ExecOptions{})
+}
+
+// ExecuteWithOptions is Execute with per-call options such as live output
+// streaming. The returned Result is the same as Execute's.
+func (e *Executor) ExecuteWithOptions(command, shell string, opts ExecOptions) *Result {
+	return e.withHooks(command, shell, opts, func(command string) *Result {
+		return e.execute(command, shell, opts)
+	})
+}
+
+// execute is ExecuteWithOptions without the hooks
+func (e *Executor) execute(command, shell string, opts ExecOptions) *Result {
 	start := time.Now()
 	logger.Info("Executing command: %s (shell: %s)", command, shell)
 
-	// Detect directory change commands and handle them natively
-	if newDir, ok := extractCDTarget(command); ok {
-		return e.handleCD(newDir, start)
+	// On a remote target the remote shell handles everything; nothing
+	// here (cd, env, snapshots) applies to its filesystem
+	if t := e.CurrentTarget(); t != nil {
+		return e.executeOnTarget(t, command, opts, start)
 	}
 
-	// VALIDATE WorkingDir: If it doesn't exist, fallback to current process directory
-	// This prevents persistence errors where a previously valid folder was deleted
-	if _, err := os.Stat(e.WorkingDir); os.IsNotExist(err) {
-		logger.Error("Working directory '%s' does not exist. Falling back to default.", e.WorkingDir)
-		cwd, err := os.Getwd()
-		if err == nil {
-			e.WorkingDir = cwd
-			logger.Info("Executor working directory reset to: %s", e.WorkingDir)
-		} else {
-			// Absolute fallback if os.Getwd fails (rare)
-			e.WorkingDir = "."
+	sh := resolveShell(shell)
+	changes, isEnv := sh.ParseEnv(command, e.lookupEnv)
+
+	// In persistent mode the real shell handles everything, including cd.
+	// Env changes are still recorded so they survive a session restart.
+	if e.Persistent && !opts.NoSession && opts.Password == "" && opts.Stdin == nil {
+		if sess := e.session(sh); sess != nil {
+			result := e.executeInSession(sess, command, sh, opts, start)
+			if isEnv && result.Success {
+				e.applyEnv(changes)
+			}
+			return result
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), e.Timeout)
+	// Detect environment variable assignments and handle them natively.
+	// A background job's stay in its own shell, like its directory changes.
+	if isEnv && !opts.NoSession {
+		return e.handleEnv(changes, start)
+	}
+
+	// Detect directory changes (cd, pushd, popd) and handle them natively,
+	// including as the first statement of a chain like "cd src && ls".
+	// Background jobs leave them to their own shell so they can't move
+	// the foreground's directory.
+	first, sep, rest := splitChain(command)
+	if nav, ok := parseNavigation(sh, first); ok && !opts.NoSession {
+		if rest == "" {
+			return e.navigate(nav, start)
+		}
+		return e.executeChained(nav, sep, rest, shell, opts, start)
+	}
+
+	var dir string
+	env := e.environ()
+	if opts.job != nil {
+		dir, env = e.validDir(opts.job.dir), opts.job.env
+	} else {
+		e.ensureWorkingDir()
+		dir = e.WorkingDir
+	}
+	stdin, closeStdin, stdinErr := e.stdinFor(opts, dir)
+	if stdinErr != nil {
+		logger.Error("Command not run: %s (%v)", command, stdinErr)
+		return &Result{
+			Error:          stdinErr.Error(),
+			ExitCode:       -1,
+			Duration:       time.Since(start),
+			CurrentWorkDir: dir,
+		}
+	}
+	defer closeStdin()
+	snapshotID, notSaved := e.snapshot(sh, command, dir)
+
+	ctx, deadline, cancel := e.commandContext(command, opts)
 	defer cancel()
 
-	var cmd *exec.Cmd
-
-	switch strings.ToLower(shell) {
-	case "cmd":
-		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
-	default: // powershell
-		cmd = exec.CommandContext(ctx, "powershell",
-			"-NoProfile",
-			"-NonInteractive",
-			"-Command", command,
-		)
+	run, rewritten := command, false
+	if !opts.plain {
+		run, rewritten = e.structuredCommand(sh, command)
+	}
+	if opts.Password != "" {
+		helper, helperDir, err := writeAskpass(opts.Password)
+		if err != nil {
+			logger.Error("Command not run: %s (askpass helper: %v)", command, err)
+			return &Result{
+				Error:          fmt.Sprintf("could not pass the sudo password: %v", err),
+				ExitCode:       -1,
+				Duration:       time.Since(start),
+				CurrentWorkDir: dir,
+			}
+		}
+		defer os.RemoveAll(helperDir)
+		run = sudoWithAskpass(run)
+		if env == nil {
+			env = os.Environ()
+		}
+		env = append(env, "SUDO_ASKPASS="+helper)
+	}
+	// With no encoding configured, ask for UTF-8 output where the shell
+	// can switch; a configured one means its legacy output is expected
+	if us, ok := sh.(UTF8Shell); ok && e.Encoding == "" {
+		run = us.UTF8Command(run)
+	}
+	name, args := sh.CommandLine(run)
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	if stdin != nil {
+		cmd.Stdin = stdin
 	}
 
-	cmd.Dir = e.WorkingDir
+	// Run in a process group (job object on Windows) so a timeout or cancel
+	// takes down grandchildren too, not just the shell
+	group := newProcessGroup(cmd)
+	defer group.close()
+	var killed []KilledProcess
+	cmd.Cancel = func() error {
+		killed = group.terminate(killGrace)
+		return nil
+	}
+	cmd.WaitDelay = pipeGrace
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	// Stream lines to the caller as they arrive while still buffering
+	// everything for the final Result
+	enc := e.outputEncoding()
+	var outLines, errLines *lineWriter
+	if opts.OnOutput != nil {
+		outLines = newLineWriter(false, opts.OnOutput)
+		errLines = newLineWriter(true, opts.OnOutput)
+		outLines.enc, errLines.enc = enc, enc
+		if !rewritten {
+			// JSON asked for behind the user's back isn't shown live
+			cmd.Stdout = io.MultiWriter(&stdout, outLines)
+		}
+		cmd.Stderr = io.MultiWriter(&stderr, errLines)
+	}
+
+	err := cmd.Start()
+	if err == nil {
+		if attachErr := group.attach(); attachErr != nil {
+			logger.Error("Could not attach process group: %v", attachErr)
+		}
+		err = cmd.Wait()
+	}
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// The shell finished but something it left running kept the
+		// output pipes open; the command itself succeeded
+		logger.Info("Closed output pipes held by a background process: %s", command)
+		err = nil
+	}
+	if outLines != nil {
+		outLines.Close()
+		errLines.Close()
+	}
 	duration := time.Since(start)
+	stdoutText := decodeOutput(stdout.Bytes(), enc)
+	stderrText := decodeOutput(stderr.Bytes(), enc)
 
-	if ctx.Err() == context.DeadlineExceeded {
-		logger.Error("Command timed out: %s", command)
-		return &Result{
-			Success:        false,
-			Error:          fmt.Sprintf("Command timed out after %v", e.Timeout),
-			Duration:       duration,
-			CurrentWorkDir: e.WorkingDir,
+	result := &Result{
+		Stdout:         cleanTerminalOutput(trimOutput(stdoutText)),
+		Stderr:         cleanTerminalOutput(trimOutput(stderrText)),
+		ExitCode:       -1,
+		Duration:       duration,
+		CurrentWorkDir: dir,
+		SnapshotID:     snapshotID,
+		NotSnapshotted: notSaved,
+	}
+	result.recordState(cmd.ProcessState)
+	group.usage(result)
+
+	if ctx.Err() != nil {
+		result.TimedOut = deadline.Expired()
+		result.Cancelled = !result.TimedOut
+		result.Error = "Command cancelled"
+		if result.TimedOut {
+			result.Error = fmt.Sprintf("Command timed out after %v", deadline.Timeout())
 		}
+		result.Output = result.Stdout
+		result.Killed = killed
+		logger.Error("%s: %s (killed %d processes)", result.Error, command, len(killed))
+		return result
 	}
 
-	output := strings.TrimSpace(stdout.String())
-	errStr := strings.TrimSpace(stderr.String())
+	output := trimOutput(stdoutText)
+	errStr := strings.TrimSpace(stderrText)
 
 	// Combine stdout and stderr for the user output
 	// Many tools (like java -version) print to stderr even on success
@@ -107,6 +399,7 @@ func (e *Executor) Execute(command, shell string) *Result {
 			output = errStr
 		}
 	}
+	result.Output = cleanTerminalOutput(output)
 
 	if err != nil {
 		logger.Error("Command failed: %s (err: %v, stderr: %s)", command, err, errStr)
@@ -114,87 +407,80 @@ func (e *Executor) Execute(command, shell string) *Result {
 		// Handle search commands where exit code 1 means "Not Found" rather than error
 		// e.g., Select-String, grep, findstr
 		if exitErr, ok := err.(*exec.ExitError); ok {
-			if exitErr.ExitCode() == 1 {
-				lowerCmd := strings.ToLower(command)
-				if strings.Contains(lowerCmd, "select-string") ||
-					strings.Contains(lowerCmd, "grep") ||
-					strings.Contains(lowerCmd, "findstr") {
-					return &Result{
-						Success:        false, // Technically failed to find, but valid execution
-						Output:         cleanTerminalOutput(output),
-						Error:          "No matches found",
-						Duration:       duration,
-						CurrentWorkDir: e.WorkingDir,
-					}
+			switch sh.ClassifyExit(command, exitErr.ExitCode()) {
+			case ExitNoMatch:
+				// Technically failed to find, but valid execution
+				result.Error = "No matches found"
+				return result
+			case ExitCommandNotFound:
+				if errStr == "" {
+					errStr = "Command not found"
 				}
 			}
 		}
 
-		errorMsg := errStr
-		if errorMsg == "" {
-			errorMsg = err.Error()
-		}
-		return &Result{
-			Success:        false,
-			Output:         cleanTerminalOutput(output),
-			Error:          errorMsg,
-			Duration:       duration,
-			CurrentWorkDir: e.WorkingDir,
+		result.Error = errStr
+		if result.Error == "" {
+			result.Error = err.Error()
 		}
+		return result
 	}
 
 	logger.Info("Command success: %s", command)
-	return &Result{
-		Success:        true,
-		Output:         cleanTerminalOutput(output),
-		Duration:       duration,
-		CurrentWorkDir: e.WorkingDir,
+	result.Success = true
+	if !e.structure(result, rewritten) && rewritten {
+		// The JSON isn't a table after all; run the command as written so
+		// the user sees its normal output. Get-* cmdlets only read.
+		logger.Info("No table in structured output, running as written: %s", command)
+		opts.plain = true
+		return e.execute(command, shell, opts)
 	}
+	return result
 }
 
-// handleCD changes the executor's working directory natively.
-// This is necessary because cd/Set-Location in a subprocess doesn't
-// affect the parent process.
-func (e *Executor) handleCD(target string, start time.Time) *Result {
-	// Resolve relative to current working dir
-	var newDir string
-	if filepath.IsAbs(target) {
-		newDir = target
-	} else {
-		newDir = filepath.Join(e.WorkingDir, target)
+// recordState fills in how a process ended and the resources it used
+func (r *Result) recordState(state *os.ProcessState) {
+	if state == nil {
+		return
 	}
+	r.ExitCode = state.ExitCode()
+	r.CPUTime = state.UserTime() + state.SystemTime()
+	stateUsage(state, r)
+}
 
-	// Clean the path
-	newDir = filepath.Clean(newDir)
+// ensureWorkingDir validates WorkingDir: if it doesn't exist, fall back to the
+// current process directory. This prevents persistence errors where a
+// previously valid folder was deleted. A directory outside the allowed
+// roots is replaced by the first root.
+func (e *Executor) ensureWorkingDir() {
+	if dir := e.validDir(e.WorkingDir); dir != e.WorkingDir {
+		e.WorkingDir = dir
+		logger.Info("Executor working directory reset to: %s", e.WorkingDir)
+	}
+}
 
-	// Verify directory exists
-	info, err := os.Stat(newDir)
-	if err != nil {
-		return &Result{
-			Success:        false,
-			Error:          fmt.Sprintf("Cannot navigate to '%s': %v", target, err),
-			Duration:       time.Since(start),
-			CurrentWorkDir: e.WorkingDir,
+// validDir is dir, or where to go instead if it is gone or outside the
+// allowed roots
+func (e *Executor) validDir(dir string) string {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		logger.Error("Working directory '%s' does not exist. Falling back to default.", dir)
+		cwd, err := os.Getwd()
+		if err == nil {
+			dir = cwd
+		} else {
+			// Absolute fallback if os.Getwd fails (rare)
+			dir = "."
 		}
 	}
-	if !info.IsDir() {
-		return &Result{
-			Success:        false,
-			Error:          fmt.Sprintf("'%s' is not a directory", target),
-			Duration:       time.Since(start),
-			CurrentWorkDir: e.WorkingDir,
-		}
+	if !e.Roots.Restricted() {
+		return dir
 	}
-
-	e.WorkingDir = newDir
-
-	return &Result{
-		Success:        true,
-		Output:         fmt.Sprintf("Directory: %s", newDir),
-		Duration:       time.Since(start),
-		NewWorkDir:     newDir,
-		CurrentWorkDir: newDir,
+	if abs, err := filepath.Abs(dir); err != nil || !e.Roots.Contains(abs) {
+		root := e.Roots.Paths()[0]
+		logger.Error("Working directory '%s' is outside the allowed workspace. Moving to %s.", dir, root)
+		dir = root
 	}
+	return dir
 }
 
 // SetWorkingDir updates the working directory
@@ -202,38 +488,6 @@ func (e *Executor) SetWorkingDir(dir string) {
 	e.WorkingDir = dir
 }
 
-// extractCDTarget detects cd/Set-Location commands and extracts the target path.
-// Returns the target and true if it's a cd command, or ("", false) otherwise.
-func extractCDTarget(command string) (string, bool) {
-	cmd := strings.TrimSpace(command)
-
-	// Check various cd patterns (case-insensitive)
-	lower := strings.ToLower(cmd)
-
-	// "cd 'path'" or "cd path"
-	if strings.HasPrefix(lower, "cd ") {
-		return cleanPathArg(cmd[3:]), true
-	}
-
-	// "Set-Location 'path'" or "Set-Location -Path 'path'"
-	if strings.HasPrefix(lower, "set-location ") {
-		rest := strings.TrimSpace(cmd[13:])
-		// Handle -Path parameter
-		lowerRest := strings.ToLower(rest)
-		if strings.HasPrefix(lowerRest, "-path ") {
-			rest = strings.TrimSpace(rest[6:])
-		}
-		return cleanPathArg(rest), true
-	}
-
-	// "sl 'path'" (alias)
-	if strings.HasPrefix(lower, "sl ") {
-		return cleanPathArg(cmd[3:]), true
-	}
-
-	return "", false
-}
-
 // cleanPathArg strips quotes and whitespace from a path argument
 func cleanPathArg(s string) string {
 	s = strings.TrimSpace(s)
@@ -246,28 +500,23 @@ func cleanPathArg(s string) string {
 	return s
 }
 
-// cleanTerminalOutput handles control characters like \r to clean up progress bars
+// cleanTerminalOutput replays carriage returns, cursor movement and erase
+// sequences (progress bars, spinners) so only the final screen remains.
+// Colors are kept for display.
 func cleanTerminalOutput(s string) string {
-	// Normalize Windows line endings to prevent \r at end of line being interpreted as overwrite
-	s = strings.ReplaceAll(s, "\r\n", "\n")
-
-	if !strings.ContainsAny(s, "\r") {
-		return s
-	}
-
-	var result strings.Builder
-	lines := strings.Split(s, "\n")
-	for i, line := range lines {
-		if i > 0 {
-			result.WriteByte('\n')
-		}
+	return terminal.Render(s)
+}
 
-		// Handle Carriage Return (\r)
-		// We keep the text after the last \r, simulating the final state of the line
-		if idx := strings.LastIndexByte(line, '\r'); idx != -1 {
-			line = line[idx+1:]
+// trimOutput drops leading blank lines and trailing whitespace but keeps
+// the first line's indentation, which right-aligned column headers (ps,
+// Format-Table) need to stay over their values
+func trimOutput(s string) string {
+	s = strings.TrimRight(s, " \t\r\n")
+	for {
+		line, rest, found := strings.Cut(s, "\n")
+		if !found || strings.TrimSpace(line) != "" {
+			return s
 		}
-		result.WriteString(line)
+		s = rest
 	}
-	return result.String()
 }
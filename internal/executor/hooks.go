@@ -0,0 +1,69 @@
+package executor
+
+import (
+	"time"
+
+	"shell-e/internal/hooks"
+	"shell-e/internal/logger"
+)
+
+// withHooks runs command through the pre-hooks, then run (with the
+// command they settled on), then the post-hooks. A refused command never
+// reaches run.
+func (e *Executor) withHooks(command, shell string, opts ExecOptions, run func(command string) *Result) *Result {
+	if e.Hooks == nil || (len(e.Hooks.Pre) == 0 && len(e.Hooks.Post) == 0) {
+		return run(command)
+	}
+	start := time.Now()
+	payload := hooks.Payload{Command: command, Shell: shell, Cwd: e.localDir(opts), Plan: opts.Plan}
+	if t := e.CurrentTarget(); t != nil {
+		payload.Target, payload.Cwd, payload.Shell = t.Name(), e.TargetDir(), t.Shell()
+	}
+
+	runCommand, rewrittenBy, err := e.Hooks.RunPre(payload)
+	if err != nil {
+		logger.Error("Command not run: %s (%v)", command, err)
+		result := &Result{
+			Error:          err.Error(),
+			ExitCode:       -1,
+			Duration:       time.Since(start),
+			CurrentWorkDir: payload.Cwd,
+			Refused:        true,
+			Target:         payload.Target,
+		}
+		if refusal, ok := err.(*hooks.Refusal); ok {
+			result.Hook = refusal.Hook
+		}
+		return result
+	}
+	if rewrittenBy != "" {
+		logger.Info("Hook %s rewrote %q to %q", rewrittenBy, command, runCommand)
+	}
+
+	result := run(runCommand)
+	if rewrittenBy != "" {
+		result.Hook, result.Rewritten = rewrittenBy, runCommand
+	}
+
+	payload.Command = runCommand
+	if runCommand != command {
+		payload.Original = command
+	}
+	if result.CurrentWorkDir != "" {
+		payload.Cwd = result.CurrentWorkDir
+	}
+	outcome := &hooks.Outcome{
+		Success:    result.Success,
+		ExitCode:   result.ExitCode,
+		Error:      result.Error,
+		DurationMS: result.Duration.Milliseconds(),
+		TimedOut:   result.TimedOut,
+		Cancelled:  result.Cancelled,
+	}
+	outcome.SetOutput(result.Output)
+	payload.Result = outcome
+	for _, err := range e.Hooks.RunPost(payload) {
+		logger.Error("Post-hook failed after %s: %v", runCommand, err)
+	}
+	return result
+}
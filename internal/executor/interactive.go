@@ -0,0 +1,259 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"shell-e/internal/hooks"
+	"shell-e/internal/logger"
+)
+
+// InteractiveCmd runs a command with the user's terminal attached, for
+// programs that prompt (git commit without -m, ssh-keygen, installers).
+//
+// It satisfies BubbleTea's tea.ExecCommand interface, so the TUI can hand
+// it to tea.Exec: the program is suspended, the child gets the terminal,
+// and the TUI resumes when the child exits. On Unix the child runs in a
+// pseudo-terminal so its output is also captured for the Result.
+type InteractiveCmd struct {
+	e       *Executor
+	command string
+	shell   Shell
+
+	// Plan tells hooks why the command runs
+	Plan *hooks.Plan
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	mu     sync.Mutex
+	result *Result
+}
+
+// Interactive prepares command to run with the terminal handed over to it.
+// Nothing runs until the returned command's Run is called.
+func (e *Executor) Interactive(command, shell string) *InteractiveCmd {
+	return &InteractiveCmd{
+		e:       e,
+		command: command,
+		shell:   resolveShell(shell),
+		stdin:   os.Stdin,
+		stdout:  os.Stdout,
+		stderr:  os.Stderr,
+	}
+}
+
+func (c *InteractiveCmd) SetStdin(r io.Reader)  { c.stdin = r }
+func (c *InteractiveCmd) SetStdout(w io.Writer) { c.stdout = w }
+func (c *InteractiveCmd) SetStderr(w io.Writer) { c.stderr = w }
+
+// Result returns the outcome once Run has returned
+func (c *InteractiveCmd) Result() *Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.result
+}
+
+// Run executes the command attached to the terminal. The returned error is
+// only for the TUI's exec callback; the full outcome is in Result.
+func (c *InteractiveCmd) Run() error {
+	var err error
+	result := c.e.withHooks(c.command, c.shell.Name(), ExecOptions{Plan: c.Plan}, func(command string) *Result {
+		c.command = command
+		err = c.run()
+		return c.Result()
+	})
+	c.setResult(result)
+	return err
+}
+
+func (c *InteractiveCmd) run() error {
+	start := time.Now()
+	logger.Info("Executing interactive command: %s (shell: %s)", c.command, c.shell.Name())
+
+	// Directory and environment changes need no terminal — handle them
+	// natively. Leading "cd dir &&" statements are applied first and the
+	// rest runs in the terminal.
+	for {
+		first, sep, rest := splitChain(c.command)
+		nav, ok := parseNavigation(c.shell, first)
+		if !ok {
+			break
+		}
+		navResult := c.e.navigate(nav, start)
+		if rest == "" || (sep == "&&" && !navResult.Success) || (sep == "||" && navResult.Success) {
+			c.setResult(navResult)
+			return nil
+		}
+		c.command = rest
+		defer c.keepWorkDir(navResult)
+	}
+	if changes, ok := c.shell.ParseEnv(c.command, c.e.lookupEnv); ok {
+		c.setResult(c.e.handleEnv(changes, start))
+		return nil
+	}
+
+	c.e.ensureWorkingDir()
+	snapshotID, notSaved := c.e.snapshot(c.shell, c.command, c.e.WorkingDir)
+
+	name, args := c.shell.CommandLine(c.command)
+	if is, ok := c.shell.(InteractiveShell); ok {
+		name, args = is.InteractiveCommandLine(c.command)
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Dir = c.e.WorkingDir
+	cmd.Env = c.e.environ()
+
+	// Interactive commands have no timeout: the user is in control and
+	// can always press Ctrl+C in the child
+	captured, err := runInTerminal(cmd, c.stdin, c.stdout, c.stderr)
+	duration := time.Since(start)
+
+	output := strings.TrimSpace(cleanTerminalOutput(decodeOutput([]byte(captured), c.e.outputEncoding())))
+	result := &Result{
+		Success:        err == nil,
+		Output:         output,
+		Stdout:         output, // The terminal merges stdout and stderr
+		ExitCode:       -1,
+		Duration:       duration,
+		CurrentWorkDir: c.e.WorkingDir,
+		SnapshotID:     snapshotID,
+		NotSnapshotted: notSaved,
+	}
+	result.recordState(cmd.ProcessState)
+	if err != nil {
+		logger.Error("Interactive command failed: %s (err: %v)", c.command, err)
+		result.Error = err.Error()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			result.Error = fmt.Sprintf("exit status %d", exitErr.ExitCode())
+		}
+	} else {
+		logger.Info("Interactive command success: %s", c.command)
+	}
+
+	c.setResult(result)
+	return err
+}
+
+// keepWorkDir reports a directory change made before the command ran
+func (c *InteractiveCmd) keepWorkDir(nav *Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.result != nil && c.result.NewWorkDir == "" {
+		c.result.NewWorkDir = nav.NewWorkDir
+	}
+}
+
+func (c *InteractiveCmd) setResult(r *Result) {
+	c.mu.Lock()
+	c.result = r
+	c.mu.Unlock()
+}
+
+// interactivePrograms start a full-screen UI or always prompt
+var interactivePrograms = map[string]bool{
+	"vim": true, "vi": true, "nvim": true, "nano": true, "emacs": true,
+	"less": true, "more": true, "top": true, "htop": true, "btop": true,
+	"ssh": true, "ssh-keygen": true, "passwd": true,
+	"mysql": true, "psql": true, "sqlite3": true, "ftp": true, "sftp": true,
+	"edit": true, "notepad": true, "read-host": true,
+}
+
+// replPrograms are interactive only when started without arguments
+var replPrograms = map[string]bool{
+	"python": true, "python3": true, "node": true, "irb": true,
+	"powershell": true, "pwsh": true, "bash": true, "zsh": true, "sh": true,
+	"su": true,
+}
+
+// sudoValueOptions are the sudo options followed by a separate value,
+// lowercased as NeedsTerminal sees them
+var sudoValueOptions = map[string]bool{
+	"-u": true, "-g": true, "-p": true, "-c": true, "-h": true, "-d": true, "-r": true, "-t": true,
+}
+
+// NeedsTerminal guesses whether a command will wait for keyboard input and
+// should therefore run interactively instead of with captured output
+func NeedsTerminal(command string) bool {
+	fields := strings.Fields(strings.ToLower(strings.TrimSpace(command)))
+	if len(fields) == 0 {
+		return false
+	}
+
+	program := strings.TrimSuffix(fields[0], ".exe")
+	if program == "sudo" {
+		// sudo's password is asked for separately; what it runs decides
+		return sudoNeedsTerminal(fields[1:])
+	}
+	if interactivePrograms[program] {
+		return true
+	}
+	if replPrograms[program] && len(fields) == 1 {
+		return true
+	}
+
+	// git commit without a message opens an editor
+	if program == "git" && len(fields) >= 2 && fields[1] == "commit" {
+		for _, f := range fields[2:] {
+			switch {
+			case strings.HasPrefix(f, "--message"), strings.HasPrefix(f, "--file"),
+				f == "--no-edit", strings.HasPrefix(f, "--fixup"):
+				return false
+			case strings.HasPrefix(f, "-") && !strings.HasPrefix(f, "--") &&
+				strings.ContainsAny(f[1:], "mf"): // -m, -am, -F (lowercased)
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// sudoNeedsTerminal is NeedsTerminal for the arguments of sudo: a shell
+// started without a command (sudo -i, sudo -s, sudo su) needs one, and so
+// does a command that would without sudo
+func sudoNeedsTerminal(args []string) bool {
+	shell := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		arg := args[0]
+		args = args[1:]
+		switch {
+		case arg == "--":
+			return len(args) > 0 && NeedsTerminal(strings.Join(args, " "))
+		case arg == "-i" || arg == "-s" || arg == "--login" || arg == "--shell":
+			shell = true
+		case sudoValueOptions[arg] && len(args) > 0:
+			args = args[1:]
+		}
+	}
+	if len(args) == 0 {
+		return shell
+	}
+	return NeedsTerminal(strings.Join(args, " "))
+}
+
+// teeBuffer is a goroutine-safe buffer for captured terminal output
+type teeBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *teeBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *teeBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
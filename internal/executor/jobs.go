@@ -0,0 +1,282 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"shell-e/internal/logger"
+)
+
+// JobStatus is the state of a background job
+type JobStatus int
+
+const (
+	JobRunning JobStatus = iota
+	JobDone              // Exited successfully
+	JobFailed            // Exited with an error
+	JobKilled            // Stopped with Kill
+)
+
+func (s JobStatus) String() string {
+	switch s {
+	case JobRunning:
+		return "running"
+	case JobDone:
+		return "done"
+	case JobFailed:
+		return "failed"
+	case JobKilled:
+		return "killed"
+	}
+	return "unknown"
+}
+
+// maxJobLines bounds the output kept per job; older lines are dropped
+const maxJobLines = 2000
+
+// Job is a command running in the background. It has no timeout: it runs
+// until it exits or is killed, and its output is kept in a bounded buffer.
+type Job struct {
+	ID      int
+	Command string
+	Shell   string
+	Started time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{} // Closed when the command has finished
+
+	mu        sync.Mutex
+	status    JobStatus
+	result    *Result
+	lines     []string
+	partial   [2]partialLine // Per stream (stdout, stderr)
+	killed    bool
+	listeners map[int]chan OutputLine
+	nextLis   int
+}
+
+// partialLine is a job's last line from one stream if it ended with \r,
+// so the stream's next line overwrites it
+type partialLine struct {
+	ok    bool
+	index int // In lines
+}
+
+// StartJob runs command in the background and returns immediately. Jobs
+// always get a fresh process, even in persistent mode.
+func (e *Executor) StartJob(command, shell string) *Job {
+	return e.StartJobWithOptions(command, shell, ExecOptions{})
+}
+
+// StartJobWithOptions is StartJob with per-call options such as a sudo
+// password. The job's own context, output, timeout and session settings
+// replace any given.
+func (e *Executor) StartJobWithOptions(command, shell string, opts ExecOptions) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	e.jobsMu.Lock()
+	e.nextJobID++
+	job := &Job{
+		ID:      e.nextJobID,
+		Command: command,
+		Shell:   shell,
+		Started: time.Now(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	e.jobs = append(e.jobs, job)
+	e.jobsMu.Unlock()
+
+	logger.Info("Starting job [%d]: %s (shell: %s)", job.ID, command, shell)
+	opts.job = &jobState{dir: e.WorkingDir, env: e.environ()}
+	go func() {
+		defer cancel()
+		opts.Context = ctx
+		opts.OnOutput = job.append
+		opts.NoTimeout = true
+		opts.NoSession = true
+		opts.Timeout = 0
+		opts.Deadline = nil
+		result := e.ExecuteWithOptions(command, shell, opts)
+		job.finish(result)
+		logger.Info("Job [%d] %s: %s", job.ID, job.Status(), command)
+	}()
+
+	return job
+}
+
+// Jobs lists all jobs started so far, oldest first
+func (e *Executor) Jobs() []*Job {
+	e.jobsMu.Lock()
+	defer e.jobsMu.Unlock()
+	jobs := make([]*Job, len(e.jobs))
+	copy(jobs, e.jobs)
+	return jobs
+}
+
+// Job finds a job by ID
+func (e *Executor) Job(id int) (*Job, bool) {
+	e.jobsMu.Lock()
+	defer e.jobsMu.Unlock()
+	for _, job := range e.jobs {
+		if job.ID == id {
+			return job, true
+		}
+	}
+	return nil, false
+}
+
+// killJobs stops every running job and waits for them to finish
+func (e *Executor) killJobs() {
+	for _, job := range e.Jobs() {
+		if job.Kill() {
+			<-job.Done()
+		}
+	}
+}
+
+// Status reports whether the job is still running and how it ended
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// Done is closed when the job has finished
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Result returns the final outcome, or nil while the job is running
+func (j *Job) Result() *Result {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.result
+}
+
+// Tail returns up to n of the most recent output lines (all if n <= 0)
+func (j *Job) Tail(n int) []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	lines := j.lines
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	out := make([]string, len(lines))
+	copy(out, lines)
+	return out
+}
+
+// Kill stops the job and everything it spawned. Returns false if the job
+// had already finished.
+func (j *Job) Kill() bool {
+	j.mu.Lock()
+	if j.status != JobRunning {
+		j.mu.Unlock()
+		return false
+	}
+	j.killed = true
+	j.mu.Unlock()
+
+	j.cancel()
+	return true
+}
+
+// Follow delivers output lines produced from now on, for bringing a job to
+// the foreground. The channel is closed when the job finishes or stop is
+// called. Slow readers miss lines rather than stall the job.
+func (j *Job) Follow() (lines <-chan OutputLine, stop func()) {
+	ch := make(chan OutputLine, 256)
+
+	j.mu.Lock()
+	if j.status != JobRunning {
+		j.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if j.listeners == nil {
+		j.listeners = make(map[int]chan OutputLine)
+	}
+	id := j.nextLis
+	j.nextLis++
+	j.listeners[id] = ch
+	j.mu.Unlock()
+
+	return ch, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if l, ok := j.listeners[id]; ok {
+			delete(j.listeners, id)
+			close(l)
+		}
+	}
+}
+
+// Runtime is how long the job has been (or was) running
+func (j *Job) Runtime() time.Duration {
+	if r := j.Result(); r != nil {
+		return r.Duration
+	}
+	return time.Since(j.Started)
+}
+
+// String formats the job for a job listing
+func (j *Job) String() string {
+	return fmt.Sprintf("[%d] %-7s %6.0fs  %s", j.ID, j.Status(), j.Runtime().Seconds(), j.Command)
+}
+
+// append records one output line, called from the output goroutines
+func (j *Job) append(line OutputLine) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	stream := 0
+	if line.Stderr {
+		stream = 1
+	}
+	index := len(j.lines)
+	if p := j.partial[stream]; p.ok && p.index < len(j.lines) {
+		index = p.index
+		j.lines[index] = line.Text
+	} else {
+		j.lines = append(j.lines, line.Text)
+	}
+	j.partial[stream] = partialLine{ok: line.Partial, index: index}
+
+	if drop := len(j.lines) - maxJobLines; drop > 0 {
+		j.lines = j.lines[drop:]
+		for i := range j.partial {
+			j.partial[i].index -= drop
+			j.partial[i].ok = j.partial[i].ok && j.partial[i].index >= 0
+		}
+	}
+
+	for _, l := range j.listeners {
+		select {
+		case l <- line:
+		default:
+		}
+	}
+}
+
+// finish records the result and wakes everyone waiting on the job
+func (j *Job) finish(result *Result) {
+	j.mu.Lock()
+	j.result = result
+	switch {
+	case j.killed:
+		j.status = JobKilled
+	case result.Success:
+		j.status = JobDone
+	default:
+		j.status = JobFailed
+	}
+	for id, l := range j.listeners {
+		close(l)
+		delete(j.listeners, id)
+	}
+	j.mu.Unlock()
+	close(j.done)
+}
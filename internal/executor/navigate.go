@@ -0,0 +1,197 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"shell-e/internal/workspace"
+)
+
+// expandPath resolves a leading ~ and the environment variable references
+// written in vars' syntax, as the session's environment defines them
+func (e *Executor) expandPath(path string, vars workspace.Vars) string {
+	return workspace.ExpandPath(path, vars, e.lookupEnv)
+}
+
+// splitChain splits off the first statement of a command chained with
+// &&, || or ; (or a newline), ignoring separators inside quotes. sep is
+// "" when command is a single statement.
+func splitChain(command string) (first, sep, rest string) {
+	var quote byte
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ';' || c == '\n':
+			return strings.TrimSpace(command[:i]), ";", strings.TrimSpace(command[i+1:])
+		case (c == '&' || c == '|') && i+1 < len(command) && command[i+1] == c:
+			return strings.TrimSpace(command[:i]), command[i : i+2], strings.TrimSpace(command[i+2:])
+		}
+	}
+	return strings.TrimSpace(command), "", ""
+}
+
+// navigation is a parsed cd, pushd or popd statement
+type navigation struct {
+	cd    bool // cd (as opposed to the directory stack)
+	stack DirStackOp
+	dir   string         // cd target as written
+	vars  workspace.Vars // The variables the shell expands in targets
+}
+
+// parseNavigation detects a statement that changes directory
+func parseNavigation(sh Shell, statement string) (navigation, bool) {
+	if dir, ok := sh.ParseCD(statement); ok {
+		return navigation{cd: true, dir: dir, vars: pathVars(sh)}, true
+	}
+	if op, ok := sh.ParseDirStack(statement); ok {
+		return navigation{stack: op, vars: pathVars(sh)}, true
+	}
+	return navigation{}, false
+}
+
+// navigate carries out a parsed directory change natively, since a cd in
+// a subprocess can't move the executor
+func (e *Executor) navigate(nav navigation, start time.Time) *Result {
+	switch {
+	case nav.cd:
+		return e.handleCD(nav.dir, nav.vars, start)
+	case nav.stack.Pop:
+		return e.popDir(start)
+	}
+	return e.pushDir(nav.stack.Target, nav.vars, start)
+}
+
+// executeChained runs "cd dir && rest" style commands: the directory
+// change is made natively, then the rest runs in the new directory if the
+// separator allows it (&& after success, || after failure, ; always)
+func (e *Executor) executeChained(nav navigation, sep, rest, shell string, opts ExecOptions, start time.Time) *Result {
+	navResult := e.navigate(nav, start)
+	if (sep == "&&" && !navResult.Success) || (sep == "||" && navResult.Success) {
+		return navResult
+	}
+
+	result := e.execute(rest, shell, opts)
+	if result.NewWorkDir == "" && navResult.NewWorkDir != "" {
+		result.NewWorkDir = navResult.NewWorkDir
+	}
+	if !navResult.Success {
+		result.Output = strings.TrimLeft(navResult.Error+"\n"+result.Output, "\n")
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// handleCD changes the executor's working directory natively.
+// This is necessary because cd/Set-Location in a subprocess doesn't
+// affect the parent process. "-" returns to the previous directory.
+func (e *Executor) handleCD(target string, vars workspace.Vars, start time.Time) *Result {
+	if target == "-" {
+		if e.prevDir == "" {
+			return navFailure("No previous directory", e.WorkingDir, start)
+		}
+		return e.changeDir(e.prevDir, e.prevDir, start)
+	}
+	return e.changeDir(target, e.expandPath(target, vars), start)
+}
+
+// pushDir saves the working directory on the stack and changes to target
+func (e *Executor) pushDir(target string, vars workspace.Vars, start time.Time) *Result {
+	from := e.WorkingDir
+	result := e.changeDir(target, e.expandPath(target, vars), start)
+	if result.Success {
+		e.dirStack = append(e.dirStack, from)
+		e.appendStack(result)
+	}
+	return result
+}
+
+// popDir returns to the most recently pushed directory
+func (e *Executor) popDir(start time.Time) *Result {
+	if len(e.dirStack) == 0 {
+		return navFailure("Directory stack is empty", e.WorkingDir, start)
+	}
+	top := e.dirStack[len(e.dirStack)-1]
+	result := e.changeDir(top, top, start)
+	if result.Success {
+		e.dirStack = e.dirStack[:len(e.dirStack)-1]
+		e.appendStack(result)
+	}
+	return result
+}
+
+// appendStack lists the remaining stack under a pushd/popd result, most
+// recent first, as the dirs builtin does
+func (e *Executor) appendStack(result *Result) {
+	if len(e.dirStack) == 0 {
+		return
+	}
+	dirs := e.DirStack()
+	result.Output += "\nStack: " + strings.Join(dirs, "  ")
+	result.Stdout = result.Output
+}
+
+// DirStack returns the pushd stack, most recent first
+func (e *Executor) DirStack() []string {
+	dirs := make([]string, len(e.dirStack))
+	for i, dir := range e.dirStack {
+		dirs[len(dirs)-1-i] = dir
+	}
+	return dirs
+}
+
+// changeDir resolves dir, the expanded target, against the working
+// directory, checks it, and moves there, remembering the directory it
+// left for cd -. Messages name target as written.
+func (e *Executor) changeDir(target, dir string, start time.Time) *Result {
+	newDir := dir
+	if !filepath.IsAbs(newDir) {
+		newDir = filepath.Join(e.WorkingDir, newDir)
+	}
+	newDir = filepath.Clean(newDir)
+
+	info, err := os.Stat(newDir)
+	if err != nil {
+		return navFailure(fmt.Sprintf("Cannot navigate to '%s': %v", target, err), e.WorkingDir, start)
+	}
+	if !info.IsDir() {
+		return navFailure(fmt.Sprintf("'%s' is not a directory", target), e.WorkingDir, start)
+	}
+	if !e.Roots.Contains(newDir) {
+		return navFailure(fmt.Sprintf("'%s' is outside the allowed workspace (%s)", target, e.Roots), e.WorkingDir, start)
+	}
+
+	if newDir != e.WorkingDir {
+		e.prevDir = e.WorkingDir
+	}
+	e.WorkingDir = newDir
+
+	output := fmt.Sprintf("Directory: %s", newDir)
+	return &Result{
+		Success:        true,
+		Output:         output,
+		Stdout:         output,
+		Duration:       time.Since(start),
+		NewWorkDir:     newDir,
+		CurrentWorkDir: newDir,
+	}
+}
+
+func navFailure(msg, dir string, start time.Time) *Result {
+	return &Result{
+		Success:        false,
+		Error:          msg,
+		Stderr:         msg,
+		ExitCode:       1,
+		Duration:       time.Since(start),
+		CurrentWorkDir: dir,
+	}
+}
@@ -0,0 +1,17 @@
+package executor
+
+import "time"
+
+// KilledProcess identifies a process terminated on timeout or cancel
+type KilledProcess struct {
+	PID  int
+	Name string
+}
+
+// killGrace is how long a process group gets to exit after the polite
+// signal (SIGTERM / CTRL_BREAK) before it is killed outright
+const killGrace = 2 * time.Second
+
+// pipeGrace bounds how long Wait keeps reading output after the shell has
+// exited, in case a detached grandchild still holds the pipes open
+const pipeGrace = 2 * time.Second
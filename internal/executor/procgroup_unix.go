@@ -0,0 +1,135 @@
+//go:build !windows
+
+package executor
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// processGroup runs a command in its own process group so the shell and
+// everything it spawned can be signalled together
+type processGroup struct {
+	cmd *exec.Cmd
+}
+
+// newProcessGroup configures cmd (before Start) to lead a new process group
+func newProcessGroup(cmd *exec.Cmd) *processGroup {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	return &processGroup{cmd: cmd}
+}
+
+// attach is a no-op on Unix: the group exists as soon as the child starts
+func (g *processGroup) attach() error { return nil }
+
+// close releases group resources (none on Unix)
+func (g *processGroup) close() {}
+
+// usage adds nothing on Unix: the rusage in the exit status already covers
+// the children the shell waited for
+func (g *processGroup) usage(r *Result) {}
+
+// stateUsage records the signal that ended a process, if any, and its peak
+// resident memory, which includes every child it waited for
+func stateUsage(state *os.ProcessState, r *Result) {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		r.Signal = ws.Signal().String()
+	}
+	if ru, ok := state.SysUsage().(*syscall.Rusage); ok {
+		peak := int64(ru.Maxrss)
+		if runtime.GOOS != "darwin" && runtime.GOOS != "ios" {
+			peak *= 1024 // Kilobytes everywhere but Apple platforms
+		}
+		r.PeakMemory = peak
+	}
+}
+
+// terminate sends SIGTERM to the whole group, waits up to grace for it to
+// exit, then sends SIGKILL. It returns the processes that were in the group.
+func (g *processGroup) terminate(grace time.Duration) []KilledProcess {
+	if g.cmd.Process == nil {
+		return nil
+	}
+	pgid := g.cmd.Process.Pid
+	procs := groupMembers(pgid)
+
+	syscall.Kill(-pgid, syscall.SIGTERM)
+
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) {
+		if len(groupMembers(pgid)) == 0 {
+			return procs
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	syscall.Kill(-pgid, syscall.SIGKILL)
+	return procs
+}
+
+// groupMembers lists live (non-zombie) processes in a process group
+func groupMembers(pgid int) []KilledProcess {
+	if _, err := os.Stat("/proc/self/stat"); err == nil {
+		return procGroupMembers(pgid)
+	}
+	return psGroupMembers(pgid)
+}
+
+// procGroupMembers scans /proc (Linux)
+func procGroupMembers(pgid int) []KilledProcess {
+	var procs []KilledProcess
+	stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+	for _, path := range stats {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// Format: pid (comm) state ppid pgrp ... — comm may contain spaces
+		open := bytes.IndexByte(data, '(')
+		end := bytes.LastIndexByte(data, ')')
+		if open < 0 || end < open {
+			continue
+		}
+		fields := strings.Fields(string(data[end+1:]))
+		if len(fields) < 3 || fields[0] == "Z" {
+			continue
+		}
+		if pg, _ := strconv.Atoi(fields[2]); pg != pgid {
+			continue
+		}
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data[:open])))
+		procs = append(procs, KilledProcess{PID: pid, Name: string(data[open+1 : end])})
+	}
+	return procs
+}
+
+// psGroupMembers asks ps (macOS and other systems without /proc)
+func psGroupMembers(pgid int) []KilledProcess {
+	out, err := exec.Command("ps", "-A", "-o", "pid=,pgid=,stat=,comm=").Output()
+	if err != nil {
+		return nil
+	}
+	var procs []KilledProcess
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || strings.HasPrefix(fields[2], "Z") {
+			continue
+		}
+		if pg, _ := strconv.Atoi(fields[1]); pg != pgid {
+			continue
+		}
+		pid, _ := strconv.Atoi(fields[0])
+		procs = append(procs, KilledProcess{PID: pid, Name: filepath.Base(strings.Join(fields[3:], " "))})
+	}
+	return procs
+}
@@ -0,0 +1,175 @@
+//go:build windows
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// processGroup puts a command in a job object so the shell and everything
+// it spawned can be terminated together
+type processGroup struct {
+	cmd *exec.Cmd
+	job windows.Handle
+}
+
+// newProcessGroup configures cmd (before Start) to get its own console
+// process group and prepares a job object for it
+func newProcessGroup(cmd *exec.Cmd) *processGroup {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= windows.CREATE_NEW_PROCESS_GROUP
+
+	g := &processGroup{cmd: cmd}
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return g
+	}
+
+	// Closing the last handle kills anything left in the job, so Shell-E
+	// exiting never leaves orphans behind
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)))
+
+	g.job = job
+	return g
+}
+
+// attach assigns the started process to the job. Children spawned after
+// this point are placed in the job automatically.
+func (g *processGroup) attach() error {
+	if g.job == 0 || g.cmd.Process == nil {
+		return nil
+	}
+	h, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE,
+		false, uint32(g.cmd.Process.Pid))
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+	return windows.AssignProcessToJobObject(g.job, h)
+}
+
+// close releases the job handle (killing anything still in it)
+func (g *processGroup) close() {
+	if g.job != 0 {
+		windows.CloseHandle(g.job)
+		g.job = 0
+	}
+}
+
+// terminate sends CTRL_BREAK to the console group, waits up to grace for
+// the job to empty, then terminates the job. It returns the processes that
+// were in the job.
+func (g *processGroup) terminate(grace time.Duration) []KilledProcess {
+	if g.cmd.Process == nil {
+		return nil
+	}
+	procs := g.members()
+
+	windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, uint32(g.cmd.Process.Pid))
+
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) {
+		if len(g.members()) == 0 {
+			return procs
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if g.job != 0 {
+		windows.TerminateJobObject(g.job, 1)
+	} else {
+		g.cmd.Process.Kill()
+	}
+	return procs
+}
+
+// stateUsage adds nothing on Windows: processes have no signals, and
+// memory is read from the job object instead
+func stateUsage(state *os.ProcessState, r *Result) {}
+
+// jobAccounting mirrors JOBOBJECT_BASIC_ACCOUNTING_INFORMATION; times are
+// in 100ns units
+type jobAccounting struct {
+	TotalUserTime             int64
+	TotalKernelTime           int64
+	ThisPeriodTotalUserTime   int64
+	ThisPeriodTotalKernelTime int64
+	TotalPageFaultCount       uint32
+	TotalProcesses            uint32
+	ActiveProcesses           uint32
+	TotalTerminatedProcesses  uint32
+}
+
+// usage records the job's peak committed memory and the CPU time of every
+// process that ran in it, not just the shell. Windows has no signals.
+func (g *processGroup) usage(r *Result) {
+	if g.job == 0 {
+		return
+	}
+	var limits windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+	if windows.QueryInformationJobObject(g.job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&limits)), uint32(unsafe.Sizeof(limits)), nil) == nil {
+		r.PeakMemory = int64(limits.PeakJobMemoryUsed)
+	}
+	var acct jobAccounting
+	if windows.QueryInformationJobObject(g.job, windows.JobObjectBasicAccountingInformation,
+		uintptr(unsafe.Pointer(&acct)), uint32(unsafe.Sizeof(acct)), nil) == nil {
+		r.CPUTime = time.Duration(acct.TotalUserTime+acct.TotalKernelTime) * 100
+	}
+}
+
+// jobProcessList mirrors JOBOBJECT_BASIC_PROCESS_ID_LIST with room for
+// a reasonable number of processes
+type jobProcessList struct {
+	NumberOfAssignedProcesses uint32
+	NumberOfProcessIdsInList  uint32
+	ProcessIdList             [256]uintptr
+}
+
+// members lists the processes currently in the job
+func (g *processGroup) members() []KilledProcess {
+	if g.job == 0 {
+		return []KilledProcess{{PID: g.cmd.Process.Pid}}
+	}
+
+	var list jobProcessList
+	err := windows.QueryInformationJobObject(g.job, windows.JobObjectBasicProcessIdList,
+		uintptr(unsafe.Pointer(&list)), uint32(unsafe.Sizeof(list)), nil)
+	if err != nil {
+		return nil
+	}
+
+	procs := make([]KilledProcess, 0, list.NumberOfProcessIdsInList)
+	for _, pid := range list.ProcessIdList[:list.NumberOfProcessIdsInList] {
+		procs = append(procs, KilledProcess{PID: int(pid), Name: processName(uint32(pid))})
+	}
+	return procs
+}
+
+// processName returns the executable name for a PID, or "" if unavailable
+func processName(pid uint32) string {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return ""
+	}
+	defer windows.CloseHandle(h)
+
+	buf := make([]uint16, windows.MAX_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(h, 0, &buf[0], &size); err != nil {
+		return ""
+	}
+	return filepath.Base(windows.UTF16ToString(buf[:size]))
+}
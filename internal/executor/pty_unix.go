@@ -0,0 +1,75 @@
+//go:build !windows
+
+package executor
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/creack/pty"
+	"github.com/muesli/cancelreader"
+)
+
+// runInTerminal starts cmd in a pseudo-terminal, wires it to the user's
+// terminal and returns everything it printed
+func runInTerminal(cmd *exec.Cmd, stdin io.Reader, stdout, stderr io.Writer) (string, error) {
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return "", err
+	}
+	defer ptmx.Close()
+
+	// Keep the child's window size in sync with ours
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer func() {
+		signal.Stop(winch)
+		close(winch)
+	}()
+	go func() {
+		for range winch {
+			pty.InheritSize(os.Stdin, ptmx)
+		}
+	}()
+	pty.InheritSize(os.Stdin, ptmx)
+
+	// Raw mode: the child's pty does line editing and echo now
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(f.Fd()) {
+		if state, err := term.MakeRaw(f.Fd()); err == nil {
+			defer term.Restore(f.Fd(), state)
+		}
+	}
+
+	// The stdin copy must be cancelable, otherwise it would stay blocked
+	// on a read after the child exits and swallow the first keystroke
+	// meant for the TUI
+	if in, err := cancelreader.NewReader(stdin); err == nil {
+		defer in.Cancel()
+		go io.Copy(ptmx, in)
+	} else {
+		go io.Copy(ptmx, stdin)
+	}
+
+	var captured teeBuffer
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(io.MultiWriter(stdout, &captured), ptmx)
+		close(copied)
+	}()
+
+	err = cmd.Wait()
+
+	// Drain remaining output, but don't hang if a grandchild still holds
+	// the terminal open
+	select {
+	case <-copied:
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	return captured.String(), err
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package executor
+
+import (
+	"io"
+	"os/exec"
+)
+
+// runInTerminal runs cmd directly on the console. Windows has no pty in the
+// standard toolchain, so the child owns the console outright and its output
+// is not captured.
+func runInTerminal(cmd *exec.Cmd, stdin io.Reader, stdout, stderr io.Writer) (string, error) {
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return "", cmd.Run()
+}
@@ -0,0 +1,409 @@
+package executor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/encoding"
+
+	"shell-e/internal/logger"
+)
+
+// SessionShell is implemented by shells that can run as one long-lived
+// process reading commands from stdin. Shells without it (cmd) always run
+// one process per command.
+type SessionShell interface {
+	// SessionCommandLine starts a non-interactive shell reading from stdin
+	SessionCommandLine() (string, []string)
+
+	// FrameCommand wraps command so that, once it finishes, the shell prints
+	// a line "<sentinel> <exit code> <cwd>" on stdout. If dir is non-empty
+	// the shell must change to it first. Stdin of command must not be the
+	// session's own stdin, or it would swallow the following frames.
+	FrameCommand(command, dir, sentinel string) string
+}
+
+// Session is one long-lived shell process. Commands run in it one at a time,
+// so environment variables, aliases, functions and activated virtualenvs
+// carry over from one command to the next.
+type Session struct {
+	shell   Shell
+	ss      SessionShell
+	environ func() []string   // Environment for a newly started shell
+	enc     encoding.Encoding // Output that isn't UTF-8 is decoded from this
+
+	mu     sync.Mutex // One command at a time
+	cmd    *exec.Cmd
+	group  *processGroup
+	stdin  io.WriteCloser
+	lines  chan OutputLine // Closed when the shell's output ends
+	exited chan struct{}   // Closed when the shell process exits
+	cwd    string          // Shell's cwd as of the last command
+}
+
+func newSession(sh Shell, ss SessionShell, environ func() []string, enc encoding.Encoding) *Session {
+	return &Session{shell: sh, ss: ss, environ: environ, enc: enc}
+}
+
+// alive reports whether the shell process is still running
+func (s *Session) alive() bool {
+	if s.cmd == nil {
+		return false
+	}
+	select {
+	case <-s.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// start launches the shell process in dir
+func (s *Session) start(dir string) error {
+	name, args := s.ss.SessionCommandLine()
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = s.environ()
+
+	// stdout and stderr share one pipe so output stays in order
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		pr.Close()
+		pw.Close()
+		return err
+	}
+
+	group := newProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		pr.Close()
+		pw.Close()
+		group.close()
+		return err
+	}
+	pw.Close()
+	if err := group.attach(); err != nil {
+		logger.Error("Could not attach session process group: %v", err)
+	}
+
+	lines := make(chan OutputLine, 256)
+	go func() {
+		lw := newLineWriter(false, func(l OutputLine) { lines <- l })
+		lw.enc = s.enc
+		io.Copy(lw, pr)
+		lw.Close()
+		pr.Close()
+		close(lines)
+	}()
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	s.cmd = cmd
+	s.group = group
+	s.stdin = stdin
+	s.lines = lines
+	s.exited = exited
+	s.cwd = dir
+	logger.Info("Started %s session (PID: %d)", s.shell.Name(), cmd.Process.Pid)
+	return nil
+}
+
+// stop terminates the shell and everything it started
+func (s *Session) stop() []KilledProcess {
+	if s.cmd == nil {
+		return nil
+	}
+	s.stdin.Close()
+	var killed []KilledProcess
+	if s.alive() {
+		killed = s.group.terminate(killGrace)
+	}
+	s.group.close()
+	s.cmd = nil
+	return killed
+}
+
+// Close shuts the session down
+func (s *Session) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
+}
+
+// drain discards output printed between commands (e.g. by background jobs)
+func (s *Session) drain() {
+	for {
+		select {
+		case _, ok := <-s.lines:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// sessionResult is the raw outcome of one framed command
+type sessionResult struct {
+	output   string
+	exitCode int
+	cwd      string
+	killed   []KilledProcess
+}
+
+// Run executes command in the session, starting (or restarting) the shell
+// in dir if needed. Lines are passed to onLine as they arrive.
+func (s *Session) Run(ctx context.Context, command, dir string, onLine func(OutputLine)) (*sessionResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.alive() {
+		if s.cmd != nil {
+			logger.Error("%s session died — respawning", s.shell.Name())
+			s.stop()
+		}
+		if err := s.start(dir); err != nil {
+			return nil, fmt.Errorf("could not start %s session: %w", s.shell.Name(), err)
+		}
+	}
+	s.drain()
+
+	// Only change directory when the executor's view differs from the
+	// shell's, so `cd -` and OLDPWD keep working inside the session
+	cdTo := ""
+	if dir != "" && dir != s.cwd {
+		cdTo = dir
+	}
+
+	sentinel := newSentinel()
+	if _, err := io.WriteString(s.stdin, s.ss.FrameCommand(command, cdTo, sentinel)); err != nil {
+		s.stop()
+		return nil, fmt.Errorf("%s session is not accepting input: %w", s.shell.Name(), err)
+	}
+
+	var out []string
+	partial := false
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				// The shell exited mid-command (e.g. the command ran `exit`)
+				s.stop()
+				return &sessionResult{output: joinLines(out), exitCode: -1, cwd: s.cwd},
+					fmt.Errorf("%s session exited", s.shell.Name())
+			}
+
+			if !line.Partial && strings.HasPrefix(line.Text, sentinel+" ") {
+				code, cwd := parseSentinel(line.Text[len(sentinel)+1:])
+				if cwd != "" {
+					s.cwd = cwd
+				}
+				// The frame prints a newline before the sentinel in case the
+				// output didn't end with one; drop the resulting blank line
+				if n := len(out); n > 0 && out[n-1] == "" {
+					out = out[:n-1]
+				}
+				return &sessionResult{output: joinLines(out), exitCode: code, cwd: s.cwd}, nil
+			}
+
+			if partial && len(out) > 0 {
+				out[len(out)-1] = line.Text
+			} else {
+				out = append(out, line.Text)
+			}
+			partial = line.Partial
+			if onLine != nil {
+				onLine(line)
+			}
+
+		case <-ctx.Done():
+			// There is no reliable way to interrupt just the current command,
+			// so the whole session goes; the next command respawns it
+			killed := s.stop()
+			return &sessionResult{output: joinLines(out), exitCode: -1, cwd: s.cwd, killed: killed}, ctx.Err()
+		}
+	}
+}
+
+func joinLines(lines []string) string {
+	return strings.Join(lines, "\n")
+}
+
+// parseSentinel splits "<exit code> <cwd>" (cwd may contain spaces)
+func parseSentinel(rest string) (int, string) {
+	codeStr, cwd, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	code, err := strconv.Atoi(codeStr)
+	if err != nil {
+		code = -1
+	}
+	return code, strings.TrimSpace(cwd)
+}
+
+// newSentinel returns a marker that cannot plausibly appear in real output
+func newSentinel() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "__SHELLE_DONE_" + hex.EncodeToString(b) + "__"
+}
+
+// session returns the persistent session for sh, creating it on first use.
+// Returns nil if the shell does not support sessions.
+func (e *Executor) session(sh Shell) *Session {
+	ss, ok := sh.(SessionShell)
+	if !ok {
+		return nil
+	}
+
+	e.sessionsMu.Lock()
+	defer e.sessionsMu.Unlock()
+	if e.sessions == nil {
+		e.sessions = make(map[string]*Session)
+	}
+	sess, ok := e.sessions[sh.Name()]
+	if !ok {
+		sess = newSession(sh, ss, e.environ, e.outputEncoding())
+		e.sessions[sh.Name()] = sess
+	}
+	return sess
+}
+
+// executeInSession runs command in the persistent session for sh
+func (e *Executor) executeInSession(sess *Session, command string, sh Shell, opts ExecOptions, start time.Time) *Result {
+	e.ensureWorkingDir()
+	snapshotID, notSaved := e.snapshot(sh, command, e.WorkingDir)
+
+	ctx, deadline, cancel := e.commandContext(command, opts)
+	defer cancel()
+
+	run, rewritten := command, false
+	if !opts.plain {
+		run, rewritten = e.structuredCommand(sh, command)
+	}
+	onLine := opts.OnOutput
+	if rewritten && onLine != nil {
+		// JSON asked for behind the user's back isn't shown live
+		onLine = func(l OutputLine) {
+			if l.Stderr {
+				opts.OnOutput(l)
+			}
+		}
+	}
+	res, err := sess.Run(ctx, run, e.WorkingDir, onLine)
+	duration := time.Since(start)
+
+	if res == nil {
+		logger.Error("Session command failed: %s (err: %v)", command, err)
+		return &Result{
+			Success:        false,
+			Error:          err.Error(),
+			ExitCode:       -1,
+			Duration:       duration,
+			CurrentWorkDir: e.WorkingDir,
+			SnapshotID:     snapshotID,
+			NotSnapshotted: notSaved,
+		}
+	}
+
+	output := cleanTerminalOutput(trimOutput(res.output))
+	result := &Result{
+		Output:         output,
+		Stdout:         output,
+		ExitCode:       res.exitCode,
+		Duration:       duration,
+		CurrentWorkDir: e.WorkingDir,
+		Killed:         res.killed,
+		SnapshotID:     snapshotID,
+		NotSnapshotted: notSaved,
+	}
+
+	// Adopt the shell's real cwd, which any command may have changed. A
+	// cwd outside the allowed roots is not adopted, so the next command
+	// moves the shell back.
+	outside := false
+	if res.cwd != "" && res.cwd != e.WorkingDir {
+		if e.Roots.Contains(res.cwd) {
+			e.WorkingDir = res.cwd
+			result.NewWorkDir = res.cwd
+			result.CurrentWorkDir = res.cwd
+		} else {
+			outside = true
+		}
+	}
+
+	switch {
+	case outside && ctx.Err() == nil:
+		result.Error = fmt.Sprintf("'%s' is outside the allowed workspace (%s); staying in %s", res.cwd, e.Roots, e.WorkingDir)
+		logger.Error("Refused to follow session into %s: %s", res.cwd, command)
+	case ctx.Err() != nil:
+		result.TimedOut = deadline.Expired()
+		result.Cancelled = !result.TimedOut
+		result.Error = "Command cancelled"
+		if result.TimedOut {
+			result.Error = fmt.Sprintf("Command timed out after %v", deadline.Timeout())
+		}
+		logger.Error("%s: %s (session restarted)", result.Error, command)
+	case err != nil:
+		result.Error = err.Error() + " — a new session will be started"
+		logger.Error("Session command failed: %s (err: %v)", command, err)
+	case res.exitCode != 0:
+		switch sh.ClassifyExit(command, res.exitCode) {
+		case ExitNoMatch:
+			result.Error = "No matches found"
+		case ExitCommandNotFound:
+			result.Error = "Command not found"
+		default:
+			result.Error = fmt.Sprintf("exit status %d", res.exitCode)
+		}
+		logger.Error("Command failed: %s (exit: %d)", command, res.exitCode)
+	default:
+		result.Success = true
+		logger.Info("Command success: %s", command)
+	}
+
+	if !e.structure(result, rewritten) && rewritten && result.Success {
+		// Not a table after all: show the command's normal output instead
+		logger.Info("No table in structured output, running as written: %s", command)
+		opts.plain = true
+		return e.executeInSession(sess, command, sh, opts, time.Now())
+	}
+	return result
+}
+
+// Close shuts down persistent shell sessions, kills background jobs and
+// disconnects from remote targets
+func (e *Executor) Close() {
+	e.CloseSessions()
+	e.killJobs()
+	e.closeTargets()
+}
+
+// CloseSessions shuts down any persistent shell sessions. The next command
+// starts a fresh one.
+func (e *Executor) CloseSessions() {
+	e.sessionsMu.Lock()
+	defer e.sessionsMu.Unlock()
+	for name, sess := range e.sessions {
+		sess.Close()
+		delete(e.sessions, name)
+	}
+}
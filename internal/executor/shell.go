@@ -0,0 +1,206 @@
+package executor
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"shell-e/internal/workspace"
+)
+
+// ExitClass categorizes a non-zero exit code
+type ExitClass int
+
+const (
+	ExitFailure         ExitClass = iota // Ordinary failure
+	ExitNoMatch                          // Search ran fine but found nothing (grep, findstr)
+	ExitCommandNotFound                  // The program itself does not exist
+)
+
+// Shell encapsulates everything the executor needs to know about a shell's
+// syntax. Implementations are registered by name with RegisterShell so new
+// shells can be added without touching Execute.
+type Shell interface {
+	// Name is the canonical registry name, e.g. "powershell" or "bash"
+	Name() string
+
+	// CommandLine returns the program and arguments that run command
+	CommandLine(command string) (string, []string)
+
+	// Quote quotes a single argument so the shell passes it through literally
+	Quote(arg string) string
+
+	// ParseCD detects a directory change command and returns its target
+	// as written: "~" for a bare cd that goes home, "-" for the previous
+	// directory. Returns ("", false) if command is not a directory change.
+	ParseCD(command string) (string, bool)
+
+	// ParseDirStack detects pushd <dir> and popd (Push-Location and
+	// Pop-Location in PowerShell)
+	ParseDirStack(command string) (DirStackOp, bool)
+
+	// ClassifyExit explains what a non-zero exit code means for command
+	ClassifyExit(command string, exitCode int) ExitClass
+
+	// SetEnv returns a statement that sets an environment variable
+	SetEnv(name, value string) string
+
+	// ParseEnv detects a command that only sets or removes environment
+	// variables and returns the changes. lookup resolves variables
+	// referenced in values (e.g. PATH=$PATH:/opt/bin).
+	ParseEnv(command string, lookup func(string) string) ([]EnvChange, bool)
+
+	// ModifiedPaths lists the paths a single statement would delete,
+	// overwrite or create (rm, Remove-Item, a copy's destination, output
+	// redirects), as written, so they can be snapshotted for undo
+	ModifiedPaths(statement string) []Modification
+}
+
+// EnvChange is one environment variable assignment or removal
+type EnvChange struct {
+	Name  string
+	Value string
+	Unset bool
+}
+
+// DirStackOp is a pushd (Target set) or popd (Pop) statement
+type DirStackOp struct {
+	Pop    bool
+	Target string
+}
+
+// Modification is a path a command changes, as written in the command
+type Modification struct {
+	Path string
+	// Sources are copied or moved to Path. If Path is an existing directory
+	// they land inside it, so only those names change.
+	Sources []string
+}
+
+// InteractiveShell is implemented by shells that need a different command
+// line when attached to a terminal (e.g. PowerShell's -NonInteractive)
+type InteractiveShell interface {
+	InteractiveCommandLine(command string) (string, []string)
+}
+
+// StructuredShell is implemented by shells that can be asked for
+// machine-readable output, e.g. by piping PowerShell objects through
+// ConvertTo-Json. It returns false for commands that shouldn't be changed.
+type StructuredShell interface {
+	StructuredCommand(command string) (string, bool)
+}
+
+// UTF8Shell is implemented by shells whose output is in a legacy code
+// page unless switched to UTF-8 (PowerShell 5, cmd). UTF8Command makes
+// the command switch first.
+type UTF8Shell interface {
+	UTF8Command(command string) string
+}
+
+// VarShell is implemented by shells that say which variable syntaxes
+// they expand in a path; paths for other shells expand every syntax
+type VarShell interface {
+	PathVars() workspace.Vars
+}
+
+// pathVars is the variable syntax sh expands in a path
+func pathVars(sh Shell) workspace.Vars {
+	if vs, ok := sh.(VarShell); ok {
+		return vs.PathVars()
+	}
+	return workspace.AllVars
+}
+
+var (
+	shellsMu sync.RWMutex
+	shells   = map[string]Shell{}
+)
+
+// RegisterShell makes a shell available under its name and any aliases.
+// Registering an existing name replaces the previous implementation.
+func RegisterShell(s Shell, aliases ...string) {
+	shellsMu.Lock()
+	defer shellsMu.Unlock()
+	shells[strings.ToLower(s.Name())] = s
+	for _, alias := range aliases {
+		shells[strings.ToLower(alias)] = s
+	}
+}
+
+// LookupShell finds a registered shell by name or alias (case-insensitive)
+func LookupShell(name string) (Shell, bool) {
+	shellsMu.RLock()
+	defer shellsMu.RUnlock()
+	s, ok := shells[strings.ToLower(strings.TrimSpace(name))]
+	return s, ok
+}
+
+// ShellNames lists every registered name and alias in sorted order
+func ShellNames() []string {
+	shellsMu.RLock()
+	defer shellsMu.RUnlock()
+	names := make([]string, 0, len(shells))
+	for name := range shells {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveShell returns the named shell, falling back to PowerShell for
+// unknown names to match the historical default
+func resolveShell(name string) Shell {
+	if s, ok := LookupShell(name); ok {
+		return s
+	}
+	s, _ := LookupShell("powershell")
+	return s
+}
+
+// parseCDPrefix matches command against "<prefix> <target>" for each prefix
+// (case-insensitive) and returns the cleaned target
+func parseCDPrefix(command string, prefixes ...string) (string, bool) {
+	cmd := strings.TrimSpace(command)
+	lower := strings.ToLower(cmd)
+
+	for _, prefix := range prefixes {
+		p := prefix + " "
+		if strings.HasPrefix(lower, p) {
+			return cleanPathArg(cmd[len(p):]), true
+		}
+	}
+	return "", false
+}
+
+// isBareCommand reports whether command is just one of names, with no
+// arguments (case-insensitive)
+func isBareCommand(command string, names ...string) bool {
+	cmd := strings.ToLower(strings.TrimSpace(command))
+	for _, name := range names {
+		if cmd == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDirStack matches "<push> <target>" and a bare "<pop>" for each of
+// the given command names
+func parseDirStack(command string, push, pop []string) (DirStackOp, bool) {
+	if isBareCommand(command, pop...) {
+		return DirStackOp{Pop: true}, true
+	}
+	if target, ok := parseCDPrefix(command, push...); ok && target != "" {
+		return DirStackOp{Target: target}, true
+	}
+	return DirStackOp{}, false
+}
+
+// isSearchCommand reports whether command runs a tool whose exit code 1
+// means "no matches" rather than an error
+func isSearchCommand(command string) bool {
+	lower := strings.ToLower(command)
+	return strings.Contains(lower, "select-string") ||
+		strings.Contains(lower, "grep") ||
+		strings.Contains(lower, "findstr")
+}
@@ -0,0 +1,349 @@
+package executor
+
+import (
+	"strings"
+
+	"shell-e/internal/workspace"
+)
+
+func init() {
+	RegisterShell(powerShell{}, "pwsh")
+	RegisterShell(cmdShell{})
+	RegisterShell(posixShell{name: "bash"})
+	RegisterShell(posixShell{name: "zsh"})
+	RegisterShell(posixShell{name: "sh"})
+	RegisterShell(fishShell{})
+}
+
+// --- PowerShell ---
+
+type powerShell struct{}
+
+func (powerShell) Name() string { return "powershell" }
+
+func (powerShell) PathVars() workspace.Vars { return workspace.EnvVars | workspace.DollarVars }
+
+func (powerShell) CommandLine(command string) (string, []string) {
+	return "powershell", []string{
+		"-NoProfile",
+		"-NonInteractive",
+		"-Command", command,
+	}
+}
+
+// InteractiveCommandLine drops -NonInteractive so Read-Host and
+// confirmation prompts work when the user has the terminal
+func (powerShell) InteractiveCommandLine(command string) (string, []string) {
+	return "powershell", []string{
+		"-NoProfile",
+		"-Command", command,
+	}
+}
+
+// Quote uses single quotes, which PowerShell never expands; embedded
+// single quotes are escaped by doubling
+func (powerShell) Quote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", "''") + "'"
+}
+
+func (powerShell) ParseCD(command string) (string, bool) {
+	if isBareCommand(command, "cd", "sl", "chdir", "set-location") {
+		return "~", true
+	}
+	if target, ok := parseCDPrefix(command, "cd", "sl", "chdir"); ok {
+		return target, true
+	}
+
+	// "Set-Location 'path'" or "Set-Location -Path 'path'"
+	cmd := strings.TrimSpace(command)
+	if strings.HasPrefix(strings.ToLower(cmd), "set-location ") {
+		rest := strings.TrimSpace(cmd[13:])
+		// Handle -Path / -LiteralPath parameter
+		lowerRest := strings.ToLower(rest)
+		for _, param := range []string{"-path ", "-literalpath "} {
+			if strings.HasPrefix(lowerRest, param) {
+				rest = strings.TrimSpace(rest[len(param):])
+				break
+			}
+		}
+		return cleanPathArg(rest), true
+	}
+
+	return "", false
+}
+
+func (powerShell) ParseDirStack(command string) (DirStackOp, bool) {
+	op, ok := parseDirStack(command,
+		[]string{"pushd", "push-location -path", "push-location -literalpath", "push-location"},
+		[]string{"popd", "pop-location"})
+	return op, ok
+}
+
+func (powerShell) ClassifyExit(command string, exitCode int) ExitClass {
+	if exitCode == 1 && isSearchCommand(command) {
+		return ExitNoMatch
+	}
+	return ExitFailure
+}
+
+func (p powerShell) SetEnv(name, value string) string {
+	return "$env:" + name + " = " + p.Quote(value)
+}
+
+func (powerShell) ParseEnv(command string, lookup func(string) string) ([]EnvChange, bool) {
+	return parsePowerShellEnv(command, lookup)
+}
+
+func (powerShell) ModifiedPaths(statement string) []Modification {
+	return modifiedPaths(statement, psFiles)
+}
+
+func (powerShell) StructuredCommand(command string) (string, bool) {
+	return structuredPowerShell(command)
+}
+
+// UTF8Command sets the console encoding PowerShell 5 writes (and reads
+// piped input) with; without a console the setters fail harmlessly
+func (powerShell) UTF8Command(command string) string {
+	return "try { [Console]::OutputEncoding = [Console]::InputEncoding = [System.Text.UTF8Encoding]::new($false) } catch {}; " +
+		"$OutputEncoding = [System.Text.UTF8Encoding]::new($false); " + command
+}
+
+func (powerShell) SessionCommandLine() (string, []string) {
+	return "powershell", []string{
+		"-NoProfile",
+		"-NoLogo",
+		"-NonInteractive",
+		"-Command", "-",
+	}
+}
+
+// FrameCommand runs the command through Invoke-Expression in the global
+// scope so variables and functions persist. Failure is detected from
+// $LASTEXITCODE for native programs and from new $Error entries for
+// cmdlets. A command whose directory is gone doesn't run. The trailing
+// blank line ends the statement for -Command -.
+func (p powerShell) FrameCommand(command, dir, sentinel string) string {
+	var sb strings.Builder
+	sb.WriteString("$global:LASTEXITCODE = 0; $__shelleErrors = $Error.Count; $__shelleOk = $true; ")
+	if dir != "" {
+		sb.WriteString("try { Set-Location -LiteralPath " + p.Quote(dir) + " -ErrorAction Stop } ")
+		sb.WriteString("catch { $__shelleOk = $false; " + p.Quote(notRunMessage(dir)) + "; $_ | Out-String -Stream }; ")
+	}
+	sb.WriteString("if ($__shelleOk) { try { Invoke-Expression " + p.Quote(command) + " 2>&1 | Out-String -Stream -Width 4096 } ")
+	sb.WriteString("catch { $__shelleOk = $false; $_ | Out-String -Stream } }; ")
+	sb.WriteString("if ($Error.Count -gt $__shelleErrors) { $__shelleOk = $false }; ")
+	sb.WriteString("$__shelleCode = if ($LASTEXITCODE) { $LASTEXITCODE } elseif ($__shelleOk) { 0 } else { 1 }; ")
+	sb.WriteString("[Console]::Out.WriteLine(\"`n" + sentinel + " $__shelleCode $($PWD.ProviderPath)\")\n\n")
+	return sb.String()
+}
+
+// --- cmd.exe ---
+
+type cmdShell struct{}
+
+func (cmdShell) Name() string { return "cmd" }
+
+func (cmdShell) PathVars() workspace.Vars { return workspace.PercentVars }
+
+func (cmdShell) CommandLine(command string) (string, []string) {
+	return "cmd", []string{"/C", command}
+}
+
+// UTF8Command switches the console to code page 65001 so built-ins and
+// console programs write UTF-8. & binds loosest, so the rest of the
+// command, chains included, runs as written.
+func (cmdShell) UTF8Command(command string) string {
+	return "chcp 65001 >nul & " + command
+}
+
+// Quote wraps the argument in double quotes; cmd has no escape for an
+// embedded double quote, so it is doubled as most programs expect
+func (cmdShell) Quote(arg string) string {
+	return `"` + strings.ReplaceAll(arg, `"`, `""`) + `"`
+}
+
+func (cmdShell) ParseCD(command string) (string, bool) {
+	target, ok := parseCDPrefix(command, "cd /d", "chdir /d", "cd", "chdir")
+	return target, ok
+}
+
+// ParseDirStack: a bare pushd in cmd lists the stack, so only pushd with
+// a directory is handled
+func (cmdShell) ParseDirStack(command string) (DirStackOp, bool) {
+	return parseDirStack(command, []string{"pushd"}, []string{"popd"})
+}
+
+func (cmdShell) ClassifyExit(command string, exitCode int) ExitClass {
+	switch {
+	case exitCode == 9009:
+		return ExitCommandNotFound
+	case exitCode == 1 && isSearchCommand(command):
+		return ExitNoMatch
+	}
+	return ExitFailure
+}
+
+func (cmdShell) SetEnv(name, value string) string {
+	return `set "` + name + "=" + value + `"`
+}
+
+func (cmdShell) ParseEnv(command string, lookup func(string) string) ([]EnvChange, bool) {
+	return parseCmdEnv(command, lookup)
+}
+
+func (cmdShell) ModifiedPaths(statement string) []Modification {
+	return modifiedPaths(statement, cmdFiles)
+}
+
+// --- POSIX shells (bash, zsh, sh) ---
+
+type posixShell struct {
+	name string
+}
+
+func (s posixShell) Name() string { return s.name }
+
+func (posixShell) PathVars() workspace.Vars { return workspace.DollarVars }
+
+func (s posixShell) CommandLine(command string) (string, []string) {
+	return s.name, []string{"-c", command}
+}
+
+// Quote uses single quotes; an embedded single quote closes the string,
+// adds an escaped quote and reopens it
+func (posixShell) Quote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+func (posixShell) ParseCD(command string) (string, bool) {
+	if isBareCommand(command, "cd") {
+		return "~", true
+	}
+	return parseCDPrefix(command, "cd")
+}
+
+func (posixShell) ParseDirStack(command string) (DirStackOp, bool) {
+	return parseDirStack(command, []string{"pushd"}, []string{"popd"})
+}
+
+func (posixShell) ClassifyExit(command string, exitCode int) ExitClass {
+	switch {
+	case exitCode == 127:
+		return ExitCommandNotFound
+	case exitCode == 1 && isSearchCommand(command):
+		return ExitNoMatch
+	}
+	return ExitFailure
+}
+
+func (s posixShell) SetEnv(name, value string) string {
+	return "export " + name + "=" + s.Quote(value)
+}
+
+func (posixShell) ParseEnv(command string, lookup func(string) string) ([]EnvChange, bool) {
+	return parsePosixEnv(command, lookup)
+}
+
+func (posixShell) ModifiedPaths(statement string) []Modification {
+	return modifiedPaths(statement, posixFiles)
+}
+
+func (s posixShell) SessionCommandLine() (string, []string) {
+	switch s.name {
+	case "bash":
+		return "bash", []string{"--noprofile", "--norc"}
+	case "zsh":
+		return "zsh", []string{"-f"}
+	}
+	return s.name, nil
+}
+
+// FrameCommand uses eval so a syntax error in the command fails just that
+// command instead of the whole session, and so cd/export/alias take effect
+// in the session shell itself. A command whose directory is gone doesn't
+// run, rather than running wherever the shell happens to be.
+func (s posixShell) FrameCommand(command, dir, sentinel string) string {
+	var sb strings.Builder
+	if s.name == "bash" {
+		// Non-interactive bash ignores aliases unless asked
+		sb.WriteString("shopt -s expand_aliases 2>/dev/null\n")
+	}
+	eval := "eval " + s.Quote(command) + " </dev/null 2>&1\n"
+	if dir != "" {
+		sb.WriteString("if cd -- " + s.Quote(dir) + " 2>&1; then\n" + eval)
+		sb.WriteString("else echo " + s.Quote(notRunMessage(dir)) + "; false; fi\n")
+	} else {
+		sb.WriteString(eval)
+	}
+	sb.WriteString("printf '\\n%s %d %s\\n' " + s.Quote(sentinel) + ` "$?" "$PWD"` + "\n")
+	return sb.String()
+}
+
+// --- fish ---
+
+type fishShell struct{}
+
+func (fishShell) Name() string { return "fish" }
+
+func (fishShell) PathVars() workspace.Vars { return workspace.DollarVars }
+
+func (fishShell) CommandLine(command string) (string, []string) {
+	return "fish", []string{"--no-config", "-c", command}
+}
+
+// Quote uses single quotes; fish allows \' and \\ inside them
+func (fishShell) Quote(arg string) string {
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	return "'" + strings.ReplaceAll(arg, "'", `\'`) + "'"
+}
+
+func (fishShell) ParseCD(command string) (string, bool) {
+	if isBareCommand(command, "cd") {
+		return "~", true
+	}
+	return parseCDPrefix(command, "cd")
+}
+
+func (fishShell) ParseDirStack(command string) (DirStackOp, bool) {
+	return parseDirStack(command, []string{"pushd"}, []string{"popd"})
+}
+
+func (fishShell) ClassifyExit(command string, exitCode int) ExitClass {
+	switch {
+	case exitCode == 127:
+		return ExitCommandNotFound
+	case exitCode == 1 && isSearchCommand(command):
+		return ExitNoMatch
+	}
+	return ExitFailure
+}
+
+func (f fishShell) SetEnv(name, value string) string {
+	return "set -gx " + name + " " + f.Quote(value)
+}
+
+func (fishShell) ParseEnv(command string, lookup func(string) string) ([]EnvChange, bool) {
+	return parseFishEnv(command, lookup)
+}
+
+func (fishShell) ModifiedPaths(statement string) []Modification {
+	return modifiedPaths(statement, posixFiles)
+}
+
+func (fishShell) SessionCommandLine() (string, []string) {
+	return "fish", []string{"--no-config"}
+}
+
+func (f fishShell) FrameCommand(command, dir, sentinel string) string {
+	var sb strings.Builder
+	eval := "eval " + f.Quote(command) + " </dev/null 2>&1\n"
+	if dir != "" {
+		sb.WriteString("if cd " + f.Quote(dir) + " 2>&1\n" + eval)
+		sb.WriteString("else\necho " + f.Quote(notRunMessage(dir)) + "\nfalse\nend\n")
+	} else {
+		sb.WriteString(eval)
+	}
+	sb.WriteString("printf '\\n%s %d %s\\n' " + f.Quote(sentinel) + " $status $PWD\n")
+	return sb.String()
+}
@@ -0,0 +1,313 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"shell-e/internal/logger"
+)
+
+// sshDialTimeout bounds connecting and authenticating to a host
+const sshDialTimeout = 10 * time.Second
+
+// SSHConfig describes a host to run commands on over SSH
+type SSHConfig struct {
+	Name       string // Shown in the UI; defaults to Host
+	Host       string // host or host:port (port 22 if omitted)
+	User       string // Defaults to the local user
+	KeyFile    string // Private key; without one the SSH agent and ~/.ssh keys are tried
+	KnownHosts string // Defaults to ~/.ssh/known_hosts
+	Dir        string // Where the first command runs; the login directory if empty
+}
+
+// SSHTarget runs commands on a remote host. Each command gets its own SSH
+// session over one shared connection.
+type SSHTarget struct {
+	cfg    SSHConfig
+	config *ssh.ClientConfig
+	addr   string
+	os     string
+	shell  string
+	home   string // Where a login starts
+
+	mu     sync.Mutex
+	client *ssh.Client
+	agent  net.Conn
+}
+
+// DialSSH connects to the host in cfg, checking its key against
+// known_hosts, and finds out which OS and shell it runs. Hosts that are
+// not in known_hosts are refused rather than trusted on first use.
+func DialSSH(cfg SSHConfig) (*SSHTarget, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("no host given")
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.Host
+	}
+	if cfg.User == "" {
+		cfg.User = localUser()
+	}
+	addr := cfg.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+
+	knownHostsFile := expandHome(cfg.KnownHosts)
+	if knownHostsFile == "" {
+		knownHostsFile = expandHome("~/.ssh/known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading known hosts: %w", err)
+	}
+
+	t := &SSHTarget{cfg: cfg, addr: addr}
+	auth, err := t.authMethods()
+	if err != nil {
+		return nil, err
+	}
+	t.config = &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         sshDialTimeout,
+	}
+	if t.client, err = ssh.Dial("tcp", addr, t.config); err != nil {
+		t.Close()
+		return nil, describeDialError(cfg.Host, err)
+	}
+
+	if err := t.probe(); err != nil {
+		t.Close()
+		return nil, err
+	}
+	logger.Info("Connected to %s (%s, %s) as %s", addr, t.os, t.shell, cfg.User)
+	return t, nil
+}
+
+// authMethods prefers the configured key, then the SSH agent, then the
+// usual key files in ~/.ssh
+func (t *SSHTarget) authMethods() ([]ssh.AuthMethod, error) {
+	if t.cfg.KeyFile != "" {
+		signer, err := loadKey(expandHome(t.cfg.KeyFile))
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+
+	var methods []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			t.agent = conn
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		} else {
+			logger.Error("Could not reach the SSH agent: %v", err)
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		if signer, err := loadKey(expandHome("~/.ssh/" + name)); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no SSH key: set key_file for %s or start an SSH agent", t.cfg.Name)
+	}
+	return methods, nil
+}
+
+func loadKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, fmt.Errorf("key %s is passphrase-protected; add it to the SSH agent instead", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing key %s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// describeDialError turns host key failures into something actionable
+func describeDialError(host string, err error) error {
+	var keyErr *knownhosts.KeyError
+	if errors.As(err, &keyErr) {
+		if len(keyErr.Want) == 0 {
+			return fmt.Errorf("%s is not in known_hosts; connect once with ssh to verify and add its key", host)
+		}
+		return fmt.Errorf("host key for %s does not match known_hosts — refusing to connect", host)
+	}
+	return fmt.Errorf("connecting to %s: %w", host, err)
+}
+
+// probe asks the host which shell to use, what OS it runs and where a
+// login starts
+func (t *SSHTarget) probe() error {
+	out, err := t.Run(context.Background(),
+		`sh -c 'command -v bash >/dev/null 2>&1 && echo bash || echo sh; uname -s; pwd'`, nil, nil)
+	if err != nil {
+		return fmt.Errorf("probing %s: %w", t.cfg.Name, err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.Stdout), "\n")
+	if out.ExitCode != 0 || len(lines) < 3 {
+		return fmt.Errorf("%s did not answer like a POSIX host (only POSIX hosts are supported)", t.cfg.Name)
+	}
+	t.shell = strings.TrimSpace(lines[0])
+	t.os = strings.TrimSpace(lines[1])
+	t.home = strings.TrimSpace(lines[2])
+	return nil
+}
+
+func (t *SSHTarget) Name() string  { return t.cfg.Name }
+func (t *SSHTarget) OS() string    { return t.os }
+func (t *SSHTarget) Shell() string { return t.shell }
+
+// Dir is where the first command runs: the configured directory, else
+// the login directory
+func (t *SSHTarget) Dir() string {
+	if t.cfg.Dir != "" {
+		return t.cfg.Dir
+	}
+	return t.home
+}
+
+// Run starts command in a new session, streaming its output. The
+// connection is redialled once if the host dropped it.
+func (t *SSHTarget) Run(ctx context.Context, command string, stdin io.Reader, onLine func(OutputLine)) (*TargetOutput, error) {
+	session, err := t.newSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdin = stdin
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	var outLines, errLines *lineWriter
+	if onLine != nil {
+		outLines = newLineWriter(false, onLine)
+		errLines = newLineWriter(true, onLine)
+		outLines.enc, errLines.enc = latin1, latin1
+		session.Stdout = io.MultiWriter(&stdout, outLines)
+		session.Stderr = io.MultiWriter(&stderr, errLines)
+	}
+
+	if err := session.Start(command); err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Not every server honours signals; closing the session is what
+		// guarantees Wait returns
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		err = <-done
+	}
+	if outLines != nil {
+		outLines.Close()
+		errLines.Close()
+	}
+
+	out := &TargetOutput{Stdout: stdout.String(), Stderr: stderr.String()}
+	var exitErr *ssh.ExitError
+	var missingErr *ssh.ExitMissingError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		out.ExitCode = exitErr.ExitStatus()
+		out.Signal = exitErr.Signal()
+		if out.Signal != "" {
+			out.ExitCode = -1
+		}
+	case errors.As(err, &missingErr), ctx.Err() != nil:
+		out.ExitCode = -1
+	default:
+		out.ExitCode = -1
+		return out, err
+	}
+	return out, nil
+}
+
+func (t *SSHTarget) newSession() (*ssh.Session, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	session, err := t.client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+
+	logger.Info("Reconnecting to %s: %v", t.addr, err)
+	t.client.Close()
+	client, dialErr := ssh.Dial("tcp", t.addr, t.config)
+	if dialErr != nil {
+		t.client = nil
+		return nil, describeDialError(t.cfg.Host, dialErr)
+	}
+	t.client = client
+	return client.NewSession()
+}
+
+// Close disconnects from the host
+func (t *SSHTarget) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.agent != nil {
+		t.agent.Close()
+		t.agent = nil
+	}
+	if t.client == nil {
+		return nil
+	}
+	err := t.client.Close()
+	t.client = nil
+	return err
+}
+
+// expandHome expands a leading ~ to the user's home directory
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+func localUser() string {
+	for _, key := range []string{"USER", "USERNAME", "LOGNAME"} {
+		if u := os.Getenv(key); u != "" {
+			return u
+		}
+	}
+	return "root"
+}
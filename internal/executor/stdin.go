@@ -0,0 +1,81 @@
+package executor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/atotto/clipboard"
+
+	"shell-e/internal/workspace"
+)
+
+// Stdin is data to feed a command on its standard input. Set one field;
+// an empty Stdin feeds nothing.
+type Stdin struct {
+	File      string // A file on this machine, relative to the working directory
+	Text      string // Text, such as an earlier command's stored output
+	Clipboard bool   // The clipboard's text
+}
+
+// String describes the source for messages
+func (s *Stdin) String() string {
+	switch {
+	case s.File != "":
+		return s.File
+	case s.Clipboard:
+		return "the clipboard"
+	default:
+		return fmt.Sprintf("%d bytes of text", len(s.Text))
+	}
+}
+
+// openStdin returns a reader for the source. Relative files are found in
+// dir and must be inside the workspace roots, like everything else
+// commands touch.
+func (e *Executor) openStdin(s *Stdin, dir string) (io.ReadCloser, error) {
+	switch {
+	case s.File != "":
+		path := e.expandPath(s.File, workspace.AllVars)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if !e.Roots.Contains(path) {
+			return nil, fmt.Errorf("'%s' is outside the allowed workspace (%s)", s.File, e.Roots)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := f.Stat(); err == nil && info.IsDir() {
+			f.Close()
+			return nil, fmt.Errorf("'%s' is a directory", s.File)
+		}
+		return f, nil
+	case s.Clipboard:
+		text, err := clipboard.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("reading the clipboard: %w", err)
+		}
+		return io.NopCloser(strings.NewReader(text)), nil
+	default:
+		return io.NopCloser(strings.NewReader(s.Text)), nil
+	}
+}
+
+// stdinFor opens what the command reads on stdin, with relative files in
+// dir. The reader is nil when there is no source; close must be called
+// when the command is done.
+func (e *Executor) stdinFor(opts ExecOptions, dir string) (r io.Reader, close func(), err error) {
+	close = func() {}
+	if opts.Stdin == nil {
+		return nil, close, nil
+	}
+	src, err := e.openStdin(opts.Stdin, dir)
+	if err != nil {
+		return nil, close, fmt.Errorf("could not read stdin from %s: %w", opts.Stdin, err)
+	}
+	return src, func() { src.Close() }, nil
+}
@@ -0,0 +1,76 @@
+package executor
+
+import (
+	"sync"
+
+	"golang.org/x/text/encoding"
+)
+
+// OutputLine is one line of live command output
+type OutputLine struct {
+	Text   string
+	Stderr bool
+	// Partial is set when the line ended with a bare \r (progress bars);
+	// the next line for the same stream overwrites it
+	Partial bool
+}
+
+// lineWriter is an io.Writer that splits what it receives into lines and
+// forwards each one to a callback, treating a bare \r as an in-place update
+type lineWriter struct {
+	mu        sync.Mutex
+	enc       encoding.Encoding // Lines that aren't UTF-8 are decoded from this
+	stderr    bool
+	emit      func(OutputLine)
+	buf       []byte
+	pendingCR bool // last chunk ended with \r; need next byte to decide
+}
+
+func newLineWriter(stderr bool, emit func(OutputLine)) *lineWriter {
+	return &lineWriter{stderr: stderr, emit: emit}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, b := range p {
+		if w.pendingCR {
+			w.pendingCR = false
+			if b == '\n' {
+				w.flush(false)
+				continue
+			}
+			w.flush(true)
+		}
+
+		switch b {
+		case '\n':
+			w.flush(false)
+		case '\r':
+			w.pendingCR = true
+		default:
+			w.buf = append(w.buf, b)
+		}
+	}
+	return len(p), nil
+}
+
+// Close emits whatever is left in the buffer as a final line
+func (w *lineWriter) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pendingCR {
+		w.pendingCR = false
+		w.flush(false)
+		return
+	}
+	if len(w.buf) > 0 {
+		w.flush(false)
+	}
+}
+
+func (w *lineWriter) flush(partial bool) {
+	w.emit(OutputLine{Text: decodeLine(w.buf, w.enc), Stderr: w.stderr, Partial: partial})
+	w.buf = w.buf[:0]
+}
@@ -0,0 +1,93 @@
+package executor
+
+import (
+	"strings"
+
+	"shell-e/internal/table"
+	"shell-e/internal/terminal"
+)
+
+// psJSONSuffix turns a PowerShell pipeline's objects into JSON. Depth 1
+// keeps nested objects as short strings instead of walking whole object
+// graphs, and the depth warning is silenced because it would end up in
+// the output.
+const psJSONSuffix = " | ConvertTo-Json -Depth 1 -Compress -WarningAction SilentlyContinue"
+
+// psObjectAliases are common aliases for cmdlets that emit objects
+var psObjectAliases = map[string]bool{
+	"ls": true, "dir": true, "gci": true, "ps": true, "gps": true,
+	"gsv": true, "gcim": true, "gwmi": true, "gdr": true, "gal": true,
+}
+
+// psTextCmdlets emit plain strings or formatted text, which don't become
+// useful tables
+var psTextCmdlets = map[string]bool{
+	"get-content": true, "gc": true, "cat": true, "type": true,
+	"get-help": true, "help": true, "man": true,
+	"get-clipboard": true, "get-history": true, "h": true, "history": true,
+}
+
+// psFormatted marks pipelines that already choose their own output form
+var psFormatted = []string{
+	"format-", "out-", "convertto-", "export-", "write-", "select-string",
+	"| ft", "| fl", "| fw", "| ogv", "| sls",
+}
+
+// structuredPowerShell appends ConvertTo-Json to single pipelines that
+// start with a Get-* cmdlet (or an alias of one) and don't already format
+// their output
+func structuredPowerShell(command string) (string, bool) {
+	command = strings.TrimSpace(command)
+	if command == "" || strings.ContainsAny(command, ";\n`") {
+		return command, false
+	}
+	lower := strings.ToLower(command)
+	for _, f := range psFormatted {
+		if strings.Contains(lower, f) {
+			return command, false
+		}
+	}
+
+	first := strings.Fields(lower)[0]
+	if psTextCmdlets[first] || (!strings.HasPrefix(first, "get-") && !psObjectAliases[first]) {
+		return command, false
+	}
+	return command + psJSONSuffix, true
+}
+
+// structuredCommand rewrites command for machine-readable output when
+// Structured is on and the shell knows how
+func (e *Executor) structuredCommand(sh Shell, command string) (string, bool) {
+	if !e.Structured {
+		return command, false
+	}
+	if ss, ok := sh.(StructuredShell); ok {
+		return ss.StructuredCommand(command)
+	}
+	return command, false
+}
+
+// structure detects a table in a successful result's output and reports
+// whether it found one. Output that was rewritten to JSON is shown as the
+// aligned table instead, since the user asked for the command's normal
+// output, not JSON; only a JSON array counts then, as a single object is
+// a record (Get-Date, Get-Location) that reads better as printed.
+func (e *Executor) structure(result *Result, rewritten bool) bool {
+	if !e.Structured || !result.Success {
+		return false
+	}
+	output := terminal.Strip(result.Output)
+	if rewritten && !strings.HasPrefix(strings.TrimSpace(output), "[") {
+		return false
+	}
+	t, ok := table.Detect(output)
+	if !ok {
+		return false
+	}
+	result.Table = t
+	if rewritten {
+		result.Output = t.Text()
+		result.Stdout = result.Output
+	}
+	return true
+}
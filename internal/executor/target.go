@@ -0,0 +1,291 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"shell-e/internal/logger"
+)
+
+// Target is a machine other than this one that commands can run on
+type Target interface {
+	// Name identifies the target, e.g. the host's name in config.yaml
+	Name() string
+
+	// OS and Shell describe the remote system, e.g. "Linux" and "bash"
+	OS() string
+	Shell() string
+
+	// Run executes command with the target's shell, reading stdin (if
+	// set) and streaming output lines to onLine (if set) as they arrive.
+	// Cancelling ctx stops it. err is only for failures to run at all; a
+	// non-zero exit is in the output.
+	Run(ctx context.Context, command string, stdin io.Reader, onLine func(OutputLine)) (*TargetOutput, error)
+
+	Close() error
+}
+
+// TargetOutput is what a command printed on a target and how it ended.
+// Stdout and Stderr are the bytes as printed, which may not be UTF-8.
+type TargetOutput struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int    // -1 if the command was killed or its status is unknown
+	Signal   string // Signal that ended it, if the target reports one
+}
+
+// UseTarget runs subsequent commands on t; nil returns to this machine.
+// Targets stay open, and keep their working directory, until Close.
+func (e *Executor) UseTarget(t Target) {
+	e.targetsMu.Lock()
+	defer e.targetsMu.Unlock()
+	e.target = t
+	if t == nil {
+		return
+	}
+	if e.targets == nil {
+		e.targets = make(map[string]Target)
+		e.targetDirs = make(map[string]string)
+	}
+	e.targets[t.Name()] = t
+}
+
+// CurrentTarget returns the target commands run on, or nil for this machine
+func (e *Executor) CurrentTarget() Target {
+	e.targetsMu.Lock()
+	defer e.targetsMu.Unlock()
+	return e.target
+}
+
+// OpenTarget returns a target already opened under name
+func (e *Executor) OpenTarget(name string) (Target, bool) {
+	e.targetsMu.Lock()
+	defer e.targetsMu.Unlock()
+	t, ok := e.targets[name]
+	return t, ok
+}
+
+// TargetDir is the working directory on the current target; "" until the
+// first command reports it
+func (e *Executor) TargetDir() string {
+	e.targetsMu.Lock()
+	defer e.targetsMu.Unlock()
+	if e.target == nil {
+		return ""
+	}
+	return e.targetDirs[e.target.Name()]
+}
+
+// SetTargetDir sets where the next command on target name starts
+func (e *Executor) SetTargetDir(name, dir string) {
+	e.targetsMu.Lock()
+	defer e.targetsMu.Unlock()
+	if e.targetDirs == nil {
+		e.targetDirs = make(map[string]string)
+	}
+	e.targetDirs[name] = dir
+}
+
+// closeTargets closes every target opened with UseTarget
+func (e *Executor) closeTargets() {
+	e.targetsMu.Lock()
+	defer e.targetsMu.Unlock()
+	for name, t := range e.targets {
+		t.Close()
+		delete(e.targets, name)
+	}
+	e.target = nil
+}
+
+// executeOnTarget runs command on t. The command is framed so the remote
+// shell reports its exit code and final directory, which is how cd
+// carries over from one command to the next: each command runs in a
+// fresh remote shell that first changes to the last reported directory.
+func (e *Executor) executeOnTarget(t Target, command string, opts ExecOptions, start time.Time) *Result {
+	ctx, deadline, cancel := e.commandContext(command, opts)
+	defer cancel()
+
+	sh := resolveShell(t.Shell())
+	dir := e.TargetDir()
+	sentinel := newSentinel()
+	run := command
+	if opts.Password != "" {
+		run = sudoWithAskpass(command)
+	}
+	framed := frameRemote(sh, run, dir, sentinel, opts.Password != "")
+	stdin, closeStdin, err := e.stdinFor(opts, e.localDir(opts))
+	if err != nil {
+		logger.Error("Command not run on %s: %s (%v)", t.Name(), command, err)
+		return &Result{
+			Error:          err.Error(),
+			ExitCode:       -1,
+			Duration:       time.Since(start),
+			CurrentWorkDir: dir,
+			Target:         t.Name(),
+		}
+	}
+	defer closeStdin()
+	if opts.Password != "" {
+		// Read by the framing shell before the command starts, so the
+		// command's stdin is what it would be without a password
+		password := strings.NewReader(opts.Password + "\n")
+		if stdin != nil {
+			stdin = io.MultiReader(password, stdin)
+		} else {
+			stdin = password
+		}
+	}
+
+	// The sentinel line, and the blank line printed before it, are
+	// bookkeeping rather than output. A blank stdout line is held back
+	// until the next one shows which it is.
+	onLine := opts.OnOutput
+	if onLine != nil {
+		var mu sync.Mutex
+		heldBlank := false
+		onLine = func(l OutputLine) {
+			mu.Lock()
+			defer mu.Unlock()
+			if l.Stderr {
+				opts.OnOutput(l)
+				return
+			}
+			if strings.HasPrefix(l.Text, sentinel) {
+				heldBlank = false
+				return
+			}
+			if heldBlank {
+				opts.OnOutput(OutputLine{})
+				heldBlank = false
+			}
+			if l.Text == "" && !l.Partial {
+				heldBlank = true
+				return
+			}
+			opts.OnOutput(l)
+		}
+	}
+
+	out, err := t.Run(ctx, framed, stdin, onLine)
+	duration := time.Since(start)
+	if err != nil && out == nil {
+		logger.Error("Command failed on %s: %s (err: %v)", t.Name(), command, err)
+		return &Result{
+			Error:          fmt.Sprintf("%s: %v", t.Name(), err),
+			ExitCode:       -1,
+			Duration:       duration,
+			CurrentWorkDir: dir,
+			Target:         t.Name(),
+		}
+	}
+
+	enc := e.remoteEncoding()
+	stdout, code, cwd, framedOK := unframeRemote(decodeOutput([]byte(out.Stdout), enc), sentinel)
+	if !framedOK {
+		code = out.ExitCode // The shell itself died before reporting
+	}
+	result := &Result{
+		Stdout:         cleanTerminalOutput(trimOutput(stdout)),
+		Stderr:         cleanTerminalOutput(trimOutput(decodeOutput([]byte(out.Stderr), enc))),
+		ExitCode:       code,
+		Signal:         out.Signal,
+		Duration:       duration,
+		CurrentWorkDir: dir,
+		Target:         t.Name(),
+	}
+	if cwd != "" && cwd != dir {
+		e.SetTargetDir(t.Name(), cwd)
+		result.NewWorkDir = cwd
+		result.CurrentWorkDir = cwd
+	}
+
+	output := result.Stdout
+	if result.Stderr != "" {
+		output = strings.TrimLeft(output+"\n"+result.Stderr, "\n")
+	}
+	result.Output = output
+
+	switch {
+	case ctx.Err() != nil:
+		result.TimedOut = deadline.Expired()
+		result.Cancelled = !result.TimedOut
+		result.Error = "Command cancelled"
+		if result.TimedOut {
+			result.Error = fmt.Sprintf("Command timed out after %v", deadline.Timeout())
+		}
+		logger.Error("%s on %s: %s", result.Error, t.Name(), command)
+	case err != nil:
+		result.Error = fmt.Sprintf("%s: %v", t.Name(), err)
+		logger.Error("Command failed on %s: %s (err: %v)", t.Name(), command, err)
+	case code != 0:
+		switch sh.ClassifyExit(command, code) {
+		case ExitNoMatch:
+			result.Error = "No matches found"
+		case ExitCommandNotFound:
+			result.Error = "Command not found"
+		default:
+			result.Error = fmt.Sprintf("exit status %d", code)
+		}
+		if result.Stderr != "" && result.Error != "No matches found" {
+			result.Error = result.Stderr
+		}
+		logger.Error("Command failed on %s: %s (exit: %d)", t.Name(), command, code)
+	default:
+		result.Success = true
+		logger.Info("Command success on %s: %s", t.Name(), command)
+	}
+	e.structure(result, false)
+	return result
+}
+
+// frameRemote wraps command so that, after it runs in dir, the shell
+// prints "<sentinel> <exit code> <cwd>" as the last line of stdout. If
+// dir is gone the command doesn't run at all, rather than in the login
+// directory, and the sentinel reports exit code 1 and where it is. With
+// askpass, the shell first reads a sudo password line from stdin into a
+// private file and sets up a SUDO_ASKPASS helper that hands it to sudo -A;
+// the password is never exported.
+func frameRemote(sh Shell, command, dir, sentinel string, askpass bool) string {
+	var sb strings.Builder
+	if askpass {
+		sb.WriteString(`IFS= read -r __shelle_pw; __shelle_dir=$(umask 077; mktemp -d) || exit 1` + "\n")
+		sb.WriteString(`trap 'rm -rf "$__shelle_dir"' EXIT` + "\n")
+		sb.WriteString(`(umask 077; printf '%s\n' "$__shelle_pw" > "$__shelle_dir/password"); unset __shelle_pw` + "\n")
+		sb.WriteString("printf '%s' " + sh.Quote(askpassScript) + ` > "$__shelle_dir/askpass" && chmod 700 "$__shelle_dir/askpass"` + "\n")
+		sb.WriteString(`SUDO_ASKPASS=$__shelle_dir/askpass; export SUDO_ASKPASS` + "\n")
+	}
+	if dir != "" {
+		sb.WriteString("cd -- " + sh.Quote(dir) + " || { ")
+		sb.WriteString("echo " + sh.Quote(notRunMessage(dir)) + " >&2; ")
+		sb.WriteString("printf '\\n%s %d %s\\n' " + sh.Quote(sentinel) + ` 1 "$PWD"; exit 1; }` + "\n")
+	}
+	sb.WriteString("eval " + sh.Quote(command) + "\n")
+	sb.WriteString("printf '\\n%s %d %s\\n' " + sh.Quote(sentinel) + ` "$?" "$PWD"` + "\n")
+	name, args := sh.CommandLine(sb.String())
+	parts := []string{name}
+	for _, a := range args {
+		parts = append(parts, sh.Quote(a))
+	}
+	return strings.Join(parts, " ")
+}
+
+// notRunMessage explains a command skipped because its directory is gone
+func notRunMessage(dir string) string {
+	return "Shell-E: command not run, could not change to " + dir
+}
+
+// unframeRemote splits the sentinel line off stdout. ok is false when the
+// shell never printed it.
+func unframeRemote(stdout, sentinel string) (output string, code int, cwd string, ok bool) {
+	i := strings.LastIndex(stdout, sentinel+" ")
+	if i < 0 {
+		return stdout, -1, "", false
+	}
+	code, cwd = parseSentinel(strings.TrimRight(stdout[i+len(sentinel)+1:], "\r\n"))
+	output = strings.TrimSuffix(stdout[:i], "\n") // The newline printed before the sentinel
+	return output, code, cwd, true
+}
@@ -0,0 +1,229 @@
+package executor
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeoutRule gives commands matching Pattern their own timeout, e.g.
+// 10 minutes for "npm install". A zero Timeout means no timeout.
+type TimeoutRule struct {
+	Pattern string
+	Timeout time.Duration
+}
+
+// matches reports whether the rule's words appear, in order and adjacent,
+// among the command's words ("apt" matches "sudo apt install" but not
+// "aptitude" or "capture")
+func (r TimeoutRule) matches(words []string) bool {
+	pattern := commandWords(r.Pattern)
+	if len(pattern) == 0 {
+		return false
+	}
+	for i := 0; i+len(pattern) <= len(words); i++ {
+		match := true
+		for j, p := range pattern {
+			if words[i+j] != p {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// commandWords lowercases and splits a command, dropping quotes and .exe
+func commandWords(command string) []string {
+	fields := strings.Fields(strings.ToLower(command))
+	for i, f := range fields {
+		f = strings.Trim(f, `'"`)
+		fields[i] = strings.TrimSuffix(f, ".exe")
+	}
+	return fields
+}
+
+// TimeoutFor returns the timeout that applies to command: the first
+// matching rule, otherwise Timeout. Zero means no timeout.
+func (e *Executor) TimeoutFor(command string) time.Duration {
+	words := commandWords(command)
+	for _, rule := range e.TimeoutRules {
+		if rule.matches(words) {
+			return rule.Timeout
+		}
+	}
+	return e.Timeout
+}
+
+// Deadline is the timeout of one running command. Unlike a context
+// deadline it can be extended or lifted while the command runs, and it
+// sends a warning on Warnings shortly before it expires so the user can
+// decide whether to give the command more time.
+type Deadline struct {
+	mu        sync.Mutex
+	timeout   time.Duration // Total time granted so far; 0 = none
+	started   time.Time
+	timer     *time.Timer
+	warnTimer *time.Timer
+	cancel    func()
+	expired   bool
+	stopped   bool
+	warn      chan time.Duration
+}
+
+// NewDeadline creates a deadline to pass in ExecOptions. The executor sets
+// its initial timeout when the command starts.
+func NewDeadline() *Deadline {
+	return &Deadline{warn: make(chan time.Duration, 1)}
+}
+
+// Warnings receives the time left whenever the command is about to time
+// out. Warnings are dropped if nobody is listening.
+func (d *Deadline) Warnings() <-chan time.Duration {
+	return d.warn
+}
+
+// Extend adds by to the deadline. Returns false if there is nothing to
+// extend: no timeout, or the command already finished or timed out.
+func (d *Deadline) Extend(by time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped || d.expired || d.timeout <= 0 {
+		return false
+	}
+	d.timeout += by
+	d.arm()
+	return true
+}
+
+// Lift removes the deadline so the command runs until it exits
+func (d *Deadline) Lift() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped || d.expired {
+		return false
+	}
+	d.timeout = 0
+	d.arm()
+	return true
+}
+
+// Timeout is the total time granted, including extensions (0 = none)
+func (d *Deadline) Timeout() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.timeout
+}
+
+// Expired reports whether the command was stopped by this deadline
+func (d *Deadline) Expired() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.expired
+}
+
+func (d *Deadline) start(timeout time.Duration, cancel func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.started = time.Now()
+	d.timeout = timeout
+	d.cancel = cancel
+	d.arm()
+}
+
+// stop disarms the deadline once the command has finished
+func (d *Deadline) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = true
+	d.disarm()
+}
+
+// arm (re)schedules expiry and the warning; d.mu must be held
+func (d *Deadline) arm() {
+	d.disarm()
+	if d.timeout <= 0 || d.stopped || d.expired {
+		return
+	}
+
+	remaining := time.Until(d.started.Add(d.timeout))
+	d.timer = time.AfterFunc(remaining, d.expire)
+	if lead := warnLead(d.timeout); lead > 0 && remaining > lead {
+		d.warnTimer = time.AfterFunc(remaining-lead, func() {
+			select {
+			case d.warn <- lead:
+			default:
+			}
+		})
+	}
+}
+
+func (d *Deadline) disarm() {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if d.warnTimer != nil {
+		d.warnTimer.Stop()
+		d.warnTimer = nil
+	}
+}
+
+func (d *Deadline) expire() {
+	d.mu.Lock()
+	if d.stopped || d.expired {
+		d.mu.Unlock()
+		return
+	}
+	d.expired = true
+	cancel := d.cancel
+	d.mu.Unlock()
+	cancel()
+}
+
+// warnLead is how long before expiry to warn: a quarter of the timeout,
+// at most 10 seconds. Timeouts too short to react to get no warning.
+func warnLead(timeout time.Duration) time.Duration {
+	lead := timeout / 4
+	if lead > 10*time.Second {
+		lead = 10 * time.Second
+	}
+	if lead < time.Second {
+		return 0
+	}
+	return lead
+}
+
+// commandContext derives the context a command runs under. It is cancelled
+// by the caller's context or when the command's deadline expires; the
+// returned Deadline tells the two apart.
+func (e *Executor) commandContext(command string, opts ExecOptions) (context.Context, *Deadline, context.CancelFunc) {
+	parent := opts.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+
+	timeout := opts.Timeout
+	switch {
+	case opts.NoTimeout:
+		timeout = 0
+	case timeout <= 0:
+		timeout = e.TimeoutFor(command)
+	}
+
+	dl := opts.Deadline
+	if dl == nil {
+		dl = NewDeadline()
+	}
+	dl.start(timeout, cancel)
+
+	return ctx, dl, func() {
+		dl.stop()
+		cancel()
+	}
+}
@@ -0,0 +1,388 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"shell-e/internal/logger"
+	"shell-e/internal/trash"
+	"shell-e/internal/workspace"
+)
+
+// pathRule says which arguments of a file command it changes
+type pathRule int
+
+const (
+	allArgs  pathRule = iota // rm a b: every argument
+	firstArg                 // Set-Content path value: the first
+	copyArgs                 // cp a b dest: the destination
+	moveArgs                 // mv a b dest: the sources and the destination
+	sedArgs                  // sed -i script files: the files, only with -i
+)
+
+// fileCommand describes a command that deletes or overwrites files
+type fileCommand struct {
+	rule   pathRule
+	values []string // Options followed by a value that isn't a path
+	paths  []string // Named parameters followed by a path (PowerShell)
+	dest   []string // Named parameters followed by the destination
+}
+
+// fileSyntax is how a shell writes file commands
+type fileSyntax struct {
+	escape   byte   // Escapes the next character outside single quotes
+	single   bool   // Single quotes quote (not in cmd)
+	option   string // Option prefix
+	fold     bool   // Names and options are case-insensitive
+	commands map[string]fileCommand
+}
+
+var psRemove = fileCommand{
+	rule:   allArgs,
+	values: []string{"-filter", "-include", "-exclude", "-stream", "-credential"},
+	paths:  []string{"-path", "-literalpath"},
+}
+
+var psWrite = fileCommand{
+	rule:   firstArg,
+	values: []string{"-value", "-encoding", "-inputobject", "-width", "-stream", "-delimiter"},
+	paths:  []string{"-path", "-literalpath", "-filepath"},
+}
+
+var psCopy = fileCommand{
+	rule:   copyArgs,
+	values: []string{"-filter", "-include", "-exclude", "-credential"},
+	paths:  []string{"-path", "-literalpath"},
+	dest:   []string{"-destination"},
+}
+
+var psMove = fileCommand{
+	rule:   moveArgs,
+	values: psCopy.values,
+	paths:  psCopy.paths,
+	dest:   []string{"-destination", "-newname"},
+}
+
+var psFiles = fileSyntax{
+	escape: '`', single: true, option: "-", fold: true,
+	commands: map[string]fileCommand{
+		"remove-item": psRemove, "ri": psRemove, "rm": psRemove, "del": psRemove,
+		"erase": psRemove, "rd": psRemove, "rmdir": psRemove,
+		"set-content": psWrite, "sc": psWrite, "add-content": psWrite, "ac": psWrite,
+		"out-file": psWrite, "clear-content": psWrite, "clc": psWrite,
+		"copy-item": psCopy, "copy": psCopy, "cp": psCopy, "cpi": psCopy,
+		"move-item": psMove, "move": psMove, "mv": psMove, "mi": psMove,
+		"rename-item": psMove, "ren": psMove, "rni": psMove,
+	},
+}
+
+var cmdFiles = fileSyntax{
+	escape: '^', option: "/", fold: true,
+	commands: map[string]fileCommand{
+		"del": {rule: allArgs}, "erase": {rule: allArgs},
+		"rd": {rule: allArgs}, "rmdir": {rule: allArgs},
+		"copy": {rule: copyArgs}, "xcopy": {rule: copyArgs},
+		"move": {rule: moveArgs}, "ren": {rule: moveArgs}, "rename": {rule: moveArgs},
+	},
+}
+
+var posixFiles = fileSyntax{
+	escape: '\\', single: true, option: "-",
+	commands: map[string]fileCommand{
+		"rm": {rule: allArgs}, "rmdir": {rule: allArgs}, "unlink": {rule: allArgs},
+		"shred":    {rule: allArgs, values: []string{"-n", "-s", "--iterations", "--size"}},
+		"truncate": {rule: allArgs, values: []string{"-s", "-r", "--size", "--reference"}},
+		"tee":      {rule: allArgs},
+		"cp":       {rule: copyArgs, values: []string{"-S", "--suffix"}},
+		"mv":       {rule: moveArgs, values: []string{"-S", "--suffix"}},
+		"sed":      {rule: sedArgs, values: []string{"-e", "-f", "-l", "--expression", "--file"}},
+	},
+}
+
+// posixPrefixes run the command that follows them
+var posixPrefixes = map[string]bool{"sudo": true, "doas": true, "command": true, "nohup": true, "builtin": true}
+
+// modifiedPaths finds what one statement deletes, overwrites or creates:
+// the path arguments of known file commands in each part of a pipeline,
+// and output redirection targets
+func modifiedPaths(statement string, syn fileSyntax) []Modification {
+	pipeline, redirects := syn.words(statement)
+
+	var mods []Modification
+	for _, target := range redirects {
+		mods = append(mods, Modification{Path: target})
+	}
+	for _, words := range pipeline {
+		for len(words) > 1 && posixPrefixes[words[0]] && syn.escape == '\\' {
+			words = words[1:]
+		}
+		if len(words) < 2 {
+			continue
+		}
+		name := filepath.Base(strings.ReplaceAll(words[0], `\`, "/"))
+		if syn.fold {
+			name = strings.TrimSuffix(strings.ToLower(name), ".exe")
+		}
+		fc, ok := syn.commands[name]
+		if !ok {
+			continue
+		}
+		mods = append(mods, syn.apply(fc, words[1:])...)
+	}
+	return mods
+}
+
+// apply picks out the arguments fc changes
+func (syn fileSyntax) apply(fc fileCommand, words []string) []Modification {
+	var args []string
+	dest := ""
+	inPlace, script := false, false
+	endOpts := false
+
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if endOpts || !strings.HasPrefix(w, syn.option) || w == syn.option {
+			args = append(args, w)
+			continue
+		}
+		if w == "--" && syn.option == "-" {
+			endOpts = true
+			continue
+		}
+		opt := w
+		if syn.fold {
+			opt = strings.ToLower(opt)
+		}
+		// sed only edits files with -i, and only takes the script from the
+		// first argument without -e or -f
+		switch {
+		case strings.HasPrefix(opt, "-i") || strings.HasPrefix(opt, "--in-place"):
+			inPlace = true
+		case opt == "-e" || opt == "-f" || strings.HasPrefix(opt, "--expression") || strings.HasPrefix(opt, "--file"):
+			script = true
+		}
+		hasNext := i+1 < len(words)
+		switch {
+		case hasNext && containsWord(fc.dest, opt):
+			i++
+			dest = words[i]
+		case hasNext && containsWord(fc.paths, opt):
+			i++
+			args = append(args, words[i])
+		case containsWord(fc.values, opt):
+			i++
+		}
+	}
+
+	var mods []Modification
+	switch fc.rule {
+	case allArgs:
+		for _, a := range args {
+			mods = append(mods, Modification{Path: a})
+		}
+	case firstArg:
+		if len(args) > 0 {
+			mods = append(mods, Modification{Path: args[0]})
+		}
+	case sedArgs:
+		if !inPlace {
+			return nil
+		}
+		if !script && len(args) > 0 {
+			args = args[1:]
+		}
+		for _, a := range args {
+			mods = append(mods, Modification{Path: a})
+		}
+	case copyArgs, moveArgs:
+		if dest == "" && len(args) >= 2 {
+			dest, args = args[len(args)-1], args[:len(args)-1]
+		}
+		if dest == "" {
+			return nil
+		}
+		mods = append(mods, Modification{Path: dest, Sources: args})
+		if fc.rule == moveArgs {
+			for _, a := range args {
+				mods = append(mods, Modification{Path: a})
+			}
+		}
+	}
+	return mods
+}
+
+func containsWord(list []string, w string) bool {
+	for _, s := range list {
+		if s == w {
+			return true
+		}
+	}
+	return false
+}
+
+// nullDevices discard redirected output, so writing to them changes nothing
+var nullDevices = map[string]bool{"/dev/null": true, "$null": true, "nul": true}
+
+// words splits a statement into the words of each pipeline stage, with
+// quotes and escapes removed, and collects output redirection targets.
+// Variables are left as written.
+func (syn fileSyntax) words(statement string) (pipeline [][]string, redirects []string) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	redirect, skip := false, false
+
+	endWord := func() {
+		if !inWord {
+			return
+		}
+		w := cur.String()
+		cur.Reset()
+		inWord = false
+		switch {
+		case skip:
+			skip = false
+		case redirect:
+			redirect = false
+			if !nullDevices[strings.ToLower(w)] {
+				redirects = append(redirects, w)
+			}
+		default:
+			words = append(words, w)
+		}
+	}
+
+	s := statement
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			endWord()
+		case c == '"' || (c == '\'' && syn.single):
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if c == '"' && s[j] == syn.escape && syn.escape != '^' && j+1 < len(s) {
+					j++
+				}
+				cur.WriteByte(s[j])
+			}
+			i = j
+			inWord = true
+		case c == syn.escape && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+			inWord = true
+		case c == '|':
+			endWord()
+			pipeline = append(pipeline, words)
+			words = nil
+		case c == '>':
+			// A file descriptor written just before (2>, *>) is not a word
+			if w := cur.String(); inWord && (w == "1" || w == "2" || w == "*" || w == "&") {
+				cur.Reset()
+				inWord = false
+			}
+			endWord()
+			if i+1 < len(s) && (s[i+1] == '>' || s[i+1] == '|') {
+				i++
+			}
+			if i+1 < len(s) && s[i+1] == '&' {
+				// 2>&1 duplicates a descriptor rather than naming a file
+				i++
+				for i+1 < len(s) && strings.IndexByte("0123456789-", s[i+1]) >= 0 {
+					i++
+				}
+				continue
+			}
+			redirect = true
+		case c == '<':
+			endWord()
+			skip = true
+		case c == '&' && syn.escape == '\\' && i+1 < len(s) && s[i+1] == '>':
+			endWord() // &> redirects both streams
+		case c == '&' || c == '(' || c == ')':
+			endWord()
+		default:
+			cur.WriteByte(c)
+			inWord = true
+		}
+	}
+	endWord()
+	return append(pipeline, words), redirects
+}
+
+// snapshot saves the paths command is about to change into the trash and
+// returns the snapshot ID, or "" if there was nothing to save or it
+// couldn't be saved, in which case notSaved says why. Statements after a
+// directory change are skipped, since their relative paths would resolve
+// against the wrong directory.
+func (e *Executor) snapshot(sh Shell, command, dir string) (id, notSaved string) {
+	if e.Trash == nil {
+		return "", ""
+	}
+	var paths []string
+	for rest := command; rest != ""; {
+		var statement string
+		statement, _, rest = splitChain(rest)
+		if _, ok := parseNavigation(sh, statement); ok {
+			break
+		}
+		for _, mod := range sh.ModifiedPaths(statement) {
+			paths = append(paths, e.resolveModification(mod, dir, pathVars(sh))...)
+		}
+	}
+	if len(paths) == 0 {
+		return "", ""
+	}
+
+	snap, err := e.Trash.Snapshot(command, paths)
+	if err != nil {
+		logger.Error("Could not snapshot before %s: %v", command, err)
+		if errors.Is(err, trash.ErrTooLarge) {
+			return "", fmt.Sprintf("%v; undo_max_mb in config.yaml sets the limit", err)
+		}
+		return "", err.Error()
+	}
+	logger.Info("Snapshot %s: %d path(s), %d bytes", snap.ID, len(snap.Entries), snap.Size)
+	return snap.ID, ""
+}
+
+// resolveModification turns a modification into absolute paths against
+// dir, expanding variables written in vars' syntax and wildcards. A copy or move into an existing
+// directory changes only the names landing in it.
+func (e *Executor) resolveModification(mod Modification, dir string, vars workspace.Vars) []string {
+	var paths []string
+	for _, path := range e.resolvePath(mod.Path, dir, vars) {
+		info, err := os.Stat(path)
+		if len(mod.Sources) == 0 || err != nil || !info.IsDir() {
+			paths = append(paths, path)
+			continue
+		}
+		for _, src := range mod.Sources {
+			for _, p := range e.resolvePath(src, dir, vars) {
+				paths = append(paths, filepath.Join(path, filepath.Base(p)))
+			}
+		}
+	}
+	return paths
+}
+
+// resolvePath expands and resolves one path as written against dir.
+// Wildcards match existing files only.
+func (e *Executor) resolvePath(path, dir string, vars workspace.Vars) []string {
+	path = e.expandPath(path, vars)
+	if path == "" {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if strings.ContainsAny(path, "*?[") {
+		matches, _ := filepath.Glob(path)
+		return matches
+	}
+	return []string{filepath.Clean(path)}
+}
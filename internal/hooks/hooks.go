@@ -0,0 +1,256 @@
+// Package hooks runs user-configured programs before and after each
+// command, so local tooling (change freezes, notifications, metrics) can
+// take part in execution. Each hook gets a JSON Payload on stdin.
+//
+// A pre-hook decides whether the command runs. Exit status 0 lets it
+// through; anything else, a crash or a timeout refuses it. On stdout it
+// may print a Decision to refuse with a reason or replace the command.
+// Post-hooks only observe: their output and failures are logged.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultTimeout is how long a hook may run when its Timeout is 0
+const DefaultTimeout = 5 * time.Second
+
+// maxPayloadOutput caps the command output sent to post-hooks; the end
+// is kept, since that is where errors are
+const maxPayloadOutput = 64 << 10
+
+// Hook is an external program run around commands
+type Hook struct {
+	Name    string // For messages; defaults to the program's file name
+	Program string
+	Args    []string
+	Timeout time.Duration // 0 uses DefaultTimeout
+}
+
+func (h Hook) name() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return filepath.Base(h.Program)
+}
+
+// Hooks are the programs run before (Pre) and after (Post) each command
+type Hooks struct {
+	Pre  []Hook
+	Post []Hook
+
+	// Check, if set, vets a command a pre-hook rewrote; an error refuses
+	// it. This keeps a rewrite from skipping the safety check the planned
+	// command went through.
+	Check func(p Payload) error
+}
+
+// Plan is why the command runs, as the planner put it
+type Plan struct {
+	Request   string `json:"request,omitempty"` // What the user asked for
+	Response  string `json:"response,omitempty"`
+	Reasoning string `json:"reasoning,omitempty"`
+}
+
+// Outcome is how the command ended, for post-hooks
+type Outcome struct {
+	Success    bool   `json:"success"`
+	ExitCode   int    `json:"exit_code"`
+	Output     string `json:"output"`
+	Truncated  bool   `json:"output_truncated,omitempty"` // Output holds only the end
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	TimedOut   bool   `json:"timed_out,omitempty"`
+	Cancelled  bool   `json:"cancelled,omitempty"`
+}
+
+// Payload is what a hook reads on stdin
+type Payload struct {
+	Event   string `json:"event"` // "pre" or "post"
+	Command string `json:"command"`
+	// Original is the planned command when a pre-hook rewrote it
+	Original string   `json:"original_command,omitempty"`
+	Shell    string   `json:"shell"`
+	Cwd      string   `json:"cwd"`
+	Target   string   `json:"target,omitempty"` // The remote host; "" for this machine
+	Plan     *Plan    `json:"plan,omitempty"`
+	Result   *Outcome `json:"result,omitempty"` // Post-hooks only
+}
+
+// Decision is what a pre-hook may print on stdout. Action is "allow",
+// "deny" or "rewrite"; a rewrite puts the replacement in Command. An
+// empty Action is a rewrite if Command is set, otherwise allow.
+type Decision struct {
+	Action  string `json:"action"`
+	Command string `json:"command,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Refusal is the error RunPre returns when a hook stops the command
+type Refusal struct {
+	Hook   string
+	Reason string
+}
+
+func (r *Refusal) Error() string {
+	return fmt.Sprintf("Refused by hook %s: %s", r.Hook, r.Reason)
+}
+
+// SetOutput fills in Output, keeping only the last maxPayloadOutput
+// bytes of a long output
+func (o *Outcome) SetOutput(output string) {
+	if len(output) > maxPayloadOutput {
+		cut := len(output) - maxPayloadOutput
+		for cut < len(output) && !utf8.RuneStart(output[cut]) {
+			cut++
+		}
+		output = output[cut:]
+		o.Truncated = true
+	}
+	o.Output = output
+}
+
+// RunPre runs the pre-hooks in order, each seeing the command as the ones
+// before it left it. It returns the command to run and the name of the
+// last hook that rewrote it (""), or a *Refusal.
+func (h *Hooks) RunPre(p Payload) (command, rewrittenBy string, err error) {
+	p.Event = "pre"
+	planned := p.Command
+	for _, hook := range h.Pre {
+		stdout, runErr := hook.run(p)
+		if runErr != nil {
+			return "", "", &Refusal{Hook: hook.name(), Reason: runErr.Error()}
+		}
+		d, ok := parseDecision(stdout)
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(d.Action) {
+		case "", "allow", "rewrite":
+			if d.Command == "" && strings.EqualFold(d.Action, "rewrite") {
+				return "", "", &Refusal{Hook: hook.name(), Reason: "asked for a rewrite without a command"}
+			}
+			if d.Command == "" || d.Command == p.Command {
+				continue
+			}
+			rewritten := p
+			rewritten.Command = d.Command
+			rewritten.Original = planned
+			if h.Check != nil {
+				if err := h.Check(rewritten); err != nil {
+					return "", "", &Refusal{Hook: hook.name(), Reason: fmt.Sprintf("its rewrite %q was not allowed: %v", d.Command, err)}
+				}
+			}
+			p, rewrittenBy = rewritten, hook.name()
+		case "deny":
+			reason := d.Reason
+			if reason == "" {
+				reason = "no reason given"
+			}
+			return "", "", &Refusal{Hook: hook.name(), Reason: reason}
+		default:
+			return "", "", &Refusal{Hook: hook.name(), Reason: fmt.Sprintf("unknown action %q", d.Action)}
+		}
+	}
+	return p.Command, rewrittenBy, nil
+}
+
+// RunPost runs every post-hook, returning the failures. A failing hook
+// doesn't stop the ones after it.
+func (h *Hooks) RunPost(p Payload) []error {
+	p.Event = "post"
+	var errs []error
+	for _, hook := range h.Post {
+		if _, err := hook.run(p); err != nil {
+			errs = append(errs, fmt.Errorf("hook %s: %w", hook.name(), err))
+		}
+	}
+	return errs
+}
+
+// run starts the hook with p on stdin and returns what it printed. The
+// error describes a non-zero exit (with what the hook said on stderr), a
+// timeout or a program that couldn't start.
+func (hook Hook) run(p Payload) ([]byte, error) {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hook.Program, hook.Args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), "SHELLE_HOOK_EVENT="+p.Event)
+	if p.Target == "" {
+		if info, err := os.Stat(p.Cwd); err == nil && info.IsDir() {
+			cmd.Dir = p.Cwd
+		}
+	}
+	// Whatever the hook leaves running in the background must not keep
+	// the command waiting once the hook itself is gone
+	cmd.WaitDelay = time.Second
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, fmt.Errorf("timed out after %v", timeout)
+	case errors.Is(err, exec.ErrWaitDelay):
+		// The hook exited; only something it started held the pipes
+	case err != nil:
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("could not run %s: %w", hook.Program, err)
+		}
+		reason := firstLine(stderr.String())
+		if d, ok := parseDecision(stdout.Bytes()); ok && d.Reason != "" {
+			reason = d.Reason
+		} else if reason == "" {
+			reason = firstLine(stdout.String())
+		}
+		if reason == "" {
+			reason = fmt.Sprintf("exit status %d", exitErr.ExitCode())
+		}
+		return nil, errors.New(reason)
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseDecision reads a Decision from a hook's stdout; anything that
+// isn't a JSON object is ignored
+func parseDecision(stdout []byte) (Decision, bool) {
+	var d Decision
+	trimmed := bytes.TrimSpace(stdout)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return d, false
+	}
+	if err := json.Unmarshal(trimmed, &d); err != nil {
+		return d, false
+	}
+	return d, true
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s
+}
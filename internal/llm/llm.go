@@ -44,6 +44,20 @@ type ChatResponse struct {
 	} `json:"choices"`
 }
 
+// CompletionRequest is the request body for the raw /completion endpoint
+type CompletionRequest struct {
+	Prompt      string                 `json:"prompt"`
+	Temperature float64                `json:"temperature"`
+	NPredict    int                    `json:"n_predict,omitempty"`
+	Stop        []string               `json:"stop,omitempty"`
+	JSONSchema  map[string]interface{} `json:"json_schema,omitempty"`
+}
+
+// CompletionResponse is the response body from /completion
+type CompletionResponse struct {
+	Content string `json:"content"`
+}
+
 // LlamaServer implements LLM using llama-server HTTP API
 type LlamaServer struct {
 	BinPath      string
@@ -52,6 +66,11 @@ type LlamaServer struct {
 	Port         int
 	SystemPrompt string // System prompt sent with every request
 
+	// Template, when set, switches inference to the raw /completion endpoint
+	// with the prompt formatted by Shell-E instead of by llama-server.
+	// Leave nil to use /v1/chat/completions and the GGUF's embedded template.
+	Template *ChatTemplate
+
 	cmd     *exec.Cmd
 	running bool
 	mu      sync.Mutex
@@ -231,6 +250,27 @@ func (s *LlamaServer) InferWithHistory(history []ChatMessage, onToken func(strin
 	// Append all conversation history (user/assistant turns)
 	messages = append(messages, history...)
 
+	var content string
+	var err error
+	if s.Template != nil {
+		content, err = s.inferCompletion(messages)
+	} else {
+		content, err = s.inferChat(messages)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if onToken != nil {
+		onToken(content)
+	}
+
+	return content, nil
+}
+
+// inferChat sends the messages to /v1/chat/completions, letting llama-server
+// apply the model's embedded chat template
+func (s *LlamaServer) inferChat(messages []ChatMessage) (string, error) {
 	reqBody := ChatRequest{
 		Messages:    messages,
 		Temperature: 0.1,
@@ -240,45 +280,76 @@ func (s *LlamaServer) InferWithHistory(history []ChatMessage, onToken func(strin
 		},
 	}
 
-	jsonBody, err := json.Marshal(reqBody)
+	body, err := s.post("/v1/chat/completions", reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return "", err
 	}
 
-	client := &http.Client{Timeout: 120 * time.Second}
-	url := s.baseURL + "/v1/chat/completions"
+	var chatResp ChatResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
 
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return "", fmt.Errorf("HTTP request failed: %w", err)
+	if len(chatResp.Choices) == 0 {
+		return "", fmt.Errorf("no response choices returned")
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+	return strings.TrimSpace(chatResp.Choices[0].Message.Content), nil
+}
+
+// inferCompletion renders the messages with s.Template and sends the raw
+// prompt to /completion, stopping on the template's end-of-turn markers
+func (s *LlamaServer) inferCompletion(messages []ChatMessage) (string, error) {
+	reqBody := CompletionRequest{
+		Prompt:      s.Template.Render(messages),
+		Temperature: 0.1,
+		NPredict:    512,
+		Stop:        s.Template.Stop,
+		JSONSchema: map[string]interface{}{
+			"type": "object",
+		},
 	}
 
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("server error %d: %s", resp.StatusCode, string(body))
+	body, err := s.post("/completion", reqBody)
+	if err != nil {
+		return "", err
 	}
 
-	var chatResp ChatResponse
-	if err := json.Unmarshal(body, &chatResp); err != nil {
+	var compResp CompletionResponse
+	if err := json.Unmarshal(body, &compResp); err != nil {
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	if len(chatResp.Choices) == 0 {
-		return "", fmt.Errorf("no response choices returned")
+	return strings.TrimSpace(compResp.Content), nil
+}
+
+// post marshals reqBody, sends it to the given endpoint and returns the raw
+// response body, treating any non-200 status as an error
+func (s *LlamaServer) post(endpoint string, reqBody interface{}) ([]byte, error) {
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	content := strings.TrimSpace(chatResp.Choices[0].Message.Content)
+	client := &http.Client{Timeout: 120 * time.Second}
+	url := s.baseURL + endpoint
 
-	if onToken != nil {
-		onToken(content)
+	resp, err := client.Post(url, "application/json", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
 	}
+	defer resp.Body.Close()
 
-	return content, nil
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("server error %d: %s", resp.StatusCode, string(body))
+	}
+
+	return body, nil
 }
 
 // CouldBePartialEnd is kept for backward compatibility with existing tests
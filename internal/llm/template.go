@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChatTemplate turns a list of chat messages into a raw prompt string for the
+// /completion endpoint. It is used when a GGUF has no embedded chat template
+// (or a broken one) and llama-server would otherwise format
+// /v1/chat/completions incorrectly.
+//
+// BOS tokens (<s>, <|begin_of_text|>, <bos>) are deliberately omitted —
+// llama-server adds them itself when tokenizing the prompt.
+type ChatTemplate struct {
+	Name string
+	Stop []string // Stop sequences sent with the request
+
+	// system, user and assistant wrap a single message of that role
+	system    func(content string) string
+	user      func(content string) string
+	assistant func(content string) string
+
+	// generation is appended after the last message to start the model's turn
+	generation string
+
+	// mergeSystem folds the system prompt into the first user turn for
+	// templates that have no dedicated system role (Gemma, Mistral)
+	mergeSystem bool
+}
+
+// Render builds the full prompt, ending with the assistant generation prefix
+func (t *ChatTemplate) Render(messages []ChatMessage) string {
+	var sb strings.Builder
+	var pendingSystem string
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			if t.mergeSystem {
+				pendingSystem = msg.Content
+				continue
+			}
+			sb.WriteString(t.system(msg.Content))
+		case "assistant":
+			sb.WriteString(t.assistant(msg.Content))
+		default: // user
+			content := msg.Content
+			if pendingSystem != "" {
+				content = pendingSystem + "\n\n" + content
+				pendingSystem = ""
+			}
+			sb.WriteString(t.user(content))
+		}
+	}
+
+	sb.WriteString(t.generation)
+	return sb.String()
+}
+
+// chatTemplates holds the built-in templates keyed by name
+var chatTemplates = map[string]*ChatTemplate{
+	"chatml": {
+		Name: "chatml",
+		Stop: []string{"<|im_end|>", "<|im_start|>"},
+		system: func(c string) string {
+			return "<|im_start|>system\n" + c + "<|im_end|>\n"
+		},
+		user: func(c string) string {
+			return "<|im_start|>user\n" + c + "<|im_end|>\n"
+		},
+		assistant: func(c string) string {
+			return "<|im_start|>assistant\n" + c + "<|im_end|>\n"
+		},
+		generation: "<|im_start|>assistant\n",
+	},
+	"llama3": {
+		Name: "llama3",
+		Stop: []string{"<|eot_id|>", "<|end_of_text|>"},
+		system: func(c string) string {
+			return "<|start_header_id|>system<|end_header_id|>\n\n" + c + "<|eot_id|>"
+		},
+		user: func(c string) string {
+			return "<|start_header_id|>user<|end_header_id|>\n\n" + c + "<|eot_id|>"
+		},
+		assistant: func(c string) string {
+			return "<|start_header_id|>assistant<|end_header_id|>\n\n" + c + "<|eot_id|>"
+		},
+		generation: "<|start_header_id|>assistant<|end_header_id|>\n\n",
+	},
+	"phi": {
+		Name: "phi",
+		Stop: []string{"<|end|>", "<|endoftext|>", "<|user|>"},
+		system: func(c string) string {
+			return "<|system|>\n" + c + "<|end|>\n"
+		},
+		user: func(c string) string {
+			return "<|user|>\n" + c + "<|end|>\n"
+		},
+		assistant: func(c string) string {
+			return "<|assistant|>\n" + c + "<|end|>\n"
+		},
+		generation: "<|assistant|>\n",
+	},
+	"gemma": {
+		Name: "gemma",
+		Stop: []string{"<end_of_turn>", "<start_of_turn>"},
+		user: func(c string) string {
+			return "<start_of_turn>user\n" + c + "<end_of_turn>\n"
+		},
+		assistant: func(c string) string {
+			return "<start_of_turn>model\n" + c + "<end_of_turn>\n"
+		},
+		generation:  "<start_of_turn>model\n",
+		mergeSystem: true,
+	},
+	"mistral": {
+		Name: "mistral",
+		Stop: []string{"</s>", "[INST]"},
+		user: func(c string) string {
+			return "[INST] " + c + " [/INST]"
+		},
+		assistant: func(c string) string {
+			return c + "</s>"
+		},
+		generation:  "",
+		mergeSystem: true,
+	},
+}
+
+// templateAliases maps common alternative spellings to built-in names
+var templateAliases = map[string]string{
+	"qwen":    "chatml",
+	"llama-3": "llama3",
+	"phi3":    "phi",
+	"phi-3":   "phi",
+	"gemma2":  "gemma",
+}
+
+// GetChatTemplate looks up a built-in template by name (case-insensitive)
+func GetChatTemplate(name string) (*ChatTemplate, error) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := templateAliases[key]; ok {
+		key = alias
+	}
+	if t, ok := chatTemplates[key]; ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("unknown chat template %q (available: %s)",
+		name, strings.Join(ChatTemplateNames(), ", "))
+}
+
+// ChatTemplateNames lists the built-in template names in sorted order
+func ChatTemplateNames() []string {
+	names := make([]string, 0, len(chatTemplates))
+	for name := range chatTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -8,15 +8,41 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"shell-e/internal/table"
 )
 
 // Exchange represents one user-agent interaction
 type Exchange struct {
+	ID        int       `json:"id,omitempty"` // Names the exchange's output file
 	Timestamp time.Time `json:"timestamp"`
 	UserInput string    `json:"user_input"`
 	Command   string    `json:"command,omitempty"`
-	Result    string    `json:"result,omitempty"`
+	Result    string    `json:"result,omitempty"` // Preview; full text via LoadOutput
 	Response  string    `json:"response"`
+
+	// Table is the result's structured form, first rows only
+	Table *table.Table `json:"table,omitempty"`
+
+	// Outcome is how the command ended; nil for chat-only exchanges
+	Outcome *Outcome `json:"outcome,omitempty"`
+
+	// SnapshotID names the trash snapshot taken before the command ran;
+	// cleared once it is undone
+	SnapshotID string `json:"snapshot_id,omitempty"`
+}
+
+// Outcome records how a command ended and what it used
+type Outcome struct {
+	ExitCode   int           `json:"exit_code"`
+	Signal     string        `json:"signal,omitempty"`
+	TimedOut   bool          `json:"timed_out,omitempty"`
+	Cancelled  bool          `json:"cancelled,omitempty"`
+	Stdout     string        `json:"stdout,omitempty"` // Previews, like Result
+	Stderr     string        `json:"stderr,omitempty"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	PeakMemory int64         `json:"peak_memory,omitempty"` // Bytes
+	CPUTime    time.Duration `json:"cpu_time,omitempty"`
 }
 
 // ContextInfo is injected into the LLM prompt
@@ -62,8 +88,14 @@ type Memory struct {
 	LastAction   string     `json:"last_action"`
 	LastCreated  string     `json:"last_created"`
 	Exchanges    []Exchange `json:"exchanges"`
-	MaxExchanges int        `json:"-"` // How many to keep in active memory
-	CompactAfter int        `json:"-"` // Compact after this many exchanges
+	LastID       int        `json:"last_id"` // ID of the most recent exchange
+	MaxExchanges int        `json:"-"`       // How many to keep in active memory
+	CompactAfter int        `json:"-"`       // Compact after this many exchanges
+
+	// Env holds environment variables set by earlier commands, so they are
+	// restored in the next session. An empty value means the variable was
+	// removed.
+	Env map[string]string `json:"env,omitempty"`
 }
 
 func NewMemory(dataDir string) *Memory {
@@ -108,16 +140,19 @@ func (m *Memory) Save() error {
 	return os.WriteFile(filepath.Join(m.dataDir, "memory.json"), data, 0644)
 }
 
-// RecordExchange adds a new interaction to memory
-func (m *Memory) RecordExchange(userInput, command, result, response string) {
+// RecordExchange adds a new interaction to memory and returns its ID.
+// Only a preview of result is kept; use SaveOutput for the full text.
+func (m *Memory) RecordExchange(userInput, command, result, response string) int {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.LastID++
 	ex := Exchange{
+		ID:        m.LastID,
 		Timestamp: time.Now(),
 		UserInput: userInput,
 		Command:   command,
-		Result:    result,
+		Result:    previewResult(result),
 		Response:  response,
 	}
 
@@ -128,7 +163,7 @@ func (m *Memory) RecordExchange(userInput, command, result, response string) {
 	if command != "" {
 		lower := strings.ToLower(command)
 		// Try to detect what was created/opened for context resolution
-		if strings.Contains(lower, "new-item") || strings.Contains(lower, "mkdir") {
+		if strings.Contains(lower, "new-item") || strings.Contains(lower, "mkdir") || strings.HasPrefix(lower, "touch ") {
 			m.LastCreated = ExtractNameFromCommand(command)
 		} else if strings.Contains(lower, "explorer") {
 			m.LastCreated = ExtractPathFromCommand(command)
@@ -139,6 +174,7 @@ func (m *Memory) RecordExchange(userInput, command, result, response string) {
 	if len(m.Exchanges) > m.CompactAfter {
 		m.compact()
 	}
+	return ex.ID
 }
 
 // GetContext returns the current context for the planner
@@ -160,6 +196,20 @@ func (m *Memory) GetContext() *ContextInfo {
 	}
 }
 
+// SetEnv replaces the remembered environment variable changes
+func (m *Memory) SetEnv(env map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(env) == 0 {
+		m.Env = nil
+		return
+	}
+	m.Env = make(map[string]string, len(env))
+	for k, v := range env {
+		m.Env[k] = v
+	}
+}
+
 // GetHistory returns all exchanges
 func (m *Memory) GetHistory() []Exchange {
 	m.mu.Lock()
@@ -169,16 +219,18 @@ func (m *Memory) GetHistory() []Exchange {
 	return result
 }
 
-// Clear resets the conversation memory
+// Clear resets the conversation memory and deletes its saved output
 func (m *Memory) Clear() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.removeOutputs(m.Exchanges)
 	m.Exchanges = nil
 	m.LastAction = ""
 	m.LastCreated = ""
 }
 
-// compact summarizes old exchanges and saves to daily note
+// compact summarizes old exchanges and saves to daily note, deleting
+// their saved output
 func (m *Memory) compact() {
 	if len(m.Exchanges) <= m.MaxExchanges {
 		return
@@ -187,6 +239,7 @@ func (m *Memory) compact() {
 	// Keep last MaxExchanges, summarize the rest into a daily note
 	old := m.Exchanges[:len(m.Exchanges)-m.MaxExchanges]
 	m.Exchanges = m.Exchanges[len(m.Exchanges)-m.MaxExchanges:]
+	m.removeOutputs(old)
 
 	// Write compacted history to daily note
 	today := time.Now().Format("2006-01-02")
@@ -227,8 +280,8 @@ func ExtractNameFromCommand(cmd string) string {
 		return name
 	}
 
-	// Look for mkdir xxx
-	if strings.Contains(lower, "mkdir") {
+	// Look for mkdir xxx / touch xxx
+	if strings.Contains(lower, "mkdir") || strings.HasPrefix(lower, "touch ") {
 		parts := strings.Fields(cmd)
 		if len(parts) >= 2 {
 			return strings.Trim(parts[len(parts)-1], "'\"")
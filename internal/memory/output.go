@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"shell-e/internal/table"
+	"shell-e/internal/terminal"
+)
+
+// maxPreviewLines is how much of a result is kept inline in memory.json;
+// the full output lives in its own file under <data dir>/outputs
+const maxPreviewLines = 30
+
+// maxTableRows is how much of a structured result is kept with its
+// exchange for follow-up questions
+const maxTableRows = 50
+
+// previewResult trims result to maxPreviewLines. Colours and other
+// escape sequences are only for the screen, so they are dropped.
+func previewResult(result string) string {
+	result = terminal.Strip(result)
+	lines := strings.Split(result, "\n")
+	if len(lines) <= maxPreviewLines {
+		return result
+	}
+	return strings.Join(lines[:maxPreviewLines], "\n") +
+		fmt.Sprintf("\n... (%d more lines)", len(lines)-maxPreviewLines)
+}
+
+// OutputPath is where the full output of exchange id is stored
+func (m *Memory) OutputPath(id int) string {
+	return filepath.Join(m.dataDir, "outputs", fmt.Sprintf("%d.txt", id))
+}
+
+// SaveOutput stores the full output of exchange id as plain text. The
+// output of an exchange memory no longer keeps, such as a background
+// job's that finished after its exchange was compacted away, isn't saved.
+func (m *Memory) SaveOutput(id int, output string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !slices.ContainsFunc(m.Exchanges, func(ex Exchange) bool { return ex.ID == id }) {
+		return nil
+	}
+	path := m.OutputPath(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(terminal.Strip(output)), 0644)
+}
+
+// removeOutputs deletes the saved output of each of exchanges
+func (m *Memory) removeOutputs(exchanges []Exchange) {
+	for _, ex := range exchanges {
+		if ex.ID != 0 {
+			os.Remove(m.OutputPath(ex.ID))
+		}
+	}
+}
+
+// LoadOutput reads the full output of exchange id
+func (m *Memory) LoadOutput(id int) (string, error) {
+	data, err := os.ReadFile(m.OutputPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("no saved output for #%d", id)
+		}
+		return "", err
+	}
+	return string(data), nil
+}
+
+// LastOutputID returns the most recent exchange that has saved output
+func (m *Memory) LastOutputID() (int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.Exchanges) - 1; i >= 0; i-- {
+		id := m.Exchanges[i].ID
+		if id == 0 {
+			continue
+		}
+		if _, err := os.Stat(m.OutputPath(id)); err == nil {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// SetOutcome records how exchange id's command ended. Stdout and stderr
+// are trimmed to previews.
+func (m *Memory) SetOutcome(id int, o Outcome) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o.Stdout = previewResult(o.Stdout)
+	o.Stderr = previewResult(o.Stderr)
+	for i := range m.Exchanges {
+		if m.Exchanges[i].ID == id {
+			m.Exchanges[i].Outcome = &o
+			return
+		}
+	}
+}
+
+// LastTableID returns the most recent exchange whose result was a table
+func (m *Memory) LastTableID() (int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.Exchanges) - 1; i >= 0; i-- {
+		if m.Exchanges[i].Table != nil && m.Exchanges[i].ID != 0 {
+			return m.Exchanges[i].ID, true
+		}
+	}
+	return 0, false
+}
+
+// Exchange looks up an exchange still in memory by ID
+func (m *Memory) Exchange(id int) (Exchange, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ex := range m.Exchanges {
+		if ex.ID == id {
+			return ex, true
+		}
+	}
+	return Exchange{}, false
+}
+
+// SetTable attaches the structured form of exchange id's result
+func (m *Memory) SetTable(id int, t *table.Table) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.Exchanges {
+		if m.Exchanges[i].ID == id {
+			m.Exchanges[i].Table = t.Head(maxTableRows)
+			return
+		}
+	}
+}
+
+// SetSnapshot records the undo snapshot taken before exchange id's command
+func (m *Memory) SetSnapshot(id int, snapshotID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.Exchanges {
+		if m.Exchanges[i].ID == id {
+			m.Exchanges[i].SnapshotID = snapshotID
+			return
+		}
+	}
+}
+
+// ClearSnapshot forgets an undone snapshot and returns the exchange that
+// took it, if still in memory
+func (m *Memory) ClearSnapshot(snapshotID string) (int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.Exchanges {
+		if m.Exchanges[i].SnapshotID == snapshotID {
+			m.Exchanges[i].SnapshotID = ""
+			return m.Exchanges[i].ID, true
+		}
+	}
+	return 0, false
+}
@@ -3,8 +3,11 @@ package planner
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 
+	"shell-e/internal/executor"
 	"shell-e/internal/llm"
 	"shell-e/internal/memory"
 )
@@ -12,17 +15,80 @@ import (
 // CommandPlan is the structured output from the LLM
 type CommandPlan struct {
 	Command   *string `json:"command"`   // Shell command to run (null if chat-only)
-	Shell     string  `json:"shell"`     // "powershell" or "cmd"
+	Shell     string  `json:"shell"`     // "powershell", "cmd", "bash", "zsh" or "sh"
 	Response  string  `json:"response"`  // Chat response to show user
 	Reasoning string  `json:"reasoning"` // Brief explanation of what/why
 	Safe      bool    `json:"safe"`      // LLM's self-assessment (we verify independently)
+
+	// Interactive asks for the command to run with the terminal handed over,
+	// for programs that prompt the user (ssh-keygen, git commit without -m)
+	Interactive bool `json:"interactive,omitempty"`
+
+	// Background runs the command as a job so the TUI stays usable while it
+	// runs (servers, watchers, long builds)
+	Background bool `json:"background,omitempty"`
+
+	// TimeoutSeconds asks for a longer timeout than configured for a slow
+	// command. It can only lengthen the timeout, never shorten or lift it.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+
+	// Stdin feeds data to the command: "{{last_output}}", "{{output:N}}",
+	// "{{clipboard}}" or a file name
+	Stdin string `json:"stdin,omitempty"`
+}
+
+// StdinLastOutput and friends are the references a plan's Stdin can hold
+// besides a file name
+const (
+	StdinLastOutput = "{{last_output}}"
+	StdinClipboard  = "{{clipboard}}"
+)
+
+// stdinRefPattern matches a data reference, also when the model writes it
+// into the command itself
+var stdinRefPattern = regexp.MustCompile(`(?i)\{\{\s*(last_output|clipboard|output\s*:\s*#?(\d+))\s*\}\}`)
+
+// StdinOutputID returns N for a "{{output:N}}" reference
+func StdinOutputID(ref string) (int, bool) {
+	m := stdinRefPattern.FindStringSubmatch(ref)
+	if m == nil || m[2] == "" {
+		return 0, false
+	}
+	id, err := strconv.Atoi(m[2])
+	return id, err == nil
 }
 
 // Planner converts user intent into executable command plans
 type Planner struct {
-	llm   llm.LLM
-	mem   *memory.Memory
-	shell string // default shell
+	llm    llm.LLM
+	mem    *memory.Memory
+	shell  string  // default shell
+	target *Target // Remote host commands run on; nil for this machine
+}
+
+// Target describes the remote host commands are planned for
+type Target struct {
+	Name  string
+	OS    string // e.g. "Linux", "Darwin"
+	Shell string
+	Dir   string // Working directory on the host
+}
+
+// SetTarget plans subsequent commands for t's OS and shell; nil plans for
+// this machine again. The system prompt follows the shell.
+func (p *Planner) SetTarget(t *Target) {
+	p.target = t
+	if server, ok := p.llm.(*llm.LlamaServer); ok {
+		server.SystemPrompt = SystemPromptFor(p.activeShell())
+	}
+}
+
+// activeShell is the shell commands are planned for
+func (p *Planner) activeShell() string {
+	if p.target != nil {
+		return p.target.Shell
+	}
+	return p.shell
 }
 
 func NewPlanner(l llm.LLM, mem *memory.Memory, defaultShell string) *Planner {
@@ -60,13 +126,23 @@ func (p *Planner) Plan(userInput string) (*CommandPlan, error) {
 		}, nil
 	}
 
-	if plan.Shell == "" {
-		plan.Shell = p.shell
+	// Keep the plan on the configured platform: a model prompted for bash
+	// occasionally answers "powershell" (and vice versa), which would fail
+	// outright on the other OS. A remote target only has its own shell.
+	shell := p.activeShell()
+	plan.Shell = strings.ToLower(strings.TrimSpace(plan.Shell))
+	if !isKnownShell(plan.Shell) || !sameFamily(plan.Shell, shell) ||
+		(p.target != nil && plan.Shell != shell) {
+		plan.Shell = shell
 	}
 
 	// Sanitize: strip CWD prefix from commands (model sometimes uses absolute paths)
 	if plan.Command != nil && p.mem != nil {
-		sanitized := sanitizeCommand(*plan.Command, p.mem.WorkingDir)
+		dir := p.mem.WorkingDir
+		if p.target != nil {
+			dir = p.target.Dir
+		}
+		sanitized := sanitizeCommand(*plan.Command, dir)
 		plan.Command = &sanitized
 	}
 
@@ -83,6 +159,10 @@ type historyPlan struct {
 	Safe      bool    `json:"safe"`
 }
 
+// maxPromptRows is how many rows of the previous command's table the model
+// sees; small models lose track of longer context
+const maxPromptRows = 15
+
 // buildMessages creates the ChatML conversation history.
 // Only the last 2 exchanges are included to keep the 3B model focused.
 // Previous exchanges are proper user/assistant turns so the model has
@@ -108,7 +188,7 @@ func (p *Planner) buildMessages(userInput string) []llm.ChatMessage {
 
 			// Previous assistant response — use json.Marshal for safe serialization
 			var hp historyPlan
-			hp.Shell = "powershell"
+			hp.Shell = p.activeShell()
 			hp.Response = ex.Response
 			hp.Reasoning = "executed"
 			hp.Safe = true
@@ -134,7 +214,24 @@ func (p *Planner) buildMessages(userInput string) []llm.ChatMessage {
 		// because \F, \P etc. are invalid JSON escapes. Forward slashes
 		// work fine in PowerShell and avoid this corruption.
 		cwd := strings.ReplaceAll(ctx.WorkingDirectory, "\\", "/")
+		if p.target != nil {
+			cwd = p.target.Dir
+		}
 		userMsg := fmt.Sprintf("%s\n\n[CWD: %s]", userInput, cwd)
+		if t := p.target; t != nil {
+			userMsg += fmt.Sprintf("\n[Target: %s — %s, %s; commands run there over SSH]", t.Name, t.OS, t.Shell)
+		}
+
+		// The previous command's table, so follow-ups like "which of those
+		// uses the most memory?" can be answered from real values
+		if n := len(exchanges); n > 0 && exchanges[n-1].Table != nil {
+			userMsg += fmt.Sprintf("\n[Last output table: %s]", exchanges[n-1].Table.Summary(maxPromptRows))
+		}
+		// Follow-ups like "sort that" can use the output as it is rather
+		// than running the command again
+		if n := len(exchanges); n > 0 && exchanges[n-1].Command != "" && exchanges[n-1].Result != "" {
+			userMsg += fmt.Sprintf("\n[Last output (#%d) can be fed in as stdin: %s]", exchanges[n-1].ID, StdinLastOutput)
+		}
 		messages = append(messages, llm.ChatMessage{
 			Role:    "user",
 			Content: userMsg,
@@ -149,6 +246,40 @@ func (p *Planner) buildMessages(userInput string) []llm.ChatMessage {
 	return messages
 }
 
+// IsPosixShell reports whether the shell uses POSIX (bash-style) syntax
+func IsPosixShell(shell string) bool {
+	switch strings.ToLower(shell) {
+	case "bash", "zsh", "sh":
+		return true
+	}
+	return false
+}
+
+// isKnownShell reports whether the executor has a shell by that name
+func isKnownShell(shell string) bool {
+	_, ok := executor.LookupShell(shell)
+	return ok
+}
+
+// sameFamily reports whether two shells run on the same platforms: the
+// POSIX shells together, PowerShell and cmd together, and any other shell
+// (fish) only with itself
+func sameFamily(a, b string) bool {
+	family := func(shell string) string {
+		switch {
+		case IsPosixShell(shell):
+			return "posix"
+		case shell == "cmd":
+			return "powershell"
+		}
+		if sh, ok := executor.LookupShell(shell); ok {
+			return sh.Name()
+		}
+		return strings.ToLower(shell)
+	}
+	return family(a) == family(b)
+}
+
 // ParseResponse extracts JSON from the LLM output
 func (p *Planner) ParseResponse(raw string) (*CommandPlan, error) {
 	raw = strings.TrimSpace(raw)
@@ -177,9 +308,63 @@ func (p *Planner) ParseResponse(raw string) (*CommandPlan, error) {
 		plan.Command = nil
 	}
 
+	// A data reference belongs in stdin; models sometimes write it into
+	// the command instead, e.g. "{{last_output}} | sort"
+	plan.Stdin = normalizeStdinRef(plan.Stdin)
+	if plan.Command != nil {
+		if command, ref := takeStdinRef(*plan.Command); ref != "" {
+			plan.Command = &command
+			if plan.Stdin == "" {
+				plan.Stdin = ref
+			}
+		}
+	} else {
+		plan.Stdin = ""
+	}
+
 	return &plan, nil
 }
 
+// normalizeStdinRef writes references the one way they are looked up
+func normalizeStdinRef(ref string) string {
+	ref = strings.TrimSpace(ref)
+	m := stdinRefPattern.FindStringSubmatch(ref)
+	if m == nil || m[0] != ref {
+		return ref // A file name
+	}
+	switch {
+	case m[2] != "":
+		return "{{output:" + m[2] + "}}"
+	case strings.EqualFold(m[1], "clipboard"):
+		return StdinClipboard
+	default:
+		return StdinLastOutput
+	}
+}
+
+// takeStdinRef removes a data reference from command, along with the pipe
+// or cat that fed it in, and returns it normalized
+func takeStdinRef(command string) (string, string) {
+	loc := stdinRefPattern.FindStringIndex(command)
+	if loc == nil {
+		return command, ""
+	}
+	ref := normalizeStdinRef(command[loc[0]:loc[1]])
+	before := strings.TrimSpace(command[:loc[0]])
+	after := strings.TrimSpace(command[loc[1]:])
+
+	switch {
+	case before == "" || strings.EqualFold(before, "cat") || strings.EqualFold(before, "Get-Content") || strings.EqualFold(before, "echo"):
+		// "{{last_output}} | sort" or "cat {{last_output}} | sort"
+		after = strings.TrimSpace(strings.TrimPrefix(after, "|"))
+		return after, ref
+	case strings.HasSuffix(before, "<"):
+		// "sort < {{last_output}}"
+		before = strings.TrimSpace(strings.TrimSuffix(before, "<"))
+	}
+	return strings.TrimSpace(before + " " + after), ref
+}
+
 // sanitizeJSON fixes common JSON issues from small models:
 // - Invalid escape sequences like \F, \P, \S (from Windows paths)
 // - These get converted to proper \\F, \\P, \\S
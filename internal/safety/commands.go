@@ -0,0 +1,339 @@
+package safety
+
+import (
+	"encoding/base64"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf16"
+)
+
+// command is one simple command found in a command line, however deeply
+// it was nested in pipelines, subshells, substitutions or wrappers
+type command struct {
+	name    string   // Program name: lowercased, no directory or extension, aliases resolved
+	program string   // The program as written
+	args    []string // Arguments with quotes removed
+	writes  []string // Files written by output redirections
+	reads   []string // Files read by input redirections
+	piped   bool     // Reads the output of the command before it in a pipeline
+	dialect dialect
+}
+
+// String shows c as a command line, e.g. for saying what a rule matched
+func (c *command) String() string {
+	words := append([]string{c.program}, c.args...)
+	for _, w := range c.writes {
+		words = append(words, "> "+w)
+	}
+	for _, r := range c.reads {
+		words = append(words, "< "+r)
+	}
+	return strings.TrimSpace(strings.Join(words, " "))
+}
+
+// analysis is everything a command line would run
+type analysis struct {
+	commands []command
+	forkBomb bool // A function that pipes or backgrounds calls to itself
+}
+
+// analyze parses line in dialect d and collects the commands it runs
+func analyze(line string, d dialect) *analysis {
+	a := &analysis{}
+	a.walk(parse(line, d), d, 0)
+	return a
+}
+
+// walk collects the commands in l, nested ones included
+func (a *analysis) walk(l *list, d dialect, depth int) {
+	if depth > maxDepth {
+		return
+	}
+	for _, pl := range l.pipelines {
+		for i, n := range pl.nodes {
+			switch n := n.(type) {
+			case *simpleCmd:
+				a.walkSimple(n, i > 0, d, depth)
+			case *group:
+				a.walk(n.body, d, depth+1)
+			case *funcDef:
+				a.walk(n.body, d, depth+1)
+				if callsItself(n.body, n.name) {
+					a.forkBomb = true
+				}
+			}
+		}
+	}
+}
+
+func (a *analysis) walkSimple(sc *simpleCmd, piped bool, d dialect, depth int) {
+	var words, writes, reads []string
+	for _, w := range sc.words {
+		for _, l := range w.nested {
+			a.walk(l, d, depth+1)
+		}
+		words = append(words, w.text)
+	}
+	for _, r := range sc.redirects {
+		for _, l := range r.target.nested {
+			a.walk(l, d, depth+1)
+		}
+		if r.output {
+			writes = append(writes, r.target.text)
+		} else {
+			reads = append(reads, r.target.text)
+		}
+	}
+	a.add(words, writes, reads, piped, d, depth)
+}
+
+// callsItself reports whether a function body runs the function in a
+// pipeline or in the background, the shape of a fork bomb
+func callsItself(body *list, name string) bool {
+	for _, pl := range body.pipelines {
+		if len(pl.nodes) < 2 && !pl.background {
+			continue
+		}
+		for _, n := range pl.nodes {
+			if sc, ok := n.(*simpleCmd); ok && len(sc.words) > 0 && sc.words[0].text == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// assignmentRe matches a POSIX variable assignment prefix, FOO=bar
+var assignmentRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// add records the command made of words, then what it wraps
+func (a *analysis) add(words, writes, reads []string, piped bool, d dialect, depth int) {
+	words = skipAssignments(words, d)
+	invoked := false
+	if d == powerShell && len(words) > 1 && (words[0] == "&" || words[0] == ".") {
+		words, invoked = words[1:], true
+	}
+	if d == powerShell && !invoked && len(words) > 0 && strings.HasPrefix(words[0], "$") {
+		words = nil // An expression such as $x or $x.Method(), not a command
+	}
+	c := command{writes: writes, reads: reads, piped: piped, dialect: d}
+	if len(words) > 0 {
+		c.program, c.name, c.args = words[0], programName(words[0], d), words[1:]
+	}
+	if c.name == "" && len(writes) == 0 && len(reads) == 0 {
+		return
+	}
+	a.commands = append(a.commands, c)
+	if depth < maxDepth {
+		a.unwrap(c, depth+1)
+	}
+}
+
+// skipAssignments drops variable assignments before a command: FOO=bar
+// cmd in POSIX shells, $x = cmd in PowerShell
+func skipAssignments(words []string, d dialect) []string {
+	for len(words) > 0 {
+		switch {
+		case d == posix && assignmentRe.MatchString(words[0]):
+			words = words[1:]
+		case d == powerShell && strings.HasPrefix(words[0], "$") && len(words) > 1 && strings.HasSuffix(words[1], "="):
+			words = words[2:]
+		default:
+			return words
+		}
+	}
+	return words
+}
+
+// psAliases are PowerShell's built-in aliases for the cmdlets rules care
+// about. Several shadow programs of the same name elsewhere.
+var psAliases = map[string]string{
+	"rm": "remove-item", "ri": "remove-item", "del": "remove-item", "erase": "remove-item",
+	"rd": "remove-item", "rmdir": "remove-item",
+	"rp":   "remove-itemproperty",
+	"kill": "stop-process", "spps": "stop-process",
+	"spsv": "stop-service", "sasv": "start-service", "gsv": "get-service",
+	"sc": "set-content", "clc": "clear-content",
+	"cp": "copy-item", "copy": "copy-item", "cpi": "copy-item",
+	"mv": "move-item", "move": "move-item", "mi": "move-item",
+	"ni": "new-item", "ls": "get-childitem", "dir": "get-childitem", "gci": "get-childitem",
+	"cat": "get-content", "gc": "get-content", "type": "get-content",
+	"echo": "write-output", "write": "write-output",
+	"cd": "set-location", "chdir": "set-location", "sl": "set-location",
+	"iex": "invoke-expression", "icm": "invoke-command",
+	"saps": "start-process", "start": "start-process",
+	"ps": "get-process", "gps": "get-process",
+}
+
+// programName normalizes how a program was written: C:\Windows\System32\
+// shutdown.exe and SHUTDOWN are both "shutdown". In PowerShell a bare
+// alias becomes the cmdlet it stands for.
+func programName(program string, d dialect) string {
+	name := strings.ToLower(program)
+	bare := true
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name, bare = name[i+1:], false
+	}
+	for _, ext := range []string{".exe", ".com", ".bat", ".cmd"} {
+		if strings.HasSuffix(name, ext) {
+			name, bare = strings.TrimSuffix(name, ext), false
+		}
+	}
+	if d == powerShell && bare {
+		if cmdlet, ok := psAliases[name]; ok {
+			return cmdlet
+		}
+	}
+	return name
+}
+
+// unwrap records the command c runs on its behalf: sudo's command, the
+// script given to bash -c or powershell -Command, find's -exec, and so on
+func (a *analysis) unwrap(c command, depth int) {
+	args := c.args
+	switch c.name {
+	case "sudo":
+		a.add(skipOptions(args, "-u", "-g", "-h", "-p", "-C", "-D", "-r", "-t", "-U", "-T"), nil, nil, c.piped, c.dialect, depth)
+	case "doas":
+		a.add(skipOptions(args, "-u", "-C"), nil, nil, c.piped, c.dialect, depth)
+	case "nohup", "exec", "command", "builtin", "time", "setsid", "unbuffer":
+		a.add(skipOptions(args), nil, nil, c.piped, c.dialect, depth)
+	case "nice", "ionice", "stdbuf", "chrt", "taskset":
+		a.add(skipOptions(args, "-n", "-c", "-p", "-i", "-o", "-e"), nil, nil, c.piped, c.dialect, depth)
+	case "xargs":
+		a.add(skipOptions(args, "-I", "-n", "-L", "-P", "-d", "-s", "-E", "-a"), nil, nil, false, c.dialect, depth)
+	case "timeout":
+		if rest := skipOptions(args, "-s", "-k"); len(rest) > 0 {
+			a.add(rest[1:], nil, nil, c.piped, c.dialect, depth)
+		}
+	case "env":
+		rest := skipOptions(args, "-u", "-C", "-S")
+		for len(rest) > 0 && assignmentRe.MatchString(rest[0]) {
+			rest = rest[1:]
+		}
+		if i := slices.Index(args, "-S"); i >= 0 && i+1 < len(args) {
+			a.script(args[i+1], posix, depth)
+		}
+		a.add(rest, nil, nil, c.piped, c.dialect, depth)
+	case "watch":
+		a.script(strings.Join(skipOptions(args, "-n", "-d"), " "), posix, depth)
+	case "eval":
+		a.script(strings.Join(args, " "), posix, depth)
+	case "find":
+		for i, arg := range args {
+			if arg == "-exec" || arg == "-execdir" || arg == "-ok" || arg == "-okdir" {
+				end := i + 1
+				for end < len(args) && args[end] != ";" && args[end] != "+" {
+					end++
+				}
+				a.add(args[i+1:end], nil, nil, false, c.dialect, depth)
+			}
+		}
+	case "bash", "sh", "zsh", "dash", "ksh", "su":
+		for i, arg := range args {
+			if strings.HasPrefix(arg, "--command=") {
+				a.script(strings.TrimPrefix(arg, "--command="), posix, depth)
+			}
+			if (arg == "--command" || shortFlag(arg, 'c')) && i+1 < len(args) {
+				a.script(args[i+1], posix, depth)
+				break
+			}
+		}
+	case "powershell", "pwsh":
+		a.powerShellArgs(args, depth)
+	case "cmd":
+		for i, arg := range args {
+			lower := strings.ToLower(arg)
+			if strings.HasPrefix(lower, "/c") || strings.HasPrefix(lower, "/k") || strings.HasPrefix(lower, "/r") {
+				script := strings.Join(append([]string{arg[2:]}, args[i+1:]...), " ")
+				a.script(script, cmdExe, depth)
+				break
+			}
+		}
+	case "invoke-expression":
+		a.script(strings.Join(skipOptions(args, "-command"), " "), powerShell, depth)
+	case "runas":
+		if rest := skipOptions(args); len(rest) > 0 {
+			a.script(rest[len(rest)-1], cmdExe, depth)
+		}
+	}
+}
+
+// script records the commands of a command line run by another shell
+func (a *analysis) script(line string, d dialect, depth int) {
+	if strings.TrimSpace(line) != "" {
+		a.walk(parse(line, d), d, depth)
+	}
+}
+
+// powerShellArgs finds the script in powershell.exe's arguments: the
+// -Command text, a base64 -EncodedCommand, or bare trailing words
+func (a *analysis) powerShellArgs(args []string, depth int) {
+	valued := []string{"-executionpolicy", "-ep", "-ex", "-windowstyle", "-w", "-configurationname",
+		"-inputformat", "-outputformat", "-workingdirectory", "-wd", "-version", "-psconsolefile", "-settingsfile"}
+	for i := 0; i < len(args); i++ {
+		arg := strings.ToLower(args[i])
+		switch {
+		case !strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "/"):
+			a.script(strings.Join(args[i:], " "), powerShell, depth)
+			return
+		case len(arg) >= 2 && strings.HasPrefix("-command", arg):
+			a.script(strings.Join(args[i+1:], " "), powerShell, depth)
+			return
+		case len(arg) >= 2 && strings.HasPrefix("-encodedcommand", arg) || arg == "-ec":
+			if i+1 < len(args) {
+				a.script(decodeUTF16Base64(args[i+1]), powerShell, depth)
+			}
+			return
+		case len(arg) >= 2 && strings.HasPrefix("-file", arg):
+			return
+		case slices.Contains(valued, arg):
+			i++
+		}
+	}
+}
+
+// decodeUTF16Base64 decodes a PowerShell -EncodedCommand
+func decodeUTF16Base64(s string) string {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(data)%2 != 0 {
+		return ""
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+	}
+	return string(utf16.Decode(units))
+}
+
+// skipOptions drops a wrapper's leading options (and the values of those
+// in valued) and returns the command that follows
+func skipOptions(args []string, valued ...string) []string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return args[i+1:]
+		case !strings.HasPrefix(arg, "-") || arg == "-":
+			return args[i:]
+		case slices.Contains(valued, arg):
+			i++
+		}
+	}
+	return nil
+}
+
+// shortFlag reports whether arg is a bundle of single-letter POSIX
+// options including f, like -c or -lc
+func shortFlag(arg string, f rune) bool {
+	if len(arg) < 2 || arg[0] != '-' || arg[1] == '-' {
+		return false
+	}
+	for _, r := range arg[1:] {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z') {
+			return false
+		}
+	}
+	return strings.ContainsRune(arg[1:], f)
+}
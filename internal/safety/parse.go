@@ -0,0 +1,603 @@
+package safety
+
+import "strings"
+
+// dialect is the syntax a command line is read in
+type dialect int
+
+const (
+	posix      dialect = iota // sh, bash, zsh
+	powerShell                // Windows PowerShell and pwsh
+	cmdExe                    // cmd.exe
+)
+
+// dialectsFor returns the dialects to read a command for shell in. An
+// unknown shell gets all of them, so a command can't slip past the check
+// by being read the wrong way.
+func dialectsFor(shell string) []dialect {
+	if d, ok := shellDialect(shell); ok {
+		return []dialect{d}
+	}
+	return []dialect{posix, powerShell, cmdExe}
+}
+
+// shellDialect returns the dialect shell reads commands in
+func shellDialect(shell string) (dialect, bool) {
+	switch strings.ToLower(shell) {
+	case "powershell", "pwsh":
+		return powerShell, true
+	case "cmd":
+		return cmdExe, true
+	case "bash", "zsh", "sh", "dash", "ksh":
+		return posix, true
+	}
+	return 0, false
+}
+
+// The syntax tree. A list is what a shell runs: pipelines separated by
+// ; && || & or newlines. A pipeline's nodes are simple commands, groups
+// (subshells, brace groups, PowerShell script blocks and parentheses) and
+// function definitions.
+type (
+	list struct {
+		pipelines []*pipeline
+	}
+
+	pipeline struct {
+		nodes      []node
+		background bool // Ended by & (POSIX, PowerShell 7)
+	}
+
+	node interface{}
+
+	simpleCmd struct {
+		words     []*word
+		redirects []redirect
+	}
+
+	group struct {
+		body *list
+	}
+
+	funcDef struct {
+		name string
+		body *list
+	}
+
+	redirect struct {
+		output bool // > or >>, as opposed to <
+		target *word
+	}
+
+	// word is one argument with its quotes and escapes removed. Command
+	// substitutions in it ($(...), `...`, PowerShell's (...) and {...})
+	// are kept as text and parsed into nested.
+	word struct {
+		text   string
+		quoted bool
+		nested []*list
+	}
+)
+
+// maxDepth bounds nesting, so pathological input can't exhaust the stack
+const maxDepth = 32
+
+// parse reads a command line into a syntax tree. It never fails: an
+// unterminated quote or group simply runs to the end of the input.
+func parse(src string, d dialect) *list {
+	p := &parser{src: []rune(src), d: d}
+	return p.parseList(0)
+}
+
+type parser struct {
+	src      []rune
+	pos      int
+	d        dialect
+	depth    int
+	heredocs []heredoc // Started on the current line, read at its end
+}
+
+type heredoc struct {
+	delim     string
+	stripTabs bool // <<- strips leading tabs
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *parser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) peekAt(offset int) rune {
+	if p.pos+offset >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos+offset]
+}
+
+// blank reports whether c separates words. cmd also splits arguments
+// on commas and semicolons.
+func (p *parser) blank(c rune) bool {
+	return c == ' ' || c == '\t' || (p.d == cmdExe && (c == ',' || c == ';'))
+}
+
+func (p *parser) skipBlanks() {
+	for !p.eof() && p.blank(p.peek()) {
+		p.pos++
+	}
+}
+
+// skipLine skips to the end of the line, leaving the newline
+func (p *parser) skipLine() {
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+}
+
+// wordBreak reports whether c ends an unquoted word
+func (p *parser) wordBreak(c rune) bool {
+	if p.blank(c) || c == '\n' || c == '\r' {
+		return true
+	}
+	switch p.d {
+	case posix:
+		return strings.ContainsRune(";&|<>()", c)
+	case powerShell:
+		return strings.ContainsRune(";&|<>(){}", c)
+	default:
+		return strings.ContainsRune("&|<>()", c)
+	}
+}
+
+// parseList reads pipelines up to end (a closing ) or }) or the end of
+// the input
+func (p *parser) parseList(end rune) *list {
+	l := &list{}
+	if p.depth >= maxDepth {
+		p.pos = len(p.src)
+		return l
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+
+	for {
+		p.skipBlanks()
+		if p.eof() {
+			return l
+		}
+		c := p.peek()
+		switch {
+		case end != 0 && c == end:
+			p.pos++
+			return l
+		case c == '\n':
+			p.pos++
+			p.readHeredocs()
+		case c == ';' || c == '\r' || c == '|' || c == ')' || c == '}':
+			p.pos++
+		case c == '&':
+			p.pos++
+			if p.peek() == '&' {
+				p.pos++
+			} else if n := len(l.pipelines); n > 0 && p.d != cmdExe {
+				l.pipelines[n-1].background = true
+			}
+		case c == '#' && p.d != cmdExe:
+			p.skipComment()
+		default:
+			start := p.pos
+			if pl := p.parsePipeline(end); len(pl.nodes) > 0 {
+				l.pipelines = append(l.pipelines, pl)
+			}
+			if p.pos == start {
+				p.pos++
+			}
+		}
+	}
+}
+
+// skipComment skips a # comment, or PowerShell's <# block #>
+func (p *parser) skipComment() {
+	if p.d == powerShell && p.peek() == '<' {
+		for p.pos += 2; !p.eof(); p.pos++ {
+			if p.peek() == '#' && p.peekAt(1) == '>' {
+				p.pos += 2
+				return
+			}
+		}
+		return
+	}
+	p.skipLine()
+}
+
+// readHeredocs skips the bodies of here-documents started on the line
+// just ended; they are data, not commands
+func (p *parser) readHeredocs() {
+	for _, h := range p.heredocs {
+		for !p.eof() {
+			start := p.pos
+			p.skipLine()
+			line := strings.TrimRight(string(p.src[start:p.pos]), "\r")
+			if h.stripTabs {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if !p.eof() {
+				p.pos++
+			}
+			if line == h.delim {
+				break
+			}
+		}
+	}
+	p.heredocs = nil
+}
+
+func (p *parser) parsePipeline(end rune) *pipeline {
+	pl := &pipeline{}
+	for {
+		if n := p.parseCommand(end); n != nil {
+			pl.nodes = append(pl.nodes, n)
+		}
+		p.skipBlanks()
+		if p.peek() != '|' || p.peekAt(1) == '|' {
+			return pl
+		}
+		p.pos++
+		if p.peek() == '&' { // |& pipes stderr too
+			p.pos++
+		}
+	}
+}
+
+func (p *parser) parseCommand(end rune) node {
+	p.skipBlanks()
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		return &group{body: p.parseList(')')}
+	case c == '{' && (p.d == powerShell || (p.d == posix && p.blankOrEOL(p.peekAt(1)))):
+		p.pos++
+		return &group{body: p.parseList('}')}
+	}
+	return p.parseSimple(end)
+}
+
+func (p *parser) blankOrEOL(c rune) bool {
+	return c == 0 || c == '\n' || c == '\r' || p.blank(c)
+}
+
+// parseSimple reads a command's words and redirections, up to the next
+// operator. A POSIX "name()" turns it into a function definition.
+func (p *parser) parseSimple(end rune) node {
+	cmd := &simpleCmd{}
+loop:
+	for {
+		p.skipBlanks()
+		if p.eof() {
+			break
+		}
+		c := p.peek()
+		if c == end || c == '\n' || c == '\r' || c == '|' || (c == ';' && p.d != cmdExe) {
+			break
+		}
+		if c == '&' {
+			switch {
+			case p.d == posix && p.peekAt(1) == '>':
+				p.pos++
+				p.parseRedirect(cmd)
+				continue
+			case p.d == powerShell && p.peekAt(1) != '&' && len(cmd.words) == 0:
+				p.pos++ // The call operator: & "program" args
+				cmd.words = append(cmd.words, &word{text: "&"})
+				continue
+			}
+			break loop
+		}
+		if c == '#' && p.d != cmdExe || c == '<' && p.d == powerShell && p.peekAt(1) == '#' {
+			p.skipComment()
+			continue
+		}
+		if c == '<' || c == '>' {
+			p.parseRedirect(cmd)
+			continue
+		}
+		if c == '(' {
+			if p.d == posix && len(cmd.words) == 1 && p.emptyParens() {
+				return p.parseFuncDef(cmd.words[0].text, end)
+			}
+			p.pos++
+			inner := p.parseList(')')
+			cmd.words = append(cmd.words, &word{text: "(...)", nested: []*list{inner}})
+			continue
+		}
+		if c == '{' && p.d == powerShell {
+			p.pos++
+			inner := p.parseList('}')
+			cmd.words = append(cmd.words, &word{text: "{...}", nested: []*list{inner}})
+			continue
+		}
+		if c == ')' || c == '}' {
+			p.pos++
+			continue
+		}
+
+		w := p.parseWord()
+		if w == nil {
+			p.pos++
+			continue
+		}
+		if p.fdPrefix(w) {
+			continue // The 2 of 2>, or PowerShell's *>
+		}
+		if w.text != "" || w.quoted || len(w.nested) > 0 {
+			cmd.words = append(cmd.words, w)
+		}
+		if p.d == cmdExe && len(cmd.words) == 1 && (strings.EqualFold(w.text, "rem") || strings.HasPrefix(w.text, "::")) {
+			p.skipLine()
+			return nil
+		}
+	}
+	if len(cmd.words) == 0 && len(cmd.redirects) == 0 {
+		return nil
+	}
+	return cmd
+}
+
+// fdPrefix reports whether w is the file descriptor of a redirection
+// that follows it immediately
+func (p *parser) fdPrefix(w *word) bool {
+	if w.quoted || w.text == "" || (p.peek() != '>' && p.peek() != '<') {
+		return false
+	}
+	if p.d == powerShell && w.text == "*" {
+		return true
+	}
+	for _, r := range w.text {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// emptyParens reports whether the input continues with "()"
+func (p *parser) emptyParens() bool {
+	i := p.pos + 1
+	for i < len(p.src) && p.blank(p.src[i]) {
+		i++
+	}
+	return i < len(p.src) && p.src[i] == ')'
+}
+
+func (p *parser) parseFuncDef(name string, end rune) node {
+	for p.peek() != ')' {
+		p.pos++
+	}
+	p.pos++
+	for !p.eof() && (p.blank(p.peek()) || p.peek() == '\n' || p.peek() == '\r') {
+		p.pos++
+	}
+	f := &funcDef{name: name, body: &list{}}
+	if p.peek() == '{' {
+		p.pos++
+		f.body = p.parseList('}')
+	} else if n := p.parseCommand(end); n != nil {
+		f.body.pipelines = []*pipeline{{nodes: []node{n}}}
+	}
+	return f
+}
+
+// parseRedirect reads a redirection operator and its target
+func (p *parser) parseRedirect(cmd *simpleCmd) {
+	output := p.peek() == '>'
+	p.pos++
+	switch c := p.peek(); {
+	case !output && c == '<':
+		p.pos++
+		if p.peek() == '<' { // Here-string: data, not a file
+			p.pos++
+			p.skipBlanks()
+			p.parseWord()
+			return
+		}
+		h := heredoc{}
+		if p.peek() == '-' {
+			p.pos++
+			h.stripTabs = true
+		}
+		p.skipBlanks()
+		if w := p.parseWord(); w != nil && p.d == posix {
+			h.delim = w.text
+			p.heredocs = append(p.heredocs, h)
+		}
+		return
+	case c == '>' || c == '|':
+		p.pos++
+		output = true
+	case c == '&':
+		// Duplicating a descriptor (2>&1) names no file
+		p.pos++
+		p.skipBlanks()
+		if w := p.parseWord(); w != nil && p.d == posix && !fdWord(w.text) {
+			cmd.redirects = append(cmd.redirects, redirect{output: true, target: w})
+		}
+		return
+	case c == '(' && p.d == posix:
+		// Process substitution: <(cmd) or >(cmd)
+		p.pos++
+		inner := p.parseList(')')
+		cmd.words = append(cmd.words, &word{text: "(...)", nested: []*list{inner}})
+		return
+	}
+	p.skipBlanks()
+	if w := p.parseWord(); w != nil {
+		cmd.redirects = append(cmd.redirects, redirect{output: output, target: w})
+	}
+}
+
+func fdWord(s string) bool {
+	if s == "-" {
+		return true
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// parseWord reads one word, removing quotes and escapes the way the
+// dialect does. It returns nil if there is no word here.
+func (p *parser) parseWord() *word {
+	w := &word{}
+	var b strings.Builder
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if p.wordBreak(c) {
+			break
+		}
+		p.pos++
+		switch {
+		case c == '\'' && p.d != cmdExe:
+			w.quoted = true
+			p.readSingle(&b)
+		case c == '"':
+			w.quoted = true
+			p.readDouble(&b, w)
+		case c == '\\' && p.d == posix, c == '`' && p.d == powerShell, c == '^' && p.d == cmdExe:
+			if !p.eof() {
+				if next := p.peek(); next != '\n' {
+					b.WriteRune(next)
+				}
+				p.pos++
+			}
+		case c == '`' && p.d == posix:
+			p.readBackticks(&b, w)
+		case c == '$' && p.d != cmdExe, c == '@' && p.d == powerShell:
+			p.readDollar(c, &b, w)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	if p.pos == start {
+		return nil
+	}
+	w.text = b.String()
+	return w
+}
+
+func (p *parser) readSingle(b *strings.Builder) {
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+		if c == '\'' {
+			if p.d == powerShell && p.peek() == '\'' { // '' is a quote
+				p.pos++
+				b.WriteRune('\'')
+				continue
+			}
+			return
+		}
+		b.WriteRune(c)
+	}
+}
+
+func (p *parser) readDouble(b *strings.Builder, w *word) {
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+		switch {
+		case c == '"':
+			if p.d == powerShell && p.peek() == '"' { // "" is a quote
+				p.pos++
+				b.WriteRune('"')
+				continue
+			}
+			return
+		case c == '\\' && p.d == posix:
+			if next := p.peek(); strings.ContainsRune("$`\"\\\n", next) && next != 0 {
+				p.pos++
+				if next != '\n' {
+					b.WriteRune(next)
+				}
+			} else {
+				b.WriteRune(c)
+			}
+		case c == '`' && p.d == powerShell:
+			if !p.eof() {
+				b.WriteRune(p.peek())
+				p.pos++
+			}
+		case c == '`' && p.d == posix:
+			p.readBackticks(b, w)
+		case c == '$' && p.d != cmdExe:
+			p.readDollar(c, b, w)
+		default:
+			b.WriteRune(c)
+		}
+	}
+}
+
+// readBackticks reads a POSIX `command substitution`, the opening
+// backtick already consumed
+func (p *parser) readBackticks(b *strings.Builder, w *word) {
+	start := p.pos
+	var inner strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+		if c == '`' {
+			break
+		}
+		if c == '\\' && !p.eof() {
+			c = p.peek()
+			p.pos++
+		}
+		inner.WriteRune(c)
+	}
+	b.WriteString("`" + string(p.src[start:p.pos]))
+	w.nested = append(w.nested, parse(inner.String(), posix))
+}
+
+// readDollar reads what follows a $ (or PowerShell's @): a substitution
+// $(...) is parsed, ${...} and $((...)) are kept as text, and anything
+// else is an ordinary character
+func (p *parser) readDollar(c rune, b *strings.Builder, w *word) {
+	start := p.pos - 1
+	switch {
+	case p.peek() == '(' && p.peekAt(1) == '(' && p.d == posix:
+		p.skipBalanced('(', ')')
+	case p.peek() == '(':
+		p.pos++
+		w.nested = append(w.nested, p.parseList(')'))
+	case p.peek() == '{' && c == '$':
+		p.skipBalanced('{', '}')
+	default:
+		b.WriteRune(c)
+		return
+	}
+	b.WriteString(string(p.src[start:p.pos]))
+}
+
+// skipBalanced skips from an opening bracket to the one closing it
+func (p *parser) skipBalanced(open, close rune) {
+	depth := 0
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+		switch c {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package safety
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"shell-e/internal/workspace"
+)
+
+// CheckIn is Check for a command about to run in workDir. When Roots are
+// set, a command with a path argument outside them needs confirmation.
+func (c *Checker) CheckIn(command, workDir string) *Assessment {
+	return c.CheckShell(command, "", workDir)
+}
+
+// checkPaths asks for confirmation of a command touching a path outside
+// the Roots, keeping the reason a rule already gave
+func (c *Checker) checkPaths(a *Assessment, analyses []*analysis, workDir string) *Assessment {
+	if a.Level == Blocked || !c.Roots.Restricted() {
+		return a
+	}
+	for _, arg := range pathArgs(analyses) {
+		path := resolveArg(arg, workDir)
+		if c.Roots.Contains(path) {
+			continue
+		}
+		reason := fmt.Sprintf("%s is outside the allowed workspace (%s)", path, c.Roots)
+		rule, matched := a.Rule, a.Matched
+		if a.Level == NeedsConfirm {
+			// Keep the original reason, which is usually the bigger concern
+			reason = strings.TrimSuffix(a.Reason, " — confirm? (y/n)") + "; " + reason
+			reason = strings.TrimPrefix(reason, "⚠️  ")
+		} else {
+			rule, matched = nil, "" // Not an allow rule's doing
+		}
+		return &Assessment{
+			Level:   NeedsConfirm,
+			Reason:  fmt.Sprintf("⚠️  %s — confirm? (y/n)", reason),
+			Command: a.Command,
+			Rule:    rule,
+			Matched: matched,
+		}
+	}
+	return a
+}
+
+// drivePathRe matches a Windows drive path such as C:\ or D:/data
+var drivePathRe = regexp.MustCompile(`^[A-Za-z]:[\\/]`)
+
+// notPaths are absolute-looking arguments that don't touch the workspace
+var notPaths = map[string]bool{"/dev/null": true, "/dev/stdout": true, "/dev/stderr": true, "/dev/stdin": true}
+
+// pathArgs picks the words of the commands that name a path outside the
+// current directory's subtree: absolute, home-relative or climbing out
+// with "..". Option values (--prefix=/opt) and redirections count too.
+func pathArgs(analyses []*analysis) []string {
+	var words []string
+	for _, an := range analyses {
+		for _, c := range an.commands {
+			words = append(words, c.program)
+			words = append(words, c.args...)
+			words = append(words, c.writes...)
+			words = append(words, c.reads...)
+		}
+	}
+
+	var paths []string
+	for _, w := range words {
+		if _, value, ok := strings.Cut(w, "="); ok && strings.HasPrefix(w, "-") {
+			w = value
+		}
+		switch {
+		case w == "" || notPaths[strings.ToLower(w)] || strings.Contains(w, "://"):
+		case cmdSwitch(w):
+		case strings.HasPrefix(w, "/") || strings.HasPrefix(w, `\\`) || drivePathRe.MatchString(w),
+			w == "~" || strings.HasPrefix(w, "~/") || strings.HasPrefix(w, `~\`),
+			strings.HasPrefix(w, "$") || strings.HasPrefix(w, "%"),
+			w == ".." || strings.HasPrefix(w, "../") || strings.HasPrefix(w, `..\`) ||
+				strings.Contains(w, "/../") || strings.Contains(w, `\..\`):
+			paths = append(paths, w)
+		}
+	}
+	return paths
+}
+
+// cmdSwitch reports whether w is a cmd.exe switch like /s, /q or /d
+// rather than a path
+func cmdSwitch(w string) bool {
+	return len(w) <= 3 && strings.HasPrefix(w, "/") && !strings.Contains(w[1:], "/")
+}
+
+// resolveArg expands ~ and environment variables in a path argument and
+// makes it absolute against workDir
+func resolveArg(arg, workDir string) string {
+	arg = workspace.ExpandPath(arg, workspace.AllVars, os.Getenv)
+	if !filepath.IsAbs(arg) {
+		arg = filepath.Join(workDir, arg)
+	}
+	return filepath.Clean(arg)
+}
@@ -0,0 +1,302 @@
+package safety
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ProjectPolicyFile is where a project keeps its policy, in the working
+// directory or one above it
+const ProjectPolicyFile = ".shell-e/policy.yaml"
+
+// BuiltIn is the Source of the default policy
+const BuiltIn = "built-in"
+
+//go:embed default_policy.yaml
+var defaultPolicyYAML []byte
+
+// Policy is an ordered list of rules; the first that matches a command
+// decides what happens to it
+type Policy struct {
+	Source string
+	Rules  []Rule
+}
+
+// Rule maps the commands it matches to an action. Every condition given
+// must hold, and a rule needs at least one.
+type Rule struct {
+	Name   string `yaml:"name"`
+	Action string `yaml:"action"` // allow, confirm or block
+	Reason string `yaml:"reason"`
+
+	Command    Strings `yaml:"command"`    // Program names (globs) after alias resolution
+	Subcommand Strings `yaml:"subcommand"` // Leading arguments, one alternative each, e.g. "link set"
+	Flags      Strings `yaml:"flags"`      // Options that must all be given; "|" separates spellings
+	Args       Strings `yaml:"args"`       // Globs, one of which some argument must match
+	ArgsRegex  string  `yaml:"args_regex"` // Regexp matched against the arguments joined by spaces
+	Paths      Strings `yaml:"paths"`      // Globs, one of which a path argument must match once resolved; ~ is home
+	Writes     Strings `yaml:"writes"`     // Globs, one of which some output redirection must match
+	Shell      Strings `yaml:"shell"`      // Shells that run the command: bash, powershell, cmd...
+	Piped      bool    `yaml:"piped"`      // Only commands reading another's output through a pipe
+
+	Source string `yaml:"-"` // The policy file, or BuiltIn
+
+	level    Level
+	argsRe   *regexp.Regexp
+	dialects []dialect
+}
+
+// Strings is a YAML list that may also be written as a single string
+type Strings []string
+
+func (s *Strings) UnmarshalYAML(n *yaml.Node) error {
+	switch {
+	case n.Kind == yaml.ScalarNode && n.Tag == "!!null":
+		*s = nil
+	case n.Kind == yaml.ScalarNode:
+		*s = Strings{n.Value}
+	default:
+		var list []string
+		if err := n.Decode(&list); err != nil {
+			return err
+		}
+		*s = list
+	}
+	return nil
+}
+
+// ParsePolicy reads a policy written in YAML. source names it in errors
+// and in its rules.
+func ParsePolicy(data []byte, source string) (*Policy, error) {
+	var doc struct {
+		Rules []Rule `yaml:"rules"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	p := &Policy{Source: source, Rules: doc.Rules}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		r.Source = source
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", source, r.Name, err)
+		}
+	}
+	return p, nil
+}
+
+// LoadPolicy reads the policy file at path
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(data, path)
+}
+
+// DefaultPolicy is the built-in policy, checked after the user's and the
+// project's. Its rules are shared, so it must not be modified.
+func DefaultPolicy() *Policy {
+	return defaultPolicy()
+}
+
+var defaultPolicy = sync.OnceValue(func() *Policy {
+	p, err := ParsePolicy(defaultPolicyYAML, BuiltIn)
+	if err != nil {
+		panic(err)
+	}
+	return p
+})
+
+// compile checks r and prepares its conditions for matching
+func (r *Rule) compile() error {
+	switch strings.ToLower(r.Action) {
+	case "allow":
+		r.level = Safe
+	case "confirm":
+		r.level = NeedsConfirm
+	case "block":
+		r.level = Blocked
+	default:
+		return fmt.Errorf("action must be allow, confirm or block, not %q", r.Action)
+	}
+	if len(r.Command)+len(r.Subcommand)+len(r.Flags)+len(r.Args)+len(r.Paths)+len(r.Writes)+len(r.Shell) == 0 &&
+		r.ArgsRegex == "" && !r.Piped {
+		return errors.New("a rule needs at least one condition")
+	}
+
+	if r.ArgsRegex != "" {
+		re, err := regexp.Compile(r.ArgsRegex)
+		if err != nil {
+			return fmt.Errorf("args_regex: %w", err)
+		}
+		r.argsRe = re
+	}
+	for i, sub := range r.Subcommand {
+		r.Subcommand[i] = strings.ToLower(strings.Join(strings.Fields(sub), " "))
+	}
+	for _, sh := range r.Shell {
+		d, ok := shellDialect(sh)
+		if !ok {
+			return fmt.Errorf("unknown shell %q", sh)
+		}
+		r.dialects = append(r.dialects, d)
+	}
+
+	if r.Reason == "" {
+		switch r.level {
+		case Blocked:
+			r.Reason = fmt.Sprintf("Blocked by policy rule %s", r.Name)
+		case NeedsConfirm:
+			r.Reason = fmt.Sprintf("Policy rule %s asks for confirmation", r.Name)
+		default:
+			r.Reason = fmt.Sprintf("Allowed by policy rule %s", r.Name)
+		}
+	}
+	return nil
+}
+
+// match returns the first rule that matches c, nil if none does
+func (p *Policy) match(c *command, workDir string) *Rule {
+	if p == nil {
+		return nil
+	}
+	for i := range p.Rules {
+		if p.Rules[i].matches(c, workDir) {
+			return &p.Rules[i]
+		}
+	}
+	return nil
+}
+
+// policyFile is a policy kept in a file, reloaded when the file changes
+type policyFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+	policy  *Policy
+	err     error
+}
+
+// load returns the file's policy; a missing file is no policy
+func (f *policyFile) load() (*Policy, error) {
+	info, err := os.Stat(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		*f = policyFile{path: f.path}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if (f.policy != nil || f.err != nil) && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.policy, f.err
+	}
+	f.modTime, f.size = info.ModTime(), info.Size()
+	f.policy, f.err = LoadPolicy(f.path)
+	return f.policy, f.err
+}
+
+// SetUserPolicy makes the policy file at path, usually policy.yaml in the
+// data directory, take precedence over every other. The file needn't
+// exist yet; it is reloaded whenever it changes.
+func (c *Checker) SetUserPolicy(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.user = &policyFile{path: path}
+	_, err := c.user.load()
+	return err
+}
+
+// projectPolicy finds the project policy that applies in workDir, nil if
+// there is none. The user's own policy file doesn't count twice.
+func (c *Checker) projectPolicy(workDir string) *policyFile {
+	if workDir == "" {
+		return nil
+	}
+	for dir := filepath.Clean(workDir); ; {
+		path := filepath.Join(dir, ProjectPolicyFile)
+		if info, err := os.Stat(path); err == nil {
+			if c.user != nil {
+				if userInfo, err := os.Stat(c.user.path); err == nil && os.SameFile(info, userInfo) {
+					return nil
+				}
+			}
+			f, ok := c.projects[path]
+			if !ok {
+				f = &policyFile{path: path}
+				c.projects[path] = f
+			}
+			return f
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// policies loads the user's and the project's policy for workDir. A
+// policy that can't be loaded is left out and its error returned.
+func (c *Checker) policies(workDir string) (user, project *Policy, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var userErr, projectErr error
+	if c.user != nil {
+		user, userErr = c.user.load()
+	}
+	if f := c.projectPolicy(workDir); f != nil {
+		project, projectErr = f.load()
+	}
+	return user, project, errors.Join(userErr, projectErr)
+}
+
+// PolicyStatus describes one of the policies a command is checked against
+type PolicyStatus struct {
+	Kind   string // "user", "project" or "built-in"
+	Source string // The file, or BuiltIn
+	Rules  int
+	Exists bool
+	Err    error // Why the file can't be used
+}
+
+// Policies lists the policies that apply to commands run in workDir, in
+// order of precedence
+func (c *Checker) Policies(workDir string) []PolicyStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []PolicyStatus
+	add := func(kind string, f *policyFile) {
+		p, err := f.load()
+		s := PolicyStatus{Kind: kind, Source: f.path, Exists: p != nil || err != nil, Err: err}
+		if p != nil {
+			s.Rules = len(p.Rules)
+		}
+		out = append(out, s)
+	}
+	if c.user != nil {
+		add("user", c.user)
+	}
+	if f := c.projectPolicy(workDir); f != nil {
+		add("project", f)
+	}
+	return append(out, PolicyStatus{Kind: BuiltIn, Source: BuiltIn, Rules: len(c.builtIn.Rules), Exists: true})
+}
@@ -0,0 +1,218 @@
+package safety
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"shell-e/internal/workspace"
+)
+
+// matches reports whether c, run in workDir, meets every condition of r
+func (r *Rule) matches(c *command, workDir string) bool {
+	if len(r.dialects) > 0 && !slices.Contains(r.dialects, c.dialect) {
+		return false
+	}
+	if len(r.Command) > 0 && !anyGlob(r.Command, c.name) {
+		return false
+	}
+	if r.Piped && !c.piped {
+		return false
+	}
+	if len(r.Subcommand) > 0 && !hasSub(r.Subcommand, c) {
+		return false
+	}
+	for _, f := range r.Flags {
+		if !hasFlag(c, strings.Split(f, "|")) {
+			return false
+		}
+	}
+	if len(r.Args) > 0 && !anyArg(r.Args, c.args) {
+		return false
+	}
+	if r.argsRe != nil && !r.argsRe.MatchString(strings.Join(c.args, " ")) {
+		return false
+	}
+	if len(r.Paths) > 0 && !anyPath(r.Paths, c, workDir) {
+		return false
+	}
+	if len(r.Writes) > 0 && !anyArg(r.Writes, c.writes) {
+		return false
+	}
+	return true
+}
+
+// hasSub reports whether c's leading positional arguments are one of
+// subs, e.g. "stop" in systemctl --now stop nginx
+func hasSub(subs []string, c *command) bool {
+	var positional []string
+	for _, arg := range c.args {
+		if !isOption(arg, c.dialect) {
+			positional = append(positional, strings.ToLower(arg))
+		}
+	}
+	for _, sub := range subs {
+		words := strings.Fields(sub)
+		if len(positional) >= len(words) && strings.Join(positional[:len(words)], " ") == sub {
+			return true
+		}
+	}
+	return false
+}
+
+func isOption(arg string, d dialect) bool {
+	return strings.HasPrefix(arg, "-") && arg != "-" || d == cmdExe && cmdSwitch(arg)
+}
+
+// hasFlag reports whether c was given an option spelled one of the ways
+// in spellings. POSIX single-letter options may be bundled (-rf has -r);
+// PowerShell parameters may be abbreviated (-Rec is -Recurse); cmd
+// switches may be run together (/s/q) and ignore case.
+func hasFlag(c *command, spellings []string) bool {
+	for _, arg := range c.args {
+		for _, s := range spellings {
+			if arg == s || c.dialect != posix && strings.EqualFold(arg, s) {
+				return true
+			}
+			switch c.dialect {
+			case posix:
+				if len(s) == 2 && s[0] == '-' && shortFlag(arg, rune(s[1])) {
+					return true
+				}
+			case powerShell:
+				name, _, _ := strings.Cut(strings.ToLower(arg), ":")
+				if len(s) > 2 && s[0] == '-' && s[1] != '-' && len(name) > 1 && strings.HasPrefix(s, name) {
+					return true
+				}
+			case cmdExe:
+				if s[0] == '/' && strings.HasPrefix(arg, "/") {
+					for _, sw := range strings.Split(strings.ToLower(arg[1:]), "/") {
+						if "/"+sw == s {
+							return true
+						}
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// anyArg reports whether an argument, or the value of an option like
+// --file=x or -Path:x, matches one of patterns
+func anyArg(patterns []string, args []string) bool {
+	for _, arg := range args {
+		if anyGlob(patterns, normalizeArg(arg)) {
+			return true
+		}
+		if strings.HasPrefix(arg, "-") {
+			if _, value, ok := strings.Cut(arg, "="); ok && anyGlob(patterns, normalizeArg(value)) {
+				return true
+			}
+			if _, value, ok := strings.Cut(arg, ":"); ok && anyGlob(patterns, normalizeArg(value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// anyPath reports whether a file c names, made absolute against workDir
+// when there is one, matches one of patterns. A leading ~ in a pattern is
+// the home directory, so "~" matches ~/, $HOME and /home/me alike.
+func anyPath(patterns []string, c *command, workDir string) bool {
+	expanded := make([]string, len(patterns))
+	for i, p := range patterns {
+		expanded[i] = filepath.ToSlash(workspace.ExpandHome(p))
+	}
+	patterns = expanded
+	var files []string
+	for _, arg := range c.args {
+		if _, value, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(arg, "-") {
+			arg = value
+		}
+		if arg != "" && !isOption(arg, c.dialect) {
+			files = append(files, arg)
+		}
+	}
+	files = append(files, c.writes...)
+	files = append(files, c.reads...)
+	for _, f := range files {
+		if anyGlob(patterns, normalizeArg(resolveArg(f, workDir))) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeArg lowercases an argument and puts paths in one form:
+// forward slashes, and no redundant separators, . or .. elements
+func normalizeArg(arg string) string {
+	arg = strings.ToLower(strings.ReplaceAll(arg, `\`, "/"))
+	switch {
+	case strings.HasPrefix(arg, "/"):
+		return path.Clean(arg)
+	case drivePathRe.MatchString(arg):
+		return arg[:2] + path.Clean(arg[2:])
+	}
+	return arg
+}
+
+// globs caches compiled globs; checks may run on several goroutines
+var globs sync.Map
+
+// anyGlob reports whether s matches one of globs, case-insensitively.
+// * and ? stay within a path element, ** crosses them, [..] is a class.
+func anyGlob(patterns []string, s string) bool {
+	for _, g := range patterns {
+		re, ok := globs.Load(g)
+		if !ok {
+			re, _ = globs.LoadOrStore(g, compileGlob(g))
+		}
+		if re.(*regexp.Regexp).MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func compileGlob(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	g := strings.ReplaceAll(glob, `\`, "/")
+	for i := 0; i < len(g); i++ {
+		switch c := g[i]; c {
+		case '*':
+			if i+1 < len(g) && g[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			if end := strings.IndexByte(g[i:], ']'); end > 1 {
+				class := g[i+1 : i+end]
+				if class[0] == '!' {
+					class = "^" + class[1:]
+				}
+				b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+				i += end
+				continue
+			}
+			b.WriteString(`\[`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return regexp.MustCompile(`[^\s\S]`) // Matches nothing
+	}
+	return re
+}
@@ -2,7 +2,9 @@ package safety
 
 import (
 	"fmt"
-	"strings"
+	"sync"
+
+	"shell-e/internal/workspace"
 )
 
 // Level indicates the safety assessment of a command
@@ -19,97 +21,103 @@ type Assessment struct {
 	Level   Level
 	Reason  string
 	Command string
+
+	// Rule is the policy rule that decided Level, nil if none matched;
+	// Matched is the part of Command it matched
+	Rule    *Rule
+	Matched string
 }
 
-// Checker validates commands before execution
+// Checker validates commands before execution. Commands are parsed the
+// way their shell would read them, and rules look at each program they
+// run, in pipelines, chains, subshells and wrappers like sudo or bash -c,
+// with its arguments; "Get-Help kill" runs nothing that kills.
+//
+// Rules come from policies. For each program the user's policy decides
+// first; then the project's, as long as it is no more lenient than the
+// built-in policy, which decides the rest. The strictest decision across
+// the programs is the command's.
 type Checker struct {
-	blockedPatterns []pattern
-	confirmPatterns []pattern
-}
+	builtIn *Policy
 
-type pattern struct {
-	match  string
-	reason string
+	mu       sync.Mutex
+	user     *policyFile
+	projects map[string]*policyFile // By path
+
+	// Roots, if set, are the only places commands should touch; CheckIn
+	// asks for confirmation before going outside them
+	Roots workspace.Roots
 }
 
 func NewChecker() *Checker {
-	return &Checker{
-		blockedPatterns: []pattern{
-			// System destruction
-			{"format-volume", "Cannot format volumes — this destroys data permanently"},
-			{"format c:", "Cannot format system drive"},
-			{"format d:", "Cannot format drives"},
-			{"remove-item -recurse c:\\windows", "Cannot delete Windows system directory"},
-			{"remove-item -recurse c:/windows", "Cannot delete Windows system directory"},
-			{"del /s /q c:\\windows", "Cannot delete Windows system directory"},
-			{"rd /s /q c:\\windows", "Cannot delete Windows system directory"},
-			{"rm -rf /", "Cannot delete root directory"},
-			{"del /s /q c:\\", "Cannot recursively delete system drive"},
-			{"rd /s /q c:\\", "Cannot recursively delete system drive"},
-			{":(){:|:&};:", "Fork bomb detected"},
-			// Registry destruction
-			{"reg delete hklm", "Cannot modify system registry"},
-			{"remove-itemproperty hklm:", "Cannot modify system registry"},
-			// Privilege escalation
-			{"net user administrator", "Cannot modify administrator account"},
-			{"set-executionpolicy unrestricted", "Cannot weaken security policy"},
-		},
-		confirmPatterns: []pattern{
-			// Process management
-			{"stop-process", "This will terminate a running process"},
-			{"taskkill", "This will terminate a running process"},
-			{"kill", "This will terminate processes"},
-			// System power
-			{"shutdown", "This will shut down the computer"},
-			{"restart-computer", "This will restart the computer"},
-			{"stop-computer", "This will shut down the computer"},
-			// File deletion
-			{"remove-item", "This will delete files or folders"},
-			{"del ", "This will delete files"},
-			{"rmdir", "This will remove a directory"},
-			{"rd ", "This will remove a directory"},
-			// Network changes
-			{"netsh", "This modifies network configuration"},
-			{"set-dnsclientserveraddress", "This changes DNS settings"},
-			// Service management
-			{"stop-service", "This will stop a system service"},
-			{"set-service", "This modifies a system service"},
-			{"sc stop", "This will stop a system service"},
-			{"sc delete", "This will delete a system service"},
-		},
-	}
+	return &Checker{builtIn: DefaultPolicy(), projects: map[string]*policyFile{}}
 }
 
-// Check evaluates a command and returns a safety assessment
+// Check evaluates a command and returns a safety assessment. Without a
+// shell to go by, it is read as every shell would read it.
 func (c *Checker) Check(command string) *Assessment {
-	lower := strings.ToLower(strings.TrimSpace(command))
+	return c.CheckShell(command, "", "")
+}
 
-	// Check blocked patterns first
-	for _, p := range c.blockedPatterns {
-		if strings.Contains(lower, p.match) {
+// CheckShell evaluates a command for shell ("bash", "powershell", "cmd";
+// "" for unknown). A workDir also applies the project's policy and
+// CheckIn's workspace check.
+func (c *Checker) CheckShell(command, shell, workDir string) *Assessment {
+	var analyses []*analysis
+	for _, d := range dialectsFor(shell) {
+		analyses = append(analyses, analyze(command, d))
+	}
+	user, project, err := c.policies(workDir)
+	a := c.assess(command, analyses, workDir, user, project)
+	if err != nil && a.Level == Safe {
+		// Whatever the broken policy meant to stop, it isn't stopped silently
+		a.Level, a.Rule, a.Matched = NeedsConfirm, nil, ""
+		a.Reason = fmt.Sprintf("⚠️  Policy not applied: %v — confirm? (y/n)", err)
+	}
+	if workDir != "" {
+		a = c.checkPaths(a, analyses, workDir)
+	}
+	return a
+}
+
+// assess decides every command found, keeping the most serious decision
+func (c *Checker) assess(command string, analyses []*analysis, workDir string, user, project *Policy) *Assessment {
+	a := &Assessment{Level: Safe, Command: command}
+	for _, an := range analyses {
+		if an.forkBomb {
 			return &Assessment{
 				Level:   Blocked,
-				Reason:  fmt.Sprintf("🚫 BLOCKED: %s", p.reason),
+				Reason:  "🚫 BLOCKED: Fork bomb detected",
 				Command: command,
 			}
 		}
-	}
-
-	// Check patterns that need confirmation
-	for _, p := range c.confirmPatterns {
-		if strings.Contains(lower, p.match) {
-			return &Assessment{
-				Level:   NeedsConfirm,
-				Reason:  fmt.Sprintf("⚠️  %s — confirm? (y/n)", p.reason),
-				Command: command,
+		for i := range an.commands {
+			cmd := &an.commands[i]
+			r := c.decide(cmd, workDir, user, project)
+			if r != nil && (a.Rule == nil || r.level > a.Rule.level) {
+				a.Level, a.Rule, a.Matched = r.level, r, cmd.String()
 			}
 		}
 	}
 
-	// Default: safe
-	return &Assessment{
-		Level:   Safe,
-		Reason:  "",
-		Command: command,
+	switch a.Level {
+	case Blocked:
+		a.Reason = fmt.Sprintf("🚫 BLOCKED: %s", a.Rule.Reason)
+	case NeedsConfirm:
+		a.Reason = fmt.Sprintf("⚠️  %s — confirm? (y/n)", a.Rule.Reason)
+	}
+	return a
+}
+
+// decide returns the rule that decides cmd, nil if no policy has one. A
+// project can ask for more care than the built-in policy but not less.
+func (c *Checker) decide(cmd *command, workDir string, user, project *Policy) *Rule {
+	if r := user.match(cmd, workDir); r != nil {
+		return r
+	}
+	p, b := project.match(cmd, workDir), c.builtIn.match(cmd, workDir)
+	if p != nil && (b == nil || p.level >= b.level) {
+		return p
 	}
+	return b
 }
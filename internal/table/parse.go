@@ -0,0 +1,376 @@
+package table
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// parseJSON accepts an array of objects (one row each), a single object
+// (one row), or an array of scalars (one "Value" column). Keys keep the
+// order they first appear in, which for ConvertTo-Json is the order
+// PowerShell would have displayed them.
+func parseJSON(s string) (*Table, bool) {
+	if s[0] != '[' && s[0] != '{' {
+		return nil, false
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return nil, false
+	}
+
+	var items []json.RawMessage
+	if s[0] == '{' {
+		items = []json.RawMessage{json.RawMessage(s)}
+	} else if err := json.Unmarshal([]byte(s), &items); err != nil || len(items) == 0 {
+		return nil, false
+	}
+
+	t := &Table{Format: "json"}
+	index := make(map[string]int)
+	var rows []map[string]string
+	for _, item := range items {
+		keys, values, ok := orderedObject(item)
+		if !ok {
+			// Array of scalars
+			if len(rows) > 0 {
+				return nil, false
+			}
+			return scalarTable(items)
+		}
+		for _, k := range keys {
+			if _, seen := index[k]; !seen {
+				index[k] = len(t.Columns)
+				t.Columns = append(t.Columns, k)
+			}
+		}
+		rows = append(rows, values)
+	}
+	if len(t.Columns) == 0 {
+		return nil, false
+	}
+
+	for _, values := range rows {
+		row := make([]string, len(t.Columns))
+		for i, c := range t.Columns {
+			row[i] = values[c]
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t, true
+}
+
+// orderedObject decodes a JSON object into its keys in document order and
+// their values as display text
+func orderedObject(raw json.RawMessage) ([]string, map[string]string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, nil, false
+	}
+
+	var keys []string
+	values := make(map[string]string)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, false
+		}
+		key, _ := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, false
+		}
+		if _, dup := values[key]; !dup {
+			keys = append(keys, key)
+		}
+		values[key] = cellText(value)
+	}
+	return keys, values, true
+}
+
+func scalarTable(items []json.RawMessage) (*Table, bool) {
+	t := &Table{Format: "json", Columns: []string{"Value"}}
+	for _, item := range items {
+		if len(item) > 0 && (item[0] == '{' || item[0] == '[') {
+			return nil, false
+		}
+		t.Rows = append(t.Rows, []string{cellText(item)})
+	}
+	return t, true
+}
+
+// cellText shows strings without quotes, null as empty, and nested values
+// as compact JSON
+func cellText(raw json.RawMessage) string {
+	raw = bytes.TrimSpace(raw)
+	switch {
+	case len(raw) == 0, string(raw) == "null":
+		return ""
+	case raw[0] == '"':
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			return strings.Join(strings.Fields(s), " ")
+		}
+	case raw[0] == '{' || raw[0] == '[':
+		var buf bytes.Buffer
+		if json.Compact(&buf, raw) == nil {
+			return buf.String()
+		}
+	}
+	return string(raw)
+}
+
+// parseCSV accepts comma- or tab-separated output with a header row, at
+// least two columns and the same number of fields on every line
+func parseCSV(s string) (*Table, bool) {
+	lines := strings.Split(s, "\n")
+	if len(lines) < 2 {
+		return nil, false
+	}
+
+	for _, sep := range []rune{',', '\t'} {
+		if !strings.ContainsRune(lines[0], sep) {
+			continue
+		}
+		r := csv.NewReader(strings.NewReader(s))
+		r.Comma = sep
+		r.LazyQuotes = true
+		records, err := r.ReadAll() // Fails on ragged rows
+		if err != nil || len(records) < 2 || len(records[0]) < 2 {
+			continue
+		}
+		if !headerLike(records[0]) {
+			continue
+		}
+		return &Table{Format: "csv", Columns: records[0], Rows: trimRows(records[1:])}, true
+	}
+	return nil, false
+}
+
+// headerLike rejects rows that can't be column names: empty, duplicated,
+// numeric, or long enough to be prose
+func headerLike(cols []string) bool {
+	seen := make(map[string]bool)
+	for _, c := range cols {
+		c = strings.TrimSpace(c)
+		if c == "" || seen[c] || len(c) > 40 {
+			return false
+		}
+		if _, ok := number(c); ok {
+			return false
+		}
+		seen[c] = true
+	}
+	return true
+}
+
+func trimRows(rows [][]string) [][]string {
+	for _, row := range rows {
+		for i := range row {
+			row[i] = strings.TrimSpace(row[i])
+		}
+	}
+	return rows
+}
+
+// span is a field's byte range within a line
+type span struct {
+	start, end int
+}
+
+// fields splits a line on whitespace, keeping each field's position
+func fields(line string) []span {
+	var spans []span
+	start := -1
+	for i, r := range line {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				spans = append(spans, span{start, i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, span{start, len(line)})
+	}
+	return spans
+}
+
+// parseAligned recognizes column layouts like ps, df, docker ps or
+// PowerShell's Format-Table. A dashed rule under the header gives exact
+// column boundaries; otherwise columns come from the header's words and
+// must line up (left or right) with the fields below them.
+func parseAligned(s string) (*Table, bool) {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line != "" && !strings.ContainsRune(line, '\t') {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 2 {
+		return nil, false
+	}
+	if len(lines) >= 3 && isRule(lines[1]) {
+		return parseRuled(lines[0], fields(lines[1]), lines[2:])
+	}
+	return parseColumns(lines[0], lines[1:])
+}
+
+// isRule reports whether line is only runs of dashes separated by spaces
+func isRule(line string) bool {
+	return strings.Trim(line, "- ") == "" && strings.Contains(line, "--")
+}
+
+// parseRuled splits columns using the dashed rule under the header. Values
+// can be wider than their dashes (PowerShell right-aligns dates and sizes
+// past the start of the rule), so each cut is made at the rightmost
+// position in the gap between two runs that is blank on every line. The
+// rule is ASCII, so its offsets are character positions; lines are cut by
+// character too so non-ASCII cells don't shift the columns after them.
+func parseRuled(header string, rule []span, lines []string) (*Table, bool) {
+	if len(rule) < 2 {
+		return nil, false
+	}
+	all := make([][]rune, 0, len(lines)+1)
+	all = append(all, []rune(header))
+	for _, line := range lines {
+		all = append(all, []rune(line))
+	}
+	blank := func(pos int) bool {
+		for _, chars := range all {
+			if pos < len(chars) && !unicode.IsSpace(chars[pos]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	cuts := make([]int, len(rule)+1) // Column i is [cuts[i], cuts[i+1])
+	for i := 1; i < len(rule); i++ {
+		cuts[i] = rule[i].start
+		for pos := rule[i].start - 1; pos >= rule[i-1].end; pos-- {
+			if blank(pos) {
+				cuts[i] = pos
+				break
+			}
+		}
+	}
+
+	cut := func(chars []rune) []string {
+		row := make([]string, len(rule))
+		for i := range rule {
+			start, end := min(cuts[i], len(chars)), len(chars)
+			if i+1 < len(rule) {
+				end = min(cuts[i+1], len(chars))
+			}
+			row[i] = strings.TrimSpace(string(chars[start:end]))
+		}
+		return row
+	}
+
+	t := &Table{Format: "aligned", Columns: cut(all[0])}
+	if !headerLike(t.Columns) {
+		return nil, false
+	}
+	for _, chars := range all[1:] {
+		t.Rows = append(t.Rows, cut(chars))
+	}
+	return t, true
+}
+
+// minAligned is the share of cells that must line up with their header
+const minAligned = 0.8
+
+func parseColumns(header string, lines []string) (*Table, bool) {
+	rows := make([][]span, len(lines))
+	n := 0 // Fewest fields on any row
+	for i, line := range lines {
+		rows[i] = fields(line)
+		if i == 0 || len(rows[i]) < n {
+			n = len(rows[i])
+		}
+	}
+
+	// Multi-word headers ("Mounted on", "CONTAINER ID") are joined, right
+	// to left, where only a single space separates the words
+	cols := fields(header)
+	for len(cols) > n {
+		joined := false
+		for i := len(cols) - 1; i > 0; i-- {
+			if cols[i].start-cols[i-1].end == 1 {
+				cols[i-1].end = cols[i].end
+				cols = append(cols[:i], cols[i+1:]...)
+				joined = true
+				break
+			}
+		}
+		if !joined {
+			return nil, false
+		}
+	}
+	if len(cols) < 2 || len(cols) != n {
+		return nil, false
+	}
+
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = header[c.start:c.end]
+	}
+	if !headerLike(names) || !titled(names) {
+		return nil, false
+	}
+
+	// Every column but the last must line up with the header, left- or
+	// right-aligned; the last takes whatever remains of the line, which is
+	// where ps puts its command lines
+	aligned, total := 0, 0
+	for _, row := range rows {
+		for i := 0; i < n-1; i++ {
+			total++
+			if row[i].start == cols[i].start || row[i].end == cols[i].end {
+				aligned++
+			}
+		}
+	}
+	if total == 0 || float64(aligned)/float64(total) < minAligned {
+		return nil, false
+	}
+
+	t := &Table{Format: "aligned", Columns: names}
+	for i, row := range rows {
+		cells := make([]string, n)
+		for j := 0; j < n-1; j++ {
+			cells[j] = lines[i][row[j].start:row[j].end]
+		}
+		cells[n-1] = lines[i][row[n-1].start:]
+		t.Rows = append(t.Rows, cells)
+	}
+	return t, true
+}
+
+// titled reports whether every name starts with an upper-case letter or a
+// symbol (PID, Filesystem, %CPU, 1K-blocks). Without a rule under it, this
+// is what tells a header apart from columns of file names.
+func titled(names []string) bool {
+	for _, name := range names {
+		r := []rune(name)[0]
+		if unicode.IsLower(r) || strings.ContainsAny(name, "./\\") {
+			return false
+		}
+	}
+	return true
+}
+
+// String describes the table's shape
+func (t *Table) String() string {
+	return fmt.Sprintf("%s table: %d columns, %d rows", t.Format, len(t.Columns), len(t.Rows))
+}
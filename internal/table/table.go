@@ -0,0 +1,178 @@
+// Package table detects structured command output (JSON, CSV, and
+// whitespace-aligned columns like ps or df) and represents it as rows and
+// columns that can be sorted, rendered and summarized for the planner.
+package table
+
+import (
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Table is structured command output
+type Table struct {
+	Format  string     `json:"format"` // "json", "csv" or "aligned"
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+
+	// Dropped counts rows cut off by Head
+	Dropped int `json:"dropped,omitempty"`
+}
+
+// Detect recognizes structured output, trying JSON, then CSV, then
+// aligned columns. Plain text returns false.
+func Detect(output string) (*Table, bool) {
+	trimmed := strings.TrimSpace(output)
+	if trimmed == "" {
+		return nil, false
+	}
+	if t, ok := parseJSON(trimmed); ok {
+		return t, true
+	}
+	if t, ok := parseCSV(trimmed); ok {
+		return t, true
+	}
+	// Leading spaces are kept: they put right-aligned headers over their
+	// columns
+	if t, ok := parseAligned(output); ok {
+		return t, true
+	}
+	return nil, false
+}
+
+// Column finds a column by case-insensitive name or 1-based number
+func (t *Table) Column(name string) (int, bool) {
+	for i, c := range t.Columns {
+		if strings.EqualFold(c, name) {
+			return i, true
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= 1 && n <= len(t.Columns) {
+		return n - 1, true
+	}
+	return 0, false
+}
+
+// Sort orders rows by column col, numerically when both values are
+// numbers and case-insensitively otherwise. The sort is stable.
+func (t *Table) Sort(col int, desc bool) {
+	sort.SliceStable(t.Rows, func(i, j int) bool {
+		a, b := t.cell(i, col), t.cell(j, col)
+		if desc {
+			a, b = b, a
+		}
+		return less(a, b)
+	})
+}
+
+func (t *Table) cell(row, col int) string {
+	if col < len(t.Rows[row]) {
+		return t.Rows[row][col]
+	}
+	return ""
+}
+
+// less compares numbers (including 12%, 1,024 and 3.5) by value and
+// everything else as text
+func less(a, b string) bool {
+	na, aok := number(a)
+	nb, bok := number(b)
+	switch {
+	case aok && bok:
+		return na < nb
+	case aok != bok:
+		return aok // Numbers before text
+	}
+	return strings.ToLower(a) < strings.ToLower(b)
+}
+
+func number(s string) (float64, bool) {
+	s = strings.TrimSuffix(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), "%")
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// Head returns a copy of the table with at most n rows. Sorting the copy
+// leaves t untouched.
+func (t *Table) Head(n int) *Table {
+	rows := t.Rows
+	if len(rows) > n {
+		rows = rows[:n]
+	}
+	return &Table{
+		Format:  t.Format,
+		Columns: t.Columns,
+		Rows:    append([][]string(nil), rows...),
+		Dropped: t.Dropped + len(t.Rows) - len(rows),
+	}
+}
+
+// Text renders the table as aligned plain text with a dashed rule under
+// the header, which Detect parses back exactly
+func (t *Table) Text() string {
+	widths := make([]int, len(t.Columns))
+	for i, c := range t.Columns {
+		widths[i] = max(len([]rune(c)), 1)
+	}
+	for _, row := range t.Rows {
+		for i := range widths {
+			if i < len(row) {
+				widths[i] = max(widths[i], len([]rune(row[i])))
+			}
+		}
+	}
+
+	var sb strings.Builder
+	writeRow := func(cells []string) {
+		var line strings.Builder
+		for i := range widths {
+			v := ""
+			if i < len(cells) {
+				v = cells[i]
+			}
+			if i < len(widths)-1 {
+				line.WriteString(fmt.Sprintf("%-*s  ", widths[i], v))
+			} else {
+				line.WriteString(v)
+			}
+		}
+		sb.WriteString(strings.TrimRight(line.String(), " "))
+		sb.WriteByte('\n')
+	}
+
+	writeRow(t.Columns)
+	rule := make([]string, len(widths))
+	for i, w := range widths {
+		rule[i] = strings.Repeat("-", w)
+	}
+	writeRow(rule)
+	for _, row := range t.Rows {
+		writeRow(row)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// CSV renders the table as CSV, header first
+func (t *Table) CSV() string {
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	w.Write(t.Columns)
+	w.WriteAll(t.Rows)
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// Summary describes the table for the planner: its shape and the first
+// rows as CSV, so follow-up questions ("which one uses the most memory?")
+// can refer to real values
+func (t *Table) Summary(maxRows int) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%d rows, columns: %s", len(t.Rows)+t.Dropped, strings.Join(t.Columns, ", ")))
+	head := t.Head(maxRows)
+	sb.WriteString("\n" + head.CSV())
+	if head.Dropped > 0 {
+		sb.WriteString(fmt.Sprintf("\n... (%d more rows)", head.Dropped))
+	}
+	return sb.String()
+}
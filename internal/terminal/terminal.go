@@ -0,0 +1,325 @@
+// Package terminal turns raw program output into what a terminal would
+// have shown, and measures and wraps text that contains ANSI styling.
+//
+// Command output is captured through pipes (or a pty), so it still carries
+// the control sequences a terminal would have interpreted: \r and cursor
+// moves from progress bars, erase-line codes, window titles, and SGR colors.
+// Render replays them on a small virtual screen and returns the final
+// screen as text, keeping only the colors.
+package terminal
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+const (
+	tabWidth  = 8
+	maxPenLen = 256 // Longer accumulated styles are cut back to the last SGR
+	sgrReset  = "\x1b[0m"
+)
+
+// cell is one column of the virtual screen
+type cell struct {
+	text  string // Grapheme cluster; "" for the second column of a wide one
+	pen   string // SGR sequences in effect when it was written
+	width int
+}
+
+var blank = cell{text: " ", width: 1}
+
+// screen is a grow-only grid. Row 0 is the first line of output; there is
+// no fixed height, so nothing scrolls off.
+type screen struct {
+	rows     [][]cell
+	row, col int
+	pen      string
+	savedRow int
+	savedCol int
+}
+
+// Render interprets control characters and escape sequences in s and
+// returns the final screen contents. SGR color and style sequences are
+// kept; everything else (cursor movement, erasing, titles, hyperlinks,
+// mode switches) is applied or dropped.
+func Render(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if !strings.ContainsAny(s, "\x1b\r\b\t\x9b") {
+		return s
+	}
+
+	sc := &screen{}
+	p := ansi.NewParser()
+	var state byte
+	for len(s) > 0 {
+		seq, width, n, newState := ansi.DecodeSequence(s, state, p)
+		state = newState
+		s = s[n:]
+
+		switch {
+		case width > 0:
+			sc.put(seq, width)
+		case len(seq) == 1 && (seq[0] < 0x20 || seq[0] == 0x7f):
+			sc.control(seq[0])
+		case ansi.HasCsiPrefix(seq):
+			sc.csi(seq, p)
+		case ansi.HasEscPrefix(seq) && len(seq) == 2:
+			sc.esc(seq[1])
+		case ansi.HasOscPrefix(seq), ansi.HasDcsPrefix(seq), ansi.HasApcPrefix(seq),
+			ansi.HasEscPrefix(seq), ansi.HasStPrefix(seq):
+			// Titles, hyperlinks, device queries: nothing to show
+		default:
+			// Zero-width graphemes (e.g. a lone combining mark)
+			if seq != "" && seq[0] >= 0x20 {
+				sc.put(seq, 0)
+			}
+		}
+	}
+	return sc.String()
+}
+
+// line returns the current row, creating rows up to it as needed
+func (sc *screen) line() []cell {
+	for len(sc.rows) <= sc.row {
+		sc.rows = append(sc.rows, nil)
+	}
+	return sc.rows[sc.row]
+}
+
+// put writes a grapheme at the cursor and advances it
+func (sc *screen) put(g string, width int) {
+	line := sc.line()
+
+	if width == 0 {
+		// Combining character: attach to the previous cell
+		if sc.col > 0 && sc.col <= len(line) {
+			line[sc.col-1].text += g
+		}
+		return
+	}
+
+	for len(line) < sc.col+width {
+		line = append(line, blank)
+	}
+	// Overwriting half of a wide character blanks the other half
+	if c := line[sc.col]; c.text == "" && sc.col > 0 {
+		line[sc.col-1] = blank
+	}
+	if end := sc.col + width - 1; line[end].width == 2 && end+1 < len(line) {
+		line[end+1] = blank
+	}
+
+	line[sc.col] = cell{text: g, pen: sc.pen, width: width}
+	for i := 1; i < width; i++ {
+		line[sc.col+i] = cell{pen: sc.pen}
+	}
+	sc.rows[sc.row] = line
+	sc.col += width
+}
+
+// control handles C0 control characters
+func (sc *screen) control(c byte) {
+	switch c {
+	case '\n', '\v', '\f':
+		sc.row++
+		sc.col = 0
+	case '\r':
+		sc.col = 0
+	case '\b':
+		if sc.col > 0 {
+			sc.col--
+		}
+	case '\t':
+		sc.col = (sc.col/tabWidth + 1) * tabWidth
+	}
+}
+
+// esc handles two-byte escape sequences
+func (sc *screen) esc(c byte) {
+	switch c {
+	case '7':
+		sc.savedRow, sc.savedCol = sc.row, sc.col
+	case '8':
+		sc.row, sc.col = sc.savedRow, sc.savedCol
+	case 'c':
+		*sc = screen{}
+	}
+}
+
+// csi handles control sequences; unknown ones are dropped
+func (sc *screen) csi(seq string, p *ansi.Parser) {
+	cmd := ansi.Cmd(p.Command())
+	if cmd.Prefix() != 0 || cmd.Intermediate() != 0 {
+		return // Private modes (?25l cursor hide, ?2004h paste) etc.
+	}
+	n, _ := p.Param(0, 1)
+	if n < 1 {
+		n = 1
+	}
+
+	switch cmd.Final() {
+	case 'm':
+		sc.sgr(seq, p)
+	case 'A':
+		sc.row = max(sc.row-n, 0)
+	case 'B':
+		sc.row += n
+	case 'C':
+		sc.col += n
+	case 'D':
+		sc.col = max(sc.col-n, 0)
+	case 'E':
+		sc.row += n
+		sc.col = 0
+	case 'F':
+		sc.row = max(sc.row-n, 0)
+		sc.col = 0
+	case 'G', '`':
+		sc.col = n - 1
+	case 'd':
+		sc.row = n - 1
+	case 'H', 'f':
+		sc.row = n - 1
+		col, _ := p.Param(1, 1)
+		sc.col = max(col, 1) - 1
+	case 'K':
+		mode, _ := p.Param(0, 0)
+		sc.eraseLine(mode)
+	case 'J':
+		mode, _ := p.Param(0, 0)
+		sc.eraseDisplay(mode)
+	case 'P':
+		line := sc.line()
+		if sc.col < len(line) {
+			end := min(sc.col+n, len(line))
+			sc.rows[sc.row] = append(line[:sc.col], line[end:]...)
+		}
+	case 's':
+		sc.savedRow, sc.savedCol = sc.row, sc.col
+	case 'u':
+		sc.row, sc.col = sc.savedRow, sc.savedCol
+	}
+}
+
+// sgr updates the pen. A reset (empty or leading 0 parameter) starts a new
+// pen; anything else is layered on top of the current one.
+func (sc *screen) sgr(seq string, p *ansi.Parser) {
+	first, ok := p.Param(0, 0)
+	switch {
+	case !ok || first == 0:
+		if len(p.Params()) <= 1 {
+			sc.pen = ""
+		} else {
+			sc.pen = seq
+		}
+	case len(sc.pen)+len(seq) > maxPenLen:
+		sc.pen = seq
+	default:
+		sc.pen += seq
+	}
+}
+
+func (sc *screen) eraseLine(mode int) {
+	line := sc.line()
+	switch mode {
+	case 0: // Cursor to end of line
+		if sc.col < len(line) {
+			sc.rows[sc.row] = line[:sc.col]
+		}
+	case 1: // Start of line through cursor
+		for i := 0; i <= sc.col && i < len(line); i++ {
+			line[i] = blank
+		}
+	case 2:
+		sc.rows[sc.row] = nil
+	}
+}
+
+func (sc *screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0: // Cursor to end of screen
+		sc.eraseLine(0)
+		if sc.row+1 < len(sc.rows) {
+			sc.rows = sc.rows[:sc.row+1]
+		}
+	case 1: // Start of screen through cursor
+		for i := 0; i < sc.row && i < len(sc.rows); i++ {
+			sc.rows[i] = nil
+		}
+		sc.eraseLine(1)
+	case 2, 3:
+		// Everything printed so far is gone. A real terminal leaves the
+		// cursor in place, but here that would only add blank lines, so
+		// later output starts from the top.
+		sc.rows = nil
+		sc.row, sc.col = 0, 0
+	}
+}
+
+// String renders the screen as lines of text with minimal SGR changes.
+// Trailing blanks are trimmed and every styled line ends with a reset.
+// Rows run through the cursor's, so a final newline is preserved.
+func (sc *screen) String() string {
+	for len(sc.rows) <= sc.row {
+		sc.rows = append(sc.rows, nil)
+	}
+
+	var sb strings.Builder
+	for i, line := range sc.rows {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+
+		end := len(line)
+		for end > 0 && line[end-1].text == " " && line[end-1].pen == "" {
+			end--
+		}
+
+		pen := ""
+		for _, c := range line[:end] {
+			if c.text == "" {
+				continue // Second half of a wide character
+			}
+			if c.pen != pen {
+				if pen != "" {
+					sb.WriteString(sgrReset)
+				}
+				sb.WriteString(c.pen)
+				pen = c.pen
+			}
+			sb.WriteString(c.text)
+		}
+		if pen != "" {
+			sb.WriteString(sgrReset)
+		}
+	}
+	return sb.String()
+}
+
+// Strip removes all escape sequences from s
+func Strip(s string) string {
+	return ansi.Strip(s)
+}
+
+// Width is the number of terminal columns s occupies, ignoring escape
+// sequences and counting wide characters (CJK, emoji) as two
+func Width(s string) int {
+	return ansi.StringWidth(s)
+}
+
+// Wrap wraps each line of s to width columns, breaking at spaces where
+// possible, without splitting escape sequences or wide characters.
+// Styles are carried across the inserted line breaks.
+func Wrap(s string, width int) string {
+	if width <= 0 {
+		return s
+	}
+	return ansi.Wrap(s, width, "")
+}
+
+// Truncate cuts s to at most width columns, ending it with "…" when
+// anything was removed. Escape sequences are kept intact.
+func Truncate(s string, width int) string {
+	return ansi.Truncate(s, width, "…")
+}
@@ -0,0 +1,344 @@
+// Package trash keeps copies of files before a command deletes or
+// overwrites them, so the change can be undone.
+package trash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTooLarge is returned when the paths to snapshot exceed MaxBytes
+var ErrTooLarge = errors.New("too large to snapshot")
+
+// manifestName is the file in each snapshot directory describing it
+const manifestName = "snapshot.json"
+
+// Entry is one path captured by a snapshot
+type Entry struct {
+	Path    string `json:"path"`    // Absolute path
+	Existed bool   `json:"existed"` // False if the command would create it; undo removes it
+	Size    int64  `json:"size,omitempty"`
+}
+
+// Snapshot is the state of the paths one command was about to change
+type Snapshot struct {
+	ID      string    `json:"id"`
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+	Entries []Entry   `json:"entries"`
+	Size    int64     `json:"size"` // Bytes stored
+}
+
+// Trash stores snapshots under one directory, one subdirectory each
+type Trash struct {
+	dir string
+
+	// MaxSnapshots and MaxBytes limit what is kept; the oldest snapshots
+	// are removed first. 0 means no limit. A single snapshot larger than
+	// MaxBytes is refused.
+	MaxSnapshots int
+	MaxBytes     int64
+
+	mu sync.Mutex
+}
+
+// New returns a trash stored in dir, keeping 20 snapshots and 100 MB
+func New(dir string) *Trash {
+	return &Trash{dir: dir, MaxSnapshots: 20, MaxBytes: 100 << 20}
+}
+
+// Snapshot copies paths into the trash before command changes them.
+// Paths that don't exist yet are recorded so undo can remove what the
+// command creates. Paths inside another listed path are covered by it.
+func (t *Trash) Snapshot(command string, paths []string) (*Snapshot, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snap := &Snapshot{Command: command, Time: time.Now()}
+	for _, path := range topLevel(paths) {
+		entry := Entry{Path: path}
+		if _, err := os.Lstat(path); err == nil {
+			size, err := treeSize(path, t.MaxBytes)
+			if err == nil && t.MaxBytes > 0 && snap.Size+size > t.MaxBytes {
+				err = ErrTooLarge
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			entry.Existed = true
+			entry.Size = size
+			snap.Size += size
+		}
+		snap.Entries = append(snap.Entries, entry)
+	}
+	if len(snap.Entries) == 0 {
+		return nil, errors.New("nothing to snapshot")
+	}
+
+	dir, err := t.newDir(snap)
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range snap.Entries {
+		if !entry.Existed {
+			continue
+		}
+		if err := copyTree(entry.Path, filepath.Join(dir, strconv.Itoa(i))); err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("could not copy %s: %w", entry.Path, err)
+		}
+	}
+	if err := writeManifest(dir, snap); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	t.prune()
+	return snap, nil
+}
+
+// newDir creates the directory for snap and assigns its ID, which sorts
+// by creation time
+func (t *Trash) newDir(snap *Snapshot) (string, error) {
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return "", err
+	}
+	base := snap.Time.Format("20060102-150405.000000")
+	for n := 0; ; n++ {
+		id := base
+		if n > 0 {
+			id = fmt.Sprintf("%s-%d", base, n)
+		}
+		dir := filepath.Join(t.dir, id)
+		err := os.Mkdir(dir, 0755)
+		if err == nil {
+			snap.ID = id
+			return dir, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+	}
+}
+
+// Restore puts every path of snapshot id back the way it was and removes
+// the snapshot. Paths the command created are deleted.
+func (t *Trash) Restore(id string) (*Snapshot, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	dir := filepath.Join(t.dir, id)
+	snap, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(snap.Entries) - 1; i >= 0; i-- {
+		entry := snap.Entries[i]
+		if err := os.RemoveAll(entry.Path); err != nil {
+			return nil, fmt.Errorf("could not remove %s: %w", entry.Path, err)
+		}
+		if !entry.Existed {
+			continue
+		}
+		if err := restoreTree(filepath.Join(dir, strconv.Itoa(i)), entry.Path); err != nil {
+			return nil, fmt.Errorf("could not restore %s: %w", entry.Path, err)
+		}
+	}
+	return snap, os.RemoveAll(dir)
+}
+
+// List returns the stored snapshots, most recent first
+func (t *Trash) List() ([]*Snapshot, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.list()
+}
+
+func (t *Trash) list() ([]*Snapshot, error) {
+	dirs, err := os.ReadDir(t.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var snaps []*Snapshot
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		snap, err := readManifest(filepath.Join(t.dir, d.Name()))
+		if err != nil {
+			// Left over from an interrupted snapshot
+			os.RemoveAll(filepath.Join(t.dir, d.Name()))
+			continue
+		}
+		snaps = append(snaps, snap)
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].ID > snaps[j].ID })
+	return snaps, nil
+}
+
+// prune removes the oldest snapshots beyond MaxSnapshots or MaxBytes
+func (t *Trash) prune() {
+	snaps, err := t.list()
+	if err != nil {
+		return
+	}
+	var total int64
+	for i, snap := range snaps {
+		total += snap.Size
+		if (t.MaxSnapshots > 0 && i >= t.MaxSnapshots) || (t.MaxBytes > 0 && total > t.MaxBytes) {
+			os.RemoveAll(filepath.Join(t.dir, snap.ID))
+		}
+	}
+}
+
+func readManifest(dir string) (*Snapshot, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no snapshot %s", filepath.Base(dir))
+		}
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// writeManifest is written last, so a directory without one is incomplete
+func writeManifest(dir string, snap *Snapshot) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, manifestName), data, 0644)
+}
+
+// topLevel cleans and de-duplicates paths, dropping any inside another
+func topLevel(paths []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		out = append(out, p)
+	}
+	var kept []string
+	for _, p := range out {
+		inside := false
+		for _, other := range out {
+			if other != p && strings.HasPrefix(p, strings.TrimSuffix(other, string(filepath.Separator))+string(filepath.Separator)) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// treeSize adds up the file sizes under path, giving up with ErrTooLarge
+// once they pass limit (if positive)
+func treeSize(path string, limit int64) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		if limit > 0 && size > limit {
+			return ErrTooLarge
+		}
+		return nil
+	})
+	return size, err
+}
+
+// copyTree copies a file, symlink or directory tree, keeping modes and
+// file modification times
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			if err := os.MkdirAll(target, info.Mode().Perm()|0700); err != nil {
+				return err
+			}
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			if err := copyFile(path, target, info.Mode().Perm()); err != nil {
+				return err
+			}
+			return os.Chtimes(target, info.ModTime(), info.ModTime())
+		}
+		return nil // Devices, sockets and pipes can't be kept
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// restoreTree moves a stored copy back into place, copying when the trash
+// is on another filesystem
+func restoreTree(stored, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(stored, path); err == nil {
+		return nil
+	}
+	return copyTree(stored, path)
+}
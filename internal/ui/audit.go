@@ -0,0 +1,64 @@
+package ui
+
+import (
+	"shell-e/internal/audit"
+	"shell-e/internal/executor"
+	"shell-e/internal/planner"
+	"shell-e/internal/safety"
+)
+
+// SetAudit makes the model record every planned command in l
+func (m *Model) SetAudit(l *audit.Log) {
+	m.audit = l
+}
+
+// newAuditRecord starts the audit record of a planned command
+func (m *Model) newAuditRecord(plan *planner.CommandPlan, a *safety.Assessment) *audit.Record {
+	rec := &audit.Record{
+		UserInput: m.getLastUserInput(),
+		Plan:      plan.Response,
+		Command:   a.Command,
+		Shell:     plan.Shell,
+		WorkDir:   m.workDir,
+		Stdin:     plan.Stdin,
+		Reason:    a.Reason,
+		ExitCode:  -1,
+	}
+	if a.Rule != nil {
+		rec.Rule = a.Rule.Source + ":" + a.Rule.Name
+	}
+	if t := m.executor.CurrentTarget(); t != nil {
+		rec.WorkDir = t.Name() + ":" + m.executor.TargetDir()
+	}
+	switch a.Level {
+	case safety.Blocked:
+		rec.Safety = "blocked"
+	case safety.NeedsConfirm:
+		rec.Safety = "confirm"
+	default:
+		rec.Safety = "safe"
+	}
+	return rec
+}
+
+// finishAudit completes rec with how the command ended and writes it
+func (m *Model) finishAudit(rec *audit.Record, result *executor.Result) {
+	if rec == nil || result == nil {
+		return
+	}
+	rec.Executed = !result.Refused
+	rec.Hook, rec.Rewritten = result.Hook, result.Rewritten
+	rec.ExitCode = result.ExitCode
+	rec.OutputHash = audit.HashOutput(fullOutput(result))
+	m.writeAudit(rec)
+}
+
+// writeAudit appends rec to the audit log, if one is open
+func (m *Model) writeAudit(rec *audit.Record) {
+	if m.audit == nil || rec == nil {
+		return
+	}
+	if err := m.audit.Append(*rec); err != nil {
+		m.addMessage(errorStyle.Render("  Could not write audit log: " + err.Error()))
+	}
+}
@@ -0,0 +1,24 @@
+package ui
+
+import (
+	"shell-e/internal/executor"
+	"shell-e/internal/hooks"
+	"shell-e/internal/planner"
+)
+
+// hookPlan describes plan for the configured hooks
+func (m *Model) hookPlan(plan *planner.CommandPlan) *hooks.Plan {
+	return &hooks.Plan{
+		Request:   m.getLastUserInput(),
+		Response:  plan.Response,
+		Reasoning: plan.Reasoning,
+	}
+}
+
+// addHookNotice tells the user a hook ran something other than the
+// planned command. A refusal needs no notice; it is the result's error.
+func (m *Model) addHookNotice(result *executor.Result) {
+	if result != nil && result.Rewritten != "" {
+		m.addMessage(confirmStyle.Render("  ↪ Hook " + result.Hook + " ran this instead: " + result.Rewritten))
+	}
+}
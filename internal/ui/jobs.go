@@ -0,0 +1,221 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"shell-e/internal/audit"
+	"shell-e/internal/executor"
+	"shell-e/internal/planner"
+)
+
+// jobDoneMsg is sent when a background job finishes
+type jobDoneMsg struct {
+	job *executor.Job
+}
+
+// foregroundDoneMsg is sent when a job waited for with /fg finishes
+type foregroundDoneMsg struct {
+	job *executor.Job
+}
+
+// defaultTailLines is how many lines /tail shows without a count
+const defaultTailLines = 20
+
+// startJob runs the plan's command as a background job and returns a
+// command that reports when it finishes. opts carries its password and
+// stdin, if any.
+func (m *Model) startJob(cmd, shell string, plan *planner.CommandPlan, opts executor.ExecOptions) tea.Cmd {
+	job := m.executor.StartJobWithOptions(cmd, shell, opts)
+	m.addMessage(statusStyle.Render(fmt.Sprintf("  🧵 Started job [%d] — /jobs to list, /tail %d to watch, /fg %d to wait for it",
+		job.ID, job.ID, job.ID)))
+
+	id := m.mem.RecordExchange(m.getLastUserInput(), cmd, fmt.Sprintf("Started as background job [%d]", job.ID), plan.Response)
+	m.mem.Save()
+	if m.jobExchanges == nil {
+		m.jobExchanges = make(map[int]int)
+	}
+	m.jobExchanges[job.ID] = id
+	if m.pendingAudit != nil {
+		if m.jobAudits == nil {
+			m.jobAudits = make(map[int]*audit.Record)
+		}
+		m.pendingAudit.Background = true
+		m.jobAudits[job.ID] = m.pendingAudit
+		m.pendingAudit = nil
+	}
+
+	m.status = "Ready"
+	m.processing = false
+	m.addMessage("")
+	m.updateViewport()
+	return waitForJob(job)
+}
+
+// waitForJob returns a command that delivers jobDoneMsg once job finishes
+func waitForJob(job *executor.Job) tea.Cmd {
+	return func() tea.Msg {
+		<-job.Done()
+		return jobDoneMsg{job: job}
+	}
+}
+
+// finishJob saves a finished job's output to the exchange that started it
+// and completes its audit record. It runs once per job, and returns the
+// exchange's ID.
+func (m *Model) finishJob(job *executor.Job) int {
+	r := job.Result()
+	id, ok := m.jobExchanges[job.ID]
+	if ok && r != nil {
+		m.saveOutput(id, r)
+		m.mem.Save()
+	}
+	delete(m.jobExchanges, job.ID)
+	if rec, ok := m.jobAudits[job.ID]; ok {
+		m.finishAudit(rec, r)
+		delete(m.jobAudits, job.ID)
+	}
+	m.checkPasswordRejected(r)
+	return id
+}
+
+// handleJobDone notifies the user that a background job finished, unless
+// it is in the foreground, whose wait reports it instead
+func (m *Model) handleJobDone(job *executor.Job) (tea.Model, tea.Cmd) {
+	if m.foregrounded[job.ID] {
+		delete(m.foregrounded, job.ID)
+		return m, nil
+	}
+	m.finishJob(job)
+
+	icon := "✓"
+	if job.Status() != executor.JobDone {
+		icon = "✗"
+	}
+	m.addMessage(statusStyle.Render(fmt.Sprintf("🔔 Job [%d] %s %s (%.1fs): %s",
+		job.ID, icon, job.Status(), job.Runtime().Seconds(), job.Command)))
+	if r := job.Result(); r != nil && !r.Success && r.Error != "" {
+		m.addMessage(errorStyle.Render("  " + r.Error))
+	}
+	m.addHookNotice(job.Result())
+	if r := job.Result(); r != nil && r.NotSnapshotted != "" {
+		m.addSnapshotNotice(r)
+	}
+	if tail := job.Tail(5); len(tail) > 0 {
+		m.addMessage(resultStyle.Render(strings.Join(tail, "\n")))
+	}
+	m.addMessage("")
+	m.updateViewport()
+	return m, nil
+}
+
+// handleForegroundDone shows the result of a job waited for with /fg. It
+// belongs to the exchange that started the job, so nothing new is recorded.
+func (m *Model) handleForegroundDone(job *executor.Job) (tea.Model, tea.Cmd) {
+	m.stopLiveOutput()
+	id := m.finishJob(job)
+	if r := job.Result(); r != nil {
+		m.addHookNotice(r)
+		m.showResult(r, id)
+	}
+
+	m.status = "Ready"
+	m.processing = false
+	m.addMessage("")
+	m.updateViewport()
+	return m, nil
+}
+
+// handleJobCommand implements /jobs, /tail, /fg and /kill
+func (m *Model) handleJobCommand(name string, args []string) (tea.Model, tea.Cmd) {
+	if name == "/jobs" {
+		jobs := m.executor.Jobs()
+		if len(jobs) == 0 {
+			m.addMessage(statusStyle.Render("No background jobs"))
+		} else {
+			m.addMessage(statusStyle.Render("🧵 Jobs:"))
+			for _, job := range jobs {
+				m.addMessage("  " + job.String())
+			}
+		}
+		m.updateViewport()
+		return m, nil
+	}
+
+	if len(args) == 0 {
+		m.addMessage(statusStyle.Render(fmt.Sprintf("Usage: %s <job id>", name)))
+		m.updateViewport()
+		return m, nil
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(args[0], "%"))
+	job, ok := m.executor.Job(id)
+	if err != nil || !ok {
+		m.addMessage(statusStyle.Render("No such job: " + args[0]))
+		m.updateViewport()
+		return m, nil
+	}
+
+	switch name {
+	case "/tail":
+		n := defaultTailLines
+		if len(args) > 1 {
+			if v, err := strconv.Atoi(args[1]); err == nil {
+				n = v
+			}
+		}
+		m.addMessage(statusStyle.Render("📄 " + job.String()))
+		if tail := job.Tail(n); len(tail) > 0 {
+			m.addMessage(resultStyle.Render(strings.Join(tail, "\n")))
+		} else {
+			m.addMessage(statusStyle.Render("  (no output yet)"))
+		}
+	case "/kill":
+		if job.Kill() {
+			m.addMessage(statusStyle.Render(fmt.Sprintf("🛑 Killing job [%d]...", job.ID)))
+		} else {
+			m.addMessage(statusStyle.Render(fmt.Sprintf("Job [%d] already %s", job.ID, job.Status())))
+		}
+	case "/fg":
+		if job.Status() != executor.JobRunning {
+			m.addMessage(statusStyle.Render(fmt.Sprintf("Job [%d] already %s — use /tail %d for its output",
+				job.ID, job.Status(), job.ID)))
+			break
+		}
+		return m, m.foregroundJob(job)
+	}
+	m.updateViewport()
+	return m, nil
+}
+
+// foregroundJob waits for job like a normally executed command: its output
+// streams into the chat, Esc kills it, and the result is shown when done
+func (m *Model) foregroundJob(job *executor.Job) tea.Cmd {
+	if m.foregrounded == nil {
+		m.foregrounded = make(map[int]bool)
+	}
+	m.foregrounded[job.ID] = true
+
+	m.addMessage(statusStyle.Render(fmt.Sprintf("⏳ Job [%d] in the foreground — Esc to kill it", job.ID)))
+	m.liveOutput = job.Tail(maxLiveLines)
+	m.livePartial = [2]partialLine{}
+	m.processing = true
+	m.status = fmt.Sprintf("⚡ Waiting for job [%d]...", job.ID)
+	m.cancelExec = func() { job.Kill() }
+	m.updateViewport()
+
+	lines, _ := job.Follow()
+	events := make(chan tea.Msg, 128)
+	go func() {
+		for line := range lines {
+			events <- outputLineMsg{line: line, events: events}
+		}
+		<-job.Done()
+		events <- foregroundDoneMsg{job: job}
+		close(events)
+	}()
+
+	return tea.Batch(m.spinner.Tick, waitForExecEvent(events))
+}
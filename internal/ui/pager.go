@@ -0,0 +1,273 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"shell-e/internal/terminal"
+)
+
+var (
+	lineNoStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#555555"))
+
+	matchStyle = lipgloss.NewStyle().
+			Background(lipgloss.Color("#FFD700")).
+			Foreground(lipgloss.Color("#000000"))
+)
+
+type pagerMode int
+
+const (
+	pagerBrowse pagerMode = iota
+	pagerSearch           // Typing a search query
+	pagerSave             // Typing a path to save to
+)
+
+// pager is a full-screen view of one command's complete output, with line
+// numbers, case-insensitive search and saving to a file
+type pager struct {
+	title   string
+	lines   []string
+	baseDir string // Relative save paths resolve against this
+
+	viewport viewport.Model
+	input    textinput.Model
+	mode     pagerMode
+
+	query   string
+	matches []int // Indexes of lines containing query
+	match   int   // Current position in matches
+	notice  string
+}
+
+func newPager(title, content, baseDir string, width, height int) *pager {
+	in := textinput.New()
+	in.Prompt = ""
+
+	p := &pager{
+		title:    title,
+		lines:    strings.Split(strings.TrimRight(content, "\n"), "\n"),
+		baseDir:  baseDir,
+		viewport: viewport.New(width, height),
+		input:    in,
+	}
+	p.viewport.SetHorizontalStep(8)
+	p.setSize(width, height)
+	p.render()
+	return p
+}
+
+// setSize leaves a line each for the title bar and the footer
+func (p *pager) setSize(width, height int) {
+	p.viewport.Width = width
+	p.viewport.Height = height - 2
+	if p.viewport.Height < 1 {
+		p.viewport.Height = 1
+	}
+	p.input.Width = width - 10
+}
+
+// render numbers the lines and highlights search matches
+func (p *pager) render() {
+	width := len(fmt.Sprint(len(p.lines)))
+	current := -1
+	if len(p.matches) > 0 {
+		current = p.matches[p.match]
+	}
+
+	var sb strings.Builder
+	for i, line := range p.lines {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		marker := " "
+		if i == current {
+			marker = "▶"
+		}
+		sb.WriteString(lineNoStyle.Render(fmt.Sprintf("%s%*d │ ", marker, width, i+1)))
+		sb.WriteString(highlight(line, p.query))
+	}
+	p.viewport.SetContent(sb.String())
+}
+
+// highlight marks every case-insensitive occurrence of query in line.
+// Matching lines lose their own colors so the marks stay readable.
+func highlight(line, query string) string {
+	if query == "" {
+		return line
+	}
+	plain := terminal.Strip(line)
+	lower := strings.ToLower(plain)
+	q := strings.ToLower(query)
+	if !strings.Contains(lower, q) {
+		return line
+	}
+	line = plain
+
+	var sb strings.Builder
+	for {
+		i := strings.Index(lower, q)
+		if i < 0 || len(lower) != len(line) {
+			// Lowercasing changed byte offsets (rare non-ASCII); stop marking
+			sb.WriteString(line)
+			return sb.String()
+		}
+		sb.WriteString(line[:i])
+		sb.WriteString(matchStyle.Render(line[i : i+len(q)]))
+		line, lower = line[i+len(q):], lower[i+len(q):]
+	}
+}
+
+// search finds query and jumps to the first match at or below the top of
+// the screen
+func (p *pager) search(query string) {
+	p.query = query
+	p.matches = nil
+	p.match = 0
+	if query == "" {
+		p.notice = ""
+		p.render()
+		return
+	}
+
+	q := strings.ToLower(query)
+	for i, line := range p.lines {
+		if strings.Contains(strings.ToLower(terminal.Strip(line)), q) {
+			p.matches = append(p.matches, i)
+		}
+	}
+	if len(p.matches) == 0 {
+		p.notice = fmt.Sprintf("No match for %q", query)
+		p.render()
+		return
+	}
+	for i, line := range p.matches {
+		if line >= p.viewport.YOffset {
+			p.match = i
+			break
+		}
+	}
+	p.showMatch()
+}
+
+// step moves to the next (+1) or previous (-1) match, wrapping around
+func (p *pager) step(dir int) {
+	if len(p.matches) == 0 {
+		return
+	}
+	p.match = (p.match + dir + len(p.matches)) % len(p.matches)
+	p.showMatch()
+}
+
+func (p *pager) showMatch() {
+	p.notice = fmt.Sprintf("Match %d/%d for %q", p.match+1, len(p.matches), p.query)
+	p.render()
+	line := p.matches[p.match]
+	if line < p.viewport.YOffset || line >= p.viewport.YOffset+p.viewport.Height {
+		p.viewport.SetYOffset(line - p.viewport.Height/3)
+	}
+}
+
+// save writes the output to path, relative to the working directory
+func (p *pager) save(path string) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		p.notice = "Save cancelled"
+		return
+	}
+	if strings.HasPrefix(path, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.baseDir, path)
+	}
+
+	text := terminal.Strip(strings.Join(p.lines, "\n")) + "\n"
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		p.notice = "Save failed: " + err.Error()
+		return
+	}
+	p.notice = "Saved to " + path
+}
+
+// update handles a key press. Returns true when the pager should close.
+func (p *pager) update(msg tea.KeyMsg) bool {
+	if p.mode != pagerBrowse {
+		switch msg.Type {
+		case tea.KeyEsc:
+			p.mode = pagerBrowse
+			p.input.Blur()
+		case tea.KeyEnter:
+			value := p.input.Value()
+			if p.mode == pagerSearch {
+				p.search(value)
+			} else {
+				p.save(value)
+			}
+			p.mode = pagerBrowse
+			p.input.Blur()
+		default:
+			p.input, _ = p.input.Update(msg)
+		}
+		return false
+	}
+
+	switch msg.String() {
+	case "q", "esc":
+		return true
+	case "/":
+		p.startInput(pagerSearch, p.query)
+	case "s":
+		p.startInput(pagerSave, "")
+	case "n":
+		p.step(1)
+	case "N":
+		p.step(-1)
+	case "g", "home":
+		p.viewport.GotoTop()
+	case "G", "end":
+		p.viewport.GotoBottom()
+	default:
+		p.viewport, _ = p.viewport.Update(msg)
+	}
+	return false
+}
+
+func (p *pager) startInput(mode pagerMode, value string) {
+	p.mode = mode
+	p.notice = ""
+	p.input.SetValue(value)
+	p.input.CursorEnd()
+	p.input.Focus()
+}
+
+func (p *pager) View() string {
+	header := titleStyle.Render("📄 "+p.title) + "  " +
+		statusStyle.Render(fmt.Sprintf("%d lines • %3.0f%%", len(p.lines), p.viewport.ScrollPercent()*100))
+
+	var footer string
+	switch p.mode {
+	case pagerSearch:
+		footer = "Search: " + p.input.View()
+	case pagerSave:
+		footer = "Save to: " + p.input.View()
+	default:
+		help := "↑/↓ PgUp/PgDn ←/→ scroll • g/G top/bottom • / search • n/N next/prev • s save • q close"
+		if p.notice != "" {
+			help = p.notice + " • " + help
+		}
+		footer = helpStyle.Render(" " + help)
+	}
+
+	return fmt.Sprintf("%s\n%s\n%s", header, p.viewport.View(), footer)
+}
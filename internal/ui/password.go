@@ -0,0 +1,162 @@
+package ui
+
+import (
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"shell-e/internal/executor"
+	"shell-e/internal/planner"
+)
+
+// cachedPassword is a sudo password kept for a short while so a series of
+// sudo commands doesn't ask for it every time
+type cachedPassword struct {
+	value   string
+	expires time.Time
+}
+
+// SetPasswordCache sets how long a sudo password is remembered; 0 asks
+// for it every time
+func (m *Model) SetPasswordCache(d time.Duration) {
+	m.passwordCache = d
+}
+
+// passwordFor returns the password to give command's sudo. probe is
+// true when none is known, and probePassword must find out whether sudo
+// needs one.
+func (m *Model) passwordFor(cmd string) (password string, probe bool) {
+	if executor.ElevationTool(cmd) != "sudo" {
+		return "", false
+	}
+	key := m.passwordKey()
+	if m.oneTimePassword != "" {
+		password, m.oneTimePassword = m.oneTimePassword, ""
+		return password, false
+	}
+	if c, ok := m.passwords[key]; ok {
+		if time.Now().Before(c.expires) {
+			return c.value, false
+		}
+		delete(m.passwords, key)
+	}
+	return "", true
+}
+
+// passwordProbedMsg reports whether sudo needs a password for plan
+type passwordProbedMsg struct {
+	plan   *planner.CommandPlan
+	needed bool
+}
+
+// probePassword asks sudo whether plan's command needs a password. That
+// can take seconds, or a round trip to a remote host, so it runs outside
+// Update and handlePasswordProbed carries on.
+func (m *Model) probePassword(plan *planner.CommandPlan, cmd string) tea.Cmd {
+	m.status = "🔑 Checking whether sudo needs a password..."
+	exec := m.executor
+	return func() tea.Msg {
+		return passwordProbedMsg{plan: plan, needed: exec.NeedsPassword(cmd)}
+	}
+}
+
+// handlePasswordProbed asks for the password sudo needs, or runs the
+// command without one
+func (m *Model) handlePasswordProbed(msg passwordProbedMsg) (tea.Model, tea.Cmd) {
+	if msg.needed {
+		m.askPassword(msg.plan)
+		return m, nil
+	}
+	m.noPasswordPlan = msg.plan
+	return m, m.runExecution(msg.plan)
+}
+
+// passwordKey identifies where commands run: sudo passwords differ per host
+func (m *Model) passwordKey() string {
+	if t := m.executor.CurrentTarget(); t != nil {
+		return t.Name()
+	}
+	return ""
+}
+
+// askPassword shows a masked input for the sudo password plan needs. What
+// is typed never reaches the chat, memory, logs or the model.
+func (m *Model) askPassword(plan *planner.CommandPlan) {
+	ti := textinput.New()
+	ti.Prompt = "🔑 Password: "
+	ti.EchoMode = textinput.EchoPassword
+	ti.EchoCharacter = '•'
+	ti.CharLimit = 256
+	ti.Focus()
+	m.passwordInput = ti
+	m.passwordPlan = plan
+
+	where := "this machine"
+	if t := m.executor.CurrentTarget(); t != nil {
+		where = t.Name()
+	}
+	m.addMessage(confirmStyle.Render("🔑 sudo needs your password on " + where + " (Enter to run, Esc to cancel)"))
+	m.status = "Awaiting password..."
+	m.processing = false
+	m.updateViewport()
+}
+
+// handlePasswordKey handles keys while the password input is open
+func (m *Model) handlePasswordKey(key tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch key.Type {
+	case tea.KeyEnter:
+		plan := m.passwordPlan
+		password := m.passwordInput.Value()
+		m.closePasswordInput()
+		if password == "" {
+			return m.cancelPassword()
+		}
+		if m.passwordCache > 0 {
+			if m.passwords == nil {
+				m.passwords = make(map[string]cachedPassword)
+			}
+			m.passwords[m.passwordKey()] = cachedPassword{value: password, expires: time.Now().Add(m.passwordCache)}
+		} else {
+			m.oneTimePassword = password
+		}
+		m.status = "⚡ Executing..."
+		m.processing = true
+		m.updateViewport()
+		return m, tea.Batch(m.spinner.Tick, m.runExecution(plan))
+	case tea.KeyEsc:
+		m.closePasswordInput()
+		return m.cancelPassword()
+	}
+
+	var cmd tea.Cmd
+	m.passwordInput, cmd = m.passwordInput.Update(key)
+	return m, cmd
+}
+
+// closePasswordInput discards the input and what was typed into it
+func (m *Model) closePasswordInput() {
+	m.passwordInput.Reset()
+	m.passwordInput.Blur()
+	m.passwordPlan = nil
+}
+
+func (m *Model) cancelPassword() (tea.Model, tea.Cmd) {
+	m.writeAudit(m.pendingAudit)
+	m.pendingAudit = nil
+	m.addMessage(statusStyle.Render("✗ Cancelled — no password given"))
+	m.status = "Ready"
+	m.processing = false
+	m.updateViewport()
+	return m, nil
+}
+
+// checkPasswordRejected forgets a cached password sudo refused, so the
+// next sudo command asks again
+func (m *Model) checkPasswordRejected(result *executor.Result) {
+	if result == nil || !executor.PasswordRejected(result) {
+		return
+	}
+	delete(m.passwords, result.Target)
+	m.addMessage(statusStyle.Render("  🔑 sudo did not accept the password — it will be asked for again"))
+}
@@ -0,0 +1,74 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"shell-e/internal/safety"
+)
+
+// handlePolicy implements /policy: which rule decided the last planned
+// command, and the policies that were consulted
+func (m *Model) handlePolicy() {
+	workDir := m.workDir
+	if m.executor.CurrentTarget() != nil {
+		workDir = ""
+	}
+	m.addMessage(statusStyle.Render("🛡  Safety policies, in order of precedence:"))
+	for _, p := range m.safety.Policies(workDir) {
+		switch {
+		case p.Err != nil:
+			m.addMessage(errorStyle.Render(fmt.Sprintf("  %-8s ✗ %v — commands need confirmation until it is fixed", p.Kind, p.Err)))
+		case !p.Exists:
+			m.addMessage(fmt.Sprintf("  %-8s %s (not created)", p.Kind, p.Source))
+		case p.Source == safety.BuiltIn:
+			m.addMessage(fmt.Sprintf("  %-8s %d rules", p.Kind, p.Rules))
+		default:
+			m.addMessage(fmt.Sprintf("  %-8s %s — %d rules", p.Kind, p.Source, p.Rules))
+		}
+	}
+
+	a := m.lastCheck
+	if a == nil {
+		m.addMessage(statusStyle.Render("No command checked yet"))
+		return
+	}
+	m.addMessage(cmdStyle.Render("  → " + a.Command))
+	r := a.Rule
+	if r == nil {
+		if a.Level == safety.Safe {
+			m.addMessage("  No rule matched, so it ran without asking")
+		} else {
+			m.addMessage("  No rule decided this: " + a.Reason)
+		}
+		return
+	}
+	m.addMessage(fmt.Sprintf("  Rule:    %s (%s) from %s", r.Name, r.Action, r.Source))
+	m.addMessage("  Matched: " + a.Matched)
+	if conds := ruleConditions(r); conds != "" {
+		m.addMessage("  When:    " + conds)
+	}
+	m.addMessage("  Reason:  " + r.Reason)
+}
+
+// ruleConditions lists the conditions of r the way they are written in
+// a policy file
+func ruleConditions(r *safety.Rule) string {
+	var conds []string
+	add := func(key string, values []string) {
+		if len(values) > 0 {
+			conds = append(conds, key+": "+strings.Join(values, ", "))
+		}
+	}
+	add("command", r.Command)
+	add("subcommand", r.Subcommand)
+	add("flags", r.Flags)
+	add("args", r.Args)
+	if r.ArgsRegex != "" {
+		add("args_regex", []string{r.ArgsRegex})
+	}
+	add("paths", r.Paths)
+	add("writes", r.Writes)
+	add("shell", r.Shell)
+	return strings.Join(conds, "; ")
+}
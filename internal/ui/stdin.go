@@ -0,0 +1,40 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"shell-e/internal/executor"
+	"shell-e/internal/planner"
+)
+
+// resolveStdin turns a plan's stdin reference into the data to feed the
+// command, and a description of it for the chat. Earlier outputs come
+// from their saved files, so nothing is re-run.
+func (m *Model) resolveStdin(ref string) (*executor.Stdin, string, error) {
+	switch {
+	case ref == "":
+		return nil, "", nil
+	case ref == planner.StdinClipboard:
+		return &executor.Stdin{Clipboard: true}, "the clipboard", nil
+	case ref == planner.StdinLastOutput:
+		id, ok := m.mem.LastOutputID()
+		if !ok {
+			return nil, "", fmt.Errorf("there is no earlier output to use")
+		}
+		return m.outputStdin(id)
+	}
+	if id, ok := planner.StdinOutputID(ref); ok {
+		return m.outputStdin(id)
+	}
+	return &executor.Stdin{File: ref}, ref, nil
+}
+
+func (m *Model) outputStdin(id int) (*executor.Stdin, string, error) {
+	output, err := m.mem.LoadOutput(id)
+	if err != nil {
+		return nil, "", err
+	}
+	lines := strings.Count(output, "\n") + 1
+	return &executor.Stdin{Text: output}, fmt.Sprintf("output of #%d (%d lines)", id, lines), nil
+}
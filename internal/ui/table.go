@@ -0,0 +1,312 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"shell-e/internal/table"
+	"shell-e/internal/terminal"
+)
+
+const (
+	maxCellWidth    = 40 // Longer values are truncated with …
+	minCellWidth    = 4  // Columns are shrunk no further than this
+	columnGap       = 2
+	inlineTableRows = 30 // Rows shown in the chat; /table shows all
+)
+
+var (
+	headerStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#7DF9FF")).
+			Bold(true)
+
+	selectedStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FFD700")).
+			Bold(true).
+			Underline(true)
+)
+
+// columnWidths sizes the columns from first onwards to fit width. Each
+// starts as wide as its widest value (up to maxCellWidth); columns that
+// can't fit even at minCellWidth are left off the right, then the widest
+// remaining ones are narrowed until the row fits.
+func columnWidths(labels []string, rows [][]string, first, width int) []int {
+	widths := make([]int, 0, len(labels)-first)
+	for i := first; i < len(labels); i++ {
+		w := terminal.Width(labels[i])
+		for _, row := range rows {
+			if i < len(row) {
+				w = max(w, terminal.Width(row[i]))
+			}
+		}
+		widths = append(widths, min(max(w, 1), maxCellWidth))
+	}
+
+	floor := 0
+	for i, w := range widths {
+		floor += min(w, minCellWidth)
+		if i > 0 {
+			floor += columnGap
+		}
+		if floor > width && i > 0 {
+			widths = widths[:i]
+			break
+		}
+	}
+
+	total := func() int {
+		n := columnGap * (len(widths) - 1)
+		for _, w := range widths {
+			n += w
+		}
+		return n
+	}
+	for total() > width {
+		widest := 0
+		for i, w := range widths {
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= minCellWidth {
+			break // A single column wider than the screen
+		}
+		widths[widest]--
+	}
+	return widths
+}
+
+// fitCell truncates or pads s to exactly width columns
+func fitCell(s string, width int) string {
+	s = terminal.Truncate(s, width)
+	return s + strings.Repeat(" ", max(width-terminal.Width(s), 0))
+}
+
+// renderRow lays out the cells of columns first..first+len(widths)
+func renderRow(cells []string, first int, widths []int, style func(col int) lipgloss.Style) string {
+	parts := make([]string, len(widths))
+	for i, w := range widths {
+		v := ""
+		if first+i < len(cells) {
+			v = cells[first+i]
+		}
+		parts[i] = style(first + i).Render(fitCell(v, w))
+	}
+	return strings.TrimRight(strings.Join(parts, strings.Repeat(" ", columnGap)), " ")
+}
+
+// inlineTable renders a result table for the chat: the first rows,
+// truncated to the chat's width, and a pointer to /table for the rest
+func inlineTable(t *table.Table, id, width int) string {
+	head := t.Head(inlineTableRows)
+	widths := columnWidths(t.Columns, head.Rows, 0, width)
+	header := func(int) lipgloss.Style { return headerStyle }
+	cell := func(int) lipgloss.Style { return resultStyle }
+
+	lines := []string{renderRow(t.Columns, 0, widths, header)}
+	for _, row := range head.Rows {
+		lines = append(lines, renderRow(row, 0, widths, cell))
+	}
+
+	info := fmt.Sprintf("%d rows × %d columns", len(t.Rows), len(t.Columns))
+	if hidden := len(t.Columns) - len(widths); hidden > 0 {
+		info += fmt.Sprintf(", %d not shown", hidden)
+	}
+	lines = append(lines, statusStyle.Render(fmt.Sprintf("  📊 %s — /table %d to sort and browse", info, id)))
+	return strings.Join(lines, "\n")
+}
+
+// tableView is a full-screen, sortable view of a result table. The
+// selected column can be moved with ←/→; columns that don't fit scroll
+// into view as the selection reaches them.
+type tableView struct {
+	title    string
+	table    *table.Table
+	viewport viewport.Model
+	width    int
+
+	col     int // Selected column
+	first   int // Leftmost visible column
+	sortCol int // -1 until sorted
+	desc    bool
+	widths  []int
+}
+
+func newTableView(title string, t *table.Table, width, height int) *tableView {
+	v := &tableView{
+		title:    title,
+		table:    t,
+		viewport: viewport.New(width, height),
+		sortCol:  -1,
+	}
+	v.setSize(width, height)
+	return v
+}
+
+// setSize leaves lines for the title, column headers and footer
+func (v *tableView) setSize(width, height int) {
+	v.width = width
+	v.viewport.Width = width
+	v.viewport.Height = max(height-3, 1)
+	v.render()
+}
+
+// label is a column's header text, with the sort direction if sorted
+func (v *tableView) label(col int) string {
+	name := v.table.Columns[col]
+	if col == v.sortCol {
+		if v.desc {
+			return name + " ▼"
+		}
+		return name + " ▲"
+	}
+	return name
+}
+
+func (v *tableView) labels() []string {
+	labels := make([]string, len(v.table.Columns))
+	for i := range labels {
+		labels[i] = v.label(i)
+	}
+	return labels
+}
+
+// render lays out the visible columns, scrolling sideways so the selected
+// column is on screen
+func (v *tableView) render() {
+	labels := v.labels()
+	if v.col < v.first {
+		v.first = v.col
+	}
+	for {
+		v.widths = columnWidths(labels, v.table.Rows, v.first, v.width)
+		if v.col < v.first+len(v.widths) || v.first >= v.col {
+			break
+		}
+		v.first++
+	}
+
+	lines := make([]string, len(v.table.Rows))
+	cell := func(int) lipgloss.Style { return resultStyle }
+	for i, row := range v.table.Rows {
+		lines[i] = renderRow(row, v.first, v.widths, cell)
+	}
+	v.viewport.SetContent(strings.Join(lines, "\n"))
+}
+
+// sortBy selects col and sorts the rows on it
+func (v *tableView) sortBy(col int, desc bool) {
+	v.col = col
+	v.sortCol = col
+	v.desc = desc
+	v.table.Sort(col, desc)
+	v.render()
+}
+
+func (v *tableView) update(msg tea.KeyMsg) bool {
+	switch msg.String() {
+	case "q", "esc":
+		return true
+	case "left", "h":
+		if v.col > 0 {
+			v.col--
+			v.render()
+		}
+	case "right", "l":
+		if v.col < len(v.table.Columns)-1 {
+			v.col++
+			v.render()
+		}
+	case "s", "enter":
+		v.sortBy(v.col, v.sortCol == v.col && !v.desc)
+	case "g", "home":
+		v.viewport.GotoTop()
+	case "G", "end":
+		v.viewport.GotoBottom()
+	default:
+		v.viewport, _ = v.viewport.Update(msg)
+	}
+	return false
+}
+
+func (v *tableView) View() string {
+	status := fmt.Sprintf("%d rows • column %d/%d", len(v.table.Rows), v.col+1, len(v.table.Columns))
+	if v.sortCol >= 0 {
+		status += " • sorted by " + v.label(v.sortCol)
+	}
+	header := titleStyle.Render("📊 "+v.title) + "  " +
+		statusStyle.Render(fmt.Sprintf("%s • %3.0f%%", status, v.viewport.ScrollPercent()*100))
+
+	headerStyleFor := func(col int) lipgloss.Style {
+		if col == v.col {
+			return selectedStyle
+		}
+		return headerStyle
+	}
+	columns := renderRow(v.labels(), v.first, v.widths, headerStyleFor)
+
+	help := helpStyle.Render(" ←/→ select column • s sort (again to reverse) • ↑/↓ PgUp/PgDn scroll • g/G top/bottom • q close")
+	return fmt.Sprintf("%s\n%s\n%s\n%s", header, columns, v.viewport.View(), help)
+}
+
+// openTable shows the table from an exchange's output (default: the latest
+// one that had a table), optionally sorted: /table [id] [column] [desc]
+func (m *Model) openTable(args []string) (tea.Model, tea.Cmd) {
+	id, ok := m.mem.LastTableID()
+	if len(args) > 0 {
+		if n, err := strconv.Atoi(strings.TrimPrefix(args[0], "#")); err == nil {
+			id, ok = n, true
+			args = args[1:]
+		}
+	}
+	if !ok {
+		m.addMessage(statusStyle.Render("No table output yet"))
+		m.updateViewport()
+		return m, nil
+	}
+
+	t, err := m.loadTable(id)
+	if err != nil {
+		m.addMessage(errorStyle.Render("  " + err.Error()))
+		m.updateViewport()
+		return m, nil
+	}
+
+	title := fmt.Sprintf("Table #%d", id)
+	if ex, found := m.mem.Exchange(id); found && ex.Command != "" {
+		title += " — " + ex.Command
+	}
+	view := newTableView(title, t, m.width, m.height)
+	if len(args) > 0 {
+		col, found := t.Column(args[0])
+		if !found {
+			m.addMessage(statusStyle.Render(fmt.Sprintf("No column %q — columns: %s",
+				args[0], strings.Join(t.Columns, ", "))))
+			m.updateViewport()
+			return m, nil
+		}
+		desc := len(args) > 1 && strings.EqualFold(args[1], "desc")
+		view.sortBy(col, desc)
+	}
+	m.screen = view
+	return m, nil
+}
+
+// loadTable re-detects the table in an exchange's full saved output,
+// falling back to the rows kept in memory
+func (m *Model) loadTable(id int) (*table.Table, error) {
+	if output, err := m.mem.LoadOutput(id); err == nil {
+		if t, ok := table.Detect(terminal.Strip(output)); ok {
+			return t, nil
+		}
+	}
+	if ex, found := m.mem.Exchange(id); found && ex.Table != nil {
+		return ex.Table.Head(len(ex.Table.Rows)), nil
+	}
+	return nil, fmt.Errorf("output #%d is not a table", id)
+}
@@ -0,0 +1,136 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"shell-e/internal/executor"
+	"shell-e/internal/planner"
+)
+
+// targetDialedMsg reports the outcome of connecting to a remote host
+type targetDialedMsg struct {
+	name   string
+	target *executor.SSHTarget
+	err    error
+}
+
+// SetTargets makes the configured remote hosts available to /target
+func (m *Model) SetTargets(targets []executor.SSHConfig) {
+	m.targets = targets
+}
+
+// handleTarget implements /target [name | local]: list the hosts commands
+// can run on, or switch to one
+func (m *Model) handleTarget(args []string) (tea.Model, tea.Cmd) {
+	current := "local"
+	if t := m.executor.CurrentTarget(); t != nil {
+		current = t.Name()
+	}
+
+	if len(args) == 0 {
+		m.addMessage(statusStyle.Render("🌐 Targets:"))
+		mark := func(name string) string {
+			if strings.EqualFold(name, current) {
+				return "* "
+			}
+			return "  "
+		}
+		m.addMessage(fmt.Sprintf("  %slocal (this machine)", mark("local")))
+		for _, cfg := range m.targets {
+			host := cfg.Host
+			if cfg.User != "" {
+				host = cfg.User + "@" + host
+			}
+			m.addMessage(fmt.Sprintf("  %s%s — %s", mark(cfg.Name), cfg.Name, host))
+		}
+		if len(m.targets) == 0 {
+			m.addMessage(statusStyle.Render("  Add remote hosts under targets: in config.yaml"))
+		}
+		m.updateViewport()
+		return m, nil
+	}
+	if len(args) > 1 {
+		m.addMessage(statusStyle.Render("Usage: /target [name | local]"))
+		m.updateViewport()
+		return m, nil
+	}
+
+	name := args[0]
+	if strings.EqualFold(name, "local") {
+		m.executor.UseTarget(nil)
+		m.syncPlannerTarget()
+		m.addMessage(statusStyle.Render("💻 Commands run on this machine again"))
+		m.updateViewport()
+		return m, nil
+	}
+
+	var cfg *executor.SSHConfig
+	for i := range m.targets {
+		if strings.EqualFold(m.targets[i].Name, name) {
+			cfg = &m.targets[i]
+			break
+		}
+	}
+	if cfg == nil {
+		m.addMessage(statusStyle.Render("Unknown target: " + name + " — /target lists them"))
+		m.updateViewport()
+		return m, nil
+	}
+
+	// A host connected to earlier is still open, in the directory it was
+	// left in
+	if t, ok := m.executor.OpenTarget(cfg.Name); ok {
+		m.executor.UseTarget(t)
+		m.syncPlannerTarget()
+		m.addMessage(statusStyle.Render(fmt.Sprintf("🌐 Commands now run on %s (%s, %s)", t.Name(), t.OS(), t.Shell())))
+		m.updateViewport()
+		return m, nil
+	}
+
+	m.status = "🔌 Connecting to " + cfg.Name + "..."
+	m.processing = true
+	m.updateViewport()
+	dial := *cfg
+	return m, tea.Batch(m.spinner.Tick, func() tea.Msg {
+		t, err := executor.DialSSH(dial)
+		return targetDialedMsg{name: dial.Name, target: t, err: err}
+	})
+}
+
+// handleTargetDialed switches to a newly connected host
+func (m *Model) handleTargetDialed(msg targetDialedMsg) (tea.Model, tea.Cmd) {
+	m.status = "Ready"
+	m.processing = false
+	if msg.err != nil {
+		m.addMessage(errorStyle.Render(fmt.Sprintf("  ✗ Could not connect to %s: %v", msg.name, msg.err)))
+		m.updateViewport()
+		return m, nil
+	}
+
+	t := msg.target
+	m.executor.UseTarget(t)
+	m.executor.SetTargetDir(t.Name(), t.Dir())
+	m.syncPlannerTarget()
+	m.addMessage(statusStyle.Render(fmt.Sprintf("🌐 Commands now run on %s (%s, %s) in %s — /target local to come back",
+		t.Name(), t.OS(), t.Shell(), t.Dir())))
+	m.updateViewport()
+	return m, nil
+}
+
+// syncPlannerTarget tells the planner where commands run now
+func (m *Model) syncPlannerTarget() {
+	t := m.executor.CurrentTarget()
+	if t == nil {
+		m.planner.SetTarget(nil)
+		return
+	}
+	m.planner.SetTarget(&planner.Target{
+		Name:  t.Name(),
+		OS:    t.OS(),
+		Shell: t.Shell(),
+		Dir:   m.executor.TargetDir(),
+	})
+}
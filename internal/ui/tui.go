@@ -1,19 +1,26 @@
 package ui
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
+	"shell-e/internal/audit"
 	"shell-e/internal/executor"
 	"shell-e/internal/memory"
 	"shell-e/internal/planner"
 	"shell-e/internal/safety"
+	"shell-e/internal/terminal"
 )
 
 // Styles
@@ -64,6 +71,25 @@ type execDoneMsg struct {
 	plan   *planner.CommandPlan
 }
 
+// outputLineMsg carries one line of live output from a running command.
+// events is the channel to keep reading from until execDoneMsg arrives.
+type outputLineMsg struct {
+	line   executor.OutputLine
+	events <-chan tea.Msg
+}
+
+// timeoutWarningMsg is sent when the running command is about to time out
+type timeoutWarningMsg struct {
+	remaining time.Duration
+	events    <-chan tea.Msg
+}
+
+// maxLiveLines is how many trailing lines of a running command are shown
+const maxLiveLines = 30
+
+// timeoutExtension is how much time pressing "e" at the timeout prompt adds
+const timeoutExtension = 5 * time.Minute
+
 // Model is the BubbleTea model
 type Model struct {
 	viewport viewport.Model
@@ -81,6 +107,46 @@ type Model struct {
 	pendingConfirm *planner.CommandPlan
 	width          int
 	height         int
+
+	liveOutput  []string           // Output of the running command, replaced by the final result
+	livePartial [2]partialLine     // Per stream (stdout, stderr), its line that will be overwritten
+	cancelExec  context.CancelFunc // Cancels the running command (Esc)
+	deadline    *executor.Deadline // Timeout of the running command
+	timeoutAsk  bool               // Offering to extend the deadline
+
+	// workDir is the executor's working directory as of the last finished
+	// command. The UI reads it rather than the executor's, which a running
+	// command changes.
+	workDir string
+
+	forceBackground bool         // Next plan runs as a job (/bg)
+	foregrounded    map[int]bool // Jobs whose result was shown via /fg
+	jobExchanges    map[int]int  // Job ID → exchange that started it
+
+	screen fullScreen // Full-screen view (/output, /table), nil when closed
+
+	targets []executor.SSHConfig // Remote hosts /target can switch to
+
+	passwordInput   textinput.Model           // Masked input for a sudo password
+	passwordPlan    *planner.CommandPlan      // Plan waiting for a sudo password
+	passwords       map[string]cachedPassword // By target name; "" for this machine
+	passwordCache   time.Duration             // How long passwords are kept
+	oneTimePassword string                    // Password for the next command when not cached
+	noPasswordPlan  *planner.CommandPlan      // Plan whose sudo was found not to need a password
+
+	lastCheck *safety.Assessment // Safety check of the last planned command, for /policy
+
+	audit        *audit.Log
+	pendingAudit *audit.Record         // Audit record of the command awaiting confirmation or running
+	jobAudits    map[int]*audit.Record // Job ID → its audit record, written when it ends
+}
+
+// fullScreen is a view that takes over the window and the keyboard until
+// update reports it closed
+type fullScreen interface {
+	update(msg tea.KeyMsg) bool
+	setSize(width, height int)
+	View() string
 }
 
 func NewModel(p *planner.Planner, exec *executor.Executor, s *safety.Checker, mem *memory.Memory) Model {
@@ -104,12 +170,13 @@ func NewModel(p *planner.Planner, exec *executor.Executor, s *safety.Checker, me
 		executor: exec,
 		safety:   s,
 		mem:      mem,
+		workDir:  exec.WorkingDir,
 		spinner:  sp,
 		status:   "Ready",
 		messages: []string{
 			"🐚 Shell-E — Your local AI OS assistant",
 			"Type natural language commands. I'll plan and execute them safely.",
-			"Commands: /clear (reset chat) • /history (show history) • /exit (quit)",
+			"Commands: /clear (reset chat) • /history (show history) • /output [id] (full output) • /table [id] [column] (sort table) • /env (environment) • /session (keep one shell between commands) • /undo [N | list] (restore files) • /target [name] (run on a remote host) • /policy (which rule checked the last command) • /bg /jobs /tail /fg /kill (jobs) • /exit (quit)",
 			"",
 		},
 	}
@@ -122,11 +189,36 @@ func (m Model) Init() tea.Cmd {
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 
+	// A full-screen view takes over the keyboard while open; everything
+	// else (running commands, job notifications) carries on underneath
+	if key, ok := msg.(tea.KeyMsg); ok && m.screen != nil && key.Type != tea.KeyCtrlC {
+		if m.screen.update(key) {
+			m.screen = nil
+		}
+		return m, nil
+	}
+
+	// The password input takes the keyboard until it is submitted or
+	// cancelled, so the password never lands in the chat input
+	if key, ok := msg.(tea.KeyMsg); ok && m.passwordPlan != nil && key.Type != tea.KeyCtrlC {
+		return m.handlePasswordKey(key)
+	}
+
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.Type {
 		case tea.KeyCtrlC:
 			return m, tea.Quit
+		case tea.KeyEsc:
+			if m.processing && m.cancelExec != nil {
+				m.cancelExec()
+				m.status = "🛑 Cancelling..."
+				return m, nil
+			}
+		case tea.KeyRunes:
+			if m.timeoutAsk {
+				return m.handleTimeoutAnswer(msg.String())
+			}
 		case tea.KeyEnter:
 			if m.processing {
 				return m, nil
@@ -179,6 +271,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.viewport.Width = vpWidth
 		m.viewport.Height = vpHeight
 		m.textarea.SetWidth(vpWidth)
+		if m.screen != nil {
+			m.screen.setSize(m.width, m.height)
+		}
 		m.ready = true
 		m.updateViewport()
 		return m, nil
@@ -188,6 +283,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.addMessage(errorStyle.Render("Error: ") + msg.err.Error())
 			m.status = "Ready"
 			m.processing = false
+			m.forceBackground = false
 			m.updateViewport()
 			return m, nil
 		}
@@ -201,8 +297,35 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, nil
 
+	case outputLineMsg:
+		m.appendLiveOutput(msg.line)
+		m.updateViewport()
+		return m, waitForExecEvent(msg.events)
+
 	case execDoneMsg:
 		return m.handleExecResult(msg.result, msg.plan)
+
+	case timeoutWarningMsg:
+		if m.deadline != nil {
+			m.timeoutAsk = true
+			m.addMessage(confirmStyle.Render(fmt.Sprintf(
+				"⏰ Still running — times out in %v. Press e to allow %v more, n for no time limit, Esc to cancel",
+				msg.remaining, timeoutExtension)))
+			m.updateViewport()
+		}
+		return m, waitForExecEvent(msg.events)
+
+	case jobDoneMsg:
+		return m.handleJobDone(msg.job)
+
+	case foregroundDoneMsg:
+		return m.handleForegroundDone(msg.job)
+
+	case targetDialedMsg:
+		return m.handleTargetDialed(msg)
+
+	case passwordProbedMsg:
+		return m.handlePasswordProbed(msg)
 	}
 
 	// Update sub-components
@@ -216,7 +339,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m *Model) handleSlashCommand(input string) (tea.Model, tea.Cmd) {
-	switch strings.ToLower(input) {
+	fields := strings.Fields(input)
+	args := fields[1:]
+	switch strings.ToLower(fields[0]) {
 	case "/clear":
 		m.messages = m.messages[:4] // Keep header
 		m.mem.Clear()
@@ -229,11 +354,54 @@ func (m *Model) handleSlashCommand(input string) (tea.Model, tea.Cmd) {
 		} else {
 			m.addMessage(statusStyle.Render("📜 History:"))
 			for _, ex := range history {
-				m.addMessage(fmt.Sprintf("  [%s] %s → %s",
-					ex.Timestamp.Format("15:04"), ex.UserInput, ex.Response))
+				line := fmt.Sprintf("  #%d [%s] %s → %s",
+					ex.ID, ex.Timestamp.Format("15:04"), ex.UserInput, ex.Response)
+				if o := ex.Outcome; o != nil && o.ExitCode != 0 {
+					line += fmt.Sprintf(" (exit %d)", o.ExitCode)
+				}
+				m.addMessage(line)
 			}
 		}
 		m.updateViewport()
+	case "/session":
+		m.executor.Persistent = !m.executor.Persistent
+		if m.executor.Persistent {
+			m.addMessage(statusStyle.Render("🔗 Persistent shell session on — env, aliases and functions carry over"))
+		} else {
+			m.executor.CloseSessions()
+			m.addMessage(statusStyle.Render("⛓  Persistent shell session off — each command gets a fresh shell"))
+		}
+		m.updateViewport()
+	case "/env":
+		m.handleEnvCommand(args)
+		m.updateViewport()
+	case "/output":
+		return m.openOutput(args)
+	case "/table":
+		return m.openTable(args)
+	case "/undo":
+		m.handleUndo(args)
+		m.updateViewport()
+	case "/target":
+		return m.handleTarget(args)
+	case "/policy":
+		m.handlePolicy()
+		m.updateViewport()
+	case "/jobs", "/tail", "/fg", "/kill":
+		return m.handleJobCommand(strings.ToLower(fields[0]), args)
+	case "/bg":
+		if len(args) == 0 {
+			m.addMessage(statusStyle.Render("Usage: /bg <request> — plan a command and run it in the background"))
+			m.updateViewport()
+			return m, nil
+		}
+		request := strings.Join(args, " ")
+		m.forceBackground = true
+		m.addMessage(userStyle.Render("You: ") + request)
+		m.status = "🧠 Thinking..."
+		m.processing = true
+		m.updateViewport()
+		return m, tea.Batch(m.spinner.Tick, m.runInference(request))
 	case "/exit":
 		return m, tea.Quit
 	default:
@@ -243,18 +411,188 @@ func (m *Model) handleSlashCommand(input string) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// handleEnvCommand lists or resets environment variables set by commands
+func (m *Model) handleEnvCommand(args []string) {
+	switch {
+	case len(args) == 0:
+		env := m.executor.EnvOverlay()
+		if len(env) == 0 {
+			m.addMessage(statusStyle.Render("No environment changes this session"))
+			return
+		}
+		names := make([]string, 0, len(env))
+		for name := range env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		m.addMessage(statusStyle.Render("🌱 Environment changes:"))
+		for _, name := range names {
+			if env[name] == "" {
+				m.addMessage(fmt.Sprintf("  %s (removed)", name))
+			} else {
+				m.addMessage(fmt.Sprintf("  %s=%s", name, env[name]))
+			}
+		}
+	case strings.EqualFold(args[0], "clear"):
+		m.executor.ClearEnv()
+		m.mem.SetEnv(nil)
+		m.mem.Save()
+		m.addMessage(statusStyle.Render("🌱 Environment reset to the inherited one"))
+	case strings.EqualFold(args[0], "unset") && len(args) == 2:
+		if !m.executor.UnsetEnv(args[1]) {
+			m.addMessage(statusStyle.Render("No change recorded for " + args[1]))
+			return
+		}
+		m.mem.SetEnv(m.executor.EnvOverlay())
+		m.mem.Save()
+		m.addMessage(statusStyle.Render("🌱 " + args[1] + " restored to its inherited value"))
+	default:
+		m.addMessage(statusStyle.Render("Usage: /env [clear | unset NAME]"))
+	}
+}
+
+// handleTimeoutAnswer extends or lifts the running command's deadline
+func (m *Model) handleTimeoutAnswer(key string) (tea.Model, tea.Cmd) {
+	switch strings.ToLower(key) {
+	case "e":
+		if m.deadline.Extend(timeoutExtension) {
+			m.addMessage(statusStyle.Render(fmt.Sprintf("  ⏱  Extended by %v", timeoutExtension)))
+		}
+	case "n":
+		if m.deadline.Lift() {
+			m.addMessage(statusStyle.Render("  ⏱  No time limit — Esc still cancels"))
+		}
+	default:
+		return m, nil
+	}
+	m.timeoutAsk = false
+	m.updateViewport()
+	return m, nil
+}
+
+// saveOutput stores a command's complete output for /output, its table
+// for /table and the planner, its undo snapshot, and how it ended
+func (m *Model) saveOutput(id int, result *executor.Result) {
+	output := fullOutput(result)
+	if result.Table != nil {
+		m.mem.SetTable(id, result.Table)
+	}
+	if result.SnapshotID != "" {
+		m.mem.SetSnapshot(id, result.SnapshotID)
+	}
+	m.mem.SetOutcome(id, memory.Outcome{
+		ExitCode:   result.ExitCode,
+		Signal:     result.Signal,
+		TimedOut:   result.TimedOut,
+		Cancelled:  result.Cancelled,
+		Stdout:     result.Stdout,
+		Stderr:     result.Stderr,
+		Duration:   result.Duration,
+		PeakMemory: result.PeakMemory,
+		CPUTime:    result.CPUTime,
+	})
+	if output == "" {
+		return
+	}
+	if err := m.mem.SaveOutput(id, output); err != nil {
+		m.addMessage(errorStyle.Render("  Could not save output: " + err.Error()))
+	}
+}
+
+// fullOutput is a result's output followed by its error, as saved for
+// /output: without the colours it was shown in
+func fullOutput(result *executor.Result) string {
+	output := result.Output
+	if !result.Success && result.Error != "" {
+		output = strings.TrimLeft(output+"\n"+result.Error, "\n")
+	}
+	return terminal.Strip(output)
+}
+
+// resultDetails summarizes how a command ended: duration, exit code or
+// signal, and the CPU time and peak memory when known
+func resultDetails(r *executor.Result) string {
+	parts := []string{fmt.Sprintf("%.1fs", r.Duration.Seconds())}
+	switch {
+	case r.TimedOut:
+		parts = append(parts, "timed out")
+	case r.Cancelled:
+		parts = append(parts, "cancelled")
+	}
+	if r.Signal != "" {
+		parts = append(parts, "signal: "+r.Signal)
+	} else if r.ExitCode >= 0 {
+		parts = append(parts, fmt.Sprintf("exit %d", r.ExitCode))
+	}
+	if r.CPUTime > 0 {
+		parts = append(parts, fmt.Sprintf("CPU %.1fs", r.CPUTime.Seconds()))
+	}
+	if r.PeakMemory > 0 {
+		parts = append(parts, "peak "+formatBytes(r.PeakMemory))
+	}
+	return strings.Join(parts, " • ")
+}
+
+// formatBytes renders a size with a binary unit, e.g. "12.3 MB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// openOutput shows the full output of an exchange (default: the latest
+// one with output) in the pager
+func (m *Model) openOutput(args []string) (tea.Model, tea.Cmd) {
+	id, ok := m.mem.LastOutputID()
+	if len(args) > 0 {
+		n, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+		id, ok = n, err == nil
+	}
+	if !ok {
+		m.addMessage(statusStyle.Render("No saved output yet"))
+		m.updateViewport()
+		return m, nil
+	}
+
+	output, err := m.mem.LoadOutput(id)
+	if err != nil {
+		m.addMessage(errorStyle.Render("  " + err.Error()))
+		m.updateViewport()
+		return m, nil
+	}
+
+	title := fmt.Sprintf("Output #%d", id)
+	if ex, found := m.mem.Exchange(id); found && ex.Command != "" {
+		title += " — " + ex.Command
+	}
+	m.screen = newPager(title, output, m.workDir, m.width, m.height)
+	return m, nil
+}
+
 func (m *Model) handleConfirmation(input string) (tea.Model, tea.Cmd) {
 	plan := m.pendingConfirm
 	m.pendingConfirm = nil
 
 	lower := strings.ToLower(strings.TrimSpace(input))
 	if lower == "y" || lower == "yes" {
+		if m.pendingAudit != nil {
+			m.pendingAudit.Confirmed = true
+		}
 		m.addMessage(statusStyle.Render("✓ Confirmed — executing..."))
 		m.status = "⚡ Executing..."
 		m.updateViewport()
 		return m, m.runExecution(plan)
 	}
 
+	m.writeAudit(m.pendingAudit)
+	m.pendingAudit = nil
 	m.addMessage(statusStyle.Render("✗ Cancelled"))
 	m.status = "Ready"
 	m.processing = false
@@ -263,6 +601,11 @@ func (m *Model) handleConfirmation(input string) (tea.Model, tea.Cmd) {
 }
 
 func (m *Model) handlePlan(plan *planner.CommandPlan) (tea.Model, tea.Cmd) {
+	if m.forceBackground {
+		plan.Background = true
+		m.forceBackground = false
+	}
+
 	if plan.Command == nil || *plan.Command == "" {
 		// Chat-only response
 		m.addMessage(botStyle.Render("Shell-E: ") + plan.Response)
@@ -279,10 +622,20 @@ func (m *Model) handlePlan(plan *planner.CommandPlan) (tea.Model, tea.Cmd) {
 	m.addMessage(botStyle.Render("Shell-E: ") + plan.Response)
 	m.addMessage(cmdStyle.Render("  → " + cmd))
 
-	assessment := m.safety.Check(cmd)
+	// Workspace roots are local paths; on a remote host only the command
+	// itself is checked
+	workDir := m.workDir
+	if m.executor.CurrentTarget() != nil {
+		workDir = ""
+	}
+	assessment := m.safety.CheckShell(cmd, plan.Shell, workDir)
+	m.lastCheck = assessment
+	m.pendingAudit = m.newAuditRecord(plan, assessment)
 
 	switch assessment.Level {
 	case safety.Blocked:
+		m.writeAudit(m.pendingAudit)
+		m.pendingAudit = nil
 		m.addMessage(errorStyle.Render(assessment.Reason))
 		m.mem.RecordExchange(m.getLastUserInput(), cmd, "BLOCKED", assessment.Reason)
 		m.mem.Save()
@@ -312,39 +665,84 @@ func (m *Model) handleExecResult(result *executor.Result, plan *planner.CommandP
 		cmd = *plan.Command
 	}
 
+	m.stopLiveOutput()
+
+	// The full output goes to its own file; memory keeps a preview
+	id := m.mem.RecordExchange(m.getLastUserInput(), cmd, result.Output, plan.Response)
+	m.saveOutput(id, result)
+	m.finishAudit(m.pendingAudit, result)
+	m.pendingAudit = nil
+	m.checkPasswordRejected(result)
+	m.addHookNotice(result)
+	m.showResult(result, id)
+
+	// Sync memory with Executor's actual state (handles cd AND fallback).
+	// A remote directory is the target's, not this machine's.
+	if result.Target != "" {
+		m.syncPlannerTarget()
+	} else if result.CurrentWorkDir != "" && result.CurrentWorkDir != m.mem.WorkingDir {
+		m.mem.WorkingDir = result.CurrentWorkDir
+	}
+	m.workDir = m.executor.WorkingDir
+	m.mem.SetEnv(m.executor.EnvOverlay())
+
+	m.mem.Save()
+
+	m.status = "Ready"
+	m.processing = false
+	m.addMessage("")
+	m.updateViewport()
+	return m, nil
+}
+
+// stopLiveOutput ends a running command's live preview, which the final,
+// cleaned output replaces
+func (m *Model) stopLiveOutput() {
+	m.liveOutput = nil
+	m.livePartial = [2]partialLine{}
+	if m.cancelExec != nil {
+		m.cancelExec()
+		m.cancelExec = nil
+	}
+	m.deadline = nil
+	m.timeoutAsk = false
+}
+
+// showResult shows a finished command's output and outcome; id is the
+// exchange its full output is saved under
+func (m *Model) showResult(result *executor.Result, id int) {
 	if result.Success {
-		if result.Output != "" {
+		if result.Table != nil {
+			m.addMessage(inlineTable(result.Table, id, m.viewport.Width))
+		} else if result.Output != "" {
 			output := result.Output
 			lines := strings.Split(output, "\n")
 			if len(lines) > 30 {
-				output = strings.Join(lines[:30], "\n") + fmt.Sprintf("\n... (%d more lines)", len(lines)-30)
+				output = strings.Join(lines[:30], "\n") +
+					fmt.Sprintf("\n... (%d more lines — /output %d to view all)", len(lines)-30, id)
 			}
 			m.addMessage(resultStyle.Render(output))
 		}
-		m.addMessage(
-			statusStyle.Render(fmt.Sprintf("  ✓ Done (%.1fs)", result.Duration.Seconds())))
+		m.addMessage(statusStyle.Render("  ✓ Done (" + resultDetails(result) + ")"))
 	} else {
 		errMsg := result.Error
 		if result.Output != "" {
 			errMsg = result.Output + "\n" + errMsg
 		}
 		m.addMessage(errorStyle.Render("  ✗ " + errMsg))
+		m.addMessage(statusStyle.Render("  (" + resultDetails(result) + ")"))
 	}
 
-	m.mem.RecordExchange(m.getLastUserInput(), cmd, result.Output, plan.Response)
+	m.addSnapshotNotice(result)
 
-	// Sync memory with Executor's actual state (handles cd AND fallback)
-	if result.CurrentWorkDir != "" && result.CurrentWorkDir != m.mem.WorkingDir {
-		m.mem.WorkingDir = result.CurrentWorkDir
+	if len(result.Killed) > 0 {
+		var procs []string
+		for _, p := range result.Killed {
+			procs = append(procs, fmt.Sprintf("%s (%d)", p.Name, p.PID))
+		}
+		m.addMessage(statusStyle.Render(fmt.Sprintf("  🛑 Killed %d process(es): %s",
+			len(result.Killed), strings.Join(procs, ", "))))
 	}
-
-	m.mem.Save()
-
-	m.status = "Ready"
-	m.processing = false
-	m.addMessage("")
-	m.updateViewport()
-	return m, nil
 }
 
 func (m *Model) runInference(input string) tea.Cmd {
@@ -355,24 +753,180 @@ func (m *Model) runInference(input string) tea.Cmd {
 }
 
 func (m *Model) runExecution(plan *planner.CommandPlan) tea.Cmd {
-	return func() tea.Msg {
-		cmd := ""
-		shell := "powershell"
-		if plan.Command != nil {
-			cmd = *plan.Command
+	cmd := ""
+	shell := "powershell"
+	if plan.Command != nil {
+		cmd = *plan.Command
+	}
+	if plan.Shell != "" {
+		shell = plan.Shell
+	}
+
+	m.liveOutput = nil
+	m.livePartial = [2]partialLine{}
+
+	// doas and runas read the password from the terminal itself, so they
+	// get it handed over like any other program that prompts
+	tool := executor.ElevationTool(cmd)
+	if plan.Interactive || executor.NeedsTerminal(cmd) || tool == "doas" || tool == "runas" {
+		if t := m.executor.CurrentTarget(); t != nil {
+			result := &executor.Result{
+				Error:    "Interactive commands can't run on " + t.Name() + " yet — ssh there directly",
+				ExitCode: -1,
+				Target:   t.Name(),
+			}
+			return func() tea.Msg { return execDoneMsg{result: result, plan: plan} }
+		}
+		if plan.Stdin != "" {
+			// The terminal is its stdin; data fed in instead would leave
+			// it without a keyboard
+			result := &executor.Result{
+				Error:    "This command needs the terminal, so it can't also be given stdin — run it without the input, or save the input to a file and pass that",
+				ExitCode: -1,
+			}
+			return func() tea.Msg { return execDoneMsg{result: result, plan: plan} }
+		}
+		return m.runInteractive(cmd, shell, plan)
+	}
+	password, probe := m.passwordFor(cmd)
+	if probe && m.noPasswordPlan != plan {
+		return m.probePassword(plan, cmd)
+	}
+	m.noPasswordPlan = nil
+	stdin, source, err := m.resolveStdin(plan.Stdin)
+	if err != nil {
+		result := &executor.Result{Error: "Could not read stdin: " + err.Error(), ExitCode: -1}
+		return func() tea.Msg { return execDoneMsg{result: result, plan: plan} }
+	}
+	if stdin != nil {
+		m.addMessage(statusStyle.Render("  ⤷ stdin: " + source))
+		m.updateViewport()
+	}
+	if plan.Background {
+		return m.startJob(cmd, shell, plan, executor.ExecOptions{Password: password, Stdin: stdin, Plan: m.hookPlan(plan)})
+	}
+
+	// The plan may ask for more time for a slow command, but never less
+	// than configured and never an unlimited run
+	var timeout time.Duration
+	if base := m.executor.TimeoutFor(cmd); base > 0 {
+		if requested := time.Duration(plan.TimeoutSeconds) * time.Second; requested > base {
+			timeout = requested
 		}
-		if plan.Shell != "" {
-			shell = plan.Shell
+	}
+
+	// Output lines, timeout warnings and the final result share one channel
+	// so they arrive in order; the channel is closed after execDoneMsg
+	events := make(chan tea.Msg, 128)
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancelExec = cancel
+	deadline := executor.NewDeadline()
+	m.deadline = deadline
+	m.timeoutAsk = false
+	exec := m.executor
+	hookPlan := m.hookPlan(plan)
+	go func() {
+		finished := make(chan struct{})
+		warned := make(chan struct{})
+		go func() {
+			defer close(warned)
+			for {
+				select {
+				case remaining := <-deadline.Warnings():
+					events <- timeoutWarningMsg{remaining: remaining, events: events}
+				case <-finished:
+					return
+				}
+			}
+		}()
+
+		result := exec.ExecuteWithOptions(cmd, shell, executor.ExecOptions{
+			Context:  ctx,
+			Timeout:  timeout,
+			Deadline: deadline,
+			Password: password,
+			Stdin:    stdin,
+			Plan:     hookPlan,
+			OnOutput: func(line executor.OutputLine) {
+				events <- outputLineMsg{line: line, events: events}
+			},
+		})
+		close(finished)
+		<-warned
+		events <- execDoneMsg{result: result, plan: plan}
+		close(events)
+	}()
+
+	return waitForExecEvent(events)
+}
+
+// runInteractive suspends the TUI and gives the command the terminal, for
+// programs that prompt. The TUI resumes with the captured output.
+func (m *Model) runInteractive(cmd, shell string, plan *planner.CommandPlan) tea.Cmd {
+	icmd := m.executor.Interactive(cmd, shell)
+	icmd.Plan = m.hookPlan(plan)
+	return tea.Exec(icmd, func(err error) tea.Msg {
+		result := icmd.Result()
+		if result == nil {
+			// The terminal could not be handed over, so Run never happened
+			result = &executor.Result{Error: fmt.Sprintf("Could not start interactive session: %v", err)}
 		}
-		result := m.executor.Execute(cmd, shell)
 		return execDoneMsg{result: result, plan: plan}
+	})
+}
+
+// waitForExecEvent returns a command that delivers the next message from a
+// running execution
+func waitForExecEvent(events <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-events
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// partialLine is a live line that ended with \r, so the next line from
+// the same stream overwrites it
+type partialLine struct {
+	ok    bool
+	index int // In liveOutput
+}
+
+// appendLiveOutput adds a streamed line to the live preview, overwriting the
+// stream's previous one if it was a \r progress update. Each stream keeps
+// its own, so a progress bar on stderr isn't overwritten by stdout.
+func (m *Model) appendLiveOutput(line executor.OutputLine) {
+	// Apply erase and cursor codes within the line so progress bars draw
+	// cleanly; colors are kept
+	text := terminal.Render(line.Text)
+	stream := 0
+	if line.Stderr {
+		stream = 1
+	}
+	index := len(m.liveOutput)
+	if p := m.livePartial[stream]; p.ok && p.index < len(m.liveOutput) {
+		index = p.index
+		m.liveOutput[index] = text
+	} else {
+		m.liveOutput = append(m.liveOutput, text)
+	}
+	m.livePartial[stream] = partialLine{ok: line.Partial, index: index}
+
+	if drop := len(m.liveOutput) - maxLiveLines; drop > 0 {
+		m.liveOutput = m.liveOutput[drop:]
+		for i := range m.livePartial {
+			m.livePartial[i].index -= drop
+			m.livePartial[i].ok = m.livePartial[i].ok && m.livePartial[i].index >= 0
+		}
 	}
 }
 
 // addMessage adds a message with word wrapping to fit the viewport width
 func (m *Model) addMessage(msg string) {
 	if m.width > 4 {
-		msg = wrapText(msg, m.width-2)
+		msg = terminal.Wrap(msg, m.width-2)
 	}
 	m.messages = append(m.messages, msg)
 }
@@ -382,7 +936,7 @@ func (m *Model) getLastUserInput() string {
 		if strings.Contains(m.messages[i], "You: ") {
 			parts := strings.SplitN(m.messages[i], "You: ", 2)
 			if len(parts) == 2 {
-				return strings.TrimSpace(stripAnsi(parts[1]))
+				return strings.TrimSpace(terminal.Strip(parts[1]))
 			}
 		}
 	}
@@ -391,6 +945,13 @@ func (m *Model) getLastUserInput() string {
 
 func (m *Model) updateViewport() {
 	content := strings.Join(m.messages, "\n")
+	if len(m.liveOutput) > 0 {
+		live := strings.Join(m.liveOutput, "\n")
+		if m.width > 4 {
+			live = terminal.Wrap(live, m.width-2)
+		}
+		content += "\n" + resultStyle.Render(live)
+	}
 	m.viewport.SetContent(content)
 	m.viewport.GotoBottom()
 }
@@ -399,81 +960,35 @@ func (m Model) View() string {
 	if !m.ready {
 		return "Loading Shell-E..."
 	}
+	if m.screen != nil {
+		return m.screen.View()
+	}
 
+	title := titleStyle.Render("🐚 Shell-E")
+	if t := m.executor.CurrentTarget(); t != nil {
+		title += " " + helpStyle.Render("🌐 "+t.Name()+":"+m.executor.TargetDir())
+	} else if m.executor.Roots.Restricted() {
+		root := m.executor.Roots.RootOf(m.workDir)
+		if root == "" {
+			root = "outside workspace"
+		}
+		title += " " + helpStyle.Render("📁 "+root)
+	}
 	header := ""
 	if m.processing {
-		header = fmt.Sprintf("%s %s %s", titleStyle.Render("🐚 Shell-E"), m.spinner.View(), statusStyle.Render(m.status))
+		header = fmt.Sprintf("%s %s %s", title, m.spinner.View(), statusStyle.Render(m.status))
 	} else {
-		header = titleStyle.Render("🐚 Shell-E") + "  " + statusStyle.Render(m.status)
+		header = title + "  " + statusStyle.Render(m.status)
 	}
 
 	chatArea := m.viewport.View()
 
 	input := m.textarea.View()
-
-	help := helpStyle.Render(" Enter: send • /clear: reset • /exit: quit • Ctrl+C: force quit")
-
-	return fmt.Sprintf("%s\n%s\n%s\n%s", header, chatArea, input, help)
-}
-
-// wrapText soft-wraps a string at maxWidth, respecting word boundaries
-func wrapText(s string, maxWidth int) string {
-	if maxWidth <= 0 {
-		return s
+	if m.passwordPlan != nil {
+		input = m.passwordInput.View()
 	}
 
-	var result strings.Builder
-	lines := strings.Split(s, "\n")
-
-	for i, line := range lines {
-		if i > 0 {
-			result.WriteByte('\n')
-		}
-
-		// Get the visible length (without ANSI codes)
-		plain := stripAnsi(line)
-		if len(plain) <= maxWidth {
-			result.WriteString(line)
-			continue
-		}
+	help := helpStyle.Render(" Enter: send • Esc: cancel command • /clear: reset • /session: persistent shell • /exit: quit • Ctrl+C: force quit")
 
-		// Need to wrap — work on the plain text, then re-wrap
-		words := strings.Fields(plain)
-		currentLen := 0
-		for j, word := range words {
-			wordLen := len(word)
-			if currentLen+wordLen+1 > maxWidth && currentLen > 0 {
-				result.WriteByte('\n')
-				currentLen = 0
-			}
-			if currentLen > 0 {
-				result.WriteByte(' ')
-				currentLen++
-			} else if j > 0 {
-				// continuation line — no extra indent
-			}
-			result.WriteString(word)
-			currentLen += wordLen
-		}
-	}
-
-	return result.String()
-}
-
-// stripAnsi removes ANSI escape codes for clean text measurement
-func stripAnsi(s string) string {
-	var result strings.Builder
-	i := 0
-	for i < len(s) {
-		if s[i] == '\x1b' {
-			for i < len(s) && s[i] != 'm' {
-				i++
-			}
-			i++ // skip the 'm'
-			continue
-		}
-		result.WriteByte(s[i])
-		i++
-	}
-	return result.String()
+	return fmt.Sprintf("%s\n%s\n%s\n%s", header, chatArea, input, help)
 }
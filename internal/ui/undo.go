@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"shell-e/internal/executor"
+	"shell-e/internal/trash"
+)
+
+// handleUndo implements /undo [N | list]: restore the files changed by the
+// last N snapshotted commands, most recent first
+func (m *Model) handleUndo(args []string) {
+	if m.executor.Trash == nil {
+		m.addMessage(statusStyle.Render("Undo is off — set undo: true in config.yaml"))
+		return
+	}
+	snaps, err := m.executor.Trash.List()
+	if err != nil {
+		m.addMessage(errorStyle.Render("  Could not read the trash: " + err.Error()))
+		return
+	}
+
+	if len(args) == 1 && strings.EqualFold(args[0], "list") {
+		if len(snaps) == 0 {
+			m.addMessage(statusStyle.Render("Nothing to undo"))
+			return
+		}
+		m.addMessage(statusStyle.Render("↩  Undoable changes (most recent first):"))
+		for i, snap := range snaps {
+			m.addMessage(fmt.Sprintf("  %d. [%s] %s (%s)", i+1, snap.Time.Format("15:04"),
+				snap.Command, describeSnapshot(snap)))
+		}
+		return
+	}
+
+	n := 1
+	if len(args) == 1 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			m.addMessage(statusStyle.Render("Usage: /undo [N | list]"))
+			return
+		}
+	} else if len(args) > 1 {
+		m.addMessage(statusStyle.Render("Usage: /undo [N | list]"))
+		return
+	}
+	if len(snaps) == 0 {
+		m.addMessage(statusStyle.Render("Nothing to undo"))
+		return
+	}
+	if n > len(snaps) {
+		n = len(snaps)
+	}
+
+	for _, snap := range snaps[:n] {
+		if _, err := m.executor.Trash.Restore(snap.ID); err != nil {
+			m.addMessage(errorStyle.Render(fmt.Sprintf("  ✗ Could not undo %s: %v", snap.Command, err)))
+			break
+		}
+		label := snap.Command
+		if id, ok := m.mem.ClearSnapshot(snap.ID); ok {
+			label = fmt.Sprintf("#%d %s", id, snap.Command)
+		}
+		m.addMessage(statusStyle.Render(fmt.Sprintf("  ↩  Undid %s (%s)", label, describeSnapshot(snap))))
+	}
+	m.mem.Save()
+}
+
+// addSnapshotNotice tells the user whether the files a command changed
+// were saved for /undo, and why not when they couldn't be
+func (m *Model) addSnapshotNotice(result *executor.Result) {
+	switch {
+	case result.SnapshotID != "":
+		m.addMessage(statusStyle.Render("  ↩  Files it changed were saved — /undo to restore them"))
+	case result.NotSnapshotted != "":
+		m.addMessage(errorStyle.Render("  ⚠  Files it changed were not saved, so /undo can't restore them: " + result.NotSnapshotted))
+	}
+}
+
+// describeSnapshot says what restoring snap does, e.g. "restores 2, removes 1"
+func describeSnapshot(snap *trash.Snapshot) string {
+	restored, removed := 0, 0
+	for _, e := range snap.Entries {
+		if e.Existed {
+			restored++
+		} else {
+			removed++
+		}
+	}
+	var parts []string
+	if restored > 0 {
+		parts = append(parts, fmt.Sprintf("restores %d", restored))
+	}
+	if removed > 0 {
+		parts = append(parts, fmt.Sprintf("removes %d", removed))
+	}
+	return strings.Join(parts, ", ")
+}
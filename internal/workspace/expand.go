@@ -0,0 +1,65 @@
+package workspace
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envRefRe matches variable references in any shell's syntax: $env:NAME
+// (PowerShell), ${NAME} and $NAME (POSIX, fish) and %NAME% (cmd)
+var envRefRe = regexp.MustCompile(`\$env:(\w+)|\$\{(\w+)\}|\$(\w+)|%(\w+)%`)
+
+// Vars are the variable reference syntaxes a shell expands
+type Vars int
+
+const (
+	EnvVars     Vars = 1 << iota // $env:NAME (PowerShell)
+	DollarVars                   // $NAME and ${NAME} (POSIX shells, fish, PowerShell)
+	PercentVars                  // %NAME% (cmd)
+
+	AllVars = EnvVars | DollarVars | PercentVars
+)
+
+// ExpandHome replaces a leading ~ in path with the user's home directory
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return home + path[1:]
+	}
+	return path
+}
+
+// ExpandPath resolves a leading ~ and the variable references in path
+// written in one of the syntaxes vars allows, looking variables up with
+// lookup. References in other syntaxes, and an unset %NAME% as cmd does,
+// are left as written; other unset references expand to nothing. $HOME
+// falls back to the user's home directory, since PowerShell defines it
+// even where no HOME variable exists.
+func ExpandPath(path string, vars Vars, lookup func(string) string) string {
+	path = ExpandHome(path)
+	return envRefRe.ReplaceAllStringFunc(path, func(ref string) string {
+		m := envRefRe.FindStringSubmatch(ref)
+		switch {
+		case m[1] != "" && vars&EnvVars == 0,
+			m[1] == "" && m[4] == "" && vars&DollarVars == 0,
+			m[4] != "" && vars&PercentVars == 0:
+			return ref
+		}
+		name := m[1] + m[2] + m[3] + m[4] // Only one group matches
+		if value := lookup(name); value != "" {
+			return value
+		}
+		if strings.EqualFold(name, "HOME") {
+			if home, err := os.UserHomeDir(); err == nil {
+				return home
+			}
+		}
+		if m[4] != "" {
+			return ref
+		}
+		return ""
+	})
+}
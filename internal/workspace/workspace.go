@@ -0,0 +1,97 @@
+// Package workspace confines Shell-E to a set of allowed directory trees.
+package workspace
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Roots are the directory trees commands may run in and touch. The zero
+// value allows everything.
+type Roots struct {
+	paths    []string // As configured, cleaned and absolute
+	resolved []string // The same with symlinks resolved, where they differ
+}
+
+// NewRoots cleans the configured roots, expanding a leading ~ and making
+// them absolute. Empty entries are dropped.
+func NewRoots(paths []string) Roots {
+	var r Roots
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		p = ExpandHome(p)
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		p = filepath.Clean(p)
+		r.paths = append(r.paths, p)
+		if real, err := filepath.EvalSymlinks(p); err == nil && real != p {
+			r.resolved = append(r.resolved, real)
+		}
+	}
+	return r
+}
+
+// Restricted reports whether any roots are configured
+func (r Roots) Restricted() bool {
+	return len(r.paths) > 0
+}
+
+// Paths returns the configured roots
+func (r Roots) Paths() []string {
+	return r.paths
+}
+
+// Contains reports whether path (absolute) is inside one of the roots.
+// A path that exists must also be inside once symlinks are resolved, so a
+// link can't lead out. Everything is inside when no roots are configured.
+func (r Roots) Contains(path string) bool {
+	if !r.Restricted() {
+		return true
+	}
+	if r.RootOf(path) == "" {
+		return false
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return true
+	}
+	return innermost(r.paths, real) != "" || innermost(r.resolved, real) != ""
+}
+
+// RootOf returns the innermost root containing path, or "" if none does
+func (r Roots) RootOf(path string) string {
+	return innermost(r.paths, filepath.Clean(path))
+}
+
+// String lists the roots for messages
+func (r Roots) String() string {
+	return strings.Join(r.paths, ", ")
+}
+
+func innermost(roots []string, path string) string {
+	best := ""
+	for _, root := range roots {
+		if within(root, path) && len(root) > len(best) {
+			best = root
+		}
+	}
+	return best
+}
+
+// within reports whether path is root or below it. Windows paths compare
+// case-insensitively.
+func within(root, path string) bool {
+	if runtime.GOOS == "windows" {
+		root, path = strings.ToLower(root), strings.ToLower(path)
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"shell-e/internal/audit"
+)
+
+// writeAuditLog appends n records to a fresh log and returns its path
+func writeAuditLog(t *testing.T, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := audit.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		err := l.Append(audit.Record{
+			UserInput:  "clean the build folder",
+			Command:    "Remove-Item -Recurse build",
+			Safety:     "confirm",
+			Confirmed:  true,
+			Executed:   true,
+			OutputHash: audit.HashOutput("removed"),
+		})
+		if err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	return path
+}
+
+func TestAudit_AppendAndVerify(t *testing.T) {
+	path := writeAuditLog(t, 3)
+	if n, err := audit.Verify(path); err != nil || n != 3 {
+		t.Fatalf("Expected 3 intact records, got %d (%v)", n, err)
+	}
+
+	// Reopening continues the chain rather than starting a new one
+	l, _ := audit.Open(path)
+	l.Append(audit.Record{Command: "ls", Safety: "safe", Executed: true})
+	if n, err := audit.Verify(path); err != nil || n != 4 {
+		t.Errorf("Expected 4 intact records after reopening, got %d (%v)", n, err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"seq":4`) || strings.Contains(string(data), "removed\"") {
+		t.Errorf("Expected sequence numbers and only output hashes, got:\n%s", data)
+	}
+}
+
+func TestAudit_SharedBetweenInstances(t *testing.T) {
+	path := writeAuditLog(t, 1)
+	first, _ := audit.Open(path)
+	second, _ := audit.Open(path)
+
+	// Two instances appending at once extend one chain rather than fork it
+	var wg sync.WaitGroup
+	for _, l := range []*audit.Log{first, second, first, second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				if err := l.Append(audit.Record{Command: "ls", Safety: "safe", Executed: true}); err != nil {
+					t.Errorf("Append failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n, err := audit.Verify(path); err != nil || n != 41 {
+		t.Errorf("Expected 41 intact records, got %d (%v)", n, err)
+	}
+}
+
+func TestAudit_DetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   func(lines []string) []string
+		intact int
+	}{
+		{"edited field", func(l []string) []string {
+			l[1] = strings.Replace(l[1], "Remove-Item -Recurse build", "ls", 1)
+			return l
+		}, 1},
+		{"deleted record", func(l []string) []string {
+			return append(l[:1], l[2:]...)
+		}, 1},
+		{"reordered records", func(l []string) []string {
+			l[0], l[1] = l[1], l[0]
+			return l
+		}, 0},
+		{"added field", func(l []string) []string {
+			l[2] = strings.Replace(l[2], `{"seq"`, `{"note":"x","seq"`, 1)
+			return l
+		}, 2},
+		{"flipped confirmation", func(l []string) []string {
+			l[0] = strings.Replace(l[0], `"confirmed":true`, `"confirmed":false`, 1)
+			return l
+		}, 0},
+	}
+
+	for _, tt := range tests {
+		path := writeAuditLog(t, 3)
+		data, _ := os.ReadFile(path)
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		os.WriteFile(path, []byte(strings.Join(tt.edit(lines), "\n")+"\n"), 0600)
+
+		n, err := audit.Verify(path)
+		var verr *audit.VerifyError
+		if !errors.As(err, &verr) {
+			t.Errorf("%s: expected a VerifyError, got %v", tt.name, err)
+			continue
+		}
+		if n != tt.intact || verr.Line != tt.intact+1 {
+			t.Errorf("%s: expected %d intact records and line %d flagged, got %d and %v",
+				tt.name, tt.intact, tt.intact+1, n, err)
+		}
+	}
+}
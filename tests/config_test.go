@@ -3,6 +3,7 @@ package tests
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"shell-e/internal/config"
@@ -23,8 +24,8 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	if cfg.ContextSize != 4096 {
 		t.Errorf("Expected context size 4096, got: %d", cfg.ContextSize)
 	}
-	if cfg.Shell != "powershell" {
-		t.Errorf("Expected shell 'powershell', got: %s", cfg.Shell)
+	if cfg.Shell != config.DefaultShell() {
+		t.Errorf("Expected shell '%s', got: %s", config.DefaultShell(), cfg.Shell)
 	}
 	if cfg.ServerPort != 8055 {
 		t.Errorf("Expected server port 8055, got: %d", cfg.ServerPort)
@@ -63,3 +64,80 @@ func TestLoadConfig_FromFile(t *testing.T) {
 		t.Errorf("Expected Shell 'cmd', got %s", cfg.Shell)
 	}
 }
+
+func TestConfig_ChatTemplateFor(t *testing.T) {
+	cfg := &config.Config{
+		ChatTemplate: "chatml",
+		ModelTemplates: map[string]string{
+			"gemma-2-2b-it.q4_k_m.gguf": "gemma",
+			"phi-3-mini.gguf":           "auto",
+		},
+	}
+
+	if got := cfg.ChatTemplateFor("assets/localmodel/Gemma-2-2b-it.Q4_K_M.gguf"); got != "gemma" {
+		t.Errorf("Expected per-model 'gemma', got %q", got)
+	}
+	if got := cfg.ChatTemplateFor("assets/phi-3-mini.gguf"); got != "" {
+		t.Errorf("Expected 'auto' to mean server template, got %q", got)
+	}
+	if got := cfg.ChatTemplateFor("other.gguf"); got != "chatml" {
+		t.Errorf("Expected global 'chatml', got %q", got)
+	}
+}
+
+func TestDefaultShell(t *testing.T) {
+	shell := config.DefaultShell()
+	if runtime.GOOS == "windows" {
+		if shell != "powershell" {
+			t.Errorf("Expected powershell on Windows, got: %s", shell)
+		}
+		return
+	}
+	if shell != "bash" && shell != "zsh" && shell != "sh" {
+		t.Errorf("Expected a POSIX shell, got: %s", shell)
+	}
+}
+
+func TestLoadConfig_TimeoutDefaults(t *testing.T) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.CommandTimeout != 30 {
+		t.Errorf("Expected default command timeout 30, got: %d", cfg.CommandTimeout)
+	}
+	found := false
+	for _, o := range cfg.TimeoutOverrides {
+		if o.Pattern == "npm install" && o.Seconds == 600 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected a 10 minute default override for npm install, got: %v", cfg.TimeoutOverrides)
+	}
+}
+
+func TestLoadConfig_TimeoutOverrides(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	os.WriteFile(configPath, []byte(`command_timeout: 0
+timeout_overrides:
+  - pattern: make
+    seconds: 120
+`), 0644)
+
+	origDir, _ := os.Getwd()
+	os.Chdir(tmpDir)
+	defer os.Chdir(origDir)
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.CommandTimeout != 0 {
+		t.Errorf("Expected command timeout 0 (none), got: %d", cfg.CommandTimeout)
+	}
+	if len(cfg.TimeoutOverrides) != 1 || cfg.TimeoutOverrides[0].Pattern != "make" || cfg.TimeoutOverrides[0].Seconds != 120 {
+		t.Errorf("Expected the file's override list to replace the defaults, got: %v", cfg.TimeoutOverrides)
+	}
+}
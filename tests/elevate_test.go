@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"shell-e/internal/executor"
+)
+
+// fakeSudo puts a sudo on PATH that accepts "hunter2" from its askpass
+// helper with -A. SUDO_NOPASSWD makes "sudo -n" succeed and sudo without
+// -A run commands; SUDO_NOPROMPT makes it run commands without asking,
+// like cached credentials.
+func fakeSudo(t *testing.T) {
+	t.Helper()
+	requireShell(t, "sh")
+	dir := t.TempDir()
+	script := `#!/bin/sh
+if [ "$1" = "-n" ]; then
+	[ -n "$SUDO_NOPASSWD" ] && exit 0
+	echo "sudo: a password is required" >&2; exit 1
+fi
+if [ "$1" != "-A" ]; then
+	[ -n "$SUDO_NOPASSWD" ] && exec "$@"
+	echo "sudo: a terminal is required to read the password" >&2; exit 1
+fi
+shift
+[ -n "$SUDO_NOPROMPT" ] && exec "$@"
+pw=$("$SUDO_ASKPASS")
+if [ "$pw" != "hunter2" ]; then
+	echo "sudo: 1 incorrect password attempt" >&2; exit 1
+fi
+exec env -u SUDO_ASKPASS "$@"
+`
+	os.WriteFile(filepath.Join(dir, "sudo"), []byte(script), 0755)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestElevationTool(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"sudo apt update", "sudo"},
+		{"cd /etc && sudo cat shadow", "sudo"},
+		{"echo hi | sudo tee /etc/motd", "sudo"},
+		{"doas pkg_add vim", "doas"},
+		{"runas /user:Administrator cmd", "runas"},
+		{"echo sudo is needed", ""},
+		{"ls sudoers.d", ""},
+		{"pseudo build", ""},
+	}
+	for _, tt := range tests {
+		if got := executor.ElevationTool(tt.command); got != tt.want {
+			t.Errorf("ElevationTool(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestExecute_SudoPassword(t *testing.T) {
+	fakeSudo(t)
+	e := executor.NewExecutor(t.TempDir())
+	defer e.Close()
+
+	if !e.NeedsPassword("sudo whoami") {
+		t.Error("Expected sudo to need a password")
+	}
+	if e.NeedsPassword("whoami") {
+		t.Error("Expected no password without sudo")
+	}
+	t.Setenv("SUDO_NOPASSWD", "1")
+	if e.NeedsPassword("sudo whoami") {
+		t.Error("Expected no password when sudo allows it")
+	}
+
+	// Persistent sessions are bypassed: the password goes to a fresh shell
+	e.Persistent = true
+	r := e.ExecuteWithOptions("echo before && sudo echo elevated", "sh", executor.ExecOptions{Password: "hunter2"})
+	if !r.Success || r.Output != "before\nelevated" {
+		t.Errorf("Expected sudo to accept the password, got %+v", r)
+	}
+	if executor.PasswordRejected(r) {
+		t.Error("Expected the password not to be reported as rejected")
+	}
+
+	r = e.ExecuteWithOptions("sudo echo elevated", "sh", executor.ExecOptions{Password: "wrong"})
+	if r.Success || !executor.PasswordRejected(r) {
+		t.Errorf("Expected a wrong password to be rejected, got %+v", r)
+	}
+
+	// The password reaches only sudo, never the command's environment
+	r = e.ExecuteWithOptions("env; sudo env", "sh", executor.ExecOptions{Password: "hunter2"})
+	if !r.Success || strings.Contains(r.Output, "hunter2") {
+		t.Errorf("Expected the password to stay out of the environment, got %+v", r)
+	}
+}
+
+func TestExecute_SudoPasswordKeepsStdin(t *testing.T) {
+	fakeSudo(t)
+	dir := t.TempDir()
+	e := executor.NewExecutor(dir)
+	defer e.Close()
+	data := filepath.Join(dir, "data.txt")
+	os.WriteFile(data, []byte("from file\n"), 0644)
+
+	// A sudo after a pipe reads the piped data, not the password
+	r := e.ExecuteWithOptions("echo piped | sudo tee out.txt", "sh", executor.ExecOptions{Password: "hunter2"})
+	if !r.Success || r.Output != "piped" {
+		t.Errorf("Expected the pipeline to run with the password, got %+v", r)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "out.txt")); string(got) != "piped\n" {
+		t.Errorf("Expected only the piped data in the file, got %q", got)
+	}
+
+	// A sudo that doesn't prompt leaves no password for its program
+	t.Setenv("SUDO_NOPROMPT", "1")
+	r = e.ExecuteWithOptions("sudo tee copy.txt", "sh", executor.ExecOptions{
+		Password: "hunter2",
+		Stdin:    &executor.Stdin{File: "data.txt"},
+	})
+	if !r.Success {
+		t.Fatalf("Expected the command to run, got %+v", r)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "copy.txt")); string(got) != "from file\n" {
+		t.Errorf("Expected the password not to reach the file, got %q", got)
+	}
+}
+
+func TestSSH_SudoPassword(t *testing.T) {
+	fakeSudo(t)
+	srv := startSSHServer(t)
+	target, err := executor.DialSSH(srv.config())
+	if err != nil {
+		t.Fatalf("DialSSH failed: %v", err)
+	}
+	e := executor.NewExecutor(t.TempDir())
+	defer e.Close()
+	e.UseTarget(target)
+
+	if !e.NeedsPassword("sudo id") {
+		t.Error("Expected remote sudo to need a password")
+	}
+	r := e.ExecuteWithOptions("sudo echo remote", "", executor.ExecOptions{Password: "hunter2"})
+	if !r.Success || r.Output != "remote" {
+		t.Errorf("Expected the password to reach the remote sudo, got %+v", r)
+	}
+	r = e.ExecuteWithOptions("echo piped | sudo cat", "", executor.ExecOptions{Password: "hunter2"})
+	if !r.Success || r.Output != "piped" {
+		t.Errorf("Expected the piped data to reach the remote command, got %+v", r)
+	}
+	r = e.ExecuteWithOptions("sudo cat", "", executor.ExecOptions{
+		Password: "hunter2",
+		Stdin:    &executor.Stdin{Text: "given"},
+	})
+	if !r.Success || r.Output != "given" {
+		t.Errorf("Expected only the given stdin to reach the remote command, got %+v", r)
+	}
+	r = e.ExecuteWithOptions("env; set; sudo env", "", executor.ExecOptions{Password: "hunter2"})
+	if !r.Success || strings.Contains(r.Output, "hunter2") {
+		t.Errorf("Expected the password to stay out of the remote environment, got %+v", r)
+	}
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"shell-e/internal/executor"
+)
+
+func TestExecute_DecodesOutput(t *testing.T) {
+	requireShell(t, "sh")
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_CTYPE", "")
+	t.Setenv("LANG", "C.UTF-8")
+	e := executor.NewExecutor(t.TempDir())
+
+	tests := []struct {
+		name    string
+		command string
+		want    string
+	}{
+		{"utf-8", `printf 'caf\303\251'`, "café"},
+		{"utf-8 BOM", `printf '\357\273\277hello'`, "hello"},
+		{"utf-16le BOM", `printf '\377\376h\000i\000'`, "hi"},
+		{"utf-16le without BOM", `printf 'o\000k\000\012\000'`, "ok"},
+		{"latin-1", `printf 'caf\351'`, "café"},
+		{"stderr", `printf 'na\357ve' >&2`, "naïve"},
+		{"mixed lines", `printf 'caf\303\251\n\351t\351'`, "café\nété"},
+		{"mixed in a line", `printf '\303\251 \351'`, "é é"},
+	}
+	for _, tt := range tests {
+		r := e.Execute(tt.command, "sh")
+		if r.Output != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, r.Output)
+		}
+	}
+
+	e.Encoding = "cp850"
+	var lines []string
+	r := e.ExecuteWithOptions(`printf 'caf\202\n'`, "sh", executor.ExecOptions{
+		OnOutput: func(l executor.OutputLine) { lines = append(lines, l.Text) },
+	})
+	if r.Output != "café" || len(lines) != 1 || lines[0] != "café" {
+		t.Errorf("Expected cp850 decoding in the result and the stream, got %q, %q", r.Output, lines)
+	}
+
+	// Whatever arrives, the result is valid UTF-8
+	e.Encoding = "utf-8"
+	r = e.Execute(`printf 'bad \377\376\375 bytes'`, "sh")
+	if !utf8.ValidString(r.Output) || !utf8.ValidString(r.Stdout) || !strings.HasPrefix(r.Output, "bad ") {
+		t.Errorf("Expected valid UTF-8, got %q", r.Output)
+	}
+}
+
+func TestLookupEncoding(t *testing.T) {
+	for _, name := range []string{"cp850", "850", "windows-1252", "CP437", "latin1", "iso-8859-15", "utf-8", "shift_jis"} {
+		if _, err := executor.LookupEncoding(name); err != nil {
+			t.Errorf("LookupEncoding(%q) failed: %v", name, err)
+		}
+	}
+	for _, name := range []string{"cp99999", "klingon"} {
+		if _, err := executor.LookupEncoding(name); err == nil {
+			t.Errorf("Expected LookupEncoding(%q) to fail", name)
+		}
+	}
+}
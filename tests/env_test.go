@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"os"
+	"testing"
+
+	"shell-e/internal/executor"
+	"shell-e/internal/memory"
+)
+
+func TestParseEnv(t *testing.T) {
+	lookup := func(name string) string {
+		if name == "PATH" {
+			return "/usr/bin"
+		}
+		return ""
+	}
+
+	tests := []struct {
+		shell   string
+		command string
+		want    []executor.EnvChange
+	}{
+		{"bash", "export FOO=bar", []executor.EnvChange{{Name: "FOO", Value: "bar"}}},
+		{"bash", `export A=1 B="two words"`, []executor.EnvChange{{Name: "A", Value: "1"}, {Name: "B", Value: "two words"}}},
+		{"bash", "export PATH=$PATH:/opt/bin", []executor.EnvChange{{Name: "PATH", Value: "/usr/bin:/opt/bin"}}},
+		{"bash", "export LIT='$PATH'", []executor.EnvChange{{Name: "LIT", Value: "$PATH"}}},
+		{"bash", "FOO=bar", []executor.EnvChange{{Name: "FOO", Value: "bar"}}},
+		{"bash", "unset FOO BAR", []executor.EnvChange{{Name: "FOO", Unset: true}, {Name: "BAR", Unset: true}}},
+		{"fish", "set -gx FOO bar", []executor.EnvChange{{Name: "FOO", Value: "bar"}}},
+		{"fish", "set -e FOO", []executor.EnvChange{{Name: "FOO", Unset: true}}},
+		{"powershell", "$env:FOO = 'bar'", []executor.EnvChange{{Name: "FOO", Value: "bar"}}},
+		{"powershell", `$env:PATH += ";C:\tools"`, []executor.EnvChange{{Name: "PATH", Value: `/usr/bin;C:\tools`}}},
+		{"powershell", `$env:P = "$env:PATH;x"`, []executor.EnvChange{{Name: "P", Value: "/usr/bin;x"}}},
+		{"powershell", "Remove-Item Env:FOO", []executor.EnvChange{{Name: "FOO", Unset: true}}},
+		{"powershell", "$env:FOO = $null", []executor.EnvChange{{Name: "FOO", Unset: true}}},
+		{"cmd", "set FOO=bar baz", []executor.EnvChange{{Name: "FOO", Value: "bar baz"}}},
+		{"cmd", `set "FOO=%PATH%;x"`, []executor.EnvChange{{Name: "FOO", Value: "/usr/bin;x"}}},
+		{"cmd", "set FOO=", []executor.EnvChange{{Name: "FOO", Unset: true}}},
+	}
+
+	for _, tt := range tests {
+		sh, _ := executor.LookupShell(tt.shell)
+		got, ok := sh.ParseEnv(tt.command, lookup)
+		if !ok {
+			t.Errorf("%s: expected %q to be an env command", tt.shell, tt.command)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %q gave %v, want %v", tt.shell, tt.command, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: %q change %d = %+v, want %+v", tt.shell, tt.command, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestParseEnv_NotEnvCommands(t *testing.T) {
+	tests := []struct {
+		shell   string
+		command string
+	}{
+		{"bash", "export FOO=bar && make"},
+		{"bash", "FOO=bar make"},
+		{"bash", "export FOO=$(date)"},
+		{"bash", "echo FOO=bar"},
+		{"fish", "set FOO bar"},
+		{"powershell", "$env:FOO = Get-Date"},
+		{"powershell", "$env:FOO = 'a'; dir"},
+		{"cmd", "set /a X=1+2"},
+		{"cmd", "set FOO"},
+	}
+	for _, tt := range tests {
+		sh, _ := executor.LookupShell(tt.shell)
+		if changes, ok := sh.ParseEnv(tt.command, os.Getenv); ok {
+			t.Errorf("%s: %q should not be an env command, got %v", tt.shell, tt.command, changes)
+		}
+	}
+}
+
+func TestExecute_EnvOverlayPersists(t *testing.T) {
+	requireShell(t, "bash")
+	e := executor.NewExecutor(t.TempDir())
+
+	r := e.Execute("export SHELLE_OVERLAY=carried", "bash")
+	if !r.Success || r.Output != "SHELLE_OVERLAY=carried" {
+		t.Fatalf("Expected export to be handled natively, got %q (err: %s)", r.Output, r.Error)
+	}
+
+	r = e.Execute("echo $SHELLE_OVERLAY", "bash")
+	if r.Output != "carried" {
+		t.Errorf("Expected overlay in the next command, got %q", r.Output)
+	}
+
+	e.Execute("unset SHELLE_OVERLAY", "bash")
+	r = e.Execute("echo \"[$SHELLE_OVERLAY]\"", "bash")
+	if r.Output != "[]" {
+		t.Errorf("Expected variable to be removed, got %q", r.Output)
+	}
+}
+
+func TestExecute_EnvOverlayRemovesInherited(t *testing.T) {
+	requireShell(t, "bash")
+	t.Setenv("SHELLE_INHERITED", "from-parent")
+	e := executor.NewExecutor(t.TempDir())
+
+	e.Execute("unset SHELLE_INHERITED", "bash")
+	if r := e.Execute("echo \"[$SHELLE_INHERITED]\"", "bash"); r.Output != "[]" {
+		t.Errorf("Expected inherited variable to be removed, got %q", r.Output)
+	}
+
+	if !e.UnsetEnv("SHELLE_INHERITED") {
+		t.Fatal("Expected UnsetEnv to drop the overlay entry")
+	}
+	if r := e.Execute("echo $SHELLE_INHERITED", "bash"); r.Output != "from-parent" {
+		t.Errorf("Expected inherited value back, got %q", r.Output)
+	}
+}
+
+func TestExecute_EnvOverlayRestored(t *testing.T) {
+	requireShell(t, "bash")
+	dir := t.TempDir()
+
+	e1 := executor.NewExecutor(dir)
+	e1.Execute("export SHELLE_SAVED=yes", "bash")
+	m1 := memory.NewMemory(dir)
+	m1.SetEnv(e1.EnvOverlay())
+	if err := m1.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	m2 := memory.NewMemory(dir)
+	if err := m2.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	e2 := executor.NewExecutor(dir)
+	e2.SetEnvOverlay(m2.Env)
+	if r := e2.Execute("echo $SHELLE_SAVED", "bash"); r.Output != "yes" {
+		t.Errorf("Expected restored overlay, got %q", r.Output)
+	}
+
+	e2.ClearEnv()
+	if len(e2.EnvOverlay()) != 0 {
+		t.Error("Expected ClearEnv to empty the overlay")
+	}
+}
+
+func TestSession_EnvOverlayRecorded(t *testing.T) {
+	e, _ := newSessionExecutor(t)
+	if r := e.Execute("export SHELLE_SESSION_ENV=kept", "bash"); !r.Success {
+		t.Fatalf("export failed: %s", r.Error)
+	}
+	if e.EnvOverlay()["SHELLE_SESSION_ENV"] != "kept" {
+		t.Error("Expected env change in session mode to be recorded in the overlay")
+	}
+
+	// A restarted session starts with the overlay applied
+	e.Close()
+	if r := e.Execute("echo $SHELLE_SESSION_ENV", "bash"); r.Output != "kept" {
+		t.Errorf("Expected overlay in a new session, got %q", r.Output)
+	}
+}
@@ -2,8 +2,10 @@ package tests
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
 	"shell-e/internal/executor"
@@ -153,3 +155,129 @@ func TestExecute_DeletedWorkingDir(t *testing.T) {
 		t.Errorf("Expected output from fallback execution, got: %s", result.Output)
 	}
 }
+
+// requireShell skips the test when the given shell binary is not installed
+func requireShell(t *testing.T, shell string) {
+	t.Helper()
+	if _, err := exec.LookPath(shell); err != nil {
+		t.Skipf("%s not available: %v", shell, err)
+	}
+}
+
+func TestExecute_Bash_SimpleCommand(t *testing.T) {
+	requireShell(t, "bash")
+	e := executor.NewExecutor(os.TempDir())
+	result := e.Execute("echo \"hello $((1+1))\"", "bash")
+
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s", result.Error)
+	}
+	if result.Output != "hello 2" {
+		t.Errorf("Expected 'hello 2', got: %s", result.Output)
+	}
+}
+
+func TestExecute_Sh_WorkingDirectory(t *testing.T) {
+	requireShell(t, "sh")
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("hello"), 0644)
+
+	e := executor.NewExecutor(tmpDir)
+	result := e.Execute("ls", "sh")
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s", result.Error)
+	}
+	if !strings.Contains(result.Output, "test.txt") {
+		t.Errorf("Expected 'test.txt' in output, got: %s", result.Output)
+	}
+}
+
+func TestExecute_Bash_GrepNoMatches(t *testing.T) {
+	requireShell(t, "bash")
+	e := executor.NewExecutor(os.TempDir())
+	result := e.Execute("echo apple | grep orange", "bash")
+
+	if result.Success {
+		t.Error("Expected failure (Success=false) for no matches")
+	}
+	if result.Error != "No matches found" {
+		t.Errorf("Expected 'No matches found' error, got: %s", result.Error)
+	}
+}
+
+func TestExecuteWithOptions_StreamsLines(t *testing.T) {
+	requireShell(t, "bash")
+	e := executor.NewExecutor(os.TempDir())
+
+	var mu sync.Mutex
+	var lines []executor.OutputLine
+	result := e.ExecuteWithOptions("printf 'one\\n50%%\\r100%%\\r\\ntwo'; echo err >&2", "bash", executor.ExecOptions{
+		OnOutput: func(line executor.OutputLine) {
+			mu.Lock()
+			lines = append(lines, line)
+			mu.Unlock()
+		},
+	})
+
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s", result.Error)
+	}
+
+	var stdout []executor.OutputLine
+	sawStderr := false
+	for _, l := range lines {
+		if l.Stderr {
+			sawStderr = l.Text == "err"
+			continue
+		}
+		stdout = append(stdout, l)
+	}
+
+	want := []executor.OutputLine{
+		{Text: "one"},
+		{Text: "50%", Partial: true},
+		{Text: "100%"},
+		{Text: "two"},
+	}
+	if len(stdout) != len(want) {
+		t.Fatalf("Expected %d stdout lines, got %d: %+v", len(want), len(stdout), stdout)
+	}
+	for i := range want {
+		if stdout[i] != want[i] {
+			t.Errorf("Line %d: got %+v, want %+v", i, stdout[i], want[i])
+		}
+	}
+	if !sawStderr {
+		t.Errorf("Expected stderr line 'err', got %+v", lines)
+	}
+
+	// The final result is still assembled in full
+	if !strings.Contains(result.Output, "two") || !strings.Contains(result.Output, "err") {
+		t.Errorf("Expected full output in Result, got: %q", result.Output)
+	}
+}
+
+func TestExecute_ExitCodeAndStreams(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+
+	r := e.Execute("echo out; echo err >&2; exit 3", "sh")
+	if r.Success || r.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d (success %v)", r.ExitCode, r.Success)
+	}
+	if r.Stdout != "out" || r.Stderr != "err" {
+		t.Errorf("Expected separate streams, got stdout %q stderr %q", r.Stdout, r.Stderr)
+	}
+	if r.Output != "out\nerr" {
+		t.Errorf("Expected combined output, got %q", r.Output)
+	}
+
+	r = e.Execute("true", "sh")
+	if !r.Success || r.ExitCode != 0 || r.TimedOut || r.Cancelled || r.Signal != "" {
+		t.Errorf("Expected a clean exit, got %+v", r)
+	}
+
+	if r := e.Execute("cd /nonexistent-shell-e-dir", "sh"); r.ExitCode != 1 {
+		t.Errorf("Expected exit code 1 for a failed native cd, got %d", r.ExitCode)
+	}
+}
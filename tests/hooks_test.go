@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"shell-e/internal/executor"
+	"shell-e/internal/hooks"
+)
+
+// hookScript writes an sh script to use as a hook
+func hookScript(t *testing.T, body string) string {
+	t.Helper()
+	requireShell(t, "sh")
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHooks_PreHookRefuses(t *testing.T) {
+	freeze := hookScript(t, `cat >/dev/null; echo "change freeze until Monday" >&2; exit 1`)
+	dir := t.TempDir()
+	e := executor.NewExecutor(dir)
+	e.Hooks = &hooks.Hooks{Pre: []hooks.Hook{{Name: "freeze", Program: freeze}}}
+
+	r := e.Execute("touch ran.txt", "sh")
+	if r.Success || !r.Refused || r.Hook != "freeze" || !strings.Contains(r.Error, "change freeze until Monday") {
+		t.Errorf("Expected the hook to refuse the command, got %+v", r)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran.txt")); !os.IsNotExist(err) {
+		t.Error("Expected a refused command not to run")
+	}
+
+	deny := hookScript(t, `echo '{"action": "deny", "reason": "not on Fridays"}'`)
+	e.Hooks.Pre = []hooks.Hook{{Program: deny}}
+	r = e.Execute("echo hi", "sh")
+	if !r.Refused || r.Hook != "hook.sh" || !strings.Contains(r.Error, "not on Fridays") {
+		t.Errorf("Expected a deny decision to refuse the command, got %+v", r)
+	}
+}
+
+func TestHooks_PreHookRewrites(t *testing.T) {
+	rewrite := hookScript(t, `echo '{"action": "rewrite", "command": "echo rewritten"}'`)
+	e := executor.NewExecutor(t.TempDir())
+	e.Hooks = &hooks.Hooks{Pre: []hooks.Hook{{Name: "wrap", Program: rewrite}}}
+
+	r := e.Execute("echo planned", "sh")
+	if !r.Success || r.Output != "rewritten" || r.Rewritten != "echo rewritten" || r.Hook != "wrap" {
+		t.Errorf("Expected the rewritten command to run, got %+v", r)
+	}
+
+	// A rewrite goes through the safety check like a planned command
+	e.Hooks.Check = func(p hooks.Payload) error {
+		if p.Original != "echo planned" {
+			t.Errorf("Expected the check to see the planned command, got %q", p.Original)
+		}
+		return errors.New("needs confirmation")
+	}
+	r = e.Execute("echo planned", "sh")
+	if !r.Refused || !strings.Contains(r.Error, "needs confirmation") {
+		t.Errorf("Expected a rewrite failing the check to be refused, got %+v", r)
+	}
+
+	// Output that isn't a decision just lets the command through
+	e.Hooks = &hooks.Hooks{Pre: []hooks.Hook{{Program: hookScript(t, `echo checked`)}}}
+	if r := e.Execute("echo planned", "sh"); !r.Success || r.Output != "planned" || r.Rewritten != "" {
+		t.Errorf("Expected the planned command to run, got %+v", r)
+	}
+}
+
+func TestHooks_Timeout(t *testing.T) {
+	slow := hookScript(t, `sleep 10`)
+	e := executor.NewExecutor(t.TempDir())
+	e.Hooks = &hooks.Hooks{Pre: []hooks.Hook{{Name: "slow", Program: slow, Timeout: 200 * time.Millisecond}}}
+
+	start := time.Now()
+	r := e.Execute("echo hi", "sh")
+	if !r.Refused || !strings.Contains(r.Error, "timed out") {
+		t.Errorf("Expected a hook that times out to refuse the command, got %+v", r)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected the hook to be stopped at its timeout, took %v", elapsed)
+	}
+}
+
+func TestHooks_PostHookPayload(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "payload.json")
+	record := hookScript(t, `cat > "`+out+`"; echo "$SHELLE_HOOK_EVENT" >> "`+out+`.event"`)
+	dir := t.TempDir()
+	e := executor.NewExecutor(dir)
+	e.Hooks = &hooks.Hooks{Post: []hooks.Hook{{Program: record}, {Program: "/nonexistent/hook"}}}
+
+	r := e.ExecuteWithOptions("echo hi; exit 3", "sh", executor.ExecOptions{
+		Plan: &hooks.Plan{Request: "say hi", Reasoning: "test"},
+	})
+	if r.ExitCode != 3 || r.Refused {
+		t.Fatalf("Expected post-hook failures not to change the result, got %+v", r)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Expected the post-hook to run: %v", err)
+	}
+	var p hooks.Payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatalf("Invalid payload %s: %v", data, err)
+	}
+	if p.Event != "post" || p.Command != "echo hi; exit 3" || p.Shell != "sh" || p.Cwd != dir {
+		t.Errorf("Unexpected payload %+v", p)
+	}
+	if p.Plan == nil || p.Plan.Request != "say hi" {
+		t.Errorf("Expected the plan in the payload, got %+v", p.Plan)
+	}
+	if p.Result == nil || p.Result.ExitCode != 3 || p.Result.Success || p.Result.Output != "hi" {
+		t.Errorf("Expected the outcome in the payload, got %+v", p.Result)
+	}
+	if event, _ := os.ReadFile(out + ".event"); strings.TrimSpace(string(event)) != "post" {
+		t.Errorf("Expected SHELLE_HOOK_EVENT=post, got %q", event)
+	}
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+
+	"shell-e/internal/executor"
+)
+
+func TestNeedsTerminal(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"git commit", true},
+		{"git commit -am 'fix'", false},
+		{"git status", false},
+		{"ssh-keygen -t ed25519", true},
+		{"vim notes.txt", true},
+		{"python", true},
+		{"python script.py", false},
+		{"Get-ChildItem", false},
+		// sudo asks for its password separately, so only what it runs counts
+		{"sudo apt-get install -y git", false},
+		{"sudo -u postgres psql", true},
+		{"sudo vim /etc/hosts", true},
+		{"sudo -i", true},
+		{"sudo su", true},
+		{"sudo -E systemctl restart nginx", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := executor.NeedsTerminal(tt.command); got != tt.want {
+			t.Errorf("NeedsTerminal(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestInteractive_PromptsAndCaptures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("pty capture is Unix-only")
+	}
+	requireShell(t, "bash")
+
+	e := executor.NewExecutor(t.TempDir())
+	icmd := e.Interactive("read -p 'Name? ' name; echo \"hello $name\"", "bash")
+
+	var screen bytes.Buffer
+	icmd.SetStdin(strings.NewReader("shell-e\n"))
+	icmd.SetStdout(&screen)
+	icmd.SetStderr(&screen)
+
+	if err := icmd.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	result := icmd.Result()
+	if result == nil || !result.Success {
+		t.Fatalf("Expected success, got %+v", result)
+	}
+	if !strings.Contains(result.Output, "hello shell-e") {
+		t.Errorf("Expected captured 'hello shell-e', got: %q", result.Output)
+	}
+	if !strings.Contains(screen.String(), "Name?") {
+		t.Errorf("Expected prompt to reach the terminal, got: %q", screen.String())
+	}
+}
+
+func TestInteractive_ExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("pty capture is Unix-only")
+	}
+	requireShell(t, "bash")
+
+	e := executor.NewExecutor(t.TempDir())
+	icmd := e.Interactive("exit 3", "bash")
+	icmd.SetStdin(strings.NewReader(""))
+	icmd.SetStdout(&bytes.Buffer{})
+
+	icmd.Run()
+	result := icmd.Result()
+	if result.Success {
+		t.Error("Expected failure for exit 3")
+	}
+	if result.Error != "exit status 3" {
+		t.Errorf("Expected 'exit status 3', got: %s", result.Error)
+	}
+}
@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"shell-e/internal/executor"
+	"shell-e/internal/planner"
+)
+
+func waitJob(t *testing.T, job *executor.Job) {
+	t.Helper()
+	select {
+	case <-job.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Job [%d] did not finish", job.ID)
+	}
+}
+
+func TestJob_RunsPastTimeout(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+	e.Timeout = 100 * time.Millisecond
+	t.Cleanup(e.Close)
+
+	job := e.StartJob("sleep 0.4; echo finished", "sh")
+	if job.Status() != executor.JobRunning {
+		t.Fatalf("Expected job to be running, got %s", job.Status())
+	}
+	waitJob(t, job)
+
+	if job.Status() != executor.JobDone {
+		t.Fatalf("Expected job to outlive the executor timeout, got %s (err: %s)", job.Status(), job.Result().Error)
+	}
+	if tail := job.Tail(0); len(tail) != 1 || tail[0] != "finished" {
+		t.Errorf("Expected output buffer [finished], got %v", tail)
+	}
+}
+
+func TestJob_Kill(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+	t.Cleanup(e.Close)
+
+	job := e.StartJob("echo started; sleep 30", "sh")
+	time.Sleep(200 * time.Millisecond)
+	if !job.Kill() {
+		t.Fatal("Expected Kill to stop a running job")
+	}
+	waitJob(t, job)
+
+	if job.Status() != executor.JobKilled {
+		t.Errorf("Expected killed status, got %s", job.Status())
+	}
+	if job.Kill() {
+		t.Error("Expected Kill on a finished job to return false")
+	}
+	if tail := job.Tail(0); len(tail) == 0 || tail[0] != "started" {
+		t.Errorf("Expected output before the kill to be kept, got %v", tail)
+	}
+}
+
+func TestJob_TableAndFailure(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+	t.Cleanup(e.Close)
+
+	first := e.StartJob("exit 3", "sh")
+	second := e.StartJob("echo ok", "sh")
+	waitJob(t, first)
+	waitJob(t, second)
+
+	if first.ID != 1 || second.ID != 2 {
+		t.Errorf("Expected sequential IDs 1 and 2, got %d and %d", first.ID, second.ID)
+	}
+	if job, ok := e.Job(2); !ok || job != second {
+		t.Error("Expected to find job 2 by ID")
+	}
+	if len(e.Jobs()) != 2 {
+		t.Errorf("Expected 2 jobs in the table, got %d", len(e.Jobs()))
+	}
+	if first.Status() != executor.JobFailed {
+		t.Errorf("Expected failed status for exit 3, got %s", first.Status())
+	}
+	if !strings.Contains(first.String(), "failed") || !strings.Contains(first.String(), "exit 3") {
+		t.Errorf("Unexpected job listing: %q", first.String())
+	}
+}
+
+func TestJob_Follow(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+	t.Cleanup(e.Close)
+
+	job := e.StartJob("sleep 0.2; echo one; echo two", "sh")
+	lines, _ := job.Follow()
+
+	var got []string
+	for line := range lines {
+		got = append(got, line.Text)
+	}
+	if strings.Join(got, ",") != "one,two" {
+		t.Errorf("Expected followed lines [one two], got %v", got)
+	}
+}
+
+func TestJob_ProgressPerStream(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+	t.Cleanup(e.Close)
+
+	// A progress line on stderr is overwritten by stderr only
+	job := e.StartJob(`printf 'at 1\rat 2\r' >&2; sleep 0.1; echo out; sleep 0.1; echo done >&2`, "sh")
+	<-job.Done()
+	if got := job.Tail(10); strings.Join(got, ",") != "done,out" {
+		t.Errorf("Expected lines [done out], got %q", got)
+	}
+}
+
+func TestJob_BypassesSession(t *testing.T) {
+	e, _ := newSessionExecutor(t)
+	e.Execute("declare SESSION_ONLY=1", "bash")
+
+	job := e.StartJob("echo \"[${SESSION_ONLY:-}]\"", "bash")
+	waitJob(t, job)
+	if tail := job.Tail(0); len(tail) != 1 || tail[0] != "[]" {
+		t.Errorf("Expected job to run outside the session, got %v", tail)
+	}
+
+	// The session is still usable while and after the job runs
+	if r := e.Execute("echo $SESSION_ONLY", "bash"); r.Output != "1" {
+		t.Errorf("Expected session state intact, got %q", r.Output)
+	}
+}
+
+// Run with -race: the job must not touch the foreground's directory
+func TestJob_KeepsStartingDirectory(t *testing.T) {
+	requireShell(t, "sh")
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "a"), 0755)
+	e := executor.NewExecutor(dir)
+	t.Cleanup(e.Close)
+
+	job := e.StartJob("pwd; sleep 0.2; pwd", "sh")
+	for i := 0; i < 10; i++ {
+		e.Execute("cd a", "sh")
+		e.Execute("cd ..", "sh")
+	}
+	e.Execute("cd a", "sh")
+	waitJob(t, job)
+
+	if tail := job.Tail(0); len(tail) != 2 || tail[0] != dir || tail[1] != dir {
+		t.Errorf("Expected the job to stay in %s, got %v", dir, tail)
+	}
+	if r := job.Result(); r.CurrentWorkDir != dir {
+		t.Errorf("Expected the job's result in %s, got %s", dir, r.CurrentWorkDir)
+	}
+	if want := filepath.Join(dir, "a"); e.WorkingDir != want {
+		t.Errorf("Expected the foreground in %s, got %s", want, e.WorkingDir)
+	}
+}
+
+func TestPlanner_BackgroundFlag(t *testing.T) {
+	mock := &MockLLM{Running: true, Response: `{"command": "npm run dev", "shell": "bash", "response": "Starting the dev server", "safe": true, "background": true}`}
+	p := planner.NewPlanner(mock, nil, "bash")
+
+	plan, err := p.Plan("start the dev server")
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if !plan.Background {
+		t.Error("Expected background flag to be parsed")
+	}
+	if !strings.Contains(planner.BashSystemPrompt, `"background": boolean`) {
+		t.Error("Expected the prompt schema to include the background field")
+	}
+}
@@ -1,9 +1,12 @@
 package tests
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"shell-e/internal/memory"
 )
@@ -75,13 +78,23 @@ func TestMemory_ContextLimit(t *testing.T) {
 
 func TestMemory_Clear(t *testing.T) {
 	m := memory.NewMemory(t.TempDir())
-	m.RecordExchange("test", "cmd", "result", "response")
+	id := m.RecordExchange("test", "cmd", "result", "response")
+	m.SaveOutput(id, "result")
 	m.Clear()
 
 	ctx := m.GetContext()
 	if len(ctx.RecentExchanges) != 0 {
 		t.Errorf("Expected 0 exchanges after clear, got %d", len(ctx.RecentExchanges))
 	}
+	if _, err := os.Stat(m.OutputPath(id)); !os.IsNotExist(err) {
+		t.Errorf("Expected the saved output to be deleted, got %v", err)
+	}
+
+	// Output arriving for a cleared exchange isn't kept either
+	m.SaveOutput(id, "late")
+	if _, err := os.Stat(m.OutputPath(id)); !os.IsNotExist(err) {
+		t.Errorf("Expected no output file for a cleared exchange, got %v", err)
+	}
 }
 
 func TestMemory_Compaction(t *testing.T) {
@@ -91,14 +104,26 @@ func TestMemory_Compaction(t *testing.T) {
 	m.CompactAfter = 5
 	m.MaxExchanges = 3
 
+	var ids []int
 	for i := 0; i < 10; i++ {
-		m.RecordExchange("msg", "cmd", "result", "response")
+		id := m.RecordExchange("msg", "cmd", "result", "response")
+		m.SaveOutput(id, "result")
+		ids = append(ids, id)
 	}
 
 	entries, _ := os.ReadDir(filepath.Join(dir, "memory"))
 	if len(entries) == 0 {
 		t.Error("Expected daily note to be created during compaction")
 	}
+
+	// Only the exchanges still in memory keep their output files
+	outputs, _ := os.ReadDir(filepath.Join(dir, "outputs"))
+	if _, err := m.LoadOutput(ids[len(ids)-1]); err != nil || len(outputs) != len(m.GetHistory()) {
+		t.Errorf("Expected %d output files, got %d (err: %v)", len(m.GetHistory()), len(outputs), err)
+	}
+	if _, err := m.LoadOutput(ids[0]); err == nil {
+		t.Error("Expected a compacted exchange's output to be deleted")
+	}
 }
 
 func TestExtractNameFromCommand(t *testing.T) {
@@ -130,3 +155,109 @@ func TestContextInfo_FormatForPrompt(t *testing.T) {
 		t.Error("Expected non-empty formatted context")
 	}
 }
+
+func TestMemory_ExchangeIDs(t *testing.T) {
+	dir := t.TempDir()
+	m1 := memory.NewMemory(dir)
+	first := m1.RecordExchange("one", "echo 1", "1", "Printed 1")
+	second := m1.RecordExchange("two", "echo 2", "2", "Printed 2")
+	if first != 1 || second != 2 {
+		t.Fatalf("Expected IDs 1 and 2, got %d and %d", first, second)
+	}
+	m1.Save()
+
+	// IDs keep counting across restarts so output files are never reused
+	m2 := memory.NewMemory(dir)
+	m2.Load()
+	if id := m2.RecordExchange("three", "", "", "Hi"); id != 3 {
+		t.Errorf("Expected ID 3 after reload, got %d", id)
+	}
+	if ex, ok := m2.Exchange(2); !ok || ex.Command != "echo 2" {
+		t.Errorf("Expected to find exchange 2, got %+v", ex)
+	}
+}
+
+func TestMemory_SaveAndLoadOutput(t *testing.T) {
+	m := memory.NewMemory(t.TempDir())
+
+	var lines []string
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	full := strings.Join(lines, "\n")
+
+	id := m.RecordExchange("list", "ls", full, "Listed")
+	if err := m.SaveOutput(id, full); err != nil {
+		t.Fatalf("SaveOutput failed: %v", err)
+	}
+
+	got, err := m.LoadOutput(id)
+	if err != nil || got != full {
+		t.Fatalf("Expected full output back, got %d bytes (err: %v)", len(got), err)
+	}
+
+	// memory.json only keeps a preview
+	ex, _ := m.Exchange(id)
+	if !strings.Contains(ex.Result, "line 30") || strings.Contains(ex.Result, "line 31\n") ||
+		!strings.Contains(ex.Result, "70 more lines") {
+		t.Errorf("Expected a 30 line preview in the exchange, got %q", ex.Result)
+	}
+
+	if last, ok := m.LastOutputID(); !ok || last != id {
+		t.Errorf("Expected LastOutputID %d, got %d (ok: %v)", id, last, ok)
+	}
+	m.RecordExchange("hi", "", "", "Hello")
+	if last, _ := m.LastOutputID(); last != id {
+		t.Errorf("Expected chat-only exchanges to be skipped, got %d", last)
+	}
+
+	if _, err := m.LoadOutput(999); err == nil {
+		t.Error("Expected an error for a missing output")
+	}
+}
+
+func TestMemory_StoresPlainText(t *testing.T) {
+	m := memory.NewMemory(t.TempDir())
+	coloured := "\x1b[1;31merror\x1b[0m: build failed"
+
+	id := m.RecordExchange("build", "make", coloured, "Building")
+	m.SetOutcome(id, memory.Outcome{ExitCode: 2, Stderr: coloured})
+	if err := m.SaveOutput(id, coloured); err != nil {
+		t.Fatalf("SaveOutput failed: %v", err)
+	}
+
+	ex, _ := m.Exchange(id)
+	got, _ := m.LoadOutput(id)
+	for what, text := range map[string]string{"preview": ex.Result, "stderr": ex.Outcome.Stderr, "output file": got} {
+		if text != "error: build failed" {
+			t.Errorf("Expected the %s without escape sequences, got %q", what, text)
+		}
+	}
+	if ctx := m.GetContext().FormatForPrompt(); strings.Contains(ctx, "\x1b") {
+		t.Errorf("Expected no escape sequences in the planner context, got %q", ctx)
+	}
+}
+
+func TestMemory_Outcome(t *testing.T) {
+	dir := t.TempDir()
+	m := memory.NewMemory(dir)
+	id := m.RecordExchange("build", "make", "failed", "Building")
+	m.SetOutcome(id, memory.Outcome{
+		ExitCode:   2,
+		Stderr:     strings.Repeat("error\n", 100),
+		PeakMemory: 1 << 20,
+		CPUTime:    1500 * time.Millisecond,
+	})
+	m.Save()
+
+	m2 := memory.NewMemory(dir)
+	m2.Load()
+	ex, _ := m2.Exchange(id)
+	o := ex.Outcome
+	if o == nil || o.ExitCode != 2 || o.PeakMemory != 1<<20 || o.CPUTime != 1500*time.Millisecond {
+		t.Fatalf("Expected outcome to round-trip, got %+v", o)
+	}
+	if !strings.Contains(o.Stderr, "more lines") {
+		t.Errorf("Expected stderr to be trimmed to a preview, got %d bytes", len(o.Stderr))
+	}
+}
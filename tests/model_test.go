@@ -1,7 +1,12 @@
 package tests
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -197,5 +202,112 @@ func TestLlamaServer_StartFailsWithBadBinary(t *testing.T) {
 	}
 }
 
+// --- Chat Template / Raw Completion Tests ---
+
+func TestChatTemplate_ChatML(t *testing.T) {
+	tmpl, err := llm.GetChatTemplate("chatml")
+	if err != nil {
+		t.Fatalf("GetChatTemplate failed: %v", err)
+	}
+
+	prompt := tmpl.Render([]llm.ChatMessage{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "hi"},
+	})
+	want := "<|im_start|>system\nsys<|im_end|>\n<|im_start|>user\nhi<|im_end|>\n<|im_start|>assistant\n"
+	if prompt != want {
+		t.Errorf("Unexpected ChatML prompt:\n%q\nwant:\n%q", prompt, want)
+	}
+	if len(tmpl.Stop) == 0 || tmpl.Stop[0] != "<|im_end|>" {
+		t.Errorf("Expected <|im_end|> stop sequence, got %v", tmpl.Stop)
+	}
+}
+
+func TestChatTemplate_GemmaMergesSystem(t *testing.T) {
+	tmpl, err := llm.GetChatTemplate("Gemma")
+	if err != nil {
+		t.Fatalf("GetChatTemplate failed: %v", err)
+	}
+
+	prompt := tmpl.Render([]llm.ChatMessage{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "{}"},
+		{Role: "user", Content: "again"},
+	})
+	if strings.Contains(prompt, "system") {
+		t.Errorf("Gemma has no system role, got: %q", prompt)
+	}
+	if !strings.HasPrefix(prompt, "<start_of_turn>user\nsys\n\nhi<end_of_turn>") {
+		t.Errorf("Expected system folded into first user turn, got: %q", prompt)
+	}
+	if !strings.HasSuffix(prompt, "<start_of_turn>model\n") {
+		t.Errorf("Expected model generation prefix, got: %q", prompt)
+	}
+}
+
+func TestChatTemplate_AllBuiltinsRender(t *testing.T) {
+	for _, name := range []string{"chatml", "llama3", "phi", "gemma", "mistral"} {
+		tmpl, err := llm.GetChatTemplate(name)
+		if err != nil {
+			t.Fatalf("GetChatTemplate(%q) failed: %v", name, err)
+		}
+		prompt := tmpl.Render([]llm.ChatMessage{
+			{Role: "system", Content: "SYS"},
+			{Role: "user", Content: "USER"},
+		})
+		if !strings.Contains(prompt, "SYS") || !strings.Contains(prompt, "USER") {
+			t.Errorf("%s: prompt lost content: %q", name, prompt)
+		}
+		if len(tmpl.Stop) == 0 {
+			t.Errorf("%s: expected stop sequences", name)
+		}
+	}
+}
+
+func TestChatTemplate_Unknown(t *testing.T) {
+	if _, err := llm.GetChatTemplate("nope"); err == nil {
+		t.Error("Expected error for unknown template")
+	}
+}
+
+func TestLlamaServer_RawCompletionMode(t *testing.T) {
+	var got llm.CompletionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/completion" {
+			t.Errorf("Expected /completion, got %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprint(w, `{"content": " {\"command\": null} "}`)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	s := llm.NewLlamaServer("unused", "model.gguf", 4096, port)
+	s.SystemPrompt = "sys"
+	s.Template, _ = llm.GetChatTemplate("llama3")
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	resp, err := s.InferWithHistory([]llm.ChatMessage{{Role: "user", Content: "hi"}}, nil)
+	if err != nil {
+		t.Fatalf("Infer failed: %v", err)
+	}
+	if resp != `{"command": null}` {
+		t.Errorf("Expected trimmed content, got: %q", resp)
+	}
+	if !strings.Contains(got.Prompt, "<|start_header_id|>system<|end_header_id|>\n\nsys<|eot_id|>") {
+		t.Errorf("Expected llama3-formatted prompt, got: %q", got.Prompt)
+	}
+	if len(got.Stop) == 0 || got.Stop[0] != "<|eot_id|>" {
+		t.Errorf("Expected llama3 stop sequences, got: %v", got.Stop)
+	}
+}
+
 // Verify time import is used (prevent lint issues)
 var _ = time.Millisecond
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"shell-e/internal/executor"
+)
+
+// navDirs creates root/a and root/b and returns root
+func navDirs(t *testing.T) string {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Mkdir(filepath.Join(root, "a"), 0755)
+	os.Mkdir(filepath.Join(root, "b"), 0755)
+	return root
+}
+
+func TestNavigate_CDDashAndHome(t *testing.T) {
+	root := navDirs(t)
+	e := executor.NewExecutor(root)
+
+	if r := e.Execute("cd -", "bash"); r.Success {
+		t.Error("Expected cd - with no previous directory to fail")
+	}
+	e.Execute("cd a", "bash")
+	e.Execute("cd ../b", "bash")
+	r := e.Execute("cd -", "bash")
+	if !r.Success || e.WorkingDir != filepath.Join(root, "a") {
+		t.Errorf("Expected cd - to return to a, got %s (err: %s)", e.WorkingDir, r.Error)
+	}
+	e.Execute("cd -", "bash")
+	if e.WorkingDir != filepath.Join(root, "b") {
+		t.Errorf("Expected cd - to toggle back to b, got %s", e.WorkingDir)
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	os.Mkdir(filepath.Join(home, "proj"), 0755)
+	for _, cmd := range []string{"cd", "cd ~"} {
+		e.WorkingDir = root
+		if r := e.Execute(cmd, "bash"); !r.Success || e.WorkingDir != home {
+			t.Errorf("%q: expected home %s, got %s (err: %s)", cmd, home, e.WorkingDir, r.Error)
+		}
+	}
+	e.Execute("cd ~/proj", "bash")
+	if e.WorkingDir != filepath.Join(home, "proj") {
+		t.Errorf("Expected ~/proj, got %s", e.WorkingDir)
+	}
+}
+
+func TestNavigate_ExpandsVariables(t *testing.T) {
+	root := navDirs(t)
+	t.Setenv("SHELLE_NAV_ROOT", root)
+	e := executor.NewExecutor(os.TempDir())
+
+	tests := []struct{ shell, command string }{
+		{"bash", "cd $SHELLE_NAV_ROOT/a"},
+		{"bash", `cd "${SHELLE_NAV_ROOT}/a"`},
+		{"powershell", "Set-Location $env:SHELLE_NAV_ROOT/a"},
+		{"cmd", `cd /d "%SHELLE_NAV_ROOT%/a"`},
+	}
+	for _, tt := range tests {
+		e.WorkingDir = os.TempDir()
+		r := e.Execute(tt.command, tt.shell)
+		if !r.Success || e.WorkingDir != filepath.Join(root, "a") {
+			t.Errorf("%s %q: expected %s, got %s (err: %s)", tt.shell, tt.command,
+				filepath.Join(root, "a"), e.WorkingDir, r.Error)
+		}
+	}
+
+	// Each shell expands only its own syntax
+	t.Setenv("Recycle", "gone")
+	os.Mkdir(filepath.Join(root, "$Recycle.Bin"), 0755)
+	e.WorkingDir = root
+	if r := e.Execute(`cd $Recycle.Bin`, "cmd"); !r.Success || e.WorkingDir != filepath.Join(root, "$Recycle.Bin") {
+		t.Errorf("Expected cmd to leave $Recycle alone, got %s (err: %s)", e.WorkingDir, r.Error)
+	}
+	e.WorkingDir = root
+	if r := e.Execute("cd %SHELLE_NAV_ROOT%", "bash"); r.Success {
+		t.Errorf("Expected bash not to expand %%NAME%%, got %s", e.WorkingDir)
+	}
+
+	// Variables set through the executor count too
+	e.SetEnvOverlay(map[string]string{"SHELLE_NAV_SUB": "b"})
+	e.WorkingDir = root
+	if r := e.Execute("cd $SHELLE_NAV_SUB", "bash"); !r.Success || e.WorkingDir != filepath.Join(root, "b") {
+		t.Errorf("Expected overlay variable to expand, got %s (err: %s)", e.WorkingDir, r.Error)
+	}
+}
+
+func TestNavigate_PushdPopd(t *testing.T) {
+	root := navDirs(t)
+	e := executor.NewExecutor(root)
+
+	e.Execute("pushd a", "bash")
+	r := e.Execute("pushd ../b", "bash")
+	if !r.Success || e.WorkingDir != filepath.Join(root, "b") {
+		t.Fatalf("Expected to be in b, got %s (err: %s)", e.WorkingDir, r.Error)
+	}
+	want := []string{filepath.Join(root, "a"), root}
+	if got := e.DirStack(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected stack %v, got %v", want, got)
+	}
+	if !strings.Contains(r.Output, "Stack: ") {
+		t.Errorf("Expected the stack in the output, got %q", r.Output)
+	}
+
+	e.Execute("popd", "bash")
+	if e.WorkingDir != filepath.Join(root, "a") {
+		t.Errorf("Expected popd to return to a, got %s", e.WorkingDir)
+	}
+	e.Execute("Pop-Location", "powershell")
+	if e.WorkingDir != root {
+		t.Errorf("Expected Pop-Location to return to root, got %s", e.WorkingDir)
+	}
+	if r := e.Execute("popd", "bash"); r.Success || r.ExitCode != 1 {
+		t.Errorf("Expected popd on an empty stack to fail, got %+v", r)
+	}
+
+	// A failed pushd leaves the stack alone
+	if r := e.Execute("pushd missing", "bash"); r.Success || len(e.DirStack()) != 0 {
+		t.Errorf("Expected failed pushd not to push, got stack %v", e.DirStack())
+	}
+}
+
+func TestNavigate_ChainedCommands(t *testing.T) {
+	requireShell(t, "sh")
+	root := navDirs(t)
+	os.WriteFile(filepath.Join(root, "a", "marker.txt"), nil, 0644)
+	e := executor.NewExecutor(root)
+
+	r := e.Execute("cd a && ls", "sh")
+	if !r.Success || r.Output != "marker.txt" {
+		t.Errorf("Expected ls to run in a, got %q (err: %s)", r.Output, r.Error)
+	}
+	if e.WorkingDir != filepath.Join(root, "a") || r.NewWorkDir != filepath.Join(root, "a") {
+		t.Errorf("Expected the cd to stick, got %s (NewWorkDir %q)", e.WorkingDir, r.NewWorkDir)
+	}
+
+	// && stops after a failed cd; ; carries on in the same directory
+	e.WorkingDir = root
+	if r := e.Execute("cd missing && echo ran", "sh"); r.Success || strings.Contains(r.Output, "ran") {
+		t.Errorf("Expected && to stop after a failed cd, got %q", r.Output)
+	}
+	r = e.Execute("cd missing; echo ran", "sh")
+	if !r.Success || !strings.HasPrefix(r.Output, "Cannot navigate to 'missing'") || !strings.HasSuffix(r.Output, "ran") {
+		t.Errorf("Expected ; to carry on after the cd error, got %q", r.Output)
+	}
+	if r := e.Execute("cd missing || echo fallback", "sh"); r.Output != "Cannot navigate to 'missing': "+
+		"stat "+filepath.Join(root, "missing")+": no such file or directory\nfallback" {
+		t.Errorf("Expected || to run the fallback, got %q", r.Output)
+	}
+	if e.WorkingDir != root {
+		t.Errorf("Expected to stay in root, got %s", e.WorkingDir)
+	}
+
+	// Background jobs leave the chain to their own shell
+	r = e.ExecuteWithOptions("cd a && pwd", "sh", executor.ExecOptions{NoSession: true})
+	if r.Output != filepath.Join(root, "a") || e.WorkingDir != root {
+		t.Errorf("Expected the job's cd to stay in its shell, got %q in %s", r.Output, e.WorkingDir)
+	}
+	if r := e.ExecuteWithOptions("cd a", "sh", executor.ExecOptions{NoSession: true}); !r.Success || e.WorkingDir != root {
+		t.Errorf("Expected a job's lone cd not to move the executor, got %s (err: %s)", e.WorkingDir, r.Error)
+	}
+	e.ExecuteWithOptions("export SHELLE_JOB_VAR=1", "sh", executor.ExecOptions{NoSession: true})
+	if r := e.Execute(`echo "[$SHELLE_JOB_VAR]"`, "sh"); r.Output != "[]" {
+		t.Errorf("Expected a job's export to stay in its shell, got %q", r.Output)
+	}
+
+	// Several changes in one chain, and separators inside quotes are not split
+	r = e.Execute("cd a && cd .. && cd b && echo 'x && y'", "sh")
+	if r.Output != "x && y" || e.WorkingDir != filepath.Join(root, "b") {
+		t.Errorf("Expected to end in b echoing 'x && y', got %q in %s", r.Output, e.WorkingDir)
+	}
+}
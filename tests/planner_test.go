@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"strings"
 	"testing"
 
 	"shell-e/internal/planner"
@@ -110,3 +111,57 @@ func TestParseResponse_UnsafeCommand(t *testing.T) {
 		t.Error("Expected safe=false")
 	}
 }
+
+func TestPlan_ShellFamilyNormalized(t *testing.T) {
+	mock := &MockLLM{Running: true, Response: `{"command": "ls -la", "shell": "powershell", "response": "Listing", "safe": true}`}
+	p := planner.NewPlanner(mock, nil, "bash")
+
+	plan, err := p.Plan("list files")
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if plan.Shell != "bash" {
+		t.Errorf("Expected powershell plan to be mapped to configured bash, got: %s", plan.Shell)
+	}
+
+	mock.Response = `{"command": "echo hi", "shell": "cmd", "response": "Echo", "safe": true}`
+	p = planner.NewPlanner(mock, nil, "powershell")
+	plan, _ = p.Plan("say hi")
+	if plan.Shell != "cmd" {
+		t.Errorf("Expected cmd to be kept on a Windows profile, got: %s", plan.Shell)
+	}
+
+	// Any registered shell is known, but only kept on its own platform
+	mock.Response = `{"command": "echo hi", "shell": "fish", "response": "Echo", "safe": true}`
+	p = planner.NewPlanner(mock, nil, "fish")
+	if plan, _ = p.Plan("say hi"); plan.Shell != "fish" {
+		t.Errorf("Expected fish to be kept on a fish profile, got: %s", plan.Shell)
+	}
+	p = planner.NewPlanner(mock, nil, "powershell")
+	if plan, _ = p.Plan("say hi"); plan.Shell != "powershell" {
+		t.Errorf("Expected fish to be mapped to configured powershell, got: %s", plan.Shell)
+	}
+}
+
+func TestSystemPromptFor(t *testing.T) {
+	if planner.SystemPromptFor("zsh") != planner.BashSystemPrompt {
+		t.Error("Expected bash prompt for zsh")
+	}
+	if planner.SystemPromptFor("powershell") != planner.SystemPrompt {
+		t.Error("Expected PowerShell prompt for powershell")
+	}
+}
+
+func TestSystemPrompts_DescribeStdinOnce(t *testing.T) {
+	for name, tt := range map[string]struct{ prompt, reads string }{
+		"powershell": {planner.SystemPrompt, "$input"},
+		"bash":       {planner.BashSystemPrompt, `"sort -u"`},
+	} {
+		if n := strings.Count(tt.prompt, "\n- stdin:"); n != 1 {
+			t.Errorf("%s: expected one stdin entry, got %d", name, n)
+		}
+		if !strings.Contains(tt.prompt, tt.reads) {
+			t.Errorf("%s: expected stdin to be read as %s", name, tt.reads)
+		}
+	}
+}
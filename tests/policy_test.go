@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"shell-e/internal/safety"
+)
+
+// writePolicy writes a policy file to path, creating its directory
+func writePolicy(t *testing.T, path, yaml string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPolicy_DefaultPolicy(t *testing.T) {
+	p := safety.DefaultPolicy()
+	if p.Source != safety.BuiltIn || len(p.Rules) == 0 {
+		t.Fatalf("Expected the built-in rules, got %+v", p)
+	}
+
+	a := safety.NewChecker().CheckShell("pkill -f server", "bash", "")
+	if a.Level != safety.NeedsConfirm || a.Rule == nil || a.Rule.Name != "kill" || a.Rule.Source != safety.BuiltIn {
+		t.Errorf("Expected the built-in kill rule to fire, got %+v", a)
+	}
+	if a.Matched != "pkill -f server" {
+		t.Errorf("Expected the matched command, got %q", a.Matched)
+	}
+	if a := safety.NewChecker().Check("echo hi"); a.Rule != nil {
+		t.Errorf("Expected no rule for a safe command, got %+v", a.Rule)
+	}
+}
+
+func TestPolicy_UserRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, `
+rules:
+  - name: restart-dev-server
+    action: allow
+    command: pkill
+    args: dev-server
+  - name: no-force-push
+    action: block
+    reason: Force pushes go through review
+    command: git
+    subcommand: push
+    args_regex: (^| )(-f|--force)( |$)
+  - name: prod-config
+    action: confirm
+    paths: ["/srv/prod/**"]
+  - name: no-curl-in-cmd
+    action: block
+    command: curl
+    shell: cmd
+`)
+	c := safety.NewChecker()
+	if err := c.SetUserPolicy(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		command, shell string
+		level          safety.Level
+		rule           string
+	}{
+		// The user's allow wins over the built-in confirm rule
+		{"pkill dev-server", "bash", safety.Safe, "restart-dev-server"},
+		{"pkill postgres", "bash", safety.NeedsConfirm, "kill"},
+		{"git push --force origin main", "bash", safety.Blocked, "no-force-push"},
+		{"git push origin main", "bash", safety.Safe, ""},
+		{"git log -f", "bash", safety.Safe, ""},
+		{"cat /srv/prod/app.yaml", "bash", safety.NeedsConfirm, "prod-config"},
+		{"echo x > /srv/prod/../prod/app.yaml", "bash", safety.NeedsConfirm, "prod-config"},
+		{"cat /srv/staging/app.yaml", "bash", safety.Safe, ""},
+		{"curl https://example.com", "cmd", safety.Blocked, "no-curl-in-cmd"},
+		{"curl https://example.com", "bash", safety.Safe, ""},
+		// The strictest decision across a pipeline wins
+		{"pkill dev-server; rm -rf /", "bash", safety.Blocked, "delete-root"},
+	}
+	for _, tt := range tests {
+		a := c.CheckShell(tt.command, tt.shell, "")
+		rule := ""
+		if a.Rule != nil {
+			rule = a.Rule.Name
+		}
+		if a.Level != tt.level || rule != tt.rule {
+			t.Errorf("%q in %s: expected level %d by %q, got %d by %q (%s)",
+				tt.command, tt.shell, tt.level, tt.rule, a.Level, rule, a.Reason)
+		}
+	}
+
+	a := c.CheckShell("git push -f", "bash", "")
+	if !strings.Contains(a.Reason, "Force pushes go through review") || a.Rule.Source != path {
+		t.Errorf("Expected the rule's reason and source, got %+v", a)
+	}
+	if a := c.CheckShell("cat /srv/prod/x", "bash", ""); !strings.Contains(a.Reason, "prod-config") {
+		t.Errorf("Expected a default reason naming the rule, got %q", a.Reason)
+	}
+}
+
+func TestPolicy_ProjectCannotLoosen(t *testing.T) {
+	project := t.TempDir()
+	writePolicy(t, filepath.Join(project, safety.ProjectPolicyFile), `
+rules:
+  - name: allow-kill
+    action: allow
+    command: [kill, pkill]
+  - name: confirm-make-deploy
+    action: confirm
+    reason: Deploys from this repo go to production
+    command: make
+    subcommand: deploy
+`)
+	workDir := filepath.Join(project, "src", "app")
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	c := safety.NewChecker()
+
+	if a := c.CheckShell("pkill node", "bash", workDir); a.Level != safety.NeedsConfirm || a.Rule.Source != safety.BuiltIn {
+		t.Errorf("Expected a project allow not to override the built-in policy, got %+v", a)
+	}
+	a := c.CheckShell("make deploy", "bash", workDir)
+	if a.Level != safety.NeedsConfirm || !strings.Contains(a.Reason, "Deploys from this repo") {
+		t.Errorf("Expected the project rule to ask for confirmation, got %+v", a)
+	}
+	if a := c.CheckShell("make deploy", "bash", t.TempDir()); a.Level != safety.Safe {
+		t.Errorf("Expected the project policy to apply only inside the project, got %+v", a)
+	}
+
+	// The user's own policy may loosen what the project may not
+	user := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, user, "rules:\n  - {name: kill-ok, action: allow, command: pkill}\n")
+	if err := c.SetUserPolicy(user); err != nil {
+		t.Fatal(err)
+	}
+	if a := c.CheckShell("pkill node", "bash", workDir); a.Level != safety.Safe || a.Rule.Name != "kill-ok" {
+		t.Errorf("Expected the user's allow to win, got %+v", a)
+	}
+
+	statuses := c.Policies(workDir)
+	if len(statuses) != 3 || statuses[0].Kind != "user" || statuses[1].Kind != "project" || statuses[2].Kind != safety.BuiltIn {
+		t.Errorf("Expected user, project and built-in policies, got %+v", statuses)
+	}
+}
+
+func TestPolicy_InvalidPolicy(t *testing.T) {
+	for _, bad := range []string{
+		"rules:\n  - {name: x, action: maybe, command: ls}\n",
+		"rules:\n  - {name: x, action: block}\n",
+		"rules:\n  - {name: x, action: block, args_regex: '('}\n",
+		"rules:\n  - {name: x, action: block, command: ls, shell: fish}\n",
+		"rules:\n  - {name: x, action: block, comand: ls}\n",
+	} {
+		if _, err := safety.ParsePolicy([]byte(bad), "test.yaml"); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, "rules:\n  - {name: x, action: maybe, command: ls}\n")
+	c := safety.NewChecker()
+	if err := c.SetUserPolicy(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("Expected an error naming the file, got %v", err)
+	}
+
+	// Broken later on, every command needs confirmation until it is fixed
+	if a := c.Check("echo hi"); a.Level != safety.NeedsConfirm || !strings.Contains(a.Reason, "Policy not applied") {
+		t.Errorf("Expected a broken policy to require confirmation, got %+v", a)
+	}
+	writePolicy(t, path, "rules:\n  - {name: x, action: block, command: ls}\n")
+	os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if a := c.Check("echo hi"); a.Level != safety.Safe {
+		t.Errorf("Expected the fixed policy to be reloaded, got %+v", a)
+	}
+	if a := c.Check("ls"); a.Level != safety.Blocked {
+		t.Errorf("Expected the fixed policy's rule to apply, got %+v", a)
+	}
+
+	// A missing file is no policy
+	if err := c.SetUserPolicy(filepath.Join(t.TempDir(), "none.yaml")); err != nil {
+		t.Errorf("Expected a missing policy file to be fine, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+//go:build !windows
+
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"shell-e/internal/executor"
+)
+
+// waitGone polls until pid no longer exists (it may linger briefly as a
+// zombie until reaped)
+func waitGone(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if syscall.Kill(pid, 0) != nil {
+			return true
+		}
+		if data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat"); err == nil &&
+			strings.Contains(string(data), ") Z ") {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
+
+func TestExecute_TimeoutKillsProcessTree(t *testing.T) {
+	requireShell(t, "bash")
+	tmpDir := t.TempDir()
+	pidFile := filepath.Join(tmpDir, "child.pid")
+
+	e := executor.NewExecutor(tmpDir)
+	e.Timeout = 500 * time.Millisecond
+
+	start := time.Now()
+	result := e.Execute("sleep 30 & echo $! > child.pid; wait", "bash")
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Execute took %v — timeout did not stop the command", time.Since(start))
+	}
+
+	if result.Success || !strings.Contains(result.Error, "timed out") {
+		t.Fatalf("Expected timeout, got success=%v error=%q", result.Success, result.Error)
+	}
+	if len(result.Killed) < 2 {
+		t.Errorf("Expected shell and sleep in Killed, got %+v", result.Killed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("Could not read grandchild pid: %v", err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	if !waitGone(pid, 3*time.Second) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("Grandchild %d survived the timeout", pid)
+	}
+}
+
+func TestExecute_CancelViaContext(t *testing.T) {
+	requireShell(t, "bash")
+	e := executor.NewExecutor(t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(300*time.Millisecond, cancel)
+
+	result := e.ExecuteWithOptions("echo started; sleep 30", "bash", executor.ExecOptions{Context: ctx})
+	if result.Error != "Command cancelled" {
+		t.Errorf("Expected 'Command cancelled', got %q", result.Error)
+	}
+	if !strings.Contains(result.Output, "started") {
+		t.Errorf("Expected partial output to be kept, got %q", result.Output)
+	}
+}
+
+func TestExecute_BackgroundChildDoesNotHoldPipes(t *testing.T) {
+	requireShell(t, "bash")
+	e := executor.NewExecutor(t.TempDir())
+
+	start := time.Now()
+	result := e.Execute("sleep 20 & echo done", "bash")
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("Execute blocked %v on pipes held by a background child", time.Since(start))
+	}
+	if !result.Success || result.Output != "done" {
+		t.Errorf("Expected success with 'done', got %+v", result)
+	}
+}
+
+func TestExecute_ReportsSignalAndTimeout(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+
+	r := e.Execute("kill -KILL $$", "sh")
+	if r.Signal != "killed" || r.ExitCode != -1 {
+		t.Errorf("Expected signal 'killed' and exit -1, got %q / %d", r.Signal, r.ExitCode)
+	}
+	if r.TimedOut || r.Cancelled {
+		t.Errorf("A signal is neither a timeout nor a cancel: %+v", r)
+	}
+
+	e.Timeout = 200 * time.Millisecond
+	r = e.Execute("sleep 5", "sh")
+	if !r.TimedOut || r.Cancelled || r.Signal == "" {
+		t.Errorf("Expected a timeout ended by a signal, got timed out %v, cancelled %v, signal %q",
+			r.TimedOut, r.Cancelled, r.Signal)
+	}
+
+	e.Timeout = 10 * time.Second
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	r = e.ExecuteWithOptions("sleep 5", "sh", executor.ExecOptions{Context: ctx})
+	if !r.Cancelled || r.TimedOut {
+		t.Errorf("Expected a cancel, got timed out %v, cancelled %v", r.TimedOut, r.Cancelled)
+	}
+}
+
+func TestExecute_ReportsResourceUsage(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+
+	// Busy-loop in the shell so there is CPU time to measure
+	r := e.Execute("i=0; while [ $i -lt 200000 ]; do i=$((i+1)); done", "sh")
+	if !r.Success {
+		t.Fatalf("Expected success, got %s", r.Error)
+	}
+	if r.CPUTime <= 0 {
+		t.Errorf("Expected CPU time, got %v", r.CPUTime)
+	}
+	if r.PeakMemory < 100*1024 {
+		t.Errorf("Expected a plausible peak memory, got %d bytes", r.PeakMemory)
+	}
+}
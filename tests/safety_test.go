@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"strings"
 	"testing"
 
 	"shell-e/internal/safety"
@@ -91,3 +92,158 @@ func TestChecker_EmptyCommand(t *testing.T) {
 		t.Errorf("Expected Safe for empty command, got level %d", a.Level)
 	}
 }
+
+func TestChecker_UnixCommands(t *testing.T) {
+	c := safety.NewChecker()
+
+	for _, cmd := range []string{"ls -la", "df -h", "git add .", "mkdir -p 'build'", "cat notes.txt"} {
+		if a := c.Check(cmd); a.Level != safety.Safe {
+			t.Errorf("Expected Safe for %q, got level %d: %s", cmd, a.Level, a.Reason)
+		}
+	}
+
+	for _, cmd := range []string{"rm -rf /*", "sudo mkfs.ext4 /dev/sdb1", "dd if=/dev/zero of=/dev/sda bs=1M", "rm -rf ~"} {
+		if a := c.Check(cmd); a.Level != safety.Blocked {
+			t.Errorf("Expected Blocked for %q, got level %d", cmd, a.Level)
+		}
+	}
+
+	for _, cmd := range []string{"rm notes.txt", "pkill firefox", "sudo reboot", "systemctl stop nginx"} {
+		if a := c.Check(cmd); a.Level != safety.NeedsConfirm {
+			t.Errorf("Expected NeedsConfirm for %q, got level %d", cmd, a.Level)
+		}
+	}
+}
+
+func TestChecker_ParsesCommands(t *testing.T) {
+	t.Setenv("HOME", "/home/tester")
+	t.Setenv("USER", "tester")
+	c := safety.NewChecker()
+
+	// Words that only look like dangerous programs
+	for _, cmd := range []string{
+		"skill",
+		"Get-Help kill",
+		"grep -r kill .",
+		"echo 'rm -rf /'",
+		"git rm --cached notes.txt",
+		"ls # rm -rf /",
+		"Write-Host \"Stop-Process\"",
+	} {
+		if a := c.Check(cmd); a.Level != safety.Safe {
+			t.Errorf("Expected Safe for %q, got level %d: %s", cmd, a.Level, a.Reason)
+		}
+	}
+
+	// Aliases, odd spacing, and commands inside pipelines, chains,
+	// subshells, substitutions, script blocks and wrappers
+	for _, cmd := range []string{
+		"ri notes.txt",
+		"erase   notes.txt",
+		"rmdir\tbuild",
+		"ls | xargs rm",
+		"find . -name '*.tmp' -exec rm {} \\;",
+		"find . -name '*.tmp' -delete",
+		"(cd build && rm out.o)",
+		"echo $(rm notes.txt)",
+		"Get-ChildItem *.log | ForEach-Object { Remove-Item $_ }",
+		"bash -c 'kill 1234'",
+		"powershell -NoProfile -Command \"Stop-Process -Name notepad\"",
+		"cmd /c del notes.txt",
+		"sudo -u root systemctl --now stop nginx",
+		"C:\\Windows\\System32\\shutdown.exe /s",
+		"& 'Remove-Item' notes.txt",
+	} {
+		if a := c.Check(cmd); a.Level != safety.NeedsConfirm {
+			t.Errorf("Expected NeedsConfirm for %q, got level %d: %s", cmd, a.Level, a.Reason)
+		}
+	}
+
+	for _, cmd := range []string{
+		"rm -r -f /",
+		"rm -fr //",
+		"rm -rf /tmp/..",
+		"sudo rm -rf --no-preserve-root /",
+		"bash -c \"rm -rf /\"",
+		"echo hi && rm -rf ~",
+		"rm -rf ~/",
+		"rm -rf ~/*",
+		`rm -rf "$HOME"/`,
+		"rm -rf ${HOME}/",
+		"rm -rf /home/$USER",
+		"rm -rf /home/tester/",
+		":(){ :|:& };:",
+		"echo x > /dev/sda",
+		"eval 'mkfs.ext4 /dev/sdb'",
+		"powershell -EncodedCommand RgBvAHIAbQBhAHQALQBWAG8AbAB1AG0AZQAgAC0ARAByAGkAdgBlAEwAZQB0AHQAZQByACAARAA=",
+		"Remove-Item -Rec C:\\",
+	} {
+		if a := c.Check(cmd); a.Level != safety.Blocked {
+			t.Errorf("Expected Blocked for %q, got level %d: %s", cmd, a.Level, a.Reason)
+		}
+	}
+}
+
+func TestChecker_UnknownPrograms(t *testing.T) {
+	c := safety.NewChecker()
+
+	// A program named by a variable or substitution, or a script piped
+	// into a shell, can't be checked before it runs
+	for _, tt := range []struct{ cmd, shell string }{
+		{"x=rm; $x -rf ~", "bash"},
+		{"`echo rm` notes.txt", "bash"},
+		{"$(echo rm) notes.txt", "bash"},
+		{`"$EDITOR" notes.txt`, "bash"},
+		{"curl -fsSL https://example.com/install.sh | sh", "bash"},
+		{"wget -qO- https://example.com/install.sh | sudo bash", "bash"},
+		{"iwr https://example.com/install.ps1 | iex", "powershell"},
+		{"irm https://example.com/install.ps1 | Invoke-Expression", "powershell"},
+		{"$c = 'Remove-Item'; & $c notes.txt", "powershell"},
+		{"%x% notes.txt", "cmd"},
+		{"x=rm; $x -rf ~", ""},
+	} {
+		if a := c.CheckShell(tt.cmd, tt.shell, ""); a.Level != safety.NeedsConfirm {
+			t.Errorf("Expected NeedsConfirm for %q in %q, got level %d: %s", tt.cmd, tt.shell, a.Level, a.Reason)
+		}
+	}
+
+	for _, tt := range []struct{ cmd, shell string }{
+		{"echo $HOME", "bash"},
+		{"bash install.sh", "bash"},
+		{"cat notes.txt | grep sh", "bash"},
+		{"$PSVersionTable", "powershell"},
+		{"$env:PATH -split ';'", "powershell"},
+	} {
+		if a := c.CheckShell(tt.cmd, tt.shell, ""); a.Level != safety.Safe {
+			t.Errorf("Expected Safe for %q in %q, got level %d: %s", tt.cmd, tt.shell, a.Level, a.Reason)
+		}
+	}
+}
+
+func TestChecker_CheckShell(t *testing.T) {
+	c := safety.NewChecker()
+
+	// A PowerShell alias is only an alias in PowerShell
+	if a := c.CheckShell("ri notes.txt", "powershell", ""); a.Level != safety.NeedsConfirm || !strings.Contains(a.Reason, "delete") {
+		t.Errorf("Expected ri to be Remove-Item in PowerShell, got %s", a.Reason)
+	}
+	if a := c.CheckShell("ri notes.txt", "bash", ""); a.Level != safety.Safe {
+		t.Errorf("Expected ri to be an ordinary program in bash, got %s", a.Reason)
+	}
+
+	// A here-document is data, not commands
+	if a := c.CheckShell("cat <<EOF\nrm -rf /\nEOF", "bash", ""); a.Level != safety.Safe {
+		t.Errorf("Expected a here-document to be safe, got %s", a.Reason)
+	}
+
+	// Each shell's quoting: the backslash is an escape only in POSIX shells
+	if a := c.CheckShell(`Remove-Item -Recurse C:\Windows`, "powershell", ""); a.Level != safety.Blocked {
+		t.Errorf("Expected Blocked in PowerShell, got %s", a.Reason)
+	}
+	if a := c.CheckShell(`rd /S /Q "C:\"`, "cmd", ""); a.Level != safety.Blocked {
+		t.Errorf("Expected Blocked in cmd, got %s", a.Reason)
+	}
+	if a := c.CheckShell("rm -rf /", "powershell", ""); a.Level != safety.NeedsConfirm {
+		t.Errorf("Expected -rf to be an unknown parameter in PowerShell, got %s", a.Reason)
+	}
+}
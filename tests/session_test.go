@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"shell-e/internal/executor"
+)
+
+func newSessionExecutor(t *testing.T) (*executor.Executor, string) {
+	t.Helper()
+	requireShell(t, "bash")
+	dir, _ := filepath.EvalSymlinks(t.TempDir())
+	e := executor.NewExecutor(dir)
+	e.Persistent = true
+	t.Cleanup(e.Close)
+	return e, dir
+}
+
+func TestSession_StatePersists(t *testing.T) {
+	e, _ := newSessionExecutor(t)
+
+	steps := []string{
+		"export SHELLE_TEST=persisted",
+		"greet() { echo \"hi $1\"; }",
+		"alias ll='echo aliased'",
+	}
+	for _, cmd := range steps {
+		if r := e.Execute(cmd, "bash"); !r.Success {
+			t.Fatalf("%q failed: %s", cmd, r.Error)
+		}
+	}
+
+	r := e.Execute("echo $SHELLE_TEST; greet there; ll", "bash")
+	if !r.Success {
+		t.Fatalf("Expected success, got error: %s", r.Error)
+	}
+	want := "persisted\nhi there\naliased"
+	if r.Output != want {
+		t.Errorf("Expected %q, got %q", want, r.Output)
+	}
+}
+
+func TestSession_ReportsRealCwd(t *testing.T) {
+	e, dir := newSessionExecutor(t)
+	os.Mkdir(filepath.Join(dir, "sub dir"), 0755)
+
+	r := e.Execute("cd 'sub dir' && echo moved", "bash")
+	if !r.Success || r.Output != "moved" {
+		t.Fatalf("Expected 'moved', got %q (err: %s)", r.Output, r.Error)
+	}
+	want := filepath.Join(dir, "sub dir")
+	if r.CurrentWorkDir != want || e.WorkingDir != want {
+		t.Errorf("Expected cwd %q, got result %q / executor %q", want, r.CurrentWorkDir, e.WorkingDir)
+	}
+
+	// Executor-side directory changes are pushed into the session
+	e.SetWorkingDir(dir)
+	r = e.Execute("pwd", "bash")
+	if r.Output != dir {
+		t.Errorf("Expected session to follow SetWorkingDir to %q, got %q", dir, r.Output)
+	}
+}
+
+func TestSession_DoesNotRunWhereItCannotChangeTo(t *testing.T) {
+	e, dir := newSessionExecutor(t)
+	if r := e.Execute("pwd", "bash"); !r.Success {
+		t.Fatalf("Expected the session to start, got %+v", r)
+	}
+	notDir := filepath.Join(dir, "not-a-dir")
+	os.WriteFile(notDir, nil, 0644)
+
+	e.SetWorkingDir(notDir)
+	r := e.Execute("touch ran.txt", "bash")
+	if r.Success || !strings.Contains(r.Output, "command not run") {
+		t.Errorf("Expected the command to be refused, got %+v", r)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran.txt")); err == nil {
+		t.Error("Expected the command not to run in the session's old directory")
+	}
+}
+
+func TestSession_ExitCodesAndOutput(t *testing.T) {
+	e, _ := newSessionExecutor(t)
+
+	r := e.Execute("echo out; echo err >&2; false", "bash")
+	if r.Success {
+		t.Error("Expected failure for `false`")
+	}
+	if r.Output != "out\nerr" {
+		t.Errorf("Expected merged output, got %q", r.Output)
+	}
+
+	r = e.Execute("echo apple | grep orange", "bash")
+	if r.Error != "No matches found" {
+		t.Errorf("Expected 'No matches found', got %q", r.Error)
+	}
+
+	// A syntax error fails only that command
+	r = e.Execute("if then fi", "bash")
+	if r.Success {
+		t.Error("Expected syntax error to fail")
+	}
+	if r = e.Execute("printf 'no newline'", "bash"); r.Output != "no newline" {
+		t.Errorf("Expected session to survive syntax error, got %q (err: %s)", r.Output, r.Error)
+	}
+}
+
+func TestSession_RespawnsAfterExit(t *testing.T) {
+	e, _ := newSessionExecutor(t)
+
+	// A plain shell variable lives only in the session; exported ones are
+	// kept in the executor's env overlay and reappear after a respawn
+	e.Execute("declare GONE=1", "bash")
+	r := e.Execute("exit 0", "bash")
+	if r.Success {
+		t.Error("Expected exit to be reported as the session ending")
+	}
+
+	r = e.Execute("echo \"alive ${GONE:-fresh}\"", "bash")
+	if !r.Success || r.Output != "alive fresh" {
+		t.Errorf("Expected respawned session, got %q (err: %s)", r.Output, r.Error)
+	}
+}
+
+func TestSession_TimeoutRestartsSession(t *testing.T) {
+	e, _ := newSessionExecutor(t)
+	e.Timeout = 300 * time.Millisecond
+
+	r := e.Execute("sleep 10", "bash")
+	if !strings.Contains(r.Error, "timed out") {
+		t.Fatalf("Expected timeout, got %q", r.Error)
+	}
+
+	e.Timeout = 5 * time.Second
+	r = e.Execute("echo back", "bash")
+	if !r.Success || r.Output != "back" {
+		t.Errorf("Expected session to restart after timeout, got %q (err: %s)", r.Output, r.Error)
+	}
+}
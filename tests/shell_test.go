@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"shell-e/internal/executor"
+)
+
+func TestShellRegistry_BuiltinShells(t *testing.T) {
+	for _, name := range []string{"powershell", "pwsh", "cmd", "bash", "zsh", "sh", "fish"} {
+		if _, ok := executor.LookupShell(name); !ok {
+			t.Errorf("Expected shell %q to be registered", name)
+		}
+	}
+
+	sh, ok := executor.LookupShell("PWSH")
+	if !ok || sh.Name() != "powershell" {
+		t.Errorf("Expected pwsh alias to resolve to powershell, got %v", sh)
+	}
+
+	// ps is the process lister, not a shell
+	if _, ok := executor.LookupShell("ps"); ok {
+		t.Error("Expected ps not to name a shell")
+	}
+}
+
+func TestShell_Quote(t *testing.T) {
+	tests := []struct {
+		shell string
+		arg   string
+		want  string
+	}{
+		{"powershell", "it's", "'it''s'"},
+		{"bash", "it's", `'it'\''s'`},
+		{"cmd", `say "hi"`, `"say ""hi"""`},
+		{"fish", `it's \n`, `'it\'s \\n'`},
+	}
+
+	for _, tt := range tests {
+		sh, _ := executor.LookupShell(tt.shell)
+		if got := sh.Quote(tt.arg); got != tt.want {
+			t.Errorf("%s.Quote(%q) = %q, want %q", tt.shell, tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestShell_QuoteRoundTrip(t *testing.T) {
+	requireShell(t, "bash")
+	sh, _ := executor.LookupShell("bash")
+
+	arg := `it's a "test" $HOME`
+	e := executor.NewExecutor(os.TempDir())
+	result := e.Execute("printf '%s' "+sh.Quote(arg), "bash")
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s", result.Error)
+	}
+	if result.Output != arg {
+		t.Errorf("Expected %q, got %q", arg, result.Output)
+	}
+}
+
+func TestShell_ParseCD(t *testing.T) {
+	tests := []struct {
+		shell   string
+		command string
+		target  string
+		ok      bool
+	}{
+		{"powershell", "Set-Location -Path 'My Folder'", "My Folder", true},
+		{"powershell", "sl ..", "..", true},
+		{"cmd", `cd /d "D:\work"`, `D:\work`, true},
+		{"bash", "cd 'src'", "src", true},
+		{"bash", "Set-Location src", "", false},
+		{"fish", "cd build", "build", true},
+		{"bash", "echo cd", "", false},
+		{"bash", "cd", "~", true},
+		{"bash", "cd -", "-", true},
+		{"powershell", "Set-Location", "~", true},
+		{"cmd", "cd", "", false}, // Prints the current directory
+	}
+
+	for _, tt := range tests {
+		sh, _ := executor.LookupShell(tt.shell)
+		target, ok := sh.ParseCD(tt.command)
+		if ok != tt.ok || target != tt.target {
+			t.Errorf("%s.ParseCD(%q) = (%q, %v), want (%q, %v)",
+				tt.shell, tt.command, target, ok, tt.target, tt.ok)
+		}
+	}
+}
+
+func TestShell_ParseDirStack(t *testing.T) {
+	tests := []struct {
+		shell   string
+		command string
+		want    executor.DirStackOp
+		ok      bool
+	}{
+		{"bash", "pushd src", executor.DirStackOp{Target: "src"}, true},
+		{"bash", "popd", executor.DirStackOp{Pop: true}, true},
+		{"powershell", "Push-Location -Path 'My Folder'", executor.DirStackOp{Target: "My Folder"}, true},
+		{"powershell", "Pop-Location", executor.DirStackOp{Pop: true}, true},
+		{"cmd", `pushd "D:\work"`, executor.DirStackOp{Target: `D:\work`}, true},
+		{"cmd", "pushd", executor.DirStackOp{}, false}, // Lists the stack
+		{"fish", "popd", executor.DirStackOp{Pop: true}, true},
+		{"bash", "echo popd", executor.DirStackOp{}, false},
+	}
+
+	for _, tt := range tests {
+		sh, _ := executor.LookupShell(tt.shell)
+		got, ok := sh.ParseDirStack(tt.command)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%s.ParseDirStack(%q) = (%+v, %v), want (%+v, %v)",
+				tt.shell, tt.command, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestShell_ClassifyExit(t *testing.T) {
+	bash, _ := executor.LookupShell("bash")
+	if bash.ClassifyExit("ls | grep foo", 1) != executor.ExitNoMatch {
+		t.Error("Expected grep exit 1 to be ExitNoMatch")
+	}
+	if bash.ClassifyExit("nope", 127) != executor.ExitCommandNotFound {
+		t.Error("Expected exit 127 to be ExitCommandNotFound")
+	}
+
+	cmd, _ := executor.LookupShell("cmd")
+	if cmd.ClassifyExit("nope", 9009) != executor.ExitCommandNotFound {
+		t.Error("Expected cmd exit 9009 to be ExitCommandNotFound")
+	}
+}
+
+// customShell wraps sh to verify Execute picks up newly registered shells
+type customShell struct{ executor.Shell }
+
+func (customShell) Name() string { return "custom-test-shell" }
+
+func TestShellRegistry_CustomShell(t *testing.T) {
+	requireShell(t, "sh")
+	base, _ := executor.LookupShell("sh")
+	executor.RegisterShell(customShell{base})
+
+	tmpDir := t.TempDir()
+	os.Mkdir(filepath.Join(tmpDir, "sub"), 0755)
+
+	e := executor.NewExecutor(tmpDir)
+	result := e.Execute("echo custom", "custom-test-shell")
+	if !result.Success || result.Output != "custom" {
+		t.Fatalf("Expected 'custom', got %q (err: %s)", result.Output, result.Error)
+	}
+
+	result = e.Execute("cd sub", "custom-test-shell")
+	if !result.Success || e.WorkingDir != filepath.Join(tmpDir, "sub") {
+		t.Errorf("Expected cd via custom shell, got dir %s (err: %s)", e.WorkingDir, result.Error)
+	}
+}
+
+func TestExecute_Bash_CommandNotFound(t *testing.T) {
+	requireShell(t, "bash")
+	e := executor.NewExecutor(os.TempDir())
+	result := e.Execute("nonexistent_command_12345", "bash")
+	if result.Success {
+		t.Error("Expected failure for invalid command")
+	}
+	if result.Error == "" {
+		t.Error("Expected an error message")
+	}
+}
@@ -0,0 +1,276 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"shell-e/internal/executor"
+)
+
+// sshServer is an in-process SSH server that runs "exec" requests with the
+// local sh, starting in home
+type sshServer struct {
+	addr       string
+	home       string
+	hostKey    ssh.PublicKey
+	keyFile    string // Private key the server accepts
+	knownHosts string // known_hosts listing the server's key
+}
+
+func startSSHServer(t *testing.T) *sshServer {
+	t.Helper()
+	requireShell(t, "sh")
+	dir := t.TempDir()
+
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPub, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "id_ed25519")
+	os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600)
+	authorized, _ := ssh.NewPublicKey(clientPub)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	home := filepath.Join(dir, "home")
+	os.Mkdir(home, 0755)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config, home)
+		}
+	}()
+
+	s := &sshServer{
+		addr:       ln.Addr().String(),
+		home:       home,
+		hostKey:    hostSigner.PublicKey(),
+		keyFile:    keyFile,
+		knownHosts: filepath.Join(dir, "known_hosts"),
+	}
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.addr)}, s.hostKey)
+	os.WriteFile(s.knownHosts, []byte(line+"\n"), 0600)
+	return s
+}
+
+func (s *sshServer) config() executor.SSHConfig {
+	return executor.SSHConfig{
+		Name:       "test",
+		Host:       s.addr,
+		User:       "tester",
+		KeyFile:    s.keyFile,
+		KnownHosts: s.knownHosts,
+	}
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig, home string) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go serveSession(ch, requests, home)
+	}
+}
+
+func serveSession(ch ssh.Channel, requests <-chan *ssh.Request, home string) {
+	defer ch.Close()
+	var cmd *exec.Cmd
+	done := make(chan struct{})
+	for {
+		select {
+		case req, ok := <-requests:
+			if !ok {
+				if cmd != nil && cmd.Process != nil {
+					cmd.Process.Kill()
+				}
+				return
+			}
+			switch req.Type {
+			case "exec":
+				if cmd != nil {
+					req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				ssh.Unmarshal(req.Payload, &payload)
+				cmd = exec.Command("sh", "-c", payload.Command)
+				cmd.Dir = home
+				cmd.Stdin = ch
+				cmd.Stdout = ch
+				cmd.Stderr = ch.Stderr()
+				if err := cmd.Start(); err != nil {
+					req.Reply(false, nil)
+					return
+				}
+				req.Reply(true, nil)
+				go func() {
+					status := make([]byte, 4)
+					if err := cmd.Wait(); err != nil {
+						var exitErr *exec.ExitError
+						if errors.As(err, &exitErr) {
+							binary.BigEndian.PutUint32(status, uint32(exitErr.ExitCode()))
+						}
+					}
+					ch.SendRequest("exit-status", false, status)
+					close(done)
+				}()
+			case "signal":
+				if cmd != nil && cmd.Process != nil {
+					cmd.Process.Kill()
+				}
+			default:
+				req.Reply(false, nil)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func TestSSH_RunsCommandsRemotely(t *testing.T) {
+	srv := startSSHServer(t)
+	target, err := executor.DialSSH(srv.config())
+	if err != nil {
+		t.Fatalf("DialSSH failed: %v", err)
+	}
+	if target.OS() == "" || (target.Shell() != "bash" && target.Shell() != "sh") {
+		t.Errorf("Expected the probe to find the OS and shell, got %q, %q", target.OS(), target.Shell())
+	}
+	if target.Dir() != srv.home {
+		t.Errorf("Expected the login directory %s, got %s", srv.home, target.Dir())
+	}
+
+	e := executor.NewExecutor(t.TempDir())
+	defer e.Close()
+	e.UseTarget(target)
+	e.SetTargetDir(target.Name(), target.Dir())
+
+	var streamed []string
+	r := e.ExecuteWithOptions("echo one; echo two", "", executor.ExecOptions{
+		OnOutput: func(l executor.OutputLine) { streamed = append(streamed, l.Text) },
+	})
+	if !r.Success || r.Output != "one\ntwo" || r.Target != "test" {
+		t.Fatalf("Expected remote output, got %+v", r)
+	}
+	if strings.Join(streamed, "|") != "one|two" {
+		t.Errorf("Expected only the command's lines streamed, got %q", streamed)
+	}
+
+	// cd carries over to the next command, which runs in a fresh shell
+	os.Mkdir(filepath.Join(srv.home, "project dir"), 0755)
+	if r := e.Execute("cd 'project dir'", ""); !r.Success || r.NewWorkDir != filepath.Join(srv.home, "project dir") {
+		t.Fatalf("Expected cd to report the remote directory, got %+v", r)
+	}
+	if r := e.Execute("pwd", ""); r.Output != filepath.Join(srv.home, "project dir") {
+		t.Errorf("Expected the next command in the new directory, got %q", r.Output)
+	}
+	if e.WorkingDir == filepath.Join(srv.home, "project dir") {
+		t.Error("Expected the local working directory to be left alone")
+	}
+
+	// A directory removed behind Shell-E's back stops the next command
+	// rather than letting it run in the login directory
+	os.Remove(filepath.Join(srv.home, "project dir"))
+	r = e.Execute("touch ran.txt", "")
+	if r.Success || !strings.Contains(r.Error, "command not run") {
+		t.Errorf("Expected the command to be refused, got %+v", r)
+	}
+	if _, err := os.Stat(filepath.Join(srv.home, "ran.txt")); err == nil {
+		t.Error("Expected the command not to run in the login directory")
+	}
+
+	r = e.Execute("echo out; echo err >&2; exit 3", "")
+	if r.Success || r.ExitCode != 3 || r.Stdout != "out" || r.Stderr != "err" {
+		t.Errorf("Expected exit 3 with separate streams, got %+v", r)
+	}
+
+	// Back on this machine
+	e.UseTarget(nil)
+	if r := e.Execute("pwd", "sh"); r.Target != "" || r.Output != e.WorkingDir {
+		t.Errorf("Expected local execution after leaving the target, got %+v", r)
+	}
+}
+
+func TestSSH_Timeout(t *testing.T) {
+	srv := startSSHServer(t)
+	target, err := executor.DialSSH(srv.config())
+	if err != nil {
+		t.Fatalf("DialSSH failed: %v", err)
+	}
+	e := executor.NewExecutor(t.TempDir())
+	defer e.Close()
+	e.UseTarget(target)
+
+	start := time.Now()
+	r := e.ExecuteWithOptions("sleep 10", "", executor.ExecOptions{Timeout: 300 * time.Millisecond})
+	if !r.TimedOut || r.Success {
+		t.Errorf("Expected a timeout, got %+v", r)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Expected the remote command to be stopped, took %v", time.Since(start))
+	}
+}
+
+func TestSSH_RejectsUnknownHostKey(t *testing.T) {
+	srv := startSSHServer(t)
+	cfg := srv.config()
+
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _ := ssh.NewPublicKey(other)
+	line := knownhosts.Line([]string{knownhosts.Normalize(srv.addr)}, otherKey)
+	os.WriteFile(cfg.KnownHosts, []byte(line+"\n"), 0600)
+	if _, err := executor.DialSSH(cfg); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("Expected a changed host key to be refused, got %v", err)
+	}
+
+	os.WriteFile(cfg.KnownHosts, nil, 0600)
+	if _, err := executor.DialSSH(cfg); err == nil || !strings.Contains(err.Error(), "not in known_hosts") {
+		t.Errorf("Expected an unknown host to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"shell-e/internal/executor"
+	"shell-e/internal/planner"
+	"shell-e/internal/workspace"
+)
+
+func TestExecute_Stdin(t *testing.T) {
+	requireShell(t, "sh")
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("pear\napple\n"), 0644)
+	e := executor.NewExecutor(dir)
+	defer e.Close()
+
+	r := e.ExecuteWithOptions("sort", "sh", executor.ExecOptions{Stdin: &executor.Stdin{Text: "b\nc\na"}})
+	if !r.Success || r.Output != "a\nb\nc" {
+		t.Errorf("Expected text fed to stdin, got %+v", r)
+	}
+
+	// Persistent sessions share one stdin, so a fed command gets its own shell
+	e.Persistent = true
+	r = e.ExecuteWithOptions("sort", "sh", executor.ExecOptions{Stdin: &executor.Stdin{File: "notes.txt"}})
+	if !r.Success || r.Output != "apple\npear" {
+		t.Errorf("Expected the file fed to stdin, got %+v", r)
+	}
+
+	r = e.ExecuteWithOptions("echo ran > ran.txt", "sh", executor.ExecOptions{Stdin: &executor.Stdin{File: "missing.txt"}})
+	if r.Success || !strings.Contains(r.Error, "missing.txt") {
+		t.Errorf("Expected a missing file to fail, got %+v", r)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran.txt")); !os.IsNotExist(err) {
+		t.Error("Expected the command not to run without its stdin")
+	}
+
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	os.WriteFile(outside, []byte("secret"), 0644)
+	e.Roots = workspace.NewRoots([]string{dir})
+	r = e.ExecuteWithOptions("cat", "sh", executor.ExecOptions{Stdin: &executor.Stdin{File: outside}})
+	if r.Success || !strings.Contains(r.Error, "outside the allowed workspace") {
+		t.Errorf("Expected a file outside the workspace to be refused, got %+v", r)
+	}
+}
+
+func TestExecute_StdinAfterPassword(t *testing.T) {
+	fakeSudo(t)
+	e := executor.NewExecutor(t.TempDir())
+	r := e.ExecuteWithOptions("sudo sort", "sh", executor.ExecOptions{
+		Password: "hunter2",
+		Stdin:    &executor.Stdin{Text: "2\n1\n"},
+	})
+	if !r.Success || r.Output != "1\n2" {
+		t.Errorf("Expected sudo to take the password and the command the data, got %+v", r)
+	}
+}
+
+func TestSSH_Stdin(t *testing.T) {
+	srv := startSSHServer(t)
+	target, err := executor.DialSSH(srv.config())
+	if err != nil {
+		t.Fatalf("DialSSH failed: %v", err)
+	}
+	e := executor.NewExecutor(t.TempDir())
+	defer e.Close()
+	e.UseTarget(target)
+
+	r := e.ExecuteWithOptions("wc -l", "", executor.ExecOptions{Stdin: &executor.Stdin{Text: "a\nb\nc\n"}})
+	if !r.Success || strings.TrimSpace(r.Output) != "3" {
+		t.Errorf("Expected stdin to reach the remote command, got %+v", r)
+	}
+}
+
+func TestParseResponse_Stdin(t *testing.T) {
+	p := planner.NewPlanner(nil, nil, "bash")
+	tests := []struct {
+		raw         string
+		wantCommand string
+		wantStdin   string
+	}{
+		{`{"command": "sort -u", "shell": "bash", "stdin": "{{last_output}}"}`, "sort -u", "{{last_output}}"},
+		{`{"command": "{{last_output}} | sort", "shell": "bash"}`, "sort", "{{last_output}}"},
+		{`{"command": "cat {{ last_output }} | grep -i error", "shell": "bash"}`, "grep -i error", "{{last_output}}"},
+		{`{"command": "sort < {{Output: #4}}", "shell": "bash"}`, "sort", "{{output:4}}"},
+		{`{"command": "$input | Sort-Object", "shell": "powershell", "stdin": "{{CLIPBOARD}}"}`, "$input | Sort-Object", "{{clipboard}}"},
+		{`{"command": "wc -l", "shell": "bash", "stdin": "notes.txt"}`, "wc -l", "notes.txt"},
+		{`{"command": null, "response": "hi", "stdin": "{{last_output}}"}`, "", ""},
+	}
+	for _, tt := range tests {
+		plan, err := p.ParseResponse(tt.raw)
+		if err != nil {
+			t.Fatalf("ParseResponse(%s) failed: %v", tt.raw, err)
+		}
+		command := ""
+		if plan.Command != nil {
+			command = *plan.Command
+		}
+		if command != tt.wantCommand || plan.Stdin != tt.wantStdin {
+			t.Errorf("ParseResponse(%s) = %q, stdin %q; want %q, stdin %q", tt.raw, command, plan.Stdin, tt.wantCommand, tt.wantStdin)
+		}
+	}
+
+	if id, ok := planner.StdinOutputID("{{output:12}}"); !ok || id != 12 {
+		t.Errorf("Expected output #12, got %d, %v", id, ok)
+	}
+}
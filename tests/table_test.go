@@ -0,0 +1,255 @@
+package tests
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"shell-e/internal/executor"
+	"shell-e/internal/memory"
+	"shell-e/internal/table"
+)
+
+func TestDetect_JSON(t *testing.T) {
+	// ConvertTo-Json output: key order is kept, nested values stay compact
+	out := `[{"Name":"svchost","Id":812,"WS":10240,"Modules":null},
+	         {"Name":"explorer","Id":4410,"WS":88000,"Parent":{"Id":1}}]`
+	tbl, ok := table.Detect(out)
+	if !ok {
+		t.Fatal("Expected JSON array to be detected")
+	}
+	if tbl.Format != "json" {
+		t.Errorf("Expected json format, got %s", tbl.Format)
+	}
+	wantCols := []string{"Name", "Id", "WS", "Modules", "Parent"}
+	if !reflect.DeepEqual(tbl.Columns, wantCols) {
+		t.Errorf("Expected columns %v, got %v", wantCols, tbl.Columns)
+	}
+	wantRow := []string{"explorer", "4410", "88000", "", `{"Id":1}`}
+	if len(tbl.Rows) != 2 || !reflect.DeepEqual(tbl.Rows[1], wantRow) {
+		t.Errorf("Expected second row %v, got %v", wantRow, tbl.Rows)
+	}
+
+	// A single object is one row; an array of scalars is one column
+	if tbl, ok := table.Detect(`{"Path":"C:/Users","Drive":"C"}`); !ok || len(tbl.Rows) != 1 {
+		t.Errorf("Expected single object as one row, got %v", tbl)
+	}
+	if tbl, ok := table.Detect(`["a","b","c"]`); !ok || tbl.Columns[0] != "Value" || len(tbl.Rows) != 3 {
+		t.Errorf("Expected scalar array as Value column, got %v", tbl)
+	}
+}
+
+func TestDetect_CSV(t *testing.T) {
+	tbl, ok := table.Detect("name,size,modified\nmain.go,1024,2026-01-02\n\"a, b.txt\",7,2026-01-03")
+	if !ok || tbl.Format != "csv" {
+		t.Fatalf("Expected CSV, got %v", tbl)
+	}
+	if len(tbl.Rows) != 2 || tbl.Rows[1][0] != "a, b.txt" {
+		t.Errorf("Expected quoted field to be kept whole, got %v", tbl.Rows)
+	}
+}
+
+func TestDetect_Aligned(t *testing.T) {
+	ps := `    PID TTY          TIME CMD
+      1 ?        00:00:03 init
+    482 pts/0    00:00:00 bash --login
+  12873 pts/0    00:00:00 ps`
+	tbl, ok := table.Detect(ps)
+	if !ok {
+		t.Fatal("Expected ps output to be detected")
+	}
+	if !reflect.DeepEqual(tbl.Columns, []string{"PID", "TTY", "TIME", "CMD"}) {
+		t.Errorf("Unexpected ps columns: %v", tbl.Columns)
+	}
+	if got := tbl.Rows[1][3]; got != "bash --login" {
+		t.Errorf("Expected last column to keep its spaces, got %q", got)
+	}
+
+	df := `Filesystem     1K-blocks     Used Available Use% Mounted on
+/dev/sda1       41152812 22098712  16921816  57% /
+tmpfs            8126436        0   8126436   0% /dev/shm`
+	tbl, ok = table.Detect(df)
+	if !ok {
+		t.Fatal("Expected df output to be detected")
+	}
+	if n := len(tbl.Columns); n != 6 || tbl.Columns[5] != "Mounted on" {
+		t.Errorf("Expected 'Mounted on' as one column, got %v", tbl.Columns)
+	}
+
+	// PowerShell's Format-Table: the dashed rule marks the columns, so values
+	// with spaces (and dates wider than their header) stay in one column
+	ft := `Mode                 LastWriteTime         Length Name
+----                 -------------         ------ ----
+d-----         10/18/2026   3:04 PM                src
+-a----         10/18/2026   3:05 PM           1204 go.mod`
+	tbl, ok = table.Detect(ft)
+	if !ok {
+		t.Fatal("Expected Format-Table output to be detected")
+	}
+	want := []string{"-a----", "10/18/2026   3:05 PM", "1204", "go.mod"}
+	if !reflect.DeepEqual(tbl.Rows[1], want) {
+		t.Errorf("Expected %v, got %v", want, tbl.Rows[1])
+	}
+}
+
+func TestDetect_PlainText(t *testing.T) {
+	for _, out := range []string{
+		"hello world",
+		"Compiling shell-e v0.1\nFinished in 2.3s",
+		"main.go  go.mod\nREADME.md  tests", // ls columns, not a header
+		"total 8\n-rw-r--r-- 1 me me 0 Oct 18 a.txt",
+		"{not json",
+	} {
+		if tbl, ok := table.Detect(out); ok {
+			t.Errorf("Expected %q not to be a table, got %v", out, tbl)
+		}
+	}
+}
+
+func TestTable_Sort(t *testing.T) {
+	tbl := &table.Table{
+		Columns: []string{"Name", "Size"},
+		Rows:    [][]string{{"b", "100"}, {"a", "9"}, {"C", "1,024"}, {"d", ""}},
+	}
+	tbl.Sort(1, false)
+	if got := []string{tbl.Rows[0][0], tbl.Rows[1][0], tbl.Rows[2][0]}; !reflect.DeepEqual(got, []string{"a", "b", "C"}) {
+		t.Errorf("Expected numeric sort, got %v", tbl.Rows)
+	}
+	tbl.Sort(0, true)
+	if tbl.Rows[0][0] != "d" || tbl.Rows[1][0] != "C" {
+		t.Errorf("Expected case-insensitive descending sort, got %v", tbl.Rows)
+	}
+
+	if col, ok := tbl.Column("size"); !ok || col != 1 {
+		t.Errorf("Expected column lookup by name, got %d %v", col, ok)
+	}
+	if col, ok := tbl.Column("1"); !ok || col != 0 {
+		t.Errorf("Expected column lookup by number, got %d %v", col, ok)
+	}
+}
+
+func TestTable_TextRoundTrip(t *testing.T) {
+	tbl := &table.Table{
+		Format:  "json",
+		Columns: []string{"Name", "Status", "DisplayName"},
+		Rows: [][]string{
+			{"wuauserv", "Running", "Windows Update"},
+			{"Spooler", "Stopped", "Print Spooler"},
+		},
+	}
+	back, ok := table.Detect(tbl.Text())
+	if !ok {
+		t.Fatalf("Expected Text() output to be detected:\n%s", tbl.Text())
+	}
+	if !reflect.DeepEqual(back.Columns, tbl.Columns) || !reflect.DeepEqual(back.Rows, tbl.Rows) {
+		t.Errorf("Round trip changed the table: %v", back)
+	}
+
+	summary := tbl.Head(1).Summary(10)
+	if !strings.HasPrefix(summary, "2 rows, columns: Name, Status, DisplayName") ||
+		!strings.Contains(summary, "wuauserv,Running,Windows Update") {
+		t.Errorf("Unexpected summary: %q", summary)
+	}
+}
+
+func TestStructuredCommand_PowerShell(t *testing.T) {
+	sh, _ := executor.LookupShell("powershell")
+	ss, ok := sh.(executor.StructuredShell)
+	if !ok {
+		t.Fatal("Expected PowerShell to support structured output")
+	}
+
+	got, ok := ss.StructuredCommand("Get-Process | Sort-Object WS -Descending | Select-Object -First 5")
+	if !ok || !strings.Contains(got, "| ConvertTo-Json") {
+		t.Errorf("Expected ConvertTo-Json to be appended, got %q", got)
+	}
+	for _, cmd := range []string{
+		"Get-ChildItem | Format-Table",
+		"Get-Content notes.txt",
+		"Get-Process | Export-Csv p.csv",
+		"Get-Date; Get-Process",
+		"New-Item -ItemType Directory test",
+		"Write-Host hi",
+	} {
+		if _, ok := ss.StructuredCommand(cmd); ok {
+			t.Errorf("Expected %q to be left alone", cmd)
+		}
+	}
+}
+
+func TestExecute_StructuredOutput(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+	csv := `printf 'name,size\na.txt,3\nb.txt,12\n'`
+
+	if r := e.Execute(csv, "sh"); r.Table != nil {
+		t.Errorf("Expected no table detection unless enabled, got %v", r.Table)
+	}
+
+	e.Structured = true
+	r := e.Execute(csv, "sh")
+	if r.Table == nil || len(r.Table.Rows) != 2 {
+		t.Fatalf("Expected a 2-row table, got %v (output %q)", r.Table, r.Output)
+	}
+	if r.Output != "name,size\na.txt,3\nb.txt,12" {
+		t.Errorf("Expected output to be left as printed, got %q", r.Output)
+	}
+	if r := e.Execute("echo hello", "sh"); r.Table != nil {
+		t.Errorf("Expected plain output to have no table, got %v", r.Table)
+	}
+
+	// Right-aligned headers keep their indentation so they stay over
+	// their values
+	r = e.Execute(`printf '\n    PID CMD\n      1 init\n  12873 ps\n'`, "sh")
+	if !strings.HasPrefix(r.Output, "    PID") {
+		t.Errorf("Expected the header's indentation to be kept, got %q", r.Output)
+	}
+	if r.Table == nil || r.Table.Rows[1][0] != "12873" {
+		t.Errorf("Expected ps-style table, got %v", r.Table)
+	}
+}
+
+func TestMemory_Table(t *testing.T) {
+	dir := t.TempDir()
+	m := memory.NewMemory(dir)
+	if _, ok := m.LastTableID(); ok {
+		t.Error("Expected no table in empty memory")
+	}
+
+	rows := make([][]string, 80)
+	for i := range rows {
+		rows[i] = []string{"x"}
+	}
+	id := m.RecordExchange("list", "ls", "...", "Listed")
+	m.SetTable(id, &table.Table{Columns: []string{"Name"}, Rows: rows})
+	m.RecordExchange("thanks", "", "", "You're welcome")
+	m.Save()
+
+	m2 := memory.NewMemory(dir)
+	m2.Load()
+	got, ok := m2.LastTableID()
+	if !ok || got != id {
+		t.Fatalf("Expected last table to be #%d, got %d", id, got)
+	}
+	ex, _ := m2.Exchange(id)
+	if ex.Table == nil || len(ex.Table.Rows) >= 80 || ex.Table.Dropped+len(ex.Table.Rows) != 80 {
+		t.Errorf("Expected a trimmed table remembering its size, got %v", ex.Table)
+	}
+}
+
+func TestExecute_StructuredOutputFallsBack(t *testing.T) {
+	requireShell(t, "pwsh")
+	e := executor.NewExecutor(t.TempDir())
+	e.Structured = true
+
+	// A string or a single object isn't a table; the command's own
+	// output is shown rather than the JSON it was turned into
+	r := e.Execute("Get-Date -Format 'yyyy-MM-dd'", "pwsh")
+	if !r.Success || r.Table != nil || strings.Contains(r.Output, `"`) {
+		t.Errorf("Expected the date as printed, got %+v", r)
+	}
+	r = e.Execute("Get-Location", "pwsh")
+	if !r.Success || r.Table != nil || strings.Contains(r.Output, "{") {
+		t.Errorf("Expected the location as printed, got %+v", r)
+	}
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"testing"
+
+	"shell-e/internal/executor"
+	"shell-e/internal/terminal"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain", "hello\nworld", "hello\nworld"},
+		{"crlf", "a\r\nb\r\n", "a\nb\n"},
+		{"carriage return overwrite", "10%\r50%\r100%", "100%"},
+		{"shorter overwrite keeps tail", "downloading\rdone", "doneloading"},
+		{"erase line", "downloading\r\x1b[Kdone", "done"},
+		{"erase whole line", "abc\x1b[2Kx", "   x"},
+		{"cursor up redraw", "step 1\nprogress 10%\n\x1b[1Aprogress 99%\n", "step 1\nprogress 99%\n"},
+		{"cursor back", "abc\x1b[2DX", "aXc"},
+		{"column absolute", "abcdef\x1b[3GX", "abXdef"},
+		{"backspace", "ab\bX", "aX"},
+		{"tab", "a\tb", "a       b"},
+		{"clear screen", "old\n\x1b[2J\x1b[Hnew", "new"},
+		{"delete chars", "abcdef\x1b[1G\x1b[2P", "cdef"},
+		{"title and hyperlink dropped", "\x1b]0;title\x07\x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"private modes dropped", "\x1b[?25lspin\x1b[?25h", "spin"},
+		{"save and restore cursor", "ab\x1b7cd\x1b8X", "abXd"},
+		{"wide characters", "日本\rX", "X 本"},
+		{"trailing blanks trimmed", "abc   \x1b[K", "abc"},
+	}
+
+	for _, tt := range tests {
+		if got := terminal.Render(tt.input); got != tt.want {
+			t.Errorf("%s: Render(%q) = %q, want %q", tt.name, tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRender_KeepsColors(t *testing.T) {
+	in := "\x1b[32mok\x1b[0m plain \x1b[1;31merr\x1b[m"
+	want := "\x1b[32mok\x1b[0m plain \x1b[1;31merr\x1b[0m"
+	if got := terminal.Render(in); got != want {
+		t.Errorf("Render(%q) = %q, want %q", in, got, want)
+	}
+
+	// A color still open at the end of a line is closed there and reopened
+	// on the next line
+	got := terminal.Render("\x1b[34mone\ntwo\x1b[0m")
+	if want := "\x1b[34mone\x1b[0m\n\x1b[34mtwo\x1b[0m"; got != want {
+		t.Errorf("Expected per-line styling, got %q", got)
+	}
+
+	// Overwriting with \r replaces the colored text too
+	got = terminal.Render("\x1b[31mfail\x1b[0m\r\x1b[32mpass\x1b[0m")
+	if want := "\x1b[32mpass\x1b[0m"; got != want {
+		t.Errorf("Expected overwritten color, got %q", got)
+	}
+}
+
+func TestWidth(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"hello", 5},
+		{"\x1b[31mred\x1b[0m", 3},
+		{"日本語", 6},
+		{"é", 1},
+		{"🙂", 2},
+	}
+	for _, tt := range tests {
+		if got := terminal.Width(tt.input); got != tt.want {
+			t.Errorf("Width(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	got := terminal.Wrap("the quick brown fox", 10)
+	if got != "the quick\nbrown fox" {
+		t.Errorf("Expected word wrap, got %q", got)
+	}
+
+	// Wide characters count double and escape codes count nothing
+	for _, line := range splitLines(terminal.Wrap("日本語日本語 \x1b[31mred text here\x1b[0m", 8)) {
+		if w := terminal.Width(line); w > 8 {
+			t.Errorf("Line %q is %d columns wide, limit 8", line, w)
+		}
+	}
+
+	if got := terminal.Strip(terminal.Wrap("\x1b[31mred\x1b[0m", 10)); got != "red" {
+		t.Errorf("Expected short styled text unchanged, got %q", got)
+	}
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			lines = append(lines, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(lines, s[start:])
+}
+
+func TestExecute_RendersProgressOutput(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+	r := e.Execute(`printf 'fetching 10%%\rfetching 100%%\n\033[1Adone\033[K\n'`, "sh")
+	if !r.Success || r.Output != "done" {
+		t.Errorf("Expected final screen 'done', got %q (err: %s)", r.Output, r.Error)
+	}
+}
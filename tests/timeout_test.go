@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"shell-e/internal/executor"
+)
+
+func TestTimeoutFor_Rules(t *testing.T) {
+	e := executor.NewExecutor(t.TempDir())
+	e.TimeoutRules = []executor.TimeoutRule{
+		{Pattern: "npm install", Timeout: 10 * time.Minute},
+		{Pattern: "apt", Timeout: 5 * time.Minute},
+		{Pattern: "serve", Timeout: 0},
+	}
+
+	tests := []struct {
+		command string
+		want    time.Duration
+	}{
+		{"npm install express", 10 * time.Minute},
+		{"NPM.exe Install", 10 * time.Minute},
+		{"npm run build", 30 * time.Second},
+		{"sudo apt install git", 5 * time.Minute},
+		{"aptitude search git", 30 * time.Second},
+		{"echo capture", 30 * time.Second},
+		{"serve -p 8080", 0},
+	}
+	for _, tt := range tests {
+		if got := e.TimeoutFor(tt.command); got != tt.want {
+			t.Errorf("TimeoutFor(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestExecute_RuleTimeoutApplies(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+	e.Timeout = 5 * time.Second
+	e.TimeoutRules = []executor.TimeoutRule{{Pattern: "sleep", Timeout: 200 * time.Millisecond}}
+
+	r := e.Execute("sleep 5", "sh")
+	if !strings.Contains(r.Error, "timed out after 200ms") {
+		t.Errorf("Expected the rule's timeout to apply, got %q", r.Error)
+	}
+}
+
+func TestExecute_ZeroTimeoutMeansNone(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+	e.Timeout = 0
+
+	r := e.Execute("sleep 0.3; echo finished", "sh")
+	if !r.Success || r.Output != "finished" {
+		t.Errorf("Expected no timeout with Timeout 0, got %q (err: %s)", r.Output, r.Error)
+	}
+}
+
+func TestExecute_OptionTimeoutOverrides(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+	e.Timeout = 100 * time.Millisecond
+
+	r := e.ExecuteWithOptions("sleep 0.3; echo finished", "sh", executor.ExecOptions{Timeout: 5 * time.Second})
+	if !r.Success {
+		t.Errorf("Expected per-call timeout to replace the default, got %q", r.Error)
+	}
+}
+
+func TestDeadline_WarnAndExtend(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+	e.Timeout = 4 * time.Second // warns 1s before expiry
+
+	deadline := executor.NewDeadline()
+	go func() {
+		<-deadline.Warnings()
+		deadline.Extend(3 * time.Second)
+	}()
+
+	start := time.Now()
+	r := e.ExecuteWithOptions("sleep 5; echo finished", "sh", executor.ExecOptions{Deadline: deadline})
+	if !r.Success || r.Output != "finished" {
+		t.Fatalf("Expected extended command to finish, got %q (err: %s) after %v", r.Output, r.Error, time.Since(start))
+	}
+	if deadline.Timeout() != 7*time.Second {
+		t.Errorf("Expected total timeout 7s, got %v", deadline.Timeout())
+	}
+	if deadline.Extend(time.Second) {
+		t.Error("Expected Extend to fail after the command finished")
+	}
+}
+
+func TestDeadline_Lift(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+	e.Timeout = 200 * time.Millisecond
+
+	deadline := executor.NewDeadline()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		deadline.Lift()
+	}()
+
+	r := e.ExecuteWithOptions("sleep 0.5; echo finished", "sh", executor.ExecOptions{Deadline: deadline})
+	if !r.Success {
+		t.Errorf("Expected lifted deadline to let the command finish, got %q", r.Error)
+	}
+}
+
+func TestDeadline_ReportsTimeoutVsCancel(t *testing.T) {
+	requireShell(t, "sh")
+	e := executor.NewExecutor(t.TempDir())
+	e.Timeout = 200 * time.Millisecond
+
+	deadline := executor.NewDeadline()
+	r := e.ExecuteWithOptions("sleep 5", "sh", executor.ExecOptions{Deadline: deadline})
+	if !deadline.Expired() || !strings.Contains(r.Error, "timed out") {
+		t.Errorf("Expected an expired deadline, got %q", r.Error)
+	}
+}
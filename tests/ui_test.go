@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"shell-e/internal/executor"
+	"shell-e/internal/memory"
+	"shell-e/internal/planner"
+	"shell-e/internal/safety"
+	"shell-e/internal/ui"
+	"shell-e/internal/workspace"
+)
+
+// newTestModel returns a TUI whose planner answers every request with
+// plan (JSON), running commands in dir
+func newTestModel(t *testing.T, dir, plan string) (tea.Model, *executor.Executor, *memory.Memory) {
+	t.Helper()
+	mem := memory.NewMemory(t.TempDir())
+	p := planner.NewPlanner(&MockLLM{Running: true, Response: plan}, mem, "bash")
+	e := executor.NewExecutor(dir)
+	var m tea.Model = ui.NewModel(p, e, safety.NewChecker(), mem)
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 200, Height: 60})
+	return m, e, mem
+}
+
+// sendModel feeds msg to m, then what the commands it returns deliver,
+// until they are done. Spinner and cursor ticks are dropped so it ends.
+func sendModel(t *testing.T, m tea.Model, msg tea.Msg) tea.Model {
+	t.Helper()
+	queue := []tea.Msg{msg}
+	for len(queue) > 0 {
+		var cmd tea.Cmd
+		m, cmd = m.Update(queue[0])
+		queue = append(queue[1:], runTeaCmd(t, cmd)...)
+	}
+	return m
+}
+
+func runTeaCmd(t *testing.T, cmd tea.Cmd) []tea.Msg {
+	t.Helper()
+	if cmd == nil {
+		return nil
+	}
+	done := make(chan tea.Msg, 1)
+	go func() { done <- cmd() }()
+	var msg tea.Msg
+	select {
+	case msg = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("A command of the model did not finish")
+	}
+	switch msg := msg.(type) {
+	case nil, spinner.TickMsg, cursor.BlinkMsg:
+		return nil
+	case tea.BatchMsg:
+		var msgs []tea.Msg
+		for _, c := range msg {
+			msgs = append(msgs, runTeaCmd(t, c)...)
+		}
+		return msgs
+	}
+	return []tea.Msg{msg}
+}
+
+// typeInput types input into m and presses Enter
+func typeInput(t *testing.T, m tea.Model, input string) tea.Model {
+	t.Helper()
+	m = sendModel(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(input)})
+	return sendModel(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+}
+
+func TestModel_AsksForSudoPassword(t *testing.T) {
+	fakeSudo(t)
+	dir := t.TempDir()
+	m, _, _ := newTestModel(t, dir, `{"command": "sudo touch done.txt", "shell": "bash", "response": "Creating it as root", "safe": true}`)
+
+	m = typeInput(t, m, "create done.txt as root")
+	if view := m.View(); !strings.Contains(view, "sudo needs your password") || !strings.Contains(view, "Password:") {
+		t.Fatalf("Expected the masked password prompt, got:\n%s", view)
+	}
+
+	// What is typed is masked, and sudo gets it through askpass
+	m = typeInput(t, m, "hunter2")
+	view := m.View()
+	if strings.Contains(view, "hunter2") {
+		t.Errorf("Expected the password never to be shown, got:\n%s", view)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "done.txt")); err != nil {
+		t.Errorf("Expected the command to run with the password, got:\n%s", view)
+	}
+}
+
+func TestModel_SudoWithoutPassword(t *testing.T) {
+	fakeSudo(t)
+	t.Setenv("SUDO_NOPASSWD", "1")
+	dir := t.TempDir()
+	m, _, _ := newTestModel(t, dir, `{"command": "sudo touch done.txt", "shell": "bash", "response": "Creating it as root", "safe": true}`)
+
+	m = typeInput(t, m, "create done.txt as root")
+	if view := m.View(); strings.Contains(view, "needs your password") {
+		t.Errorf("Expected no password prompt when sudo needs none, got:\n%s", view)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "done.txt")); err != nil {
+		t.Errorf("Expected the command to run once sudo was found not to need a password: %v", err)
+	}
+}
+
+func TestModel_ForegroundJob(t *testing.T) {
+	requireShell(t, "sh")
+	dir := t.TempDir()
+	m, e, mem := newTestModel(t, dir, `{"response": "Nothing to do"}`)
+	job := e.StartJob("while [ ! -e go ]; do sleep 0.05; done; echo finished", "sh")
+	m = sendModel(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(fmt.Sprintf("/fg %d", job.ID))})
+	time.AfterFunc(200*time.Millisecond, func() { os.WriteFile(filepath.Join(dir, "go"), nil, 0644) })
+
+	// The result is shown, but belongs to whatever started the job
+	m = sendModel(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	view := m.View()
+	if !strings.Contains(view, "finished") || !strings.Contains(view, "✓ Done") {
+		t.Errorf("Expected the job's result once it finished, got:\n%s", view)
+	}
+	if history := mem.GetHistory(); len(history) != 0 {
+		t.Errorf("Expected /fg not to record an exchange, got %+v", history)
+	}
+}
+
+func TestModel_TitleFollowsDirectory(t *testing.T) {
+	requireShell(t, "bash")
+	a, b := t.TempDir(), t.TempDir()
+	m, e, _ := newTestModel(t, a, fmt.Sprintf(`{"command": "cd '%s'", "shell": "bash", "response": "Moving", "safe": true}`, b))
+	e.Roots = workspace.NewRoots([]string{a, b})
+
+	m = typeInput(t, m, "go to b")
+	if view := m.View(); !strings.Contains(view, "📁 "+b) {
+		t.Errorf("Expected the title to show root %s after cd, got:\n%s", b, view)
+	}
+}
+
+func TestModel_RefusesStdinForTerminalCommand(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("pear\n"), 0644)
+	m, _, _ := newTestModel(t, dir, `{"command": "vim", "shell": "bash", "stdin": "notes.txt", "response": "Opening vim", "safe": true}`)
+
+	// The stdin isn't dropped silently, and the terminal isn't taken over
+	m = typeInput(t, m, "open notes.txt in vim")
+	if view := m.View(); !strings.Contains(view, "can't also be given stdin") {
+		t.Errorf("Expected the stdin to be refused, got:\n%s", view)
+	}
+}
+
+func TestModel_HelpListsSession(t *testing.T) {
+	m, _, _ := newTestModel(t, t.TempDir(), `{"response": "Nothing to do"}`)
+	if view := m.View(); strings.Count(view, "/session") < 2 {
+		t.Errorf("Expected /session in the command list and the help line, got:\n%s", view)
+	}
+}
@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"shell-e/internal/executor"
+	"shell-e/internal/memory"
+	"shell-e/internal/trash"
+)
+
+func TestShell_ModifiedPaths(t *testing.T) {
+	tests := []struct {
+		shell     string
+		statement string
+		want      []executor.Modification
+	}{
+		{"bash", "rm -rf build dist", []executor.Modification{{Path: "build"}, {Path: "dist"}}},
+		{"bash", "sudo rm -- -weird", []executor.Modification{{Path: "-weird"}}},
+		{"bash", `echo hi > "my notes.txt" 2>&1`, []executor.Modification{{Path: "my notes.txt"}}},
+		{"bash", "make 2>/dev/null >> build.log", []executor.Modification{{Path: "build.log"}}},
+		{"bash", "cp -r src a.txt backup/", []executor.Modification{{Path: "backup/", Sources: []string{"src", "a.txt"}}}},
+		{"bash", "mv old.txt new.txt", []executor.Modification{{Path: "new.txt", Sources: []string{"old.txt"}}, {Path: "old.txt"}}},
+		{"bash", "sed -i 's/a/b/' x.go y.go", []executor.Modification{{Path: "x.go"}, {Path: "y.go"}}},
+		{"bash", "sed 's/a/b/' x.go", nil},
+		{"bash", "ls -la | tee listing.txt", []executor.Modification{{Path: "listing.txt"}}},
+		{"bash", "cat < input.txt", nil},
+		{"powershell", "Remove-Item -Recurse -Force .\\build", []executor.Modification{{Path: ".\\build"}}},
+		{"powershell", "Set-Content -Value 'x' -Path notes.txt", []executor.Modification{{Path: "notes.txt"}}},
+		{"powershell", "Get-Process | Out-File procs.txt", []executor.Modification{{Path: "procs.txt"}}},
+		{"powershell", "Copy-Item a.txt -Destination b.txt", []executor.Modification{{Path: "b.txt", Sources: []string{"a.txt"}}}},
+		{"powershell", "Get-ChildItem 2>$null", nil},
+		{"cmd", `del /s /q "old logs"`, []executor.Modification{{Path: "old logs"}}},
+		{"cmd", "copy /y a.txt b.txt", []executor.Modification{{Path: "b.txt", Sources: []string{"a.txt"}}}},
+		{"cmd", "dir > nul", nil},
+		{"bash", "ls -la", nil},
+	}
+
+	for _, tt := range tests {
+		sh, _ := executor.LookupShell(tt.shell)
+		if got := sh.ModifiedPaths(tt.statement); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s.ModifiedPaths(%q) = %+v, want %+v", tt.shell, tt.statement, got, tt.want)
+		}
+	}
+}
+
+func TestTrash_SnapshotAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	tr := trash.New(filepath.Join(t.TempDir(), "trash"))
+
+	file := filepath.Join(dir, "notes.txt")
+	os.WriteFile(file, []byte("original"), 0644)
+	tree := filepath.Join(dir, "src")
+	os.MkdirAll(filepath.Join(tree, "pkg"), 0755)
+	os.WriteFile(filepath.Join(tree, "pkg", "a.go"), []byte("package pkg"), 0644)
+	created := filepath.Join(dir, "new.txt")
+
+	snap, err := tr.Snapshot("change everything", []string{file, tree, filepath.Join(tree, "pkg"), created})
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if len(snap.Entries) != 3 {
+		t.Errorf("Expected nested path to be covered by its parent, got %+v", snap.Entries)
+	}
+
+	os.WriteFile(file, []byte("overwritten"), 0644)
+	os.RemoveAll(tree)
+	os.WriteFile(created, []byte("new"), 0644)
+
+	if _, err := tr.Restore(snap.ID); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "original" {
+		t.Errorf("Expected file content restored, got %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(tree, "pkg", "a.go")); string(data) != "package pkg" {
+		t.Errorf("Expected directory tree restored, got %q", data)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Error("Expected the created file to be removed")
+	}
+	if snaps, _ := tr.List(); len(snaps) != 0 {
+		t.Errorf("Expected the snapshot to be used up, got %d", len(snaps))
+	}
+}
+
+func TestTrash_Retention(t *testing.T) {
+	dir := t.TempDir()
+	tr := trash.New(filepath.Join(t.TempDir(), "trash"))
+	tr.MaxSnapshots = 2
+	tr.MaxBytes = 100
+
+	file := filepath.Join(dir, "f.txt")
+	os.WriteFile(file, []byte("0123456789"), 0644)
+	var ids []string
+	for _, cmd := range []string{"one", "two", "three"} {
+		snap, err := tr.Snapshot(cmd, []string{file})
+		if err != nil {
+			t.Fatalf("Snapshot failed: %v", err)
+		}
+		ids = append(ids, snap.ID)
+	}
+	snaps, _ := tr.List()
+	if len(snaps) != 2 || snaps[0].ID != ids[2] || snaps[1].ID != ids[1] {
+		t.Errorf("Expected the two newest snapshots, got %+v", snaps)
+	}
+
+	big := filepath.Join(dir, "big.bin")
+	os.WriteFile(big, make([]byte, 200), 0644)
+	if _, err := tr.Snapshot("rm big.bin", []string{big}); !errors.Is(err, trash.ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestExecute_SnapshotsBeforeChanges(t *testing.T) {
+	requireShell(t, "sh")
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "keep.txt"), []byte("precious"), 0644)
+	os.Mkdir(filepath.Join(dir, "backup"), 0755)
+
+	e := executor.NewExecutor(dir)
+	if r := e.Execute("echo x > scratch.txt", "sh"); r.SnapshotID != "" {
+		t.Errorf("Expected no snapshot without a trash, got %s", r.SnapshotID)
+	}
+
+	e.Trash = trash.New(filepath.Join(t.TempDir(), "trash"))
+	if r := e.Execute("ls", "sh"); r.SnapshotID != "" {
+		t.Errorf("Expected no snapshot for a read-only command, got %s", r.SnapshotID)
+	}
+
+	r := e.Execute("rm keep.txt && echo gone > log.txt", "sh")
+	if !r.Success || r.SnapshotID == "" {
+		t.Fatalf("Expected a snapshot, got %+v", r)
+	}
+	if _, err := e.Trash.Restore(r.SnapshotID); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "keep.txt")); string(data) != "precious" {
+		t.Errorf("Expected keep.txt back, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "log.txt")); !os.IsNotExist(err) {
+		t.Error("Expected log.txt, which the command created, to be removed")
+	}
+
+	// Copying into a directory only snapshots the copied name, not the
+	// whole directory
+	os.WriteFile(filepath.Join(dir, "backup", "other.txt"), []byte("untouched"), 0644)
+	r = e.Execute("cp keep.txt backup", "sh")
+	snaps, _ := e.Trash.List()
+	if len(snaps) != 1 || len(snaps[0].Entries) != 1 || snaps[0].Entries[0].Path != filepath.Join(dir, "backup", "keep.txt") {
+		t.Fatalf("Expected backup/keep.txt to be snapshotted, got %+v", snaps)
+	}
+	e.Trash.Restore(r.SnapshotID)
+	if _, err := os.Stat(filepath.Join(dir, "backup", "keep.txt")); !os.IsNotExist(err) {
+		t.Error("Expected the copy to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "backup", "other.txt")); err != nil {
+		t.Error("Expected the rest of the directory to be left alone")
+	}
+
+	// Files too large to save are still changed, and the result says so
+	os.WriteFile(filepath.Join(dir, "big.bin"), make([]byte, 200), 0644)
+	e.Trash.MaxBytes = 100
+	r = e.Execute("rm big.bin", "sh")
+	if !r.Success || r.SnapshotID != "" || !strings.Contains(r.NotSnapshotted, "too large") {
+		t.Errorf("Expected the result to say nothing was saved, got %+v", r)
+	}
+}
+
+func TestMemory_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+	m := memory.NewMemory(dir)
+	id := m.RecordExchange("delete the logs", "rm *.log", "", "Deleted")
+	m.SetSnapshot(id, "20261018-150405.000000")
+	m.Save()
+
+	m2 := memory.NewMemory(dir)
+	m2.Load()
+	if ex, _ := m2.Exchange(id); ex.SnapshotID != "20261018-150405.000000" {
+		t.Errorf("Expected snapshot ID to persist, got %q", ex.SnapshotID)
+	}
+	if got, ok := m2.ClearSnapshot("20261018-150405.000000"); !ok || got != id {
+		t.Errorf("Expected ClearSnapshot to find #%d, got %d", id, got)
+	}
+	if ex, _ := m2.Exchange(id); ex.SnapshotID != "" {
+		t.Error("Expected snapshot ID to be cleared")
+	}
+}
@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"shell-e/internal/executor"
+	"shell-e/internal/safety"
+	"shell-e/internal/workspace"
+)
+
+// workspaceDirs creates a root with a sub directory and a sibling outside it
+func workspaceDirs(t *testing.T) (root, outside string) {
+	t.Helper()
+	base, _ := filepath.EvalSymlinks(t.TempDir())
+	root = filepath.Join(base, "lab")
+	outside = filepath.Join(base, "other")
+	os.MkdirAll(filepath.Join(root, "sub"), 0755)
+	os.MkdirAll(outside, 0755)
+	return root, outside
+}
+
+func TestRoots_Contains(t *testing.T) {
+	root, outside := workspaceDirs(t)
+	roots := workspace.NewRoots([]string{root, ""})
+
+	if !roots.Contains(root) || !roots.Contains(filepath.Join(root, "sub", "new.txt")) {
+		t.Error("Expected the root and paths below it to be inside")
+	}
+	if roots.Contains(outside) || roots.Contains(root+"-evil") || roots.Contains(filepath.Dir(root)) {
+		t.Error("Expected siblings and parents to be outside")
+	}
+	if got := roots.RootOf(filepath.Join(root, "sub")); got != root {
+		t.Errorf("Expected RootOf to be %s, got %q", root, got)
+	}
+
+	// A symlink inside the root can't lead out of it
+	link := filepath.Join(root, "escape")
+	if err := os.Symlink(outside, link); err == nil && roots.Contains(link) {
+		t.Error("Expected a symlink pointing outside to be outside")
+	}
+
+	if (workspace.Roots{}).Restricted() || !(workspace.Roots{}).Contains("/anywhere") {
+		t.Error("Expected no roots to allow everything")
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	t.Setenv("HOME", "/home/tester")
+	env := map[string]string{"PROJ": "/srv/proj"}
+	lookup := func(name string) string { return env[name] }
+
+	tests := []struct{ path, want string }{
+		{"~", "/home/tester"},
+		{"~/src", "/home/tester/src"},
+		{"~other", "~other"},
+		{"$PROJ/a", "/srv/proj/a"},
+		{"${PROJ}/a", "/srv/proj/a"},
+		{"$env:PROJ/a", "/srv/proj/a"},
+		{"%PROJ%/a", "/srv/proj/a"},
+		{"$HOME/a", "/home/tester/a"},
+		{"$UNSET/a", "/a"},
+		{"%UNSET%/a", "%UNSET%/a"},
+	}
+	for _, tt := range tests {
+		if got := workspace.ExpandPath(tt.path, workspace.AllVars, lookup); got != tt.want {
+			t.Errorf("ExpandPath(%q): expected %q, got %q", tt.path, tt.want, got)
+		}
+	}
+
+	// Only the syntaxes asked for are expanded
+	if got := workspace.ExpandPath(`$PROJ\%PROJ%\$env:PROJ`, workspace.PercentVars, lookup); got != `$PROJ\/srv/proj\$env:PROJ` {
+		t.Errorf("Expected only %%NAME%% to expand, got %q", got)
+	}
+	if got := workspace.ExpandPath("$PROJ/%PROJ%", workspace.DollarVars, lookup); got != "/srv/proj/%PROJ%" {
+		t.Errorf("Expected only $NAME to expand, got %q", got)
+	}
+}
+
+func TestExecute_ConfinedToRoots(t *testing.T) {
+	root, outside := workspaceDirs(t)
+	e := executor.NewExecutor(root)
+	e.Roots = workspace.NewRoots([]string{root})
+
+	if r := e.Execute("cd sub", "bash"); !r.Success {
+		t.Errorf("Expected cd inside the root to work, got %s", r.Error)
+	}
+	r := e.Execute("cd "+outside, "bash")
+	if r.Success || !strings.Contains(r.Error, "outside the allowed workspace") {
+		t.Errorf("Expected cd outside the root to be refused, got %+v", r)
+	}
+	for _, cmd := range []string{"cd ../..", "pushd " + outside} {
+		if r := e.Execute(cmd, "bash"); r.Success {
+			t.Errorf("Expected %q to be refused", cmd)
+		}
+	}
+	if e.WorkingDir != filepath.Join(root, "sub") {
+		t.Errorf("Expected to stay in sub, got %s", e.WorkingDir)
+	}
+
+	requireShell(t, "sh")
+	if r := e.Execute("cd "+outside+" && pwd", "sh"); r.Success || strings.Contains(r.Output, outside) {
+		t.Errorf("Expected a chained cd outside to stop the chain, got %q", r.Output)
+	}
+
+	// A working directory outside the roots is moved back into them
+	e.WorkingDir = outside
+	if r := e.Execute("pwd", "sh"); r.Output != root {
+		t.Errorf("Expected the command to run in %s, got %q", root, r.Output)
+	}
+}
+
+func TestSession_ConfinedToRoots(t *testing.T) {
+	e, dir := newSessionExecutor(t)
+	e.Roots = workspace.NewRoots([]string{dir})
+
+	r := e.Execute("cd /", "bash")
+	if r.Success || e.WorkingDir != dir {
+		t.Errorf("Expected the session's cd outside to be refused, got %+v in %s", r, e.WorkingDir)
+	}
+	if r := e.Execute("pwd", "bash"); r.Output != dir {
+		t.Errorf("Expected the session to be moved back to %s, got %q", dir, r.Output)
+	}
+}
+
+func TestChecker_CheckIn(t *testing.T) {
+	root, outside := workspaceDirs(t)
+	c := safety.NewChecker()
+
+	if a := c.CheckIn("cat "+outside+"/notes.txt", root); a.Level != safety.Safe {
+		t.Errorf("Expected no path checks without roots, got %s", a.Reason)
+	}
+
+	c.Roots = workspace.NewRoots([]string{root})
+	for _, cmd := range []string{
+		"cat " + outside + "/notes.txt",
+		"cp report.txt ../other/",
+		"ls ~",
+		"tar -xf a.tar --directory=" + outside,
+	} {
+		a := c.CheckIn(cmd, root)
+		if a.Level != safety.NeedsConfirm || !strings.Contains(a.Reason, "outside the allowed workspace") {
+			t.Errorf("Expected %q to need confirmation, got level %d: %s", cmd, a.Level, a.Reason)
+		}
+	}
+	for _, cmd := range []string{
+		"ls -la",
+		"cat sub/../notes.txt",
+		"cat " + root + "/sub/a.txt",
+		"make 2> /dev/null",
+		"curl https://example.com/x",
+		"dir /s /b",
+	} {
+		if a := c.CheckIn(cmd, root); a.Level != safety.Safe {
+			t.Errorf("Expected %q to be safe, got %s", cmd, a.Reason)
+		}
+	}
+
+	// Other concerns are kept alongside the path
+	a := c.CheckIn("Remove-Item -Recurse "+outside, root)
+	if a.Level != safety.NeedsConfirm || !strings.Contains(a.Reason, "delete") || !strings.Contains(a.Reason, outside) {
+		t.Errorf("Expected both reasons, got %s", a.Reason)
+	}
+	if a := c.CheckIn("rm -rf /", root); a.Level != safety.Blocked {
+		t.Errorf("Expected blocked commands to stay blocked, got %s", a.Reason)
+	}
+}